@@ -20,6 +20,8 @@ const (
 	fieldContent     = "Content"
 	fieldPublishDate = "PublishDate"
 	fieldPublished   = "Published"
+	fieldOwner       = "Owner"
+	fieldCoAuthors   = "CoAuthors"
 )
 
 type Article struct {
@@ -31,6 +33,25 @@ type Summary struct {
 	Slug        string     `json:"slug"`
 	PublishDate *time.Time `json:"publishDate,omitempty"`
 	Title       string     `json:"title"`
+	// Owner is the UserID of the principal that created the article, articles predating authorship tracking have none
+	Owner     string   `json:"owner,omitempty"`
+	CoAuthors []string `json:"coAuthors,omitempty"`
+}
+
+// IsAuthor reports if the given user is either the owner or a co-author of the article
+func (s Summary) IsAuthor(userID string) bool {
+	if userID == "" {
+		return false
+	}
+	if s.Owner == userID {
+		return true
+	}
+	for _, a := range s.CoAuthors {
+		if a == userID {
+			return true
+		}
+	}
+	return false
 }
 
 type Saver func(ctx context.Context, article Article) error
@@ -44,6 +65,14 @@ func NewSaver(db *dynamodb.DynamoDB, articleTable string) Saver {
 			fieldContent: {S: aws.String(article.Content)},
 		}
 
+		if article.Owner != "" {
+			item[fieldOwner] = &dynamodb.AttributeValue{S: aws.String(article.Owner)}
+		}
+		// string sets can't be empty in dynamo, so just leave the attribute off when there are no co-authors
+		if len(article.CoAuthors) > 0 {
+			item[fieldCoAuthors] = &dynamodb.AttributeValue{SS: aws.StringSlice(article.CoAuthors)}
+		}
+
 		if article.PublishDate != nil {
 			item[fieldPublishDate] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(article.PublishDate.Unix(), 10))}
 			item[fieldPublished] = &dynamodb.AttributeValue{S: aws.String("true")}
@@ -87,6 +116,8 @@ func NewFetcher(db *dynamodb.DynamoDB, articleTable string) Fetcher {
 				Slug:        *res.Item[fieldSlug].S,
 				Title:       *res.Item[fieldTitle].S,
 				PublishDate: publishDate,
+				Owner:       owner(res.Item),
+				CoAuthors:   coAuthors(res.Item),
 			},
 			Content: *res.Item[fieldContent].S,
 		}
@@ -126,7 +157,7 @@ func NewLister(db *dynamodb.DynamoDB, articleTable string) Lister {
 			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
 				":published": {S: aws.String(strconv.FormatBool(published))},
 			},
-			ProjectionExpression: aws.String(fmt.Sprintf("%s, %s, %s", fieldSlug, fieldPublishDate, fieldTitle)),
+			ProjectionExpression: aws.String(fmt.Sprintf("%s, %s, %s, %s, %s", fieldSlug, fieldPublishDate, fieldTitle, fieldOwner, fieldCoAuthors)),
 		})
 		if err != nil {
 			return nil, errors.WithStack(err)
@@ -142,6 +173,8 @@ func NewLister(db *dynamodb.DynamoDB, articleTable string) Lister {
 				Slug:        *rec[fieldSlug].S,
 				Title:       *rec[fieldTitle].S,
 				PublishDate: publishDate,
+				Owner:       owner(rec),
+				CoAuthors:   coAuthors(rec),
 			}
 		}
 		return ret, nil
@@ -181,3 +214,17 @@ func publishedDate(item map[string]*dynamodb.AttributeValue) (*time.Time, error)
 	publishDate := time.Unix(unixTime, 0)
 	return &publishDate, nil
 }
+
+func owner(item map[string]*dynamodb.AttributeValue) string {
+	if item[fieldOwner] == nil {
+		return ""
+	}
+	return *item[fieldOwner].S
+}
+
+func coAuthors(item map[string]*dynamodb.AttributeValue) []string {
+	if item[fieldCoAuthors] == nil {
+		return nil
+	}
+	return aws.StringValueSlice(item[fieldCoAuthors].SS)
+}
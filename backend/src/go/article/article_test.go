@@ -66,3 +66,42 @@ func TestNewCachedLister(t *testing.T) {
 	assert.Equal(t, summaries[false].summaries, res)
 	assert.Equal(t, 2, summaries[false].callCount)
 }
+
+func TestSummary_IsAuthor(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		summary  Summary
+		userID   string
+		expected bool
+	}{
+		{
+			"owner",
+			Summary{Owner: "bob", CoAuthors: []string{"alice"}},
+			"bob",
+			true,
+		},
+		{
+			"co-author",
+			Summary{Owner: "bob", CoAuthors: []string{"alice", "carol"}},
+			"carol",
+			true,
+		},
+		{
+			"stranger",
+			Summary{Owner: "bob", CoAuthors: []string{"alice"}},
+			"mallory",
+			false,
+		},
+		{
+			"legacy article without owner",
+			Summary{},
+			"",
+			false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.summary.IsAuthor(tc.userID))
+		})
+	}
+}
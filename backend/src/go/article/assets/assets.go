@@ -1,3 +1,151 @@
 package assets
 
-const AssetKeyPrefix = "article-assets/"
\ No newline at end of file
+import (
+	"fmt"
+	pathpkg "path"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+)
+
+const AssetKeyPrefix = "article-assets/"
+
+// VariantKeyPrefix is where generated variants (resized images and such) of assets are kept
+const VariantKeyPrefix = AssetKeyPrefix + variantDir + "/"
+
+const variantDir = "_variants"
+
+// ContentKeyPrefix is where content addressed assets are kept, named for the hash of their content so they never change
+const ContentKeyPrefix = AssetKeyPrefix + contentDir + "/"
+
+const contentDir = "_content"
+
+// CacheDuration is how long browsers and the cdn may cache published assets
+const CacheDuration = time.Hour * 24 * 365
+
+// PendingUploadKeyPrefix is where direct uploads land, they are only moved under AssetKeyPrefix once verified
+const PendingUploadKeyPrefix = "pending-uploads/"
+
+// QuarantineKeyPrefix is where uploads wait to be scanned, only clean content is promoted under AssetKeyPrefix.
+// Infected content is left here for inspection until the bucket lifecycle rules clear it out.
+const QuarantineKeyPrefix = "quarantine/"
+
+// MaxUploadSize is the largest asset that may be uploaded directly to s3
+const MaxUploadSize = 100 * 1024 * 1024
+
+// MaxPathLength is the longest asset path allowed, comfortably inside the s3 key limit once prefixed
+const MaxPathLength = 512
+
+// NormalizePath puts a path into NFC form, so visually identical names typed on different systems end up as the same
+// asset. Paths should be normalized before being validated.
+func NormalizePath(path string) string {
+	return norm.NFC.String(path)
+}
+
+// ValidatePath checks the structure of an asset path (relative to AssetKeyPrefix), adding any problem to errors against
+// field. It is enough for paths of assets that already exist, new assets should use ValidateNewPath.
+func ValidatePath(errors httputil.ErrorTracker, field string, path string) httputil.ErrorTracker {
+	if problem := structuralProblem(field, path); problem != "" {
+		return errors.WithFieldError(field, problem)
+	}
+	return errors
+}
+
+// ValidateNewPath is ValidatePath with the stricter rules new assets are held to: the path must be normalized, no
+// longer than MaxPathLength, and only use letters, numbers and a handful of punctuation that is safe in urls and
+// file systems.
+func ValidateNewPath(errors httputil.ErrorTracker, field string, path string) httputil.ErrorTracker {
+	if problem := structuralProblem(field, path); problem != "" {
+		return errors.WithFieldError(field, problem)
+	}
+	if len(path) > MaxPathLength {
+		return errors.WithFieldError(field, fmt.Sprintf("%s may not be longer than %d bytes", field, MaxPathLength))
+	}
+	if !utf8.ValidString(path) || !norm.NFC.IsNormalString(path) {
+		return errors.WithFieldError(field, fmt.Sprintf("%s must be NFC normalized utf-8", field))
+	}
+	for _, r := range path {
+		if !allowedPathRune(r) {
+			return errors.WithFieldError(field, fmt.Sprintf("%s may not contain %q", field, r))
+		}
+	}
+	return errors
+}
+
+func structuralProblem(field string, path string) string {
+	if path == "" {
+		return fmt.Sprintf("%s is required", field)
+	}
+	if strings.HasPrefix(path, "/") || strings.HasSuffix(path, "/") {
+		return fmt.Sprintf("%s must not start or end with /", field)
+	}
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Sprintf("%s must not contain empty, . or .. segments", field)
+		}
+	}
+	for _, reserved := range []string{variantDir, contentDir} {
+		if strings.HasPrefix(path, reserved+"/") {
+			return fmt.Sprintf("%s is reserved", reserved)
+		}
+	}
+	return ""
+}
+
+func allowedPathRune(r rune) bool {
+	if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) {
+		return true
+	}
+	return strings.ContainsRune("/-_.~+@,()", r)
+}
+
+// IsVariantKey reports if the object key is a generated variant rather than an uploaded asset
+func IsVariantKey(key string) bool {
+	return strings.HasPrefix(key, VariantKeyPrefix)
+}
+
+// IsContentKey reports if the object key is a content addressed asset
+func IsContentKey(key string) bool {
+	return strings.HasPrefix(key, ContentKeyPrefix)
+}
+
+// QuarantineKey is where content with the given hash, bound for path (relative to AssetKeyPrefix), waits to be scanned
+func QuarantineKey(hash string, path string) string {
+	return fmt.Sprintf("%s%s/%s", QuarantineKeyPrefix, hash, path)
+}
+
+// ContentPath is the path (relative to AssetKeyPrefix) content with the given hash is stored at when uploaded to
+// friendlyPath in content addressed mode. The extension is kept so the url still says what it is.
+func ContentPath(hash string, friendlyPath string) string {
+	return fmt.Sprintf("%s/%s%s", contentDir, hash, strings.ToLower(pathpkg.Ext(friendlyPath)))
+}
+
+// SourcePath maps the path of a variant (relative to AssetKeyPrefix) to the path of the asset it was generated from,
+// other paths are returned as is
+func SourcePath(path string) string {
+	if !strings.HasPrefix(path, variantDir+"/") {
+		return path
+	}
+	variant := strings.TrimPrefix(path, variantDir+"/")
+	lastSlash := strings.LastIndex(variant, "/")
+	if lastSlash < 0 {
+		return path
+	}
+	return variant[:lastSlash]
+}
+
+// VariantKey is the object key for a variant of the asset at path (relative to AssetKeyPrefix)
+func VariantKey(path string, width int, extension string) string {
+	return fmt.Sprintf("%s%s/%dw.%s", VariantKeyPrefix, path, width, extension)
+}
+
+// PendingUploadPrefix is the key prefix a direct upload is placed under before it is completed. Including the user
+// keeps people from completing uploads they did not start.
+func PendingUploadPrefix(userID string, uploadID string) string {
+	return fmt.Sprintf("%s%s/%s/", PendingUploadKeyPrefix, userID, uploadID)
+}
@@ -0,0 +1,97 @@
+package assets
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+)
+
+func TestValidatePath(t *testing.T) {
+	testCases := []struct {
+		path  string
+		valid bool
+	}{
+		{"foo.png", true},
+		{"some/dir/foo.png", true},
+		{"", false},
+		{"/foo.png", false},
+		{"dir/", false},
+		{"some//foo.png", false},
+		{"../foo.png", false},
+		{"some/./foo.png", false},
+		{"_variants/foo.png", false},
+		{"foo/_variants/foo.png", true},
+		{"_content/abc.png", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			assert.Equal(t, tc.valid, !ValidatePath(httputil.ErrorTracker{}, "path", tc.path).InError())
+		})
+	}
+}
+
+func TestValidateNewPath(t *testing.T) {
+	testCases := []struct {
+		path  string
+		valid bool
+	}{
+		{"foo.png", true},
+		{"some/dir/foo-bar_baz~1+2@3,(4).png", true},
+		{"caf\u00e9/\u732b.png", true},
+		{"../foo.png", false},
+		{"_content/abc.png", false},
+		{"foo bar.png", false},
+		{"foo\tbar.png", false},
+		{"foo\\bar.png", false},
+		{"foo?.png", false},
+		{"foo#.png", false},
+		{"foo%20.png", false},
+		{"foo<script>.png", false},
+		// e followed by a combining acute accent, which NFC composes into a single character
+		{"cafe\u0301.png", false},
+		{strings.Repeat("a", MaxPathLength+1), false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			assert.Equal(t, tc.valid, !ValidateNewPath(httputil.ErrorTracker{}, "path", tc.path).InError())
+		})
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	normalized := NormalizePath("cafe\u0301.png")
+	assert.Equal(t, "caf\u00e9.png", normalized)
+	assert.False(t, ValidateNewPath(httputil.ErrorTracker{}, "path", normalized).InError())
+}
+
+func TestPendingUploadPrefix(t *testing.T) {
+	assert.Equal(t, "pending-uploads/1234/abcd/", PendingUploadPrefix("1234", "abcd"))
+}
+
+func TestVariantKey(t *testing.T) {
+	key := VariantKey("some/foo.png", 640, "webp")
+	assert.Equal(t, "article-assets/_variants/some/foo.png/640w.webp", key)
+	assert.True(t, IsVariantKey(key))
+	assert.False(t, IsVariantKey("article-assets/some/foo.png"))
+}
+
+func TestSourcePath(t *testing.T) {
+	assert.Equal(t, "some/foo.png", SourcePath("some/foo.png"))
+	assert.Equal(t, "some/foo.png", SourcePath("_variants/some/foo.png/640w.webp"))
+	assert.Equal(t, "_variants/oops", SourcePath("_variants/oops"))
+}
+
+func TestContentPath(t *testing.T) {
+	path := ContentPath("abc123", "some/Cat.JPG")
+	assert.Equal(t, "_content/abc123.jpg", path)
+	assert.True(t, IsContentKey(AssetKeyPrefix+path))
+	assert.False(t, IsContentKey("article-assets/some/Cat.JPG"))
+	assert.Equal(t, "_content/abc123", ContentPath("abc123", "README"))
+}
+
+func TestQuarantineKey(t *testing.T) {
+	assert.Equal(t, "quarantine/abc123/some/cat.jpg", QuarantineKey("abc123", "some/cat.jpg"))
+}
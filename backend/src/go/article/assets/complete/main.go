@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/article/assets"
+	"github.com/jonsabados/sabadoscodes.com/article/assets/imaging"
+	"github.com/jonsabados/sabadoscodes.com/audit"
+	"github.com/jonsabados/sabadoscodes.com/auth"
+	"github.com/jonsabados/sabadoscodes.com/cors"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/response"
+	"github.com/jonsabados/sabadoscodes.com/s3"
+	"github.com/jonsabados/sabadoscodes.com/scan"
+)
+
+type inboundRequest struct {
+	// ContentAddressed stores the content under a name derived from its hash, with the upload path becoming an alias
+	ContentAddressed bool `json:"contentAddressed"`
+	// Overwrite allows replacing an asset that already exists at the upload path, the replaced content is kept as a
+	// prior version
+	Overwrite bool `json:"overwrite"`
+	assets.MetadataUpdate
+}
+
+type contentAddressedResult struct {
+	Path string `json:"path"`
+	URL  string `json:"url"`
+	// Duplicate is set when identical content was already stored, in which case nothing new was
+	Duplicate bool `json:"duplicate"`
+}
+
+func newHandler(prepLogs logging.Preparer,
+	corsHeaders cors.ResponseHeaderBuilder,
+	extractPrincipal auth.PrincipalExtractor,
+	authorize auth.RouteAuthorizer,
+	targetBucket string,
+	policy assets.Policy,
+	listObjects s3.ObjectLister,
+	describeObject s3.ObjectDescriber,
+	fetchObject s3.ObjectFetcher,
+	fetchPending s3.MatchingObjectFetcher,
+	copyObject s3.PublicObjectCopier,
+	stageObject s3.ObjectSaver,
+	stagePending s3.MatchingObjectCopier,
+	scanner scan.Scanner,
+	removeObject s3.ObjectRemover,
+	fetchDetails assets.DetailsFetcher,
+	keepVersion assets.VersionKeeper,
+	recordUpload assets.UploadRecorder,
+	recordScan assets.ScanRecorder,
+	recordAudit audit.Recorder,
+	baseAssetURL string) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		ctx, _ = prepLogs(ctx)
+		responseHeaders := corsHeaders(request.Headers)
+
+		principal, err := extractPrincipal(request)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		if !authorize(principal, request) {
+			zerolog.Ctx(ctx).Warn().Interface("user", principal).Msg("user not authorized for route")
+			return response.HandleForbidden(ctx, responseHeaders, "not permitted"), nil
+		}
+
+		uploadID := request.PathParameters["uploadId"]
+		if uploadID == "" || strings.Contains(uploadID, "/") {
+			return response.HandleNtFound(ctx, responseHeaders), nil
+		}
+
+		// a body is optional when completing, metadata goes here as there isn't anywhere to hold onto it between
+		// presigning and completion
+		errors := httputil.ErrorTracker{}
+		completeRequest := new(inboundRequest)
+		if strings.TrimSpace(request.Body) != "" {
+			err = json.Unmarshal([]byte(request.Body), completeRequest)
+			if err != nil {
+				zerolog.Ctx(ctx).Info().Err(err).Msg("unable to unmarshal request body")
+				errors = errors.WithError("invalid request body")
+				return errors.ToAPIResponse(ctx, responseHeaders), nil
+			}
+		}
+		errors = assets.ValidateMetadata(completeRequest.MetadataUpdate, errors)
+		if errors.InError() {
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		pendingPrefix := assets.PendingUploadPrefix(principal.UserID, uploadID)
+		pending, err := listObjects(ctx, targetBucket, pendingPrefix)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		if len(pending) != 1 {
+			zerolog.Ctx(ctx).Info().Str("prefix", pendingPrefix).Int("objectCount", len(pending)).Msg("no single pending upload found")
+			return response.HandleNtFound(ctx, responseHeaders), nil
+		}
+		pendingKey := pending[0].Path
+		path := strings.TrimPrefix(pendingKey, pendingPrefix)
+
+		info, err := describeObject(ctx, targetBucket, pendingKey)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		if info == nil {
+			return response.HandleNtFound(ctx, responseHeaders), nil
+		}
+
+		// anything rejected is removed straight away rather than left for the bucket lifecycle rules
+		discard := func() {
+			err := removeObject(ctx, targetBucket, pendingKey)
+			if err != nil {
+				zerolog.Ctx(ctx).Warn().Err(err).Str("key", pendingKey).Msg("unable to remove rejected upload")
+			}
+		}
+		reject := func(errors httputil.ErrorTracker) events.APIGatewayProxyResponse {
+			discard()
+			return errors.ToAPIResponse(ctx, responseHeaders)
+		}
+
+		// the presigned url pins these, but the object is going public so check again rather than trust that
+		errors = assets.ValidateNewPath(errors, "path", path)
+		errors = policy.Validate(info.ContentType, info.Size, errors)
+		if errors.InError() {
+			return reject(errors), nil
+		}
+
+		// conflicts leave the pending upload in place, so completing can be retried with overwrite set
+		key := fmt.Sprintf("%s%s", assets.AssetKeyPrefix, path)
+		existing, err := describeObject(ctx, targetBucket, key)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		existingDetails, err := fetchDetails(ctx, path)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		replacing := existing != nil || (existingDetails != nil && existingDetails.ContentPath != "")
+		if replacing && !completeRequest.Overwrite {
+			return response.HandleConflict(ctx, responseHeaders, fmt.Sprintf("an asset already exists at %s, set overwrite to replace it", path), nil), nil
+		}
+		if completeRequest.ContentAddressed && existing != nil {
+			return response.HandleConflict(ctx, responseHeaders, fmt.Sprintf("a regular asset already exists at %s", path), nil), nil
+		}
+
+		// the uploader can keep putting to the presigned url, so everything from here on is pinned to the version that
+		// was described, otherwise something else could be swapped in after it was checked
+		content, err := fetchPending(ctx, targetBucket, pendingKey, info.ETag)
+		if isChanged(err) {
+			return uploadChanged(ctx, responseHeaders, path), nil
+		}
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		defer content.Close()
+
+		// nothing stops a client from sending something other than what it presigned for, so look at the content too
+		head := make([]byte, assets.SniffLength)
+		headLength, err := io.ReadFull(content, head)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		head = head[:headLength]
+		errors = assets.ValidateContent(info.ContentType, head, errors)
+		if errors.InError() {
+			return reject(errors), nil
+		}
+
+		// svgs and images are rewritten in memory, svgs to sanitize them and images so their metadata is gone before
+		// hashing, otherwise content addressed images would be published with it. Everything else goes through as is.
+		var sanitized []byte
+		var contentHash string
+		if imaging.Processable(info.ContentType) {
+			raw, err := io.ReadAll(io.MultiReader(bytes.NewReader(head), content))
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+			sanitized, err = imaging.Clean(info.ContentType, raw)
+			if err != nil {
+				zerolog.Ctx(ctx).Info().Err(err).Msg("unable to strip image metadata")
+				return reject(errors.WithFieldError("content", "content is not a valid image")), nil
+			}
+			contentHash = audit.Hash(sanitized)
+		} else if assets.IsSVG(info.ContentType) {
+			raw, err := io.ReadAll(io.MultiReader(bytes.NewReader(head), content))
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+			sanitized, err = assets.SanitizeSVG(raw)
+			if err != nil {
+				zerolog.Ctx(ctx).Info().Err(err).Msg("unable to sanitize svg")
+				return reject(errors.WithFieldError("content", "content is not a valid svg")), nil
+			}
+			contentHash = audit.Hash(sanitized)
+		} else {
+			contentHash, err = audit.HashReader(io.MultiReader(bytes.NewReader(head), content))
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+		}
+
+		zerolog.Ctx(ctx).Info().Interface("user", principal).Str("key", pendingKey).Msg("user completing direct upload")
+		storedPath := path
+		contentPath := ""
+		duplicate := false
+		if completeRequest.ContentAddressed {
+			contentPath = assets.ContentPath(contentHash, path)
+			storedPath = contentPath
+			stored, err := describeObject(ctx, targetBucket, assets.AssetKeyPrefix+contentPath)
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+			duplicate = stored != nil
+		}
+
+		if duplicate {
+			zerolog.Ctx(ctx).Info().Str("contentPath", contentPath).Msg("content already stored, only adding alias")
+		} else {
+			// nothing goes public without being scanned, so it waits in quarantine until the scanner is happy with it
+			quarantineKey := assets.QuarantineKey(contentHash, path)
+			if sanitized != nil {
+				err = stageObject(ctx, targetBucket, quarantineKey, bytes.NewReader(sanitized), info.ContentType)
+			} else {
+				err = stagePending(ctx, targetBucket, pendingKey, quarantineKey, info.ETag)
+			}
+			if isChanged(err) {
+				return uploadChanged(ctx, responseHeaders, path), nil
+			}
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+			staged, err := fetchObject(ctx, targetBucket, quarantineKey)
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+			stagedSize := info.Size
+			if sanitized != nil {
+				stagedSize = int64(len(sanitized))
+			}
+			scanResult, err := scanner.Scan(ctx, staged, stagedSize)
+			_ = staged.Close()
+			if isTooLarge(err) {
+				// it can never be completed, so it goes like any other rejected upload
+				zerolog.Ctx(ctx).Warn().Err(err).Str("key", quarantineKey).Msg("upload too large to scan")
+				discard()
+				return response.HandleTooLarge(ctx, responseHeaders, "content is too large to be scanned"), nil
+			}
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+			if scanResult.Infected() {
+				zerolog.Ctx(ctx).Warn().Interface("user", principal).Str("key", quarantineKey).Str("signature", scanResult.Signature).Msg("upload failed scanning, leaving it in quarantine")
+				auditEntry := audit.NewEntry(ctx, principal, audit.ActionAssetQuarantine, quarantineKey)
+				auditEntry.AfterHash = contentHash
+				// the upload is already sitting in quarantine, so an audit failure is logged in full rather than failing the
+				// request
+				err = recordAudit(ctx, auditEntry)
+				if err != nil {
+					zerolog.Ctx(ctx).Error().Stack().Err(err).Interface("auditEntry", auditEntry).Msg("error recording audit entry for quarantined upload")
+				}
+				return reject(errors.WithFieldError("content", fmt.Sprintf("content failed malware scanning: %s", scanResult.Signature))), nil
+			}
+
+			// aliases don't need versions kept, what they pointed at stays put under its content path
+			if existing != nil {
+				_, err = keepVersion(ctx, targetBucket, path)
+				if err != nil {
+					return response.HandleError(ctx, responseHeaders, err), nil
+				}
+			}
+			err = copyObject(ctx, targetBucket, quarantineKey, assets.AssetKeyPrefix+storedPath, info.ContentType, assets.CacheDuration)
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+			err = recordScan(ctx, storedPath, scanResult)
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+			err = removeObject(ctx, targetBucket, quarantineKey)
+			if err != nil {
+				zerolog.Ctx(ctx).Warn().Err(err).Str("key", quarantineKey).Msg("unable to remove promoted upload from quarantine")
+			}
+		}
+
+		err = recordUpload(ctx, path, contentPath, assets.NewUpload(principal), completeRequest.MetadataUpdate)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		auditEntry := audit.NewEntry(ctx, principal, audit.ActionAssetUpload, key)
+		auditEntry.AfterHash = contentHash
+		// the asset is already stored, failing now would only have the client retry an upload that was applied
+		err = recordAudit(ctx, auditEntry)
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Stack().Err(err).Interface("auditEntry", auditEntry).Msg("error recording audit entry for uploaded asset")
+		}
+
+		// anything left behind gets cleaned up by the bucket lifecycle rules, so a failure here isn't fatal
+		err = removeObject(ctx, targetBucket, pendingKey)
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("key", pendingKey).Msg("unable to remove completed upload")
+		}
+
+		responseHeaders["Location"] = fmt.Sprintf("%s/%s", baseAssetURL, storedPath)
+
+		responseHeaders["content-type"] = "application/json"
+
+		responseCode := http.StatusCreated
+		if replacing {
+			responseCode = http.StatusOK
+		}
+
+		if !completeRequest.ContentAddressed {
+			return events.APIGatewayProxyResponse{
+				StatusCode: responseCode,
+				Headers:    responseHeaders,
+			}, nil
+		}
+
+		responseBody, err := json.Marshal(contentAddressedResult{
+			Path:      path,
+			URL:       responseHeaders["Location"],
+			Duplicate: duplicate,
+		})
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		return events.APIGatewayProxyResponse{
+			StatusCode: responseCode,
+			Headers:    responseHeaders,
+			Body:       string(responseBody),
+		}, nil
+	}
+}
+
+func isTooLarge(err error) bool {
+	return err != nil && errors.Cause(err) == scan.ErrTooLarge
+}
+
+func isChanged(err error) bool {
+	return err != nil && errors.Cause(err) == s3.ErrObjectChanged
+}
+
+// uploadChanged leaves the pending upload in place, completing again validates whatever is there now
+func uploadChanged(ctx context.Context, responseHeaders map[string]string, path string) events.APIGatewayProxyResponse {
+	return response.HandleConflict(ctx, responseHeaders, fmt.Sprintf("the upload to %s changed while it was being completed, complete it again", path), nil)
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	allowedDomains := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
+	targetBucket := os.Getenv("ASSET_BUCKET")
+	baseAssetURL := os.Getenv("BASE_ASSET_URL")
+	auditTable := os.Getenv("AUDIT_TABLE")
+	assetTable := os.Getenv("ASSET_TABLE")
+
+	routes, err := auth.ParseRouteTable([]byte(os.Getenv("ROUTE_TABLE")))
+	if err != nil {
+		panic(err)
+	}
+
+	policy, err := assets.ParsePolicy(os.Getenv("ALLOWED_ASSET_TYPES"))
+	if err != nil {
+		panic(err)
+	}
+	clamAVAddress := os.Getenv("CLAMAV_ADDRESS")
+	if scan.Enabled(clamAVAddress) {
+		// clamd won't take anything over its stream limit, so nothing bigger may be uploaded while scanning is on
+		policy = policy.Capped(scan.MaxStreamLength)
+	}
+
+	s3Client := s3.RawClient(sess)
+	dynamoClient := dynamo.RawClient(sess)
+
+	handler := newHandler(logging.NewPreparer(),
+		cors.NewResponseHeaderBuilder(allowedDomains),
+		auth.NewPrincipalExtractor(),
+		auth.NewRouteAuthorizer(routes),
+		targetBucket,
+		policy,
+		s3.NewObjectLister(s3Client),
+		s3.NewObjectDescriber(s3Client),
+		s3.NewObjectFetcher(s3Client),
+		s3.NewMatchingObjectFetcher(s3Client),
+		s3.NewPublicObjectCopier(s3Client),
+		s3.NewObjectSaver(s3Client),
+		s3.NewMatchingObjectCopier(s3Client),
+		scan.NewScanner(clamAVAddress, scan.DefaultTimeout),
+		s3.NewObjectRemover(s3Client),
+		assets.NewDetailsFetcher(dynamoClient, assetTable),
+		assets.NewVersionKeeper(s3.NewObjectCopier(s3Client)),
+		assets.NewUploadRecorder(dynamoClient, assetTable),
+		assets.NewScanRecorder(dynamoClient, assetTable),
+		audit.NewRecorder(dynamoClient, auditTable),
+		baseAssetURL)
+
+	lambda.Start(handler)
+}
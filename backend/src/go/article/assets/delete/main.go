@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/article/assets"
+	"github.com/jonsabados/sabadoscodes.com/article/references"
+	"github.com/jonsabados/sabadoscodes.com/audit"
+	"github.com/jonsabados/sabadoscodes.com/auth"
+	"github.com/jonsabados/sabadoscodes.com/cors"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/response"
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+func newHandler(prepLogs logging.Preparer,
+	corsHeaders cors.ResponseHeaderBuilder,
+	extractPrincipal auth.PrincipalExtractor,
+	authorize auth.RouteAuthorizer,
+	targetBucket string,
+	describeObject s3.ObjectDescriber,
+	fetchObject s3.ObjectFetcher,
+	findReferences references.Finder,
+	fetchDetails assets.DetailsFetcher,
+	removeAsset assets.Remover,
+	recordAudit audit.Recorder) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		ctx, _ = prepLogs(ctx)
+		responseHeaders := corsHeaders(request.Headers)
+
+		principal, err := extractPrincipal(request)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		if !authorize(principal, request) {
+			zerolog.Ctx(ctx).Warn().Interface("user", principal).Msg("user not authorized for route")
+			return response.HandleForbidden(ctx, responseHeaders, "not permitted"), nil
+		}
+
+		errors := httputil.ErrorTracker{}
+		path, err := url.PathUnescape(request.PathParameters["path"])
+		if err != nil {
+			zerolog.Ctx(ctx).Info().Err(err).Msg("invalid path")
+			errors = errors.WithFieldError("path", "invalid path")
+		} else {
+			errors = assets.ValidatePath(errors, "path", path)
+		}
+		if errors.InError() {
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		key := assets.AssetKeyPrefix + path
+		info, err := describeObject(ctx, targetBucket, key)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		if info == nil {
+			details, err := fetchDetails(ctx, path)
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+			if details == nil || details.ContentPath == "" {
+				return response.HandleNtFound(ctx, responseHeaders), nil
+			}
+			// articles link to the content itself rather than aliases, and the content may be shared with other
+			// aliases, so only the alias goes. Content nothing uses shows up in the orphaned asset report.
+			zerolog.Ctx(ctx).Info().Interface("user", principal).Str("path", path).Msg("user deleting asset alias")
+			err = removeAsset(ctx, targetBucket, path)
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+			// the delete has already happened, so an audit failure is logged in full rather than failing the request
+			auditEntry := audit.NewEntry(ctx, principal, audit.ActionAssetDelete, key)
+			err = recordAudit(ctx, auditEntry)
+			if err != nil {
+				zerolog.Ctx(ctx).Error().Stack().Err(err).Interface("auditEntry", auditEntry).Msg("error recording audit entry for deleted asset")
+			}
+			return events.APIGatewayProxyResponse{
+				StatusCode: http.StatusNoContent,
+				Headers:    responseHeaders,
+			}, nil
+		}
+
+		referencedBy, err := findReferences(ctx, path)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		if len(referencedBy) > 0 {
+			if request.QueryStringParameters["force"] != "true" {
+				return response.HandleConflict(ctx, responseHeaders, "asset is referenced by articles, use force=true to delete it anyway", referencedBy), nil
+			}
+			zerolog.Ctx(ctx).Warn().Strs("articles", referencedBy).Str("path", path).Msg("force deleting referenced asset")
+		}
+
+		content, err := fetchObject(ctx, targetBucket, key)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		contentHash, err := audit.HashReader(content)
+		_ = content.Close()
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		zerolog.Ctx(ctx).Info().Interface("user", principal).Str("path", path).Msg("user deleting asset")
+		err = removeAsset(ctx, targetBucket, path)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		auditEntry := audit.NewEntry(ctx, principal, audit.ActionAssetDelete, key)
+		auditEntry.BeforeHash = contentHash
+		err = recordAudit(ctx, auditEntry)
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Stack().Err(err).Interface("auditEntry", auditEntry).Msg("error recording audit entry for deleted asset")
+		}
+
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusNoContent,
+			Headers:    responseHeaders,
+		}, nil
+	}
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	allowedDomains := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
+	targetBucket := os.Getenv("ASSET_BUCKET")
+	assetTable := os.Getenv("ASSET_TABLE")
+	auditTable := os.Getenv("AUDIT_TABLE")
+	referenceTable := os.Getenv("REFERENCE_TABLE")
+
+	routes, err := auth.ParseRouteTable([]byte(os.Getenv("ROUTE_TABLE")))
+	if err != nil {
+		panic(err)
+	}
+
+	s3Client := s3.RawClient(sess)
+	dynamoClient := dynamo.RawClient(sess)
+
+	remover := assets.NewRemover(s3.NewObjectLister(s3Client), s3.NewObjectRemover(s3Client), assets.NewDetailsRemover(dynamoClient, assetTable))
+
+	handler := newHandler(logging.NewPreparer(),
+		cors.NewResponseHeaderBuilder(allowedDomains),
+		auth.NewPrincipalExtractor(),
+		auth.NewRouteAuthorizer(routes),
+		targetBucket,
+		s3.NewObjectDescriber(s3Client),
+		s3.NewObjectFetcher(s3Client),
+		references.NewFinder(dynamoClient, referenceTable, s3.NewObjectLister(s3Client), targetBucket),
+		assets.NewDetailsFetcher(dynamoClient, assetTable),
+		remover,
+		audit.NewRecorder(dynamoClient, auditTable))
+
+	lambda.Start(handler)
+}
@@ -0,0 +1,388 @@
+package assets
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+
+	"github.com/jonsabados/sabadoscodes.com/scan"
+)
+
+const (
+	fieldPath       = "Path"
+	fieldSourceHash = "SourceHash"
+	fieldWidth      = "Width"
+	fieldHeight     = "Height"
+	fieldVariants   = "Variants"
+	fieldProcessed  = "Processed"
+	fieldKey        = "Key"
+	fieldMimeType   = "MimeType"
+	fieldSize       = "Size"
+	fieldAltText    = "AltText"
+	fieldCaption    = "Caption"
+	fieldCredit     = "Credit"
+	fieldLicence    = "Licence"
+	fieldUploaderID = "UploaderID"
+	fieldUploader   = "Uploader"
+	fieldUploaded   = "Uploaded"
+	fieldContent    = "ContentPath"
+	fieldScan       = "ScanVerdict"
+	fieldSignature  = "ScanSignature"
+	fieldScanner    = "Scanner"
+	fieldScanned    = "Scanned"
+)
+
+// Variant is a generated alternative version of an asset, such as a smaller copy of an image
+type Variant struct {
+	Key      string
+	Width    int
+	Height   int
+	MimeType string
+	Size     int64
+}
+
+// Details are what we know about an asset beyond what s3 tells us
+type Details struct {
+	// Path is relative to AssetKeyPrefix
+	Path string
+	// SourceHash is the hash of the asset content the variants were generated from
+	SourceHash string
+	Width      int
+	Height     int
+	Variants   []Variant
+	Processed  time.Time
+	Metadata   Metadata
+	// Upload is zero for assets uploaded before uploads were recorded
+	Upload Upload
+	// ContentPath is set when Path is an alias for a content addressed asset, and is where that asset lives
+	ContentPath string
+	// Scan is zero for assets uploaded before scanning, and for aliases since it is the content that gets scanned
+	Scan scan.Result
+}
+
+// ProcessingRecorder records the outcome of processing an asset, leaving anything else known about it alone
+type ProcessingRecorder func(ctx context.Context, details Details) error
+
+func NewProcessingRecorder(db *dynamodb.DynamoDB, assetTable string) ProcessingRecorder {
+	return func(ctx context.Context, details Details) error {
+		variants := make([]*dynamodb.AttributeValue, 0, len(details.Variants))
+		for _, v := range details.Variants {
+			variants = append(variants, &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{
+				fieldKey:      {S: aws.String(v.Key)},
+				fieldWidth:    {N: aws.String(strconv.Itoa(v.Width))},
+				fieldHeight:   {N: aws.String(strconv.Itoa(v.Height))},
+				fieldMimeType: {S: aws.String(v.MimeType)},
+				fieldSize:     {N: aws.String(strconv.FormatInt(v.Size, 10))},
+			}})
+		}
+		_, err := db.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+			TableName: aws.String(assetTable),
+			Key: map[string]*dynamodb.AttributeValue{
+				fieldPath: {S: aws.String(details.Path)},
+			},
+			UpdateExpression: aws.String("SET #hash = :hash, #width = :width, #height = :height, #variants = :variants, #processed = :processed"),
+			ExpressionAttributeNames: map[string]*string{
+				"#hash":      aws.String(fieldSourceHash),
+				"#width":     aws.String(fieldWidth),
+				"#height":    aws.String(fieldHeight),
+				"#variants":  aws.String(fieldVariants),
+				"#processed": aws.String(fieldProcessed),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":hash":      {S: aws.String(details.SourceHash)},
+				":width":     {N: aws.String(strconv.Itoa(details.Width))},
+				":height":    {N: aws.String(strconv.Itoa(details.Height))},
+				":variants":  {L: variants},
+				":processed": {S: aws.String(details.Processed.Format(time.RFC3339))},
+			},
+		})
+		return errors.WithStack(err)
+	}
+}
+
+// UploadRecorder records who uploaded an asset, along with any metadata provided with it. contentPath is where the
+// content lives for content addressed uploads, and empty otherwise.
+type UploadRecorder func(ctx context.Context, path string, contentPath string, upload Upload, metadata MetadataUpdate) error
+
+func NewUploadRecorder(db *dynamodb.DynamoDB, assetTable string) UploadRecorder {
+	return func(ctx context.Context, path string, contentPath string, upload Upload, metadata MetadataUpdate) error {
+		update := newUpdateBuilder()
+		update.set(fieldUploaderID, &dynamodb.AttributeValue{S: aws.String(upload.UserID)})
+		update.set(fieldUploader, &dynamodb.AttributeValue{S: aws.String(upload.Name)})
+		update.set(fieldUploaded, &dynamodb.AttributeValue{S: aws.String(upload.Time.Format(time.RFC3339))})
+		// a plain upload replaces any alias that was at the path
+		update.applyString(fieldContent, &contentPath)
+		update.applyMetadata(metadata)
+		_, err := db.UpdateItemWithContext(ctx, update.input(assetTable, path))
+		return errors.WithStack(err)
+	}
+}
+
+// ScanRecorder records the result of scanning the content of the asset at path
+type ScanRecorder func(ctx context.Context, path string, result scan.Result) error
+
+func NewScanRecorder(db *dynamodb.DynamoDB, assetTable string) ScanRecorder {
+	return func(ctx context.Context, path string, result scan.Result) error {
+		update := newUpdateBuilder()
+		update.set(fieldScan, &dynamodb.AttributeValue{S: aws.String(string(result.Verdict))})
+		update.set(fieldScanner, &dynamodb.AttributeValue{S: aws.String(result.Scanner)})
+		update.set(fieldScanned, &dynamodb.AttributeValue{S: aws.String(result.Scanned.Format(time.RFC3339))})
+		update.applyString(fieldSignature, &result.Signature)
+		_, err := db.UpdateItemWithContext(ctx, update.input(assetTable, path))
+		return errors.WithStack(err)
+	}
+}
+
+// MetadataUpdater applies an update to the metadata of an asset, returning the resulting details
+type MetadataUpdater func(ctx context.Context, path string, metadata MetadataUpdate) (Details, error)
+
+func NewMetadataUpdater(db *dynamodb.DynamoDB, assetTable string) MetadataUpdater {
+	return func(ctx context.Context, path string, metadata MetadataUpdate) (Details, error) {
+		update := newUpdateBuilder()
+		update.applyMetadata(metadata)
+		input := update.input(assetTable, path)
+		input.ReturnValues = aws.String(dynamodb.ReturnValueAllNew)
+		res, err := db.UpdateItemWithContext(ctx, input)
+		if err != nil {
+			return Details{}, errors.WithStack(err)
+		}
+		return toDetails(res.Attributes)
+	}
+}
+
+type updateBuilder struct {
+	sets    []string
+	removes []string
+	names   map[string]*string
+	values  map[string]*dynamodb.AttributeValue
+}
+
+func newUpdateBuilder() *updateBuilder {
+	return &updateBuilder{
+		names:  make(map[string]*string),
+		values: make(map[string]*dynamodb.AttributeValue),
+	}
+}
+
+func (u *updateBuilder) set(field string, value *dynamodb.AttributeValue) {
+	u.names["#"+field] = aws.String(field)
+	u.values[":"+field] = value
+	u.sets = append(u.sets, fmt.Sprintf("#%s = :%s", field, field))
+}
+
+func (u *updateBuilder) remove(field string) {
+	u.names["#"+field] = aws.String(field)
+	u.removes = append(u.removes, "#"+field)
+}
+
+func (u *updateBuilder) applyMetadata(metadata MetadataUpdate) {
+	u.applyString(fieldAltText, metadata.AltText)
+	u.applyString(fieldCaption, metadata.Caption)
+	u.applyString(fieldCredit, metadata.Credit)
+	u.applyString(fieldLicence, metadata.Licence)
+}
+
+func (u *updateBuilder) applyString(field string, value *string) {
+	if value == nil {
+		return
+	}
+	// dynamo doesn't allow empty strings in all contexts, and there is no difference between blank and absent here
+	if *value == "" {
+		u.remove(field)
+		return
+	}
+	u.set(field, &dynamodb.AttributeValue{S: value})
+}
+
+func (u *updateBuilder) expression() string {
+	clauses := make([]string, 0, 2)
+	if len(u.sets) > 0 {
+		clauses = append(clauses, "SET "+strings.Join(u.sets, ", "))
+	}
+	if len(u.removes) > 0 {
+		clauses = append(clauses, "REMOVE "+strings.Join(u.removes, ", "))
+	}
+	return strings.Join(clauses, " ")
+}
+
+func (u *updateBuilder) input(assetTable string, path string) *dynamodb.UpdateItemInput {
+	ret := &dynamodb.UpdateItemInput{
+		TableName: aws.String(assetTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			fieldPath: {S: aws.String(path)},
+		},
+		UpdateExpression:         aws.String(u.expression()),
+		ExpressionAttributeNames: u.names,
+	}
+	if len(u.values) > 0 {
+		ret.ExpressionAttributeValues = u.values
+	}
+	return ret
+}
+
+type DetailsFetcher func(ctx context.Context, path string) (*Details, error)
+
+func NewDetailsFetcher(db *dynamodb.DynamoDB, assetTable string) DetailsFetcher {
+	return func(ctx context.Context, path string) (*Details, error) {
+		res, err := db.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+			TableName: aws.String(assetTable),
+			Key: map[string]*dynamodb.AttributeValue{
+				fieldPath: {S: aws.String(path)},
+			},
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if res.Item == nil {
+			return nil, nil
+		}
+		ret, err := toDetails(res.Item)
+		if err != nil {
+			return nil, err
+		}
+		return &ret, nil
+	}
+}
+
+type DetailsRemover func(ctx context.Context, path string) error
+
+func NewDetailsRemover(db *dynamodb.DynamoDB, assetTable string) DetailsRemover {
+	return func(ctx context.Context, path string) error {
+		_, err := db.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(assetTable),
+			Key: map[string]*dynamodb.AttributeValue{
+				fieldPath: {S: aws.String(path)},
+			},
+		})
+		return errors.WithStack(err)
+	}
+}
+
+// DetailsLister returns details for every asset keyed by path
+type DetailsLister func(ctx context.Context) (map[string]Details, error)
+
+func NewDetailsLister(db *dynamodb.DynamoDB, assetTable string) DetailsLister {
+	return func(ctx context.Context) (map[string]Details, error) {
+		ret := make(map[string]Details)
+		var parseErr error
+		err := db.ScanPagesWithContext(ctx, &dynamodb.ScanInput{
+			TableName: aws.String(assetTable),
+		}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+			for _, item := range page.Items {
+				d, err := toDetails(item)
+				if err != nil {
+					parseErr = err
+					return false
+				}
+				ret[d.Path] = d
+			}
+			return true
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		return ret, nil
+	}
+}
+
+func toDetails(item map[string]*dynamodb.AttributeValue) (Details, error) {
+	ret := Details{
+		Path:     aws.StringValue(item[fieldPath].S),
+		Variants: make([]Variant, 0),
+	}
+	ret.SourceHash = stringField(item, fieldSourceHash)
+	ret.ContentPath = stringField(item, fieldContent)
+	var err error
+	ret.Width, err = intField(item, fieldWidth)
+	if err != nil {
+		return Details{}, err
+	}
+	ret.Height, err = intField(item, fieldHeight)
+	if err != nil {
+		return Details{}, err
+	}
+	if item[fieldProcessed] != nil {
+		ret.Processed, err = time.Parse(time.RFC3339, aws.StringValue(item[fieldProcessed].S))
+		if err != nil {
+			return Details{}, errors.WithStack(err)
+		}
+	}
+	ret.Metadata = Metadata{
+		AltText: stringField(item, fieldAltText),
+		Caption: stringField(item, fieldCaption),
+		Credit:  stringField(item, fieldCredit),
+		Licence: stringField(item, fieldLicence),
+	}
+	ret.Upload = Upload{
+		UserID: stringField(item, fieldUploaderID),
+		Name:   stringField(item, fieldUploader),
+	}
+	if item[fieldUploaded] != nil {
+		ret.Upload.Time, err = time.Parse(time.RFC3339, aws.StringValue(item[fieldUploaded].S))
+		if err != nil {
+			return Details{}, errors.WithStack(err)
+		}
+	}
+	ret.Scan = scan.Result{
+		Verdict:   scan.Verdict(stringField(item, fieldScan)),
+		Signature: stringField(item, fieldSignature),
+		Scanner:   stringField(item, fieldScanner),
+	}
+	if item[fieldScanned] != nil {
+		ret.Scan.Scanned, err = time.Parse(time.RFC3339, aws.StringValue(item[fieldScanned].S))
+		if err != nil {
+			return Details{}, errors.WithStack(err)
+		}
+	}
+	if item[fieldVariants] != nil {
+		for _, v := range item[fieldVariants].L {
+			width, err := intField(v.M, fieldWidth)
+			if err != nil {
+				return Details{}, err
+			}
+			height, err := intField(v.M, fieldHeight)
+			if err != nil {
+				return Details{}, err
+			}
+			size, err := intField(v.M, fieldSize)
+			if err != nil {
+				return Details{}, err
+			}
+			ret.Variants = append(ret.Variants, Variant{
+				Key:      aws.StringValue(v.M[fieldKey].S),
+				Width:    width,
+				Height:   height,
+				MimeType: aws.StringValue(v.M[fieldMimeType].S),
+				Size:     int64(size),
+			})
+		}
+	}
+	return ret, nil
+}
+
+func stringField(item map[string]*dynamodb.AttributeValue, field string) string {
+	if item[field] == nil {
+		return ""
+	}
+	return aws.StringValue(item[field].S)
+}
+
+func intField(item map[string]*dynamodb.AttributeValue, field string) (int, error) {
+	if item[field] == nil || item[field].N == nil {
+		return 0, nil
+	}
+	ret, err := strconv.Atoi(*item[field].N)
+	if err != nil {
+		return 0, errors.Errorf("invalid number %s for %s", *item[field].N, field)
+	}
+	return ret, nil
+}
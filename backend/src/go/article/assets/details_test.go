@@ -0,0 +1,100 @@
+package assets
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jonsabados/sabadoscodes.com/scan"
+)
+
+func Test_toDetails(t *testing.T) {
+	asserter := assert.New(t)
+
+	processed := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	res, err := toDetails(map[string]*dynamodb.AttributeValue{
+		fieldPath:       {S: aws.String("cat.jpg")},
+		fieldSourceHash: {S: aws.String("abc")},
+		fieldWidth:      {N: aws.String("800")},
+		fieldHeight:     {N: aws.String("600")},
+		fieldProcessed:  {S: aws.String(processed.Format(time.RFC3339))},
+		fieldAltText:    {S: aws.String("a cat")},
+		fieldCredit:     {S: aws.String("me")},
+		fieldUploaderID: {S: aws.String("123")},
+		fieldUploader:   {S: aws.String("Bob")},
+		fieldUploaded:   {S: aws.String(processed.Format(time.RFC3339))},
+		fieldContent:    {S: aws.String("_content/abc.jpg")},
+		fieldScan:       {S: aws.String("clean")},
+		fieldScanner:    {S: aws.String("clamav")},
+		fieldScanned:    {S: aws.String(processed.Format(time.RFC3339))},
+		fieldVariants: {L: []*dynamodb.AttributeValue{
+			{M: map[string]*dynamodb.AttributeValue{
+				fieldKey:      {S: aws.String("article-assets/_variants/cat.jpg/320w.jpg")},
+				fieldWidth:    {N: aws.String("320")},
+				fieldHeight:   {N: aws.String("240")},
+				fieldMimeType: {S: aws.String("image/jpeg")},
+				fieldSize:     {N: aws.String("1234")},
+			}},
+		}},
+	})
+	asserter.NoError(err)
+	asserter.Equal(Details{
+		Path:        "cat.jpg",
+		SourceHash:  "abc",
+		Width:       800,
+		Height:      600,
+		Processed:   processed,
+		Metadata:    Metadata{AltText: "a cat", Credit: "me"},
+		Upload:      Upload{UserID: "123", Name: "Bob", Time: processed},
+		ContentPath: "_content/abc.jpg",
+		Scan:        scan.Result{Verdict: scan.VerdictClean, Scanner: scan.ScannerClamAV, Scanned: processed},
+		Variants: []Variant{
+			{Key: "article-assets/_variants/cat.jpg/320w.jpg", Width: 320, Height: 240, MimeType: "image/jpeg", Size: 1234},
+		},
+	}, res)
+
+	// assets that were never processed only have a path
+	res, err = toDetails(map[string]*dynamodb.AttributeValue{
+		fieldPath: {S: aws.String("doc.pdf")},
+	})
+	asserter.NoError(err)
+	asserter.Equal(Details{Path: "doc.pdf", Variants: []Variant{}}, res)
+
+	_, err = toDetails(map[string]*dynamodb.AttributeValue{
+		fieldPath:  {S: aws.String("cat.jpg")},
+		fieldWidth: {N: aws.String("wide")},
+	})
+	asserter.Error(err)
+
+	_, err = toDetails(map[string]*dynamodb.AttributeValue{
+		fieldPath:    {S: aws.String("cat.jpg")},
+		fieldScanned: {S: aws.String("yesterday")},
+	})
+	asserter.Error(err)
+}
+
+func Test_updateBuilder(t *testing.T) {
+	asserter := assert.New(t)
+
+	update := newUpdateBuilder()
+	update.set(fieldUploaderID, &dynamodb.AttributeValue{S: aws.String("123")})
+	update.applyMetadata(MetadataUpdate{
+		AltText: aws.String("a cat"),
+		Caption: aws.String(""),
+	})
+	input := update.input("assets", "cat.jpg")
+	asserter.Equal("SET #UploaderID = :UploaderID, #AltText = :AltText REMOVE #Caption", *input.UpdateExpression)
+	asserter.Equal("cat.jpg", *input.Key[fieldPath].S)
+	asserter.Len(input.ExpressionAttributeNames, 3)
+	asserter.Equal("a cat", *input.ExpressionAttributeValues[":AltText"].S)
+
+	// dynamo rejects empty value maps
+	update = newUpdateBuilder()
+	update.applyMetadata(MetadataUpdate{Licence: aws.String("")})
+	input = update.input("assets", "cat.jpg")
+	asserter.Equal("REMOVE #Licence", *input.UpdateExpression)
+	asserter.Nil(input.ExpressionAttributeValues)
+}
@@ -0,0 +1,247 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/pkg/errors"
+	"golang.org/x/image/draw"
+)
+
+const (
+	MimeTypeJPEG = "image/jpeg"
+	MimeTypePNG  = "image/png"
+	MimeTypeWebP = "image/webp"
+
+	// MaxPixels keeps absurdly large (or maliciously crafted) images from exhausting memory when decoded
+	MaxPixels = 50 * 1000 * 1000
+
+	jpegQuality = 82
+	// used when an original has to be re-encoded to apply its orientation, where quality matters more than size
+	originalJPEGQuality = 92
+)
+
+// VariantWidths are the widths resized variants are generated at, images are never scaled up
+var VariantWidths = []int{320, 640, 1280}
+
+var extensions = map[string]string{
+	MimeTypeJPEG: "jpg",
+	MimeTypePNG:  "png",
+	MimeTypeWebP: "webp",
+}
+
+// Variant is a resized (and possibly re-formatted) copy of an image
+type Variant struct {
+	Width     int
+	Height    int
+	MimeType  string
+	Extension string
+	Content   []byte
+}
+
+// Result is the outcome of processing an image
+type Result struct {
+	// Content is the original with its metadata removed, it will be the same as the input if there was nothing to strip
+	Content []byte
+	Width   int
+	Height  int
+	// Variants holds a resized copy for each width smaller than the original, plus a webp version when that is smaller
+	Variants []Variant
+}
+
+// Processable reports if variants can be generated for the given type. Gifs are left alone since resizing would lose
+// animation, and svgs don't need it.
+func Processable(mimeType string) bool {
+	return mimeType == MimeTypeJPEG || mimeType == MimeTypePNG
+}
+
+// Process strips metadata from an image and generates resized variants at the given widths
+func Process(mimeType string, content []byte, widths []int) (Result, error) {
+	if !Processable(mimeType) {
+		return Result{}, errors.Errorf("unable to process %s images", mimeType)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return Result{}, errors.WithStack(err)
+	}
+	if config.Width*config.Height > MaxPixels {
+		return Result{}, errors.Errorf("image is too large to process, %dx%d", config.Width, config.Height)
+	}
+
+	stripped, err := StripMetadata(mimeType, content)
+	if err != nil {
+		return Result{}, err
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return Result{}, errors.WithStack(err)
+	}
+	img := toRGBA(decoded)
+
+	orientation := orientationNormal
+	if mimeType == MimeTypeJPEG {
+		orientation = jpegOrientation(content)
+	}
+	if orientation != orientationNormal {
+		img = orient(img, orientation)
+		stripped, err = encodeOriented(img)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	bounds := img.Bounds()
+	ret := Result{
+		Content:  stripped,
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+		Variants: make([]Variant, 0),
+	}
+	for _, width := range widths {
+		if width >= ret.Width {
+			continue
+		}
+		height := int(math.Round(float64(ret.Height) * float64(width) / float64(ret.Width)))
+		if height < 1 {
+			height = 1
+		}
+		resized := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Src, nil)
+
+		variant, err := encode(resized, mimeType)
+		if err != nil {
+			return Result{}, err
+		}
+		ret.Variants = append(ret.Variants, variant)
+
+		webp, err := encode(resized, MimeTypeWebP)
+		if err != nil {
+			return Result{}, err
+		}
+		// webp encoding is lossless, which only pays off for some images
+		if len(webp.Content) < len(variant.Content) {
+			ret.Variants = append(ret.Variants, webp)
+		}
+	}
+	return ret, nil
+}
+
+// Clean strips metadata from an image the same way Process does, without generating any variants. Uploads are cleaned
+// before they are hashed, content addressed assets are named for their hash and rewriting them afterwards would leave
+// them named for content that is never served.
+func Clean(mimeType string, content []byte) ([]byte, error) {
+	if !Processable(mimeType) {
+		return nil, errors.Errorf("unable to clean %s images", mimeType)
+	}
+	stripped, err := StripMetadata(mimeType, content)
+	if err != nil {
+		return nil, err
+	}
+	if mimeType != MimeTypeJPEG {
+		return stripped, nil
+	}
+	orientation := jpegOrientation(content)
+	if orientation == orientationNormal {
+		return stripped, nil
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, errors.Errorf("image is too large to process, %dx%d", config.Width, config.Height)
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return encodeOriented(orient(toRGBA(decoded), orientation))
+}
+
+// stripping the EXIF data drops the orientation so it needs to be baked into the pixels instead
+func encodeOriented(img *image.RGBA) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := jpeg.Encode(buf, img, &jpeg.Options{Quality: originalJPEGQuality})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return buf.Bytes(), nil
+}
+
+func encode(img *image.RGBA, mimeType string) (Variant, error) {
+	buf := new(bytes.Buffer)
+	var err error
+	switch mimeType {
+	case MimeTypeJPEG:
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: jpegQuality})
+	case MimeTypePNG:
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(buf, img)
+	case MimeTypeWebP:
+		err = nativewebp.Encode(buf, img, nil)
+	default:
+		err = errors.Errorf("unable to encode %s", mimeType)
+	}
+	if err != nil {
+		return Variant{}, errors.WithStack(err)
+	}
+	return Variant{
+		Width:     img.Bounds().Dx(),
+		Height:    img.Bounds().Dy(),
+		MimeType:  mimeType,
+		Extension: extensions[mimeType],
+		Content:   buf.Bytes(),
+	}, nil
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if ret, ok := img.(*image.RGBA); ok && ret.Bounds().Min == (image.Point{}) {
+		return ret
+	}
+	b := img.Bounds()
+	ret := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(ret, ret.Bounds(), img, b.Min, draw.Src)
+	return ret
+}
+
+// orient applies an EXIF orientation, see https://magnushoff.com/articles/jpeg-orientation/ for what each value means
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	w := src.Bounds().Dx()
+	h := src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
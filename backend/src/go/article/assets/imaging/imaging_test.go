@@ -0,0 +1,262 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testImage(width, height int) image.Image {
+	ret := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			ret.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	return ret
+}
+
+func testJPEG(t *testing.T, width, height int) []byte {
+	buf := new(bytes.Buffer)
+	err := jpeg.Encode(buf, testImage(width, height), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testPNG(t *testing.T, width, height int) []byte {
+	buf := new(bytes.Buffer)
+	err := png.Encode(buf, testImage(width, height))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// exifSegment builds a little endian APP1 EXIF segment holding just an orientation
+func exifSegment(orientation uint16) []byte {
+	tiff := []byte{'I', 'I', 42, 0, 8, 0, 0, 0, 1, 0}
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry[0:2], tagOrientation)
+	binary.LittleEndian.PutUint16(entry[2:4], 3)
+	binary.LittleEndian.PutUint32(entry[4:8], 1)
+	binary.LittleEndian.PutUint16(entry[8:10], orientation)
+	tiff = append(tiff, entry...)
+	tiff = append(tiff, 0, 0, 0, 0)
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	ret := []byte{0xFF, jpegMarkerAPP1, 0, 0}
+	binary.BigEndian.PutUint16(ret[2:4], uint16(len(payload)+2))
+	return append(ret, payload...)
+}
+
+// gpsSegment builds a little endian APP1 EXIF segment pointing at a GPS IFD holding a latitude and longitude reference
+func gpsSegment() []byte {
+	tiff := []byte{'I', 'I', 42, 0, 8, 0, 0, 0, 1, 0}
+	pointer := make([]byte, 12)
+	binary.LittleEndian.PutUint16(pointer[0:2], 0x8825)
+	binary.LittleEndian.PutUint16(pointer[2:4], 4)
+	binary.LittleEndian.PutUint32(pointer[4:8], 1)
+	binary.LittleEndian.PutUint32(pointer[8:12], 26)
+	tiff = append(tiff, pointer...)
+	tiff = append(tiff, 0, 0, 0, 0)
+	tiff = append(tiff, 2, 0)
+	for _, ref := range []struct {
+		tag   uint16
+		value byte
+	}{{1, 'N'}, {3, 'W'}} {
+		entry := make([]byte, 12)
+		binary.LittleEndian.PutUint16(entry[0:2], ref.tag)
+		binary.LittleEndian.PutUint16(entry[2:4], 2)
+		binary.LittleEndian.PutUint32(entry[4:8], 2)
+		entry[8] = ref.value
+		tiff = append(tiff, entry...)
+	}
+	tiff = append(tiff, 0, 0, 0, 0)
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	ret := []byte{0xFF, jpegMarkerAPP1, 0, 0}
+	binary.BigEndian.PutUint16(ret[2:4], uint16(len(payload)+2))
+	return append(ret, payload...)
+}
+
+func withSegment(jpg []byte, segment []byte) []byte {
+	ret := append([]byte{}, jpg[:2]...)
+	ret = append(ret, segment...)
+	return append(ret, jpg[2:]...)
+}
+
+func withTextChunk(pngContent []byte, text string) []byte {
+	chunk := make([]byte, 8)
+	binary.BigEndian.PutUint32(chunk[0:4], uint32(len(text)))
+	copy(chunk[4:8], "tEXt")
+	chunk = append(chunk, text...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk[4:]))
+	chunk = append(chunk, crc...)
+	// right after the IHDR chunk
+	split := len(pngSignature) + 25
+	ret := append([]byte{}, pngContent[:split]...)
+	ret = append(ret, chunk...)
+	return append(ret, pngContent[split:]...)
+}
+
+func TestStripMetadata_JPEG(t *testing.T) {
+	asserter := assert.New(t)
+	clean := testJPEG(t, 8, 4)
+	comment := []byte{0xFF, jpegMarkerCOM, 0, 7, 'h', 'e', 'l', 'l', 'o'}
+	dirty := withSegment(withSegment(clean, exifSegment(6)), comment)
+
+	stripped, err := StripMetadata(MimeTypeJPEG, dirty)
+	asserter.NoError(err)
+	asserter.Equal(clean, stripped)
+
+	stripped, err = StripMetadata(MimeTypeJPEG, clean)
+	asserter.NoError(err)
+	asserter.Equal(clean, stripped)
+
+	_, err = StripMetadata(MimeTypeJPEG, []byte("not a jpeg"))
+	asserter.Error(err)
+}
+
+func TestStripMetadata_PNG(t *testing.T) {
+	asserter := assert.New(t)
+	clean := testPNG(t, 8, 4)
+	dirty := withTextChunk(clean, "Author\x00Bob")
+
+	_, err := png.Decode(bytes.NewReader(dirty))
+	asserter.NoError(err)
+
+	stripped, err := StripMetadata(MimeTypePNG, dirty)
+	asserter.NoError(err)
+	asserter.Equal(clean, stripped)
+}
+
+func TestStripMetadata_OtherTypes(t *testing.T) {
+	content := []byte("GIF89a whatever")
+	stripped, err := StripMetadata("image/gif", content)
+	assert.NoError(t, err)
+	assert.Equal(t, content, stripped)
+}
+
+func Test_jpegOrientation(t *testing.T) {
+	clean := testJPEG(t, 8, 4)
+	assert.Equal(t, 1, jpegOrientation(clean))
+	assert.Equal(t, 6, jpegOrientation(withSegment(clean, exifSegment(6))))
+	assert.Equal(t, 1, jpegOrientation(withSegment(clean, exifSegment(42))))
+}
+
+func Test_orient(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	marker := color.RGBA{R: 255, A: 255}
+	// top left
+	src.Set(0, 0, marker)
+
+	testCases := []struct {
+		orientation int
+		width       int
+		height      int
+		x           int
+		y           int
+	}{
+		{1, 3, 2, 0, 0},
+		{2, 3, 2, 2, 0},
+		{3, 3, 2, 2, 1},
+		{4, 3, 2, 0, 1},
+		{5, 2, 3, 0, 0},
+		{6, 2, 3, 1, 0},
+		{7, 2, 3, 1, 2},
+		{8, 2, 3, 0, 2},
+	}
+	for _, tc := range testCases {
+		res := orient(src, tc.orientation)
+		assert.Equal(t, tc.width, res.Bounds().Dx(), "orientation %d", tc.orientation)
+		assert.Equal(t, tc.height, res.Bounds().Dy(), "orientation %d", tc.orientation)
+		assert.Equal(t, marker, res.RGBAAt(tc.x, tc.y), "orientation %d", tc.orientation)
+	}
+}
+
+func TestProcess_Variants(t *testing.T) {
+	asserter := assert.New(t)
+	content := testPNG(t, 1000, 500)
+
+	res, err := Process(MimeTypePNG, content, VariantWidths)
+	asserter.NoError(err)
+	asserter.Equal(content, res.Content)
+	asserter.Equal(1000, res.Width)
+	asserter.Equal(500, res.Height)
+
+	widths := make(map[int]bool)
+	for _, v := range res.Variants {
+		widths[v.Width] = true
+		asserter.Equal(v.Width/2, v.Height)
+		decoded, format, err := image.DecodeConfig(bytes.NewReader(v.Content))
+		if v.MimeType == MimeTypeWebP {
+			// no webp decoder registered, just check the container
+			asserter.Equal("RIFF", string(v.Content[:4]))
+			asserter.Equal("webp", v.Extension)
+			continue
+		}
+		asserter.NoError(err)
+		asserter.Equal("png", format)
+		asserter.Equal(v.Width, decoded.Width)
+	}
+	asserter.Equal(map[int]bool{320: true, 640: true}, widths)
+}
+
+func TestProcess_AppliesOrientation(t *testing.T) {
+	asserter := assert.New(t)
+	content := withSegment(testJPEG(t, 800, 400), exifSegment(6))
+
+	res, err := Process(MimeTypeJPEG, content, []int{320})
+	asserter.NoError(err)
+	asserter.Equal(400, res.Width)
+	asserter.Equal(800, res.Height)
+	asserter.Equal(1, jpegOrientation(res.Content))
+	decoded, err := jpeg.DecodeConfig(bytes.NewReader(res.Content))
+	asserter.NoError(err)
+	asserter.Equal(400, decoded.Width)
+
+	asserter.Equal(320, res.Variants[0].Width)
+	asserter.Equal(640, res.Variants[0].Height)
+}
+
+func TestClean(t *testing.T) {
+	asserter := assert.New(t)
+	clean := testJPEG(t, 800, 400)
+
+	res, err := Clean(MimeTypeJPEG, withSegment(clean, gpsSegment()))
+	asserter.NoError(err)
+	asserter.Equal(clean, res)
+
+	res, err = Clean(MimeTypeJPEG, withSegment(withSegment(clean, exifSegment(6)), gpsSegment()))
+	asserter.NoError(err)
+	asserter.False(bytes.Contains(res, []byte("Exif")))
+	decoded, err := jpeg.DecodeConfig(bytes.NewReader(res))
+	asserter.NoError(err)
+	asserter.Equal(400, decoded.Width)
+	asserter.Equal(800, decoded.Height)
+
+	cleanPNG := testPNG(t, 100, 100)
+	res, err = Clean(MimeTypePNG, withTextChunk(cleanPNG, "GPS\x0052.1,-1.2"))
+	asserter.NoError(err)
+	asserter.Equal(cleanPNG, res)
+
+	_, err = Clean("image/gif", []byte("GIF89a"))
+	asserter.Error(err)
+	_, err = Clean(MimeTypeJPEG, []byte("garbage"))
+	asserter.Error(err)
+}
+
+func TestProcess_Unprocessable(t *testing.T) {
+	_, err := Process("image/gif", []byte("GIF89a"), VariantWidths)
+	assert.Error(t, err)
+	_, err = Process(MimeTypeJPEG, []byte("garbage"), VariantWidths)
+	assert.Error(t, err)
+}
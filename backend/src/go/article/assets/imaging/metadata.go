@@ -0,0 +1,188 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	jpegMarkerSOI  = 0xD8
+	jpegMarkerEOI  = 0xD9
+	jpegMarkerSOS  = 0xDA
+	jpegMarkerAPP1 = 0xE1
+	// APP13 carries photoshop/IPTC data which can include captions, names and locations
+	jpegMarkerAPP13 = 0xED
+	jpegMarkerCOM   = 0xFE
+
+	orientationNormal = 1
+	tagOrientation    = 0x0112
+)
+
+var pngSignature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n'}
+
+// pngMetadataChunks are the ancillary chunks that carry camera, location, author or time details
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+type jpegSegment struct {
+	marker byte
+	// raw is the entire segment including the marker
+	raw []byte
+	// payload is the segment data after the length
+	payload []byte
+}
+
+// readJPEGSegments splits a jpeg into the segments before the image data, plus everything from the start of scan on
+func readJPEGSegments(content []byte) ([]jpegSegment, []byte, error) {
+	if len(content) < 4 || content[0] != 0xFF || content[1] != jpegMarkerSOI {
+		return nil, nil, errors.New("not a jpeg")
+	}
+	segments := make([]jpegSegment, 0)
+	pos := 2
+	for {
+		if pos >= len(content) || content[pos] != 0xFF {
+			return nil, nil, errors.Errorf("expected jpeg marker at offset %d", pos)
+		}
+		// markers may be preceded by any number of fill bytes
+		for pos < len(content) && content[pos] == 0xFF {
+			pos++
+		}
+		if pos >= len(content) {
+			return nil, nil, errors.New("truncated jpeg")
+		}
+		marker := content[pos]
+		start := pos - 1
+		pos++
+		if marker == jpegMarkerSOS || marker == jpegMarkerEOI {
+			return segments, content[start:], nil
+		}
+		if pos+2 > len(content) {
+			return nil, nil, errors.New("truncated jpeg")
+		}
+		length := int(binary.BigEndian.Uint16(content[pos : pos+2]))
+		if length < 2 || pos+length > len(content) {
+			return nil, nil, errors.Errorf("invalid jpeg segment length at offset %d", pos)
+		}
+		segments = append(segments, jpegSegment{
+			marker:  marker,
+			raw:     content[start : pos+length],
+			payload: content[pos+2 : pos+length],
+		})
+		pos += length
+	}
+}
+
+// StripMetadata removes EXIF, XMP, IPTC, comments and text chunks from jpeg and png images without re-encoding
+// them. Other types are returned as is.
+func StripMetadata(mimeType string, content []byte) ([]byte, error) {
+	switch mimeType {
+	case MimeTypeJPEG:
+		return stripJPEG(content)
+	case MimeTypePNG:
+		return stripPNG(content)
+	default:
+		return content, nil
+	}
+}
+
+func stripJPEG(content []byte) ([]byte, error) {
+	segments, rest, err := readJPEGSegments(content)
+	if err != nil {
+		return nil, err
+	}
+	ret := bytes.NewBuffer(make([]byte, 0, len(content)))
+	ret.Write([]byte{0xFF, jpegMarkerSOI})
+	for _, s := range segments {
+		if s.marker == jpegMarkerAPP1 || s.marker == jpegMarkerAPP13 || s.marker == jpegMarkerCOM {
+			continue
+		}
+		ret.Write(s.raw)
+	}
+	ret.Write(rest)
+	return ret.Bytes(), nil
+}
+
+func stripPNG(content []byte) ([]byte, error) {
+	if !bytes.HasPrefix(content, pngSignature) {
+		return nil, errors.New("not a png")
+	}
+	ret := bytes.NewBuffer(make([]byte, 0, len(content)))
+	ret.Write(pngSignature)
+	pos := len(pngSignature)
+	for pos < len(content) {
+		// length, type, data, crc
+		if pos+8 > len(content) {
+			return nil, errors.New("truncated png")
+		}
+		length := int(binary.BigEndian.Uint32(content[pos : pos+4]))
+		end := pos + 12 + length
+		if length < 0 || end > len(content) {
+			return nil, errors.Errorf("invalid png chunk length at offset %d", pos)
+		}
+		chunkType := string(content[pos+4 : pos+8])
+		if !pngMetadataChunks[chunkType] {
+			ret.Write(content[pos:end])
+		}
+		pos = end
+	}
+	return ret.Bytes(), nil
+}
+
+// jpegOrientation reads the EXIF orientation of a jpeg, defaulting to normal when it is missing or unreadable
+func jpegOrientation(content []byte) int {
+	segments, _, err := readJPEGSegments(content)
+	if err != nil {
+		return orientationNormal
+	}
+	for _, s := range segments {
+		if s.marker != jpegMarkerAPP1 || !bytes.HasPrefix(s.payload, []byte("Exif\x00\x00")) {
+			continue
+		}
+		if o := exifOrientation(s.payload[6:]); o != 0 {
+			return o
+		}
+	}
+	return orientationNormal
+}
+
+// exifOrientation walks the first IFD of a TIFF structure looking for the orientation tag, returning 0 if absent
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[ifd : ifd+2]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:entry+2]) == tagOrientation {
+			o := int(order.Uint16(tiff[entry+8 : entry+10]))
+			if o < 1 || o > 8 {
+				return 0
+			}
+			return o
+		}
+	}
+	return 0
+}
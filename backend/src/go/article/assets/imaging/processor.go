@@ -0,0 +1,108 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/article/assets"
+	"github.com/jonsabados/sabadoscodes.com/audit"
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+// Processor strips metadata from and generates variants of a newly uploaded asset
+type Processor func(ctx context.Context, bucket string, key string) error
+
+func NewProcessor(describeObject s3.ObjectDescriber,
+	fetchObject s3.ObjectFetcher,
+	saveObject s3.PublicObjectSaver,
+	fetchDetails assets.DetailsFetcher,
+	recordProcessing assets.ProcessingRecorder) Processor {
+
+	return func(ctx context.Context, bucket string, key string) error {
+		logger := zerolog.Ctx(ctx).With().Str("key", key).Logger()
+		// content addressed assets are processed like any other, their details are what the listing shows for aliases.
+		// Uploads are cleaned before being hashed, so stripping them here only happens for ones that predate that.
+		if !strings.HasPrefix(key, assets.AssetKeyPrefix) || assets.IsVariantKey(key) {
+			logger.Debug().Msg("not an uploaded asset, skipping")
+			return nil
+		}
+		path := strings.TrimPrefix(key, assets.AssetKeyPrefix)
+
+		info, err := describeObject(ctx, bucket, key)
+		if err != nil {
+			return err
+		}
+		if info == nil {
+			logger.Info().Msg("asset no longer exists, skipping")
+			return nil
+		}
+		if !Processable(info.ContentType) {
+			logger.Debug().Str("mimeType", info.ContentType).Msg("not a processable type, skipping")
+			return nil
+		}
+
+		reader, err := fetchObject(ctx, bucket, key)
+		if err != nil {
+			return err
+		}
+		content, err := ioutil.ReadAll(reader)
+		_ = reader.Close()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		// rewriting the stripped original triggers another event, which ends up here with content already handled
+		existing, err := fetchDetails(ctx, path)
+		if err != nil {
+			return err
+		}
+		if existing != nil && existing.SourceHash == audit.Hash(content) {
+			logger.Info().Msg("asset already processed")
+			return nil
+		}
+
+		res, err := Process(info.ContentType, content, VariantWidths)
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(content, res.Content) {
+			logger.Info().Msg("replacing asset with metadata stripped version")
+			err = saveObject(ctx, bucket, key, bytes.NewReader(res.Content), info.ContentType, assets.CacheDuration)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		details := assets.Details{
+			Path:       path,
+			SourceHash: audit.Hash(res.Content),
+			Width:      res.Width,
+			Height:     res.Height,
+			Variants:   make([]assets.Variant, 0, len(res.Variants)),
+			Processed:  time.Now(),
+		}
+		for _, v := range res.Variants {
+			variantKey := assets.VariantKey(path, v.Width, v.Extension)
+			err = saveObject(ctx, bucket, variantKey, bytes.NewReader(v.Content), v.MimeType, assets.CacheDuration)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			details.Variants = append(details.Variants, assets.Variant{
+				Key:      variantKey,
+				Width:    v.Width,
+				Height:   v.Height,
+				MimeType: v.MimeType,
+				Size:     int64(len(v.Content)),
+			})
+		}
+		logger.Info().Int("variantCount", len(details.Variants)).Msg("asset processed")
+		return recordProcessing(ctx, details)
+	}
+}
@@ -0,0 +1,161 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jonsabados/sabadoscodes.com/article/assets"
+	"github.com/jonsabados/sabadoscodes.com/audit"
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+type fakeBucket struct {
+	objects map[string][]byte
+	types   map[string]string
+	details map[string]assets.Details
+}
+
+func newFakeBucket() *fakeBucket {
+	return &fakeBucket{
+		objects: make(map[string][]byte),
+		types:   make(map[string]string),
+		details: make(map[string]assets.Details),
+	}
+}
+
+func (f *fakeBucket) describe(ctx context.Context, bucket, key string) (*s3.ObjectInfo, error) {
+	content, exists := f.objects[key]
+	if !exists {
+		return nil, nil
+	}
+	return &s3.ObjectInfo{ContentType: f.types[key], Size: int64(len(content))}, nil
+}
+
+func (f *fakeBucket) fetch(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(f.objects[key])), nil
+}
+
+func (f *fakeBucket) save(ctx context.Context, bucket string, key string, object io.ReadSeeker, mimeType string, cacheDuration time.Duration) error {
+	content, err := ioutil.ReadAll(object)
+	if err != nil {
+		return err
+	}
+	f.objects[key] = content
+	f.types[key] = mimeType
+	return nil
+}
+
+func (f *fakeBucket) fetchDetails(ctx context.Context, path string) (*assets.Details, error) {
+	d, exists := f.details[path]
+	if !exists {
+		return nil, nil
+	}
+	return &d, nil
+}
+
+func (f *fakeBucket) recordProcessing(ctx context.Context, details assets.Details) error {
+	f.details[details.Path] = details
+	return nil
+}
+
+func (f *fakeBucket) processor() Processor {
+	return NewProcessor(f.describe, f.fetch, f.save, f.fetchDetails, f.recordProcessing)
+}
+
+func TestNewProcessor(t *testing.T) {
+	asserter := assert.New(t)
+	ctx := context.Background()
+	bucket := newFakeBucket()
+	clean := testJPEG(t, 700, 300)
+	key := assets.AssetKeyPrefix + "photos/cat.jpg"
+	bucket.objects[key] = withSegment(clean, exifSegment(1))
+	bucket.types[key] = MimeTypeJPEG
+
+	err := bucket.processor()(ctx, "bucket", key)
+	asserter.NoError(err)
+
+	asserter.Equal(clean, bucket.objects[key])
+	details := bucket.details["photos/cat.jpg"]
+	asserter.Equal(audit.Hash(clean), details.SourceHash)
+	asserter.Equal(700, details.Width)
+	asserter.Equal(300, details.Height)
+	widths := make([]int, 0)
+	for _, v := range details.Variants {
+		asserter.Contains(bucket.objects, v.Key)
+		asserter.Equal(v.MimeType, bucket.types[v.Key])
+		asserter.Equal(int64(len(bucket.objects[v.Key])), v.Size)
+		if v.MimeType == MimeTypeJPEG {
+			widths = append(widths, v.Width)
+		}
+	}
+	asserter.Equal([]int{320, 640}, widths)
+
+	// the follow up event from replacing the original should be a no-op, as should events for the variants
+	objectCount := len(bucket.objects)
+	processed := details.Processed
+	err = bucket.processor()(ctx, "bucket", key)
+	asserter.NoError(err)
+	err = bucket.processor()(ctx, "bucket", details.Variants[0].Key)
+	asserter.NoError(err)
+	asserter.Len(bucket.objects, objectCount)
+	asserter.Equal(processed, bucket.details["photos/cat.jpg"].Processed)
+}
+
+func TestNewProcessor_SkipsOtherObjects(t *testing.T) {
+	asserter := assert.New(t)
+	bucket := newFakeBucket()
+	bucket.objects[assets.AssetKeyPrefix+"doc.pdf"] = []byte("%PDF")
+	bucket.types[assets.AssetKeyPrefix+"doc.pdf"] = "application/pdf"
+	bucket.objects["somewhere-else/foo.png"] = testPNG(t, 800, 800)
+	bucket.types["somewhere-else/foo.png"] = MimeTypePNG
+
+	asserter.NoError(bucket.processor()(context.Background(), "bucket", assets.AssetKeyPrefix+"doc.pdf"))
+	asserter.NoError(bucket.processor()(context.Background(), "bucket", "somewhere-else/foo.png"))
+	asserter.NoError(bucket.processor()(context.Background(), "bucket", assets.AssetKeyPrefix+"gone.png"))
+	asserter.Len(bucket.objects, 2)
+	asserter.Empty(bucket.details)
+}
+
+func TestNewProcessor_ContentAddressed(t *testing.T) {
+	asserter := assert.New(t)
+	ctx := context.Background()
+	bucket := newFakeBucket()
+	clean := testJPEG(t, 700, 300)
+	dirty := withSegment(clean, gpsSegment())
+
+	// what the upload lambdas do, cleaning before hashing so the content path names what is served
+	cleaned, err := Clean(MimeTypeJPEG, dirty)
+	asserter.NoError(err)
+	contentPath := assets.ContentPath(audit.Hash(cleaned), "photos/cat.jpg")
+	key := assets.AssetKeyPrefix + contentPath
+	bucket.objects[key] = cleaned
+	bucket.types[key] = MimeTypeJPEG
+
+	err = bucket.processor()(ctx, "bucket", key)
+	asserter.NoError(err)
+	asserter.Equal(clean, cleaned)
+	// left as is, so it still matches its content path
+	asserter.Equal(cleaned, bucket.objects[key])
+	details := bucket.details[contentPath]
+	asserter.Equal(700, details.Width)
+	asserter.NotEmpty(details.Variants)
+	for _, v := range details.Variants {
+		asserter.False(bytes.Contains(bucket.objects[v.Key], []byte("Exif")))
+	}
+
+	// anything stored before uploads were cleaned still gets stripped
+	legacyPath := assets.ContentPath(audit.Hash(dirty), "photos/dog.jpg")
+	legacyKey := assets.AssetKeyPrefix + legacyPath
+	bucket.objects[legacyKey] = dirty
+	bucket.types[legacyKey] = MimeTypeJPEG
+	err = bucket.processor()(ctx, "bucket", legacyKey)
+	asserter.NoError(err)
+	asserter.Equal(clean, bucket.objects[legacyKey])
+	asserter.Contains(bucket.details, legacyPath)
+}
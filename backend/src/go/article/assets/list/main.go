@@ -6,50 +6,217 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/rs/zerolog"
 
 	"github.com/jonsabados/sabadoscodes.com/article/assets"
+	"github.com/jonsabados/sabadoscodes.com/auth"
 	"github.com/jonsabados/sabadoscodes.com/cors"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/httputil"
 	"github.com/jonsabados/sabadoscodes.com/logging"
 	"github.com/jonsabados/sabadoscodes.com/response"
 	"github.com/jonsabados/sabadoscodes.com/s3"
 )
 
+type variantDetails struct {
+	URL      string `json:"url"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	MimeType string `json:"mimeType"`
+	Size     int64  `json:"size"`
+}
+
+type uploadDetails struct {
+	UserID string    `json:"userId"`
+	Name   string    `json:"name"`
+	Time   time.Time `json:"time"`
+}
+
+type scanDetails struct {
+	Verdict string    `json:"verdict"`
+	Scanner string    `json:"scanner"`
+	Time    time.Time `json:"time"`
+}
+
 type assetDetails struct {
-	Path string `json:"path"`
-	Size int64  `json:"size"`
-	URL  string `json:"url"`
+	Path     string           `json:"path"`
+	Size     int64            `json:"size"`
+	URL      string           `json:"url"`
+	MimeType string           `json:"mimeType,omitempty"`
+	Modified time.Time        `json:"modified"`
+	Width    int              `json:"width,omitempty"`
+	Height   int              `json:"height,omitempty"`
+	Variants []variantDetails `json:"variants,omitempty"`
+	AltText  string           `json:"altText,omitempty"`
+	Caption  string           `json:"caption,omitempty"`
+	Credit   string           `json:"credit,omitempty"`
+	Licence  string           `json:"licence,omitempty"`
+	Uploaded *uploadDetails   `json:"uploaded,omitempty"`
+	// ContentAddressed is set for aliases of content addressed assets, in which case URL is the immutable content url
+	ContentAddressed bool `json:"contentAddressed,omitempty"`
+	// Scan is left out for assets uploaded before scanning was in place
+	Scan *scanDetails `json:"scan,omitempty"`
+}
+
+type listResponse struct {
+	Results []assetDetails `json:"results"`
+	// Folders are only included on the first page when listing with a delimiter
+	Folders    []string `json:"folders,omitempty"`
+	NextCursor string   `json:"nextCursor,omitempty"`
 }
 
 func newHandler(prepLogs logging.Preparer,
 	corsHeaders cors.ResponseHeaderBuilder,
+	extractPrincipal auth.PrincipalExtractor,
+	authorize auth.RouteAuthorizer,
 	targetBucket string,
 	listObjects s3.ObjectLister,
+	listDetails assets.DetailsLister,
 	baseAssetURL string) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 
 	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 		ctx, _ = prepLogs(ctx)
 		responseHeaders := corsHeaders(request.Headers)
 
-		objects, err := listObjects(ctx, targetBucket, assets.AssetKeyPrefix)
+		principal, err := extractPrincipal(request)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		if !authorize(principal, request) {
+			zerolog.Ctx(ctx).Warn().Interface("user", principal).Msg("user not authorized for route")
+			return response.HandleForbidden(ctx, responseHeaders, "not permitted"), nil
+		}
+
+		errors := httputil.ErrorTracker{}
+		params := request.QueryStringParameters
+		query := assets.ListQuery{
+			Prefix:    params["prefix"],
+			Delimiter: params["delimiter"],
+			MimeType:  strings.ToLower(params["mimeType"]),
+			Sort:      assets.SortPath,
+			Cursor:    params["cursor"],
+			Limit:     assets.DefaultListLimit,
+		}
+		if sortBy, hasParam := params["sort"]; hasParam {
+			if !assets.ValidSort(sortBy) {
+				errors = errors.WithFieldError("sort", fmt.Sprintf("must be one of %s, %s or %s", assets.SortPath, assets.SortSize, assets.SortModified))
+			}
+			query.Sort = sortBy
+		}
+		switch params["order"] {
+		case "", "asc":
+		case "desc":
+			query.Descending = true
+		default:
+			errors = errors.WithFieldError("order", "must be asc or desc")
+		}
+		if query.MimeType != "" && !strings.Contains(query.MimeType, "/") {
+			errors = errors.WithFieldError("mimeType", "must be a mime type such as image/png, or a family such as image/*")
+		}
+		if limit, hasParam := params["limit"]; hasParam {
+			query.Limit, err = strconv.Atoi(limit)
+			if err != nil || query.Limit < 1 || query.Limit > assets.MaxListLimit {
+				errors = errors.WithFieldError("limit", fmt.Sprintf("must be a number between 1 and %d", assets.MaxListLimit))
+			}
+		}
+		if errors.InError() {
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		objects, err := listObjects(ctx, targetBucket, assets.AssetKeyPrefix+query.Prefix)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		details, err := listDetails(ctx)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		content := objects
+		if query.Prefix != "" {
+			content, err = listObjects(ctx, targetBucket, assets.ContentKeyPrefix)
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+		}
+
+		listing, err := assets.List(assets.WithAliases(objects, content, details), query)
+		if err == assets.ErrInvalidCursor {
+			errors = errors.WithFieldError("cursor", "invalid cursor")
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
 		if err != nil {
 			return response.HandleError(ctx, responseHeaders, err), nil
 		}
 
-		results := make([]interface{}, 0)
-		for _, o := range objects {
-			path := strings.TrimPrefix(o.Path, assets.AssetKeyPrefix)
-			url := fmt.Sprintf("%s/%s", baseAssetURL, path)
-			results = append(results, assetDetails{path, o.Size, url})
+		results := make([]assetDetails, 0, len(listing.Assets))
+		for _, a := range listing.Assets {
+			asset := assetDetails{
+				Path:     a.Path,
+				Size:     a.Size,
+				URL:      fmt.Sprintf("%s/%s", baseAssetURL, a.Path),
+				MimeType: a.MimeType,
+				Modified: a.LastModified,
+			}
+			if d, exists := details[a.Path]; exists {
+				asset.AltText = d.Metadata.AltText
+				asset.Caption = d.Metadata.Caption
+				asset.Credit = d.Metadata.Credit
+				asset.Licence = d.Metadata.Licence
+				if !d.Upload.Time.IsZero() {
+					asset.Uploaded = &uploadDetails{
+						UserID: d.Upload.UserID,
+						Name:   d.Upload.Name,
+						Time:   d.Upload.Time,
+					}
+				}
+			}
+			// dimensions, variants and scan results belong to the content rather than its aliases
+			processedPath := a.Path
+			if d, exists := details[a.Path]; exists && d.ContentPath != "" {
+				processedPath = d.ContentPath
+				asset.URL = fmt.Sprintf("%s/%s", baseAssetURL, d.ContentPath)
+				asset.ContentAddressed = true
+			}
+			if d, exists := details[processedPath]; exists {
+				asset.Width = d.Width
+				asset.Height = d.Height
+				if d.Scan.Verdict != "" {
+					asset.Scan = &scanDetails{
+						Verdict: string(d.Scan.Verdict),
+						Scanner: d.Scan.Scanner,
+						Time:    d.Scan.Scanned,
+					}
+				}
+				for _, v := range d.Variants {
+					asset.Variants = append(asset.Variants, variantDetails{
+						URL:      fmt.Sprintf("%s/%s", baseAssetURL, strings.TrimPrefix(v.Key, assets.AssetKeyPrefix)),
+						Width:    v.Width,
+						Height:   v.Height,
+						MimeType: v.MimeType,
+						Size:     v.Size,
+					})
+				}
+			}
+			results = append(results, asset)
 		}
 
-		responseBody, err := json.Marshal(response.ListResponse{Results: results})
+		responseBody, err := json.Marshal(listResponse{
+			Results:    results,
+			Folders:    listing.Folders,
+			NextCursor: listing.NextCursor,
+		})
 		if err != nil {
 			return response.HandleError(ctx, responseHeaders, err), nil
 		}
@@ -81,11 +248,17 @@ func main() {
 	allowedDomains := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
 	targetBucket := os.Getenv("ASSET_BUCKET")
 	baseAssetURL := os.Getenv("BASE_ASSET_URL")
+	assetTable := os.Getenv("ASSET_TABLE")
+
+	routes, err := auth.ParseRouteTable([]byte(os.Getenv("ROUTE_TABLE")))
+	if err != nil {
+		panic(err)
+	}
 
 	s3Client := s3.RawClient(sess)
 	lister := s3.NewObjectLister(s3Client)
 
-	handler := newHandler(logging.NewPreparer(), cors.NewResponseHeaderBuilder(allowedDomains), targetBucket, lister, baseAssetURL)
+	handler := newHandler(logging.NewPreparer(), cors.NewResponseHeaderBuilder(allowedDomains), auth.NewPrincipalExtractor(), auth.NewRouteAuthorizer(routes), targetBucket, lister, assets.NewDetailsLister(dynamo.RawClient(sess), assetTable), baseAssetURL)
 
 	lambda.Start(handler)
 }
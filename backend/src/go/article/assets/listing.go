@@ -0,0 +1,274 @@
+package assets
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+const (
+	SortPath     = "path"
+	SortSize     = "size"
+	SortModified = "modified"
+
+	DefaultListLimit = 100
+	MaxListLimit     = 1000
+)
+
+// the lambda runtime doesn't ship a mime.types file, so the go builtins need some help with audio and video
+var extensionMimeTypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".ogg":  "audio/ogg",
+	".wav":  "audio/wav",
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".mov":  "video/quicktime",
+	".webm": "video/webm",
+	".txt":  "text/plain",
+}
+
+// MimeTypeForPath guesses the mime type of an asset from its extension, returning an empty string if it can't
+func MimeTypeForPath(assetPath string) string {
+	ext := strings.ToLower(path.Ext(assetPath))
+	if ext == "" {
+		return ""
+	}
+	if mimeType, known := extensionMimeTypes[ext]; known {
+		return mimeType
+	}
+	mimeType, _, err := mime.ParseMediaType(mime.TypeByExtension(ext))
+	if err != nil {
+		return ""
+	}
+	return mimeType
+}
+
+// ValidSort reports if sortBy is something listings can be sorted by
+func ValidSort(sortBy string) bool {
+	return sortBy == SortPath || sortBy == SortSize || sortBy == SortModified
+}
+
+// ErrInvalidCursor is returned when a listing is asked for with a cursor that was not produced by a previous listing
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor marks the last asset of a listing page, the next page starts with whatever sorts after it
+type cursor struct {
+	Value string `json:"v"`
+	Path  string `json:"p"`
+}
+
+func (c cursor) encode() string {
+	// marshalling two strings can't fail
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(encoded string) (cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	ret := cursor{}
+	err = json.Unmarshal(raw, &ret)
+	if err != nil || ret.Path == "" {
+		return cursor{}, ErrInvalidCursor
+	}
+	return ret, nil
+}
+
+// ListQuery narrows down and orders a listing of assets
+type ListQuery struct {
+	// Prefix limits the listing to paths starting with it
+	Prefix string
+	// Delimiter, when set, rolls up paths containing it after the prefix into folders, much like the s3 api does
+	Delimiter string
+	// MimeType is either an exact type, or a family such as image/*
+	MimeType   string
+	Sort       string
+	Descending bool
+	Cursor     string
+	Limit      int
+}
+
+// ListedAsset is an asset within a listing, with a path relative to AssetKeyPrefix
+type ListedAsset struct {
+	Path         string
+	Size         int64
+	LastModified time.Time
+	MimeType     string
+}
+
+type Listing struct {
+	Assets []ListedAsset
+	// Folders is only populated on the first page of a listing using a delimiter
+	Folders []string
+	// NextCursor is where the following page starts, empty when there isn't one
+	NextCursor string
+}
+
+// List builds a page of assets out of the raw contents of the asset bucket
+func List(objects []s3.Object, query ListQuery) (Listing, error) {
+	var after *cursor
+	if query.Cursor != "" {
+		c, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return Listing{}, err
+		}
+		after = &c
+	}
+
+	limit := query.Limit
+	if limit <= 0 || limit > MaxListLimit {
+		limit = DefaultListLimit
+	}
+
+	folders := make(map[string]bool)
+	matched := make([]ListedAsset, 0)
+	for _, o := range objects {
+		if !strings.HasPrefix(o.Path, AssetKeyPrefix) || IsVariantKey(o.Path) || IsContentKey(o.Path) {
+			continue
+		}
+		assetPath := strings.TrimPrefix(o.Path, AssetKeyPrefix)
+		if !strings.HasPrefix(assetPath, query.Prefix) {
+			continue
+		}
+		if query.Delimiter != "" {
+			rest := strings.TrimPrefix(assetPath, query.Prefix)
+			if idx := strings.Index(rest, query.Delimiter); idx >= 0 {
+				folders[query.Prefix+rest[:idx+len(query.Delimiter)]] = true
+				continue
+			}
+		}
+		asset := ListedAsset{
+			Path:         assetPath,
+			Size:         o.Size,
+			LastModified: o.LastModified,
+			MimeType:     MimeTypeForPath(assetPath),
+		}
+		if !mimeTypeMatches(query.MimeType, asset.MimeType) {
+			continue
+		}
+		matched = append(matched, asset)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		if query.Descending {
+			return sortsBefore(query.Sort, matched[j], matched[i])
+		}
+		return sortsBefore(query.Sort, matched[i], matched[j])
+	})
+
+	start := 0
+	if after != nil {
+		last := fromCursor(query.Sort, *after)
+		start = sort.Search(len(matched), func(i int) bool {
+			if query.Descending {
+				return sortsBefore(query.Sort, matched[i], last)
+			}
+			return sortsBefore(query.Sort, last, matched[i])
+		})
+	}
+
+	ret := Listing{
+		Assets:  make([]ListedAsset, 0),
+		Folders: make([]string, 0),
+	}
+	end := start + limit
+	if end > len(matched) {
+		end = len(matched)
+	}
+	ret.Assets = append(ret.Assets, matched[start:end]...)
+	if end < len(matched) {
+		ret.NextCursor = toCursor(query.Sort, matched[end-1]).encode()
+	}
+	if after == nil {
+		for f := range folders {
+			ret.Folders = append(ret.Folders, f)
+		}
+		sort.Strings(ret.Folders)
+	}
+	return ret, nil
+}
+
+// WithAliases adds entries for the aliases of content addressed assets to the raw contents of the asset bucket, so they
+// list like any other asset. content holds the objects under ContentKeyPrefix.
+func WithAliases(objects []s3.Object, content []s3.Object, details map[string]Details) []s3.Object {
+	contentObjects := make(map[string]s3.Object)
+	for _, o := range content {
+		contentObjects[strings.TrimPrefix(o.Path, AssetKeyPrefix)] = o
+	}
+	ret := append(make([]s3.Object, 0, len(objects)), objects...)
+	for _, d := range details {
+		if d.ContentPath == "" {
+			continue
+		}
+		target, exists := contentObjects[d.ContentPath]
+		if !exists {
+			continue
+		}
+		ret = append(ret, s3.Object{
+			Path:         AssetKeyPrefix + d.Path,
+			Size:         target.Size,
+			LastModified: d.Upload.Time,
+		})
+	}
+	return ret
+}
+
+func mimeTypeMatches(filter string, mimeType string) bool {
+	if filter == "" {
+		return true
+	}
+	if strings.HasSuffix(filter, "/*") {
+		return strings.HasPrefix(mimeType, strings.TrimSuffix(filter, "*"))
+	}
+	return strings.EqualFold(filter, mimeType)
+}
+
+// sortsBefore orders by the sort field, falling back to path so ordering is total and cursors are stable
+func sortsBefore(sortBy string, a, b ListedAsset) bool {
+	switch sortBy {
+	case SortSize:
+		if a.Size != b.Size {
+			return a.Size < b.Size
+		}
+	case SortModified:
+		if !a.LastModified.Equal(b.LastModified) {
+			return a.LastModified.Before(b.LastModified)
+		}
+	}
+	return a.Path < b.Path
+}
+
+func toCursor(sortBy string, asset ListedAsset) cursor {
+	ret := cursor{Path: asset.Path}
+	switch sortBy {
+	case SortSize:
+		ret.Value = strconv.FormatInt(asset.Size, 10)
+	case SortModified:
+		ret.Value = asset.LastModified.Format(time.RFC3339Nano)
+	}
+	return ret
+}
+
+func fromCursor(sortBy string, c cursor) ListedAsset {
+	ret := ListedAsset{Path: c.Path}
+	// values that don't parse, say from a cursor handed out by a listing sorted differently, are treated as zero
+	switch sortBy {
+	case SortSize:
+		ret.Size, _ = strconv.ParseInt(c.Value, 10, 64)
+	case SortModified:
+		ret.LastModified, _ = time.Parse(time.RFC3339Nano, c.Value)
+	}
+	return ret
+}
@@ -0,0 +1,157 @@
+package assets
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+func testObjects() []s3.Object {
+	base := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	return []s3.Object{
+		{Path: "article-assets/cat.jpg", Size: 300, LastModified: base.Add(time.Hour)},
+		{Path: "article-assets/dog.png", Size: 100, LastModified: base.Add(time.Hour * 3)},
+		{Path: "article-assets/notes.pdf", Size: 200, LastModified: base.Add(time.Hour * 2)},
+		{Path: "article-assets/photos/bird.jpg", Size: 50, LastModified: base},
+		{Path: "article-assets/photos/2021/fish.jpg", Size: 50, LastModified: base},
+		{Path: "article-assets/_variants/cat.jpg/320w.jpg", Size: 10, LastModified: base},
+		{Path: "pending-uploads/123/abc/whatever.jpg", Size: 10, LastModified: base},
+		{Path: "article-assets/_content/abc.jpg", Size: 10, LastModified: base},
+	}
+}
+
+func paths(listing Listing) []string {
+	ret := make([]string, 0)
+	for _, a := range listing.Assets {
+		ret = append(ret, a.Path)
+	}
+	return ret
+}
+
+func TestMimeTypeForPath(t *testing.T) {
+	assert.Equal(t, "image/jpeg", MimeTypeForPath("cats/cat.JPG"))
+	assert.Equal(t, "video/mp4", MimeTypeForPath("clip.mp4"))
+	assert.Equal(t, "", MimeTypeForPath("README"))
+}
+
+func TestList_InvalidCursor(t *testing.T) {
+	for _, c := range []string{"not a cursor!", cursor{}.encode()} {
+		_, err := List(testObjects(), ListQuery{Cursor: c})
+		assert.Equal(t, ErrInvalidCursor, err)
+	}
+}
+
+func TestList(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		query           ListQuery
+		expectedPaths   []string
+		expectedFolders []string
+	}{
+		{
+			"everything",
+			ListQuery{},
+			[]string{"cat.jpg", "dog.png", "notes.pdf", "photos/2021/fish.jpg", "photos/bird.jpg"},
+			[]string{},
+		},
+		{
+			"folders at the top",
+			ListQuery{Delimiter: "/"},
+			[]string{"cat.jpg", "dog.png", "notes.pdf"},
+			[]string{"photos/"},
+		},
+		{
+			"folders within a folder",
+			ListQuery{Prefix: "photos/", Delimiter: "/"},
+			[]string{"photos/bird.jpg"},
+			[]string{"photos/2021/"},
+		},
+		{
+			"mime family",
+			ListQuery{MimeType: "image/*"},
+			[]string{"cat.jpg", "dog.png", "photos/2021/fish.jpg", "photos/bird.jpg"},
+			[]string{},
+		},
+		{
+			"exact mime",
+			ListQuery{MimeType: "application/pdf"},
+			[]string{"notes.pdf"},
+			[]string{},
+		},
+		{
+			"by size",
+			ListQuery{Sort: SortSize},
+			[]string{"photos/2021/fish.jpg", "photos/bird.jpg", "dog.png", "notes.pdf", "cat.jpg"},
+			[]string{},
+		},
+		{
+			"newest first",
+			ListQuery{Sort: SortModified, Descending: true},
+			[]string{"dog.png", "notes.pdf", "cat.jpg", "photos/bird.jpg", "photos/2021/fish.jpg"},
+			[]string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			res, err := List(testObjects(), tc.query)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedPaths, paths(res))
+			assert.Equal(t, tc.expectedFolders, res.Folders)
+			assert.Empty(t, res.NextCursor)
+		})
+	}
+}
+
+func TestList_Paging(t *testing.T) {
+	for _, query := range []ListQuery{
+		{Sort: SortPath},
+		{Sort: SortSize},
+		{Sort: SortModified, Descending: true},
+		{Sort: SortSize, Descending: true, Delimiter: "/"},
+	} {
+		all, err := List(testObjects(), query)
+		assert.NoError(t, err)
+		expected := paths(all)
+		query.Limit = 2
+		actual := make([]string, 0)
+		pages := 0
+		for {
+			page, err := List(testObjects(), query)
+			assert.NoError(t, err)
+			pages++
+			actual = append(actual, paths(page)...)
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+		assert.Equal(t, expected, actual, "sort %s descending %v", query.Sort, query.Descending)
+		assert.Equal(t, (len(expected)+1)/2, pages)
+	}
+}
+
+func TestWithAliases(t *testing.T) {
+	asserter := assert.New(t)
+
+	uploaded := time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)
+	content := []s3.Object{{Path: "article-assets/_content/abc.jpg", Size: 42}}
+	details := map[string]Details{
+		"cats/cat.jpg":     {Path: "cats/cat.jpg", ContentPath: "_content/abc.jpg", Upload: Upload{Time: uploaded}},
+		"gone.jpg":         {Path: "gone.jpg", ContentPath: "_content/def.jpg"},
+		"dog.png":          {Path: "dog.png"},
+		"_content/abc.jpg": {Path: "_content/abc.jpg", Width: 100},
+	}
+	objects := WithAliases(append(testObjects(), content...), content, details)
+
+	res, err := List(objects, ListQuery{Prefix: "cats/"})
+	asserter.NoError(err)
+	asserter.Equal([]ListedAsset{{Path: "cats/cat.jpg", Size: 42, LastModified: uploaded, MimeType: "image/jpeg"}}, res.Assets)
+
+	res, err = List(objects, ListQuery{})
+	asserter.NoError(err)
+	asserter.NotContains(paths(res), "gone.jpg")
+	asserter.NotContains(paths(res), "_content/abc.jpg")
+}
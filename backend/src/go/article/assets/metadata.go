@@ -0,0 +1,86 @@
+package assets
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jonsabados/sabadoscodes.com/auth"
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+)
+
+const (
+	maxAltTextLength = 500
+	maxCaptionLength = 2000
+	maxCreditLength  = 500
+	maxLicenceLength = 200
+)
+
+// Metadata is the descriptive information editors attach to an asset
+type Metadata struct {
+	AltText string
+	Caption string
+	Credit  string
+	Licence string
+}
+
+// Update returns an update that would set every non blank field of m
+func (m Metadata) Update() MetadataUpdate {
+	return MetadataUpdate{
+		AltText: nonBlank(m.AltText),
+		Caption: nonBlank(m.Caption),
+		Credit:  nonBlank(m.Credit),
+		Licence: nonBlank(m.Licence),
+	}
+}
+
+// MetadataUpdate is a change to asset metadata, nil fields are left alone and empty ones are cleared
+type MetadataUpdate struct {
+	AltText *string `json:"altText"`
+	Caption *string `json:"caption"`
+	Credit  *string `json:"credit"`
+	Licence *string `json:"licence"`
+}
+
+// Empty reports if the update wouldn't change anything
+func (m MetadataUpdate) Empty() bool {
+	return m.AltText == nil && m.Caption == nil && m.Credit == nil && m.Licence == nil
+}
+
+// ValidateMetadata adds any problems with the update to errors
+func ValidateMetadata(update MetadataUpdate, errors httputil.ErrorTracker) httputil.ErrorTracker {
+	errors = validateLength(errors, "altText", update.AltText, maxAltTextLength)
+	errors = validateLength(errors, "caption", update.Caption, maxCaptionLength)
+	errors = validateLength(errors, "credit", update.Credit, maxCreditLength)
+	errors = validateLength(errors, "licence", update.Licence, maxLicenceLength)
+	return errors
+}
+
+func validateLength(errors httputil.ErrorTracker, field string, value *string, max int) httputil.ErrorTracker {
+	if value != nil && len([]rune(*value)) > max {
+		return errors.WithFieldError(field, fmt.Sprintf("%s may not be longer than %d characters", field, max))
+	}
+	return errors
+}
+
+// Upload is who uploaded an asset and when
+type Upload struct {
+	UserID string
+	Name   string
+	Time   time.Time
+}
+
+// NewUpload records an upload by principal happening now
+func NewUpload(principal auth.Principal) Upload {
+	return Upload{
+		UserID: principal.UserID,
+		Name:   principal.Name,
+		Time:   time.Now(),
+	}
+}
+
+func nonBlank(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/article/assets"
+	"github.com/jonsabados/sabadoscodes.com/audit"
+	"github.com/jonsabados/sabadoscodes.com/auth"
+	"github.com/jonsabados/sabadoscodes.com/cors"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/response"
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+type metadataDetails struct {
+	Path    string `json:"path"`
+	URL     string `json:"url"`
+	AltText string `json:"altText,omitempty"`
+	Caption string `json:"caption,omitempty"`
+	Credit  string `json:"credit,omitempty"`
+	Licence string `json:"licence,omitempty"`
+}
+
+func newHandler(prepLogs logging.Preparer,
+	corsHeaders cors.ResponseHeaderBuilder,
+	extractPrincipal auth.PrincipalExtractor,
+	authorize auth.RouteAuthorizer,
+	targetBucket string,
+	describeObject s3.ObjectDescriber,
+	fetchDetails assets.DetailsFetcher,
+	updateMetadata assets.MetadataUpdater,
+	recordAudit audit.Recorder,
+	baseAssetURL string) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		ctx, _ = prepLogs(ctx)
+		responseHeaders := corsHeaders(request.Headers)
+
+		principal, err := extractPrincipal(request)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		if !authorize(principal, request) {
+			zerolog.Ctx(ctx).Warn().Interface("user", principal).Msg("user not authorized for route")
+			return response.HandleForbidden(ctx, responseHeaders, "not permitted"), nil
+		}
+
+		errors := httputil.ErrorTracker{}
+		path, err := url.PathUnescape(request.PathParameters["path"])
+		if err != nil {
+			zerolog.Ctx(ctx).Info().Err(err).Msg("invalid path")
+			errors = errors.WithFieldError("path", "invalid path")
+		} else {
+			errors = assets.ValidatePath(errors, "path", path)
+		}
+
+		update := assets.MetadataUpdate{}
+		err = json.Unmarshal([]byte(request.Body), &update)
+		if err != nil {
+			zerolog.Ctx(ctx).Info().Err(err).Msg("unable to unmarshal request body")
+			errors = errors.WithError("invalid request body")
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+		if update.Empty() {
+			errors = errors.WithError("at least one of altText, caption, credit or licence is required")
+		}
+		errors = assets.ValidateMetadata(update, errors)
+		if errors.InError() {
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		key := assets.AssetKeyPrefix + path
+		info, err := describeObject(ctx, targetBucket, key)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		existing, err := fetchDetails(ctx, path)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		// aliases of content addressed assets have no object of their own
+		if info == nil && (existing == nil || existing.ContentPath == "") {
+			return response.HandleNtFound(ctx, responseHeaders), nil
+		}
+		before := assets.Metadata{}
+		if existing != nil {
+			before = existing.Metadata
+		}
+
+		zerolog.Ctx(ctx).Info().Interface("user", principal).Str("path", path).Msg("user updating asset metadata")
+		updated, err := updateMetadata(ctx, path, update)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		auditEntry := audit.NewEntry(ctx, principal, audit.ActionAssetMetadata, key)
+		auditEntry.BeforeHash, err = hashMetadata(before)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		auditEntry.AfterHash, err = hashMetadata(updated.Metadata)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		// the metadata is already saved, failing now would only have the client retry a change that was applied
+		err = recordAudit(ctx, auditEntry)
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Stack().Err(err).Interface("auditEntry", auditEntry).Msg("error recording audit entry for asset metadata")
+		}
+
+		urlPath := path
+		if updated.ContentPath != "" {
+			urlPath = updated.ContentPath
+		}
+		responseBody, err := json.Marshal(metadataDetails{
+			Path:    path,
+			URL:     fmt.Sprintf("%s/%s", baseAssetURL, urlPath),
+			AltText: updated.Metadata.AltText,
+			Caption: updated.Metadata.Caption,
+			Credit:  updated.Metadata.Credit,
+			Licence: updated.Metadata.Licence,
+		})
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		responseHeaders["content-type"] = "application/json"
+
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusOK,
+			Headers:    responseHeaders,
+			Body:       string(responseBody),
+		}, nil
+	}
+}
+
+func hashMetadata(metadata assets.Metadata) (string, error) {
+	content, err := json.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+	return audit.Hash(content), nil
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	allowedDomains := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
+	targetBucket := os.Getenv("ASSET_BUCKET")
+	baseAssetURL := os.Getenv("BASE_ASSET_URL")
+	assetTable := os.Getenv("ASSET_TABLE")
+	auditTable := os.Getenv("AUDIT_TABLE")
+
+	routes, err := auth.ParseRouteTable([]byte(os.Getenv("ROUTE_TABLE")))
+	if err != nil {
+		panic(err)
+	}
+
+	dynamoClient := dynamo.RawClient(sess)
+
+	handler := newHandler(logging.NewPreparer(),
+		cors.NewResponseHeaderBuilder(allowedDomains),
+		auth.NewPrincipalExtractor(),
+		auth.NewRouteAuthorizer(routes),
+		targetBucket,
+		s3.NewObjectDescriber(s3.RawClient(sess)),
+		assets.NewDetailsFetcher(dynamoClient, assetTable),
+		assets.NewMetadataUpdater(dynamoClient, assetTable),
+		audit.NewRecorder(dynamoClient, auditTable),
+		baseAssetURL)
+
+	lambda.Start(handler)
+}
@@ -0,0 +1,37 @@
+package assets
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+)
+
+func TestValidateMetadata(t *testing.T) {
+	asserter := assert.New(t)
+
+	errors := ValidateMetadata(MetadataUpdate{
+		AltText: aws.String("a cat"),
+		Caption: aws.String(strings.Repeat("ü", maxCaptionLength)),
+		Licence: aws.String(""),
+	}, httputil.ErrorTracker{})
+	asserter.False(errors.InError())
+
+	errors = ValidateMetadata(MetadataUpdate{
+		AltText: aws.String(strings.Repeat("a", maxAltTextLength+1)),
+		Credit:  aws.String(strings.Repeat("a", maxCreditLength+1)),
+	}, httputil.ErrorTracker{})
+	asserter.True(errors.InError())
+}
+
+func TestMetadata_Update(t *testing.T) {
+	asserter := assert.New(t)
+
+	update := Metadata{AltText: "a cat", Licence: "CC-BY"}.Update()
+	asserter.Equal(MetadataUpdate{AltText: aws.String("a cat"), Licence: aws.String("CC-BY")}, update)
+	asserter.False(update.Empty())
+	asserter.True(Metadata{}.Update().Empty())
+}
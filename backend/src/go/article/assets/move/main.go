@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/article/assets"
+	"github.com/jonsabados/sabadoscodes.com/article/references"
+	"github.com/jonsabados/sabadoscodes.com/audit"
+	"github.com/jonsabados/sabadoscodes.com/auth"
+	"github.com/jonsabados/sabadoscodes.com/cors"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/response"
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+type inboundRequest struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Force bool   `json:"force"`
+}
+
+func newHandler(prepLogs logging.Preparer,
+	corsHeaders cors.ResponseHeaderBuilder,
+	extractPrincipal auth.PrincipalExtractor,
+	authorize auth.RouteAuthorizer,
+	targetBucket string,
+	describeObject s3.ObjectDescriber,
+	fetchObject s3.ObjectFetcher,
+	copyObject s3.PublicObjectCopier,
+	findReferences references.Finder,
+	fetchDetails assets.DetailsFetcher,
+	recordUpload assets.UploadRecorder,
+	removeAsset assets.Remover,
+	recordAudit audit.Recorder,
+	baseAssetURL string) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		ctx, _ = prepLogs(ctx)
+		responseHeaders := corsHeaders(request.Headers)
+
+		principal, err := extractPrincipal(request)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		if !authorize(principal, request) {
+			zerolog.Ctx(ctx).Warn().Interface("user", principal).Msg("user not authorized for route")
+			return response.HandleForbidden(ctx, responseHeaders, "not permitted"), nil
+		}
+
+		errors := httputil.ErrorTracker{}
+		moveRequest := new(inboundRequest)
+		err = json.Unmarshal([]byte(request.Body), moveRequest)
+		if err != nil {
+			zerolog.Ctx(ctx).Info().Err(err).Msg("unable to unmarshal request body")
+			errors = errors.WithError("invalid request body")
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		moveRequest.To = assets.NormalizePath(moveRequest.To)
+		errors = assets.ValidatePath(errors, "from", moveRequest.From)
+		errors = assets.ValidateNewPath(errors, "to", moveRequest.To)
+		if moveRequest.To == moveRequest.From {
+			errors = errors.WithFieldError("to", "to must be different than from")
+		}
+		if errors.InError() {
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		fromKey := assets.AssetKeyPrefix + moveRequest.From
+		toKey := assets.AssetKeyPrefix + moveRequest.To
+
+		info, err := describeObject(ctx, targetBucket, fromKey)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		details, err := fetchDetails(ctx, moveRequest.From)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		isAlias := info == nil && details != nil && details.ContentPath != ""
+		if info == nil && !isAlias {
+			return response.HandleNtFound(ctx, responseHeaders), nil
+		}
+
+		existing, err := describeObject(ctx, targetBucket, toKey)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		existingDetails, err := fetchDetails(ctx, moveRequest.To)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		if existing != nil || (existingDetails != nil && existingDetails.ContentPath != "") {
+			return response.HandleConflict(ctx, responseHeaders, fmt.Sprintf("an asset already exists at %s", moveRequest.To), nil), nil
+		}
+
+		if isAlias {
+			// articles link to the content itself, so moving an alias can't break anything and nothing needs copying
+			zerolog.Ctx(ctx).Info().Interface("user", principal).Str("from", moveRequest.From).Str("to", moveRequest.To).Msg("user moving asset alias")
+			err = recordUpload(ctx, moveRequest.To, details.ContentPath, details.Upload, details.Metadata.Update())
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+			err = removeAsset(ctx, targetBucket, moveRequest.From)
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+			// the move has already happened, so an audit failure is logged in full rather than failing the request
+			auditEntry := audit.NewEntry(ctx, principal, audit.ActionAssetMove, fmt.Sprintf("%s -> %s", fromKey, toKey))
+			err = recordAudit(ctx, auditEntry)
+			if err != nil {
+				zerolog.Ctx(ctx).Error().Stack().Err(err).Interface("auditEntry", auditEntry).Msg("error recording audit entry for moved asset")
+			}
+			responseHeaders["Location"] = fmt.Sprintf("%s/%s", baseAssetURL, details.ContentPath)
+			return events.APIGatewayProxyResponse{
+				StatusCode: http.StatusCreated,
+				Headers:    responseHeaders,
+			}, nil
+		}
+
+		referencedBy, err := findReferences(ctx, moveRequest.From)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		if len(referencedBy) > 0 {
+			if !moveRequest.Force {
+				return response.HandleConflict(ctx, responseHeaders, "asset is referenced by articles, set force to move it anyway", referencedBy), nil
+			}
+			zerolog.Ctx(ctx).Warn().Strs("articles", referencedBy).Str("path", moveRequest.From).Msg("force moving referenced asset")
+		}
+
+		content, err := fetchObject(ctx, targetBucket, fromKey)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		contentHash, err := audit.HashReader(content)
+		_ = content.Close()
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		zerolog.Ctx(ctx).Info().Interface("user", principal).Str("from", moveRequest.From).Str("to", moveRequest.To).Msg("user moving asset")
+		// variants are regenerated for the new location by the asset processor
+		err = copyObject(ctx, targetBucket, fromKey, toKey, info.ContentType, assets.CacheDuration)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		// removing the asset takes its details with it, so carry over what isn't regenerated
+		if details != nil {
+			err = recordUpload(ctx, moveRequest.To, "", details.Upload, details.Metadata.Update())
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+		}
+		err = removeAsset(ctx, targetBucket, moveRequest.From)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		auditEntry := audit.NewEntry(ctx, principal, audit.ActionAssetMove, fmt.Sprintf("%s -> %s", fromKey, toKey))
+		auditEntry.BeforeHash = contentHash
+		auditEntry.AfterHash = contentHash
+		err = recordAudit(ctx, auditEntry)
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Stack().Err(err).Interface("auditEntry", auditEntry).Msg("error recording audit entry for moved asset")
+		}
+
+		responseHeaders["Location"] = fmt.Sprintf("%s/%s", baseAssetURL, moveRequest.To)
+
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusCreated,
+			Headers:    responseHeaders,
+		}, nil
+	}
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	allowedDomains := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
+	targetBucket := os.Getenv("ASSET_BUCKET")
+	baseAssetURL := os.Getenv("BASE_ASSET_URL")
+	assetTable := os.Getenv("ASSET_TABLE")
+	auditTable := os.Getenv("AUDIT_TABLE")
+	referenceTable := os.Getenv("REFERENCE_TABLE")
+
+	routes, err := auth.ParseRouteTable([]byte(os.Getenv("ROUTE_TABLE")))
+	if err != nil {
+		panic(err)
+	}
+
+	s3Client := s3.RawClient(sess)
+	dynamoClient := dynamo.RawClient(sess)
+
+	remover := assets.NewRemover(s3.NewObjectLister(s3Client), s3.NewObjectRemover(s3Client), assets.NewDetailsRemover(dynamoClient, assetTable))
+
+	handler := newHandler(logging.NewPreparer(),
+		cors.NewResponseHeaderBuilder(allowedDomains),
+		auth.NewPrincipalExtractor(),
+		auth.NewRouteAuthorizer(routes),
+		targetBucket,
+		s3.NewObjectDescriber(s3Client),
+		s3.NewObjectFetcher(s3Client),
+		s3.NewPublicObjectCopier(s3Client),
+		references.NewFinder(dynamoClient, referenceTable, s3.NewObjectLister(s3Client), targetBucket),
+		assets.NewDetailsFetcher(dynamoClient, assetTable),
+		assets.NewUploadRecorder(dynamoClient, assetTable),
+		remover,
+		audit.NewRecorder(dynamoClient, auditTable),
+		baseAssetURL)
+
+	lambda.Start(handler)
+}
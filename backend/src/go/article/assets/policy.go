@@ -0,0 +1,135 @@
+package assets
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+)
+
+const (
+	kilobyte = 1024
+	megabyte = 1024 * kilobyte
+)
+
+// TypeRule allows uploads of a mime type, either exact or a family such as video/*, up to a size
+type TypeRule struct {
+	MimeType string
+	MaxSize  int64
+}
+
+// Policy is what may be uploaded, rules are checked in order with the first matching rule winning
+type Policy struct {
+	Rules []TypeRule
+}
+
+// DefaultPolicy allows the common web image formats, PDFs and video
+var DefaultPolicy = Policy{
+	Rules: []TypeRule{
+		{MimeType: MimeTypeSVG, MaxSize: megabyte},
+		{MimeType: "image/png", MaxSize: 20 * megabyte},
+		{MimeType: "image/jpeg", MaxSize: 20 * megabyte},
+		{MimeType: "image/gif", MaxSize: 20 * megabyte},
+		{MimeType: "image/webp", MaxSize: 20 * megabyte},
+		{MimeType: "application/pdf", MaxSize: 50 * megabyte},
+		{MimeType: "video/mp4", MaxSize: MaxUploadSize},
+		{MimeType: "video/webm", MaxSize: MaxUploadSize},
+	},
+}
+
+// ParsePolicy reads a policy from a comma separated list of mimeType=size entries, where size is a number of bytes
+// optionally suffixed with KB or MB. A blank spec gives DefaultPolicy. Sizes are capped at MaxUploadSize.
+func ParsePolicy(spec string) (Policy, error) {
+	if strings.TrimSpace(spec) == "" {
+		return DefaultPolicy, nil
+	}
+	ret := Policy{Rules: make([]TypeRule, 0)}
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), "=")
+		if len(parts) != 2 || !strings.Contains(parts[0], "/") {
+			return Policy{}, errors.Errorf("invalid asset type entry %q", entry)
+		}
+		size, err := parseSize(parts[1])
+		if err != nil {
+			return Policy{}, err
+		}
+		if size > MaxUploadSize {
+			size = MaxUploadSize
+		}
+		ret.Rules = append(ret.Rules, TypeRule{
+			MimeType: strings.ToLower(strings.TrimSpace(parts[0])),
+			MaxSize:  size,
+		})
+	}
+	return ret, nil
+}
+
+func parseSize(raw string) (int64, error) {
+	raw = strings.ToUpper(strings.TrimSpace(raw))
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(raw, "MB"):
+		multiplier = megabyte
+		raw = strings.TrimSuffix(raw, "MB")
+	case strings.HasSuffix(raw, "KB"):
+		multiplier = kilobyte
+		raw = strings.TrimSuffix(raw, "KB")
+	}
+	ret, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+	if err != nil || ret <= 0 {
+		return 0, errors.Errorf("invalid size %q", raw)
+	}
+	return ret * multiplier, nil
+}
+
+// MaxSize returns the largest allowed upload of the type, and false if the type isn't allowed at all
+func (p Policy) MaxSize(mimeType string) (int64, bool) {
+	mimeType = baseMimeType(mimeType)
+	for _, r := range p.Rules {
+		if mimeTypeMatches(r.MimeType, mimeType) {
+			return r.MaxSize, true
+		}
+	}
+	return 0, false
+}
+
+// Capped gives the policy with no type allowed to be bigger than maxSize
+func (p Policy) Capped(maxSize int64) Policy {
+	ret := Policy{Rules: make([]TypeRule, len(p.Rules))}
+	for i, r := range p.Rules {
+		if r.MaxSize > maxSize {
+			r.MaxSize = maxSize
+		}
+		ret.Rules[i] = r
+	}
+	return ret
+}
+
+// Validate adds any problems with uploading size bytes of mimeType to errors
+func (p Policy) Validate(mimeType string, size int64, errors httputil.ErrorTracker) httputil.ErrorTracker {
+	if mimeType == "" {
+		return errors.WithFieldError("mimeType", "mimeType is required")
+	}
+	maxSize, allowed := p.MaxSize(mimeType)
+	if !allowed {
+		return errors.WithFieldError("mimeType", fmt.Sprintf("%s uploads are not allowed", mimeType))
+	}
+	if size <= 0 {
+		return errors.WithFieldError("size", "size is required")
+	}
+	if size > maxSize {
+		return errors.WithFieldError("size", fmt.Sprintf("%s uploads may not exceed %d bytes", baseMimeType(mimeType), maxSize))
+	}
+	return errors
+}
+
+// baseMimeType drops any parameters and normalizes case, so text/plain; charset=utf-8 is just text/plain
+func baseMimeType(mimeType string) string {
+	if semi := strings.Index(mimeType, ";"); semi >= 0 {
+		mimeType = mimeType[:semi]
+	}
+	return strings.ToLower(strings.TrimSpace(mimeType))
+}
@@ -0,0 +1,90 @@
+package assets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+)
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy(" image/png=2MB, video/*=500kb ,application/pdf=1234, image/gif=1000MB")
+	assert.NoError(t, err)
+	assert.Equal(t, Policy{Rules: []TypeRule{
+		{MimeType: "image/png", MaxSize: 2 * 1024 * 1024},
+		{MimeType: "video/*", MaxSize: 500 * 1024},
+		{MimeType: "application/pdf", MaxSize: 1234},
+		{MimeType: "image/gif", MaxSize: MaxUploadSize},
+	}}, policy)
+}
+
+func TestParsePolicyBlank(t *testing.T) {
+	policy, err := ParsePolicy("  ")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultPolicy, policy)
+}
+
+func TestParsePolicyInvalid(t *testing.T) {
+	for _, spec := range []string{"image/png", "png=1MB", "image/png=big", "image/png=-1", "image/png=0", "image/png=1MB,"} {
+		t.Run(spec, func(t *testing.T) {
+			_, err := ParsePolicy(spec)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	policy := Policy{Rules: []TypeRule{
+		{MimeType: "image/svg+xml", MaxSize: 100},
+		{MimeType: "image/*", MaxSize: 1000},
+	}}
+	testCases := []struct {
+		name     string
+		mimeType string
+		size     int64
+		valid    bool
+	}{
+		{"exact match", "image/svg+xml", 100, true},
+		{"exact match too big", "image/svg+xml", 101, false},
+		{"family match", "image/png", 1000, true},
+		{"family match with parameters", "IMAGE/PNG; foo=bar", 1000, true},
+		{"family match too big", "image/png", 1001, false},
+		{"not allowed", "application/pdf", 1, false},
+		{"no type", "", 1, false},
+		{"no size", "image/png", 0, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.valid, !policy.Validate(tc.mimeType, tc.size, httputil.ErrorTracker{}).InError())
+		})
+	}
+}
+
+func TestDefaultPolicy(t *testing.T) {
+	size, allowed := DefaultPolicy.MaxSize(MimeTypeSVG)
+	assert.True(t, allowed)
+	assert.Equal(t, int64(1024*1024), size)
+
+	_, allowed = DefaultPolicy.MaxSize("text/html")
+	assert.False(t, allowed)
+	_, allowed = DefaultPolicy.MaxSize("application/javascript")
+	assert.False(t, allowed)
+}
+
+func TestPolicyCapped(t *testing.T) {
+	asserter := assert.New(t)
+	capped := DefaultPolicy.Capped(25 * megabyte)
+
+	size, allowed := capped.MaxSize("video/mp4")
+	asserter.True(allowed)
+	asserter.Equal(int64(25*megabyte), size)
+	size, _ = capped.MaxSize(MimeTypeSVG)
+	asserter.Equal(int64(megabyte), size)
+	_, allowed = capped.MaxSize("text/html")
+	asserter.False(allowed)
+
+	// the original is left alone
+	size, _ = DefaultPolicy.MaxSize("video/mp4")
+	asserter.Equal(int64(MaxUploadSize), size)
+}
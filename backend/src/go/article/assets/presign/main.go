@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/article/assets"
+	"github.com/jonsabados/sabadoscodes.com/auth"
+	"github.com/jonsabados/sabadoscodes.com/cors"
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/response"
+	"github.com/jonsabados/sabadoscodes.com/s3"
+	"github.com/jonsabados/sabadoscodes.com/scan"
+)
+
+const uploadURLLifetime = time.Minute * 15
+
+type inboundRequest struct {
+	Path     string `json:"path"`
+	MimeType string `json:"mimeType"`
+	Size     int64  `json:"size"`
+}
+
+type uploadDetails struct {
+	UploadID string            `json:"uploadId"`
+	URL      string            `json:"url"`
+	Method   string            `json:"method"`
+	Headers  map[string]string `json:"headers"`
+	Expires  time.Time         `json:"expires"`
+}
+
+func newHandler(prepLogs logging.Preparer,
+	corsHeaders cors.ResponseHeaderBuilder,
+	extractPrincipal auth.PrincipalExtractor,
+	authorize auth.RouteAuthorizer,
+	targetBucket string,
+	policy assets.Policy,
+	presignPut s3.PresignedPutCreator) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		ctx, _ = prepLogs(ctx)
+		responseHeaders := corsHeaders(request.Headers)
+
+		principal, err := extractPrincipal(request)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		if !authorize(principal, request) {
+			zerolog.Ctx(ctx).Warn().Interface("user", principal).Msg("user not authorized for route")
+			return response.HandleForbidden(ctx, responseHeaders, "not permitted"), nil
+		}
+
+		errors := httputil.ErrorTracker{}
+		uploadRequest := new(inboundRequest)
+		err = json.Unmarshal([]byte(request.Body), uploadRequest)
+		if err != nil {
+			zerolog.Ctx(ctx).Info().Err(err).Msg("unable to unmarshal request body")
+			errors = errors.WithError("invalid request body")
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		uploadRequest.Path = assets.NormalizePath(uploadRequest.Path)
+		errors = assets.ValidateNewPath(errors, "path", uploadRequest.Path)
+		errors = policy.Validate(uploadRequest.MimeType, uploadRequest.Size, errors)
+
+		if errors.InError() {
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		uploadID, err := newUploadID()
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		// the object lands in a private pending location, it is only published once the upload is completed
+		key := assets.PendingUploadPrefix(principal.UserID, uploadID) + uploadRequest.Path
+		zerolog.Ctx(ctx).Info().Interface("user", principal).Str("key", key).Msg("user starting direct upload")
+		presigned, err := presignPut(ctx, targetBucket, key, uploadRequest.MimeType, uploadRequest.Size, uploadURLLifetime)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		responseBody, err := json.Marshal(uploadDetails{
+			UploadID: uploadID,
+			URL:      presigned.URL,
+			Method:   presigned.Method,
+			Headers:  presigned.Headers,
+			Expires:  presigned.Expires,
+		})
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		responseHeaders["content-type"] = "application/json"
+
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusCreated,
+			Headers:    responseHeaders,
+			Body:       string(responseBody),
+		}, nil
+	}
+}
+
+func newUploadID() (string, error) {
+	ret := make([]byte, 16)
+	_, err := rand.Read(ret)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(ret), nil
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	allowedDomains := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
+	targetBucket := os.Getenv("ASSET_BUCKET")
+
+	routes, err := auth.ParseRouteTable([]byte(os.Getenv("ROUTE_TABLE")))
+	if err != nil {
+		panic(err)
+	}
+
+	policy, err := assets.ParsePolicy(os.Getenv("ALLOWED_ASSET_TYPES"))
+	if err != nil {
+		panic(err)
+	}
+	clamAVAddress := os.Getenv("CLAMAV_ADDRESS")
+	if scan.Enabled(clamAVAddress) {
+		// clamd won't take anything over its stream limit, so nothing bigger may be uploaded while scanning is on
+		policy = policy.Capped(scan.MaxStreamLength)
+	}
+
+	s3Client := s3.RawClient(sess)
+
+	handler := newHandler(logging.NewPreparer(), cors.NewResponseHeaderBuilder(allowedDomains), auth.NewPrincipalExtractor(), auth.NewRouteAuthorizer(routes), targetBucket, policy, s3.NewPresignedPutCreator(s3Client))
+
+	lambda.Start(handler)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/article/assets"
+	"github.com/jonsabados/sabadoscodes.com/article/assets/imaging"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+func newHandler(prepLogs logging.Preparer, process imaging.Processor) func(ctx context.Context, event events.S3Event) error {
+	return func(ctx context.Context, event events.S3Event) error {
+		ctx, logger := prepLogs(ctx)
+		for _, r := range event.Records {
+			// keys in s3 events are url encoded
+			key, err := url.QueryUnescape(r.S3.Object.Key)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			logger.Info().Str("bucket", r.S3.Bucket.Name).Str("key", key).Msg("processing asset")
+			err = process(ctx, r.S3.Bucket.Name, key)
+			if err != nil {
+				zerolog.Ctx(ctx).Error().Err(err).Str("key", key).Msg("error processing asset")
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	assetTable := os.Getenv("ASSET_TABLE")
+
+	s3Client := s3.RawClient(sess)
+	dynamoClient := dynamo.RawClient(sess)
+
+	processor := imaging.NewProcessor(s3.NewObjectDescriber(s3Client),
+		s3.NewObjectFetcher(s3Client),
+		s3.NewPublicObjectSaver(s3Client),
+		assets.NewDetailsFetcher(dynamoClient, assetTable),
+		assets.NewProcessingRecorder(dynamoClient, assetTable))
+
+	lambda.Start(newHandler(logging.NewPreparer(), processor))
+}
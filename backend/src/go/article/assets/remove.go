@@ -0,0 +1,44 @@
+package assets
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+// ReferencePaths are the paths (relative to AssetKeyPrefix) an article making use of the asset at path would reference,
+// either directly or through one of its variants (objects listed under VariantKeyPrefix+path+"/")
+func ReferencePaths(path string, variants []s3.Object) []string {
+	ret := []string{path}
+	for _, v := range variants {
+		ret = append(ret, strings.TrimPrefix(v.Path, AssetKeyPrefix))
+	}
+	return ret
+}
+
+// Remover removes an asset along with its variants and details
+type Remover func(ctx context.Context, bucket string, path string) error
+
+func NewRemover(listObjects s3.ObjectLister, removeObject s3.ObjectRemover, removeDetails DetailsRemover) Remover {
+	return func(ctx context.Context, bucket string, path string) error {
+		variants, err := listObjects(ctx, bucket, VariantKeyPrefix+path+"/")
+		if err != nil {
+			return err
+		}
+		err = removeObject(ctx, bucket, AssetKeyPrefix+path)
+		if err != nil {
+			return err
+		}
+		for _, v := range variants {
+			err = removeObject(ctx, bucket, v.Path)
+			if err != nil {
+				return err
+			}
+		}
+		zerolog.Ctx(ctx).Info().Str("path", path).Int("variantCount", len(variants)).Msg("asset removed")
+		return removeDetails(ctx, path)
+	}
+}
@@ -0,0 +1,63 @@
+package assets
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+func TestReferencePaths(t *testing.T) {
+	variants := []s3.Object{
+		{Path: "article-assets/_variants/cat.jpg/320w.jpg"},
+		{Path: "article-assets/_variants/cat.jpg/320w.webp"},
+	}
+	assert.Equal(t, []string{"cat.jpg", "_variants/cat.jpg/320w.jpg", "_variants/cat.jpg/320w.webp"}, ReferencePaths("cat.jpg", variants))
+	assert.Equal(t, []string{"cat.jpg"}, ReferencePaths("cat.jpg", nil))
+}
+
+func TestNewRemover(t *testing.T) {
+	asserter := assert.New(t)
+
+	objects := map[string]bool{
+		"article-assets/cat.jpg":                        true,
+		"article-assets/cat.jpg.bak":                    true,
+		"article-assets/_variants/cat.jpg/320w.jpg":     true,
+		"article-assets/_variants/cat.jpg/320w.webp":    true,
+		"article-assets/_variants/cat.jpg.bak/320w.jpg": true,
+	}
+	listObjects := func(ctx context.Context, bucket string, prefix string) ([]s3.Object, error) {
+		asserter.Equal("bucket", bucket)
+		ret := make([]s3.Object, 0)
+		for k := range objects {
+			if strings.HasPrefix(k, prefix) {
+				ret = append(ret, s3.Object{Path: k})
+			}
+		}
+		return ret, nil
+	}
+	removeObject := func(ctx context.Context, bucket, object string) error {
+		delete(objects, object)
+		return nil
+	}
+	removedDetails := make([]string, 0)
+	removeDetails := func(ctx context.Context, path string) error {
+		removedDetails = append(removedDetails, path)
+		return nil
+	}
+
+	err := NewRemover(listObjects, removeObject, removeDetails)(context.Background(), "bucket", "cat.jpg")
+	asserter.NoError(err)
+
+	remaining := make([]string, 0)
+	for k := range objects {
+		remaining = append(remaining, k)
+	}
+	sort.Strings(remaining)
+	asserter.Equal([]string{"article-assets/_variants/cat.jpg.bak/320w.jpg", "article-assets/cat.jpg.bak"}, remaining)
+	asserter.Equal([]string{"cat.jpg"}, removedDetails)
+}
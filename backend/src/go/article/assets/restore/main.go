@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/article/assets"
+	"github.com/jonsabados/sabadoscodes.com/audit"
+	"github.com/jonsabados/sabadoscodes.com/auth"
+	"github.com/jonsabados/sabadoscodes.com/cors"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/response"
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+type inboundRequest struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+}
+
+func newHandler(prepLogs logging.Preparer,
+	corsHeaders cors.ResponseHeaderBuilder,
+	extractPrincipal auth.PrincipalExtractor,
+	authorize auth.RouteAuthorizer,
+	targetBucket string,
+	describeObject s3.ObjectDescriber,
+	fetchObject s3.ObjectFetcher,
+	copyObject s3.PublicObjectCopier,
+	fetchDetails assets.DetailsFetcher,
+	keepVersion assets.VersionKeeper,
+	recordUpload assets.UploadRecorder,
+	recordAudit audit.Recorder,
+	baseAssetURL string) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		ctx, _ = prepLogs(ctx)
+		responseHeaders := corsHeaders(request.Headers)
+
+		principal, err := extractPrincipal(request)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		if !authorize(principal, request) {
+			zerolog.Ctx(ctx).Warn().Interface("user", principal).Msg("user not authorized for route")
+			return response.HandleForbidden(ctx, responseHeaders, "not permitted"), nil
+		}
+
+		errors := httputil.ErrorTracker{}
+		restoreRequest := new(inboundRequest)
+		err = json.Unmarshal([]byte(request.Body), restoreRequest)
+		if err != nil {
+			zerolog.Ctx(ctx).Info().Err(err).Msg("unable to unmarshal request body")
+			errors = errors.WithError("invalid request body")
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		errors = assets.ValidatePath(errors, "path", restoreRequest.Path)
+		if !assets.ValidVersionID(restoreRequest.Version) {
+			errors = errors.WithFieldError("version", "invalid version")
+		}
+		if errors.InError() {
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		versionKey := assets.VersionKey(restoreRequest.Path, restoreRequest.Version)
+		version, err := describeObject(ctx, targetBucket, versionKey)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		if version == nil {
+			return response.HandleNtFound(ctx, responseHeaders), nil
+		}
+
+		key := assets.AssetKeyPrefix + restoreRequest.Path
+		existing, err := describeObject(ctx, targetBucket, key)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		existingDetails, err := fetchDetails(ctx, restoreRequest.Path)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		replacing := existing != nil || (existingDetails != nil && existingDetails.ContentPath != "")
+
+		content, err := fetchObject(ctx, targetBucket, versionKey)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		contentHash, err := audit.HashReader(content)
+		_ = content.Close()
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		zerolog.Ctx(ctx).Info().Interface("user", principal).Str("path", restoreRequest.Path).Str("version", restoreRequest.Version).Msg("user restoring asset version")
+		// restoring is itself an overwrite, so keep what is being replaced to allow undoing it
+		if existing != nil {
+			_, err = keepVersion(ctx, targetBucket, restoreRequest.Path)
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+		}
+		// variants are regenerated for the restored content by the asset processor
+		err = copyObject(ctx, targetBucket, versionKey, key, version.ContentType, assets.CacheDuration)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		// metadata is left as it is, but the path stops being an alias if it was one
+		err = recordUpload(ctx, restoreRequest.Path, "", assets.NewUpload(principal), assets.MetadataUpdate{})
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		auditEntry := audit.NewEntry(ctx, principal, audit.ActionAssetRestore, key)
+		auditEntry.AfterHash = contentHash
+		// the restore has already happened, failing now would only have the client retry a change that was applied
+		err = recordAudit(ctx, auditEntry)
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Stack().Err(err).Interface("auditEntry", auditEntry).Msg("error recording audit entry for restored asset")
+		}
+
+		responseHeaders["Location"] = fmt.Sprintf("%s/%s", baseAssetURL, restoreRequest.Path)
+
+		responseCode := http.StatusCreated
+		if replacing {
+			responseCode = http.StatusOK
+		}
+		return events.APIGatewayProxyResponse{
+			StatusCode: responseCode,
+			Headers:    responseHeaders,
+		}, nil
+	}
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	allowedDomains := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
+	targetBucket := os.Getenv("ASSET_BUCKET")
+	baseAssetURL := os.Getenv("BASE_ASSET_URL")
+	auditTable := os.Getenv("AUDIT_TABLE")
+	assetTable := os.Getenv("ASSET_TABLE")
+
+	routes, err := auth.ParseRouteTable([]byte(os.Getenv("ROUTE_TABLE")))
+	if err != nil {
+		panic(err)
+	}
+
+	s3Client := s3.RawClient(sess)
+	dynamoClient := dynamo.RawClient(sess)
+
+	handler := newHandler(logging.NewPreparer(),
+		cors.NewResponseHeaderBuilder(allowedDomains),
+		auth.NewPrincipalExtractor(),
+		auth.NewRouteAuthorizer(routes),
+		targetBucket,
+		s3.NewObjectDescriber(s3Client),
+		s3.NewObjectFetcher(s3Client),
+		s3.NewPublicObjectCopier(s3Client),
+		assets.NewDetailsFetcher(dynamoClient, assetTable),
+		assets.NewVersionKeeper(s3.NewObjectCopier(s3Client)),
+		assets.NewUploadRecorder(dynamoClient, assetTable),
+		audit.NewRecorder(dynamoClient, auditTable),
+		baseAssetURL)
+
+	lambda.Start(handler)
+}
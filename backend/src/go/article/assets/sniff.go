@@ -0,0 +1,71 @@
+package assets
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+)
+
+const MimeTypeSVG = "image/svg+xml"
+
+// SniffLength is how much of the start of the content Sniff needs to see
+const SniffLength = 512
+
+// equivalentTypes covers declared types that sniffing reports under another name
+var equivalentTypes = map[string]string{
+	"audio/wav":       "audio/wave",
+	"audio/x-wav":     "audio/wave",
+	"audio/ogg":       "application/ogg",
+	"video/ogg":       "application/ogg",
+	"audio/mp4":       "video/mp4",
+	"image/jpg":       "image/jpeg",
+	"image/pjpeg":     "image/jpeg",
+	"video/x-msvideo": "video/avi",
+}
+
+// Sniff works out what the content is from its first bytes, the way a browser would, with some help for types
+// browsers don't sniff. Anything unrecognised is application/octet-stream.
+func Sniff(head []byte) string {
+	if len(head) > SniffLength {
+		head = head[:SniffLength]
+	}
+	// iso base media files (mp4, quicktime and friends) have the brand after a box size
+	if len(head) >= 12 && bytes.Equal(head[4:8], []byte("ftyp")) && bytes.Equal(head[8:10], []byte("qt")) {
+		return "video/quicktime"
+	}
+	sniffed := baseMimeType(http.DetectContentType(head))
+	// svg is xml as far as the standard sniffing rules go, so look for the root element
+	if sniffed == "text/xml" || sniffed == "text/plain" {
+		if looksLikeSVG(head) {
+			return MimeTypeSVG
+		}
+	}
+	return sniffed
+}
+
+func looksLikeSVG(head []byte) bool {
+	lower := bytes.ToLower(head)
+	// the root element may come after an xml declaration, comments or a doctype
+	return bytes.Contains(lower, []byte("<svg")) && !bytes.Contains(lower, []byte("<html"))
+}
+
+// ValidateContent adds a problem to errors if the content doesn't look like the type it was declared to be. head is
+// the start of the content, at least SniffLength bytes of it when there is that much.
+func ValidateContent(declaredType string, head []byte, errors httputil.ErrorTracker) httputil.ErrorTracker {
+	declared := baseMimeType(declaredType)
+	if equivalent, exists := equivalentTypes[declared]; exists {
+		declared = equivalent
+	}
+	sniffed := Sniff(head)
+	if sniffed != declared {
+		return errors.WithFieldError("content", fmt.Sprintf("content looks like %s rather than %s", sniffed, baseMimeType(declaredType)))
+	}
+	return errors
+}
+
+// IsSVG reports if the mime type is svg, which needs sanitising before it can be published
+func IsSVG(mimeType string) bool {
+	return baseMimeType(mimeType) == MimeTypeSVG
+}
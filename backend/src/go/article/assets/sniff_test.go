@@ -0,0 +1,57 @@
+package assets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestSniff(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  []byte
+		expected string
+	}{
+		{"png", pngHeader, "image/png"},
+		{"jpeg", []byte("\xff\xd8\xff\xe0\x00\x10JFIF"), "image/jpeg"},
+		{"pdf", []byte("%PDF-1.7\n"), "application/pdf"},
+		{"mp4", []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"), "video/mp4"},
+		{"quicktime", []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00qt  "), "video/quicktime"},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), MimeTypeSVG},
+		{"svg with declaration", []byte(`<?xml version="1.0"?><!-- hi --><svg></svg>`), MimeTypeSVG},
+		{"html", []byte(`<html><body><svg></svg></body></html>`), "text/html"},
+		{"xml", []byte(`<?xml version="1.0"?><feed></feed>`), "text/xml"},
+		{"unknown", []byte{0x00, 0x01, 0x02}, "application/octet-stream"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Sniff(tc.content))
+		})
+	}
+}
+
+func TestValidateContent(t *testing.T) {
+	testCases := []struct {
+		name     string
+		declared string
+		content  []byte
+		valid    bool
+	}{
+		{"matches", "image/png", pngHeader, true},
+		{"matches with parameters", "IMAGE/PNG; foo=bar", pngHeader, true},
+		{"equivalent type", "image/jpg", []byte("\xff\xd8\xff\xe0\x00\x10JFIF"), true},
+		{"svg", MimeTypeSVG, []byte(`<svg></svg>`), true},
+		{"html claiming to be an image", "image/png", []byte(`<html><script>alert(1)</script></html>`), false},
+		{"html claiming to be svg", MimeTypeSVG, []byte(`<html><svg></svg></html>`), false},
+		{"png claiming to be pdf", "application/pdf", pngHeader, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.valid, !ValidateContent(tc.declared, tc.content, httputil.ErrorTracker{}).InError())
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package assets
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidSVG is returned when an svg is not well formed enough to be sanitised
+var ErrInvalidSVG = errors.New("invalid svg")
+
+// elements that are dropped along with everything inside them
+var unsafeSVGElements = map[string]bool{
+	"script":        true,
+	"foreignobject": true,
+	"iframe":        true,
+	"embed":         true,
+	"object":        true,
+}
+
+// SanitizeSVG strips anything that could run script out of an svg, so it can be safely served from the asset domain.
+// Scripts, embedded html, event handler attributes and javascript urls are removed, as are doctypes (which could
+// declare entities) and processing instructions other than the xml declaration. Everything else is left byte for byte
+// as it was.
+func SanitizeSVG(content []byte) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.Entity = xml.HTMLEntity
+
+	ret := bytes.Buffer{}
+	var start int64
+	skipDepth := 0
+	sawRoot := false
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidSVG, err.Error())
+		}
+		end := decoder.InputOffset()
+		raw := content[start:end]
+		start = end
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if skipDepth > 0 || unsafeSVGElements[strings.ToLower(t.Name.Local)] {
+				skipDepth++
+				continue
+			}
+			if !sawRoot {
+				if !strings.EqualFold(t.Name.Local, "svg") {
+					return nil, errors.Wrapf(ErrInvalidSVG, "root element is %s", t.Name.Local)
+				}
+				sawRoot = true
+			}
+			safe := safeAttrs(t.Attr)
+			if len(safe) == len(t.Attr) {
+				ret.Write(raw)
+				continue
+			}
+			t.Attr = safe
+			writeStartElement(&ret, t, bytes.HasSuffix(bytes.TrimSpace(raw), []byte("/>")))
+		case xml.EndElement:
+			if skipDepth > 0 {
+				skipDepth--
+				continue
+			}
+			ret.Write(raw)
+		case xml.ProcInst:
+			if t.Target == "xml" && skipDepth == 0 {
+				ret.Write(raw)
+			}
+		case xml.Directive:
+			// doctypes can declare entities, which are a whole other can of worms
+			continue
+		default:
+			if skipDepth == 0 {
+				ret.Write(raw)
+			}
+		}
+	}
+	if !sawRoot {
+		return nil, errors.Wrap(ErrInvalidSVG, "no svg element")
+	}
+	return ret.Bytes(), nil
+}
+
+func safeAttrs(attrs []xml.Attr) []xml.Attr {
+	ret := make([]xml.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		if strings.HasPrefix(strings.ToLower(a.Name.Local), "on") {
+			continue
+		}
+		if unsafeAttrValue(a.Value) {
+			continue
+		}
+		if strings.EqualFold(a.Name.Local, "href") && strings.HasPrefix(normalizeAttrValue(a.Value), "data:") &&
+			!strings.HasPrefix(normalizeAttrValue(a.Value), "data:image/") {
+			continue
+		}
+		ret = append(ret, a)
+	}
+	return ret
+}
+
+// unsafeAttrValue catches script urls anywhere in a value, not just hrefs, since animation elements can set hrefs
+// from their to and values attributes
+func unsafeAttrValue(value string) bool {
+	normalized := normalizeAttrValue(value)
+	return strings.Contains(normalized, "javascript:") ||
+		strings.Contains(normalized, "vbscript:") ||
+		strings.Contains(normalized, "data:text/html")
+}
+
+// normalizeAttrValue lower cases a value and drops whitespace and control characters, which browsers ignore within
+// url schemes
+func normalizeAttrValue(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, strings.ToLower(value))
+}
+
+func writeStartElement(out *bytes.Buffer, element xml.StartElement, selfClosing bool) {
+	out.WriteString("<")
+	out.WriteString(qualifiedName(element.Name))
+	for _, a := range element.Attr {
+		out.WriteString(" ")
+		out.WriteString(qualifiedName(a.Name))
+		out.WriteString(`="`)
+		// escaping to a bytes.Buffer can't fail
+		_ = xml.EscapeText(out, []byte(a.Value))
+		out.WriteString(`"`)
+	}
+	if selfClosing {
+		out.WriteString("/>")
+		return
+	}
+	out.WriteString(">")
+}
+
+// qualifiedName puts names back together, RawToken leaves the prefix rather than a namespace in Space
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
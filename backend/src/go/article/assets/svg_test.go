@@ -0,0 +1,83 @@
+package assets
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeSVG(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"clean svg is left alone",
+			`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><!-- a box --><rect width="10" height="10" fill="#f00"/><text x="1">a &amp; b</text></svg>`,
+			`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><!-- a box --><rect width="10" height="10" fill="#f00"/><text x="1">a &amp; b</text></svg>`,
+		},
+		{
+			"scripts are removed",
+			`<svg><script type="text/javascript">alert(1)</script><rect/><SCRIPT/></svg>`,
+			`<svg><rect/></svg>`,
+		},
+		{
+			"foreign objects are removed",
+			`<svg><foreignObject><div xmlns="http://www.w3.org/1999/xhtml"><script>alert(1)</script></div></foreignObject></svg>`,
+			`<svg></svg>`,
+		},
+		{
+			"event handlers are removed",
+			`<svg onload="alert(1)"><rect width="1" ONCLICK="alert(2)"/></svg>`,
+			`<svg><rect width="1"/></svg>`,
+		},
+		{
+			"javascript urls are removed",
+			`<svg><a xlink:href=" java&#x09;script:alert(1)"><rect/></a><a href="https://example.com"></a></svg>`,
+			`<svg><a><rect/></a><a href="https://example.com"></a></svg>`,
+		},
+		{
+			"animations setting javascript urls are removed",
+			`<svg><a><set attributeName="href" to="javascript:alert(1)"/></a></svg>`,
+			`<svg><a><set attributeName="href"/></a></svg>`,
+		},
+		{
+			"html data urls are removed but images are kept",
+			`<svg><image href="data:text/html;base64,PHNjcmlwdD4="/><image href="data:image/png;base64,AAAA"/></svg>`,
+			`<svg><image/><image href="data:image/png;base64,AAAA"/></svg>`,
+		},
+		{
+			"doctypes and processing instructions are removed",
+			`<?xml version="1.0"?><!DOCTYPE svg [<!ENTITY x "y">]><?xml-stylesheet href="evil.css"?><svg></svg>`,
+			`<?xml version="1.0"?><svg></svg>`,
+		},
+		{
+			"rebuilt tags keep prefixes and escape values",
+			`<svg><use xlink:href="#a" title="&quot;x&quot;" onmouseover="alert(1)"></use></svg>`,
+			`<svg><use xlink:href="#a" title="&#34;x&#34;"></use></svg>`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := SanitizeSVG([]byte(tc.input))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(res))
+		})
+	}
+}
+
+func TestSanitizeSVGInvalid(t *testing.T) {
+	for _, input := range []string{
+		``,
+		`<html></html>`,
+		`<svg><rect></svg`,
+		`<svg>&undeclared;</svg>`,
+	} {
+		t.Run(input, func(t *testing.T) {
+			_, err := SanitizeSVG([]byte(input))
+			assert.True(t, errors.Is(err, ErrInvalidSVG), "expected ErrInvalidSVG, got %v", err)
+		})
+	}
+}
@@ -9,37 +9,62 @@ import (
 	"net/http"
 	"os"
 	"strings"
-	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
 	"github.com/jonsabados/sabadoscodes.com/article/assets"
+	"github.com/jonsabados/sabadoscodes.com/article/assets/imaging"
+	"github.com/jonsabados/sabadoscodes.com/audit"
 	"github.com/jonsabados/sabadoscodes.com/auth"
 	"github.com/jonsabados/sabadoscodes.com/cors"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
 	"github.com/jonsabados/sabadoscodes.com/httputil"
 	"github.com/jonsabados/sabadoscodes.com/logging"
 	"github.com/jonsabados/sabadoscodes.com/response"
 	"github.com/jonsabados/sabadoscodes.com/s3"
+	"github.com/jonsabados/sabadoscodes.com/scan"
 )
 
-const assetCacheDuration = time.Hour * 24 * 365
-
 type inboundRequest struct {
 	Path     string `json:"path"`
 	MimeType string `json:"mimeType"`
 	Content  string `json:"content"`
+	// ContentAddressed stores the content under a name derived from its hash, with path becoming an alias for it
+	ContentAddressed bool `json:"contentAddressed"`
+	// Overwrite allows replacing an asset that already exists at path, the replaced content is kept as a prior version
+	Overwrite bool `json:"overwrite"`
+	assets.MetadataUpdate
+}
+
+type contentAddressedResult struct {
+	Path string `json:"path"`
+	URL  string `json:"url"`
+	// Duplicate is set when identical content was already stored, in which case nothing new was
+	Duplicate bool `json:"duplicate"`
 }
 
 func newHandler(prepLogs logging.Preparer,
 	corsHeaders cors.ResponseHeaderBuilder,
 	extractPrincipal auth.PrincipalExtractor,
+	authorize auth.RouteAuthorizer,
 	targetBucket string,
-	saveObject s3.PublicObjectSaver,
+	policy assets.Policy,
+	describeObject s3.ObjectDescriber,
+	stageObject s3.ObjectSaver,
+	scanner scan.Scanner,
+	copyObject s3.PublicObjectCopier,
+	removeObject s3.ObjectRemover,
+	fetchDetails assets.DetailsFetcher,
+	keepVersion assets.VersionKeeper,
+	recordUpload assets.UploadRecorder,
+	recordScan assets.ScanRecorder,
+	recordAudit audit.Recorder,
 	baseAssetURL string) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 
 	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
@@ -51,6 +76,11 @@ func newHandler(prepLogs logging.Preparer,
 			return response.HandleError(ctx, responseHeaders, err), nil
 		}
 
+		if !authorize(principal, request) {
+			zerolog.Ctx(ctx).Warn().Interface("user", principal).Msg("user not authorized for route")
+			return response.HandleForbidden(ctx, responseHeaders, "not permitted"), nil
+		}
+
 		errors := httputil.ErrorTracker{}
 		uploadRequest := new(inboundRequest)
 		err = json.Unmarshal([]byte(request.Body), uploadRequest)
@@ -60,9 +90,8 @@ func newHandler(prepLogs logging.Preparer,
 			return errors.ToAPIResponse(ctx, responseHeaders), nil
 		}
 
-		if uploadRequest.Path == "" {
-			errors = errors.WithFieldError("path", "path is required")
-		}
+		uploadRequest.Path = assets.NormalizePath(uploadRequest.Path)
+		errors = assets.ValidateNewPath(errors, "path", uploadRequest.Path)
 
 		if uploadRequest.MimeType == "" {
 			errors = errors.WithFieldError("mimeType", "mimeType is required")
@@ -79,29 +108,175 @@ func newHandler(prepLogs logging.Preparer,
 			}
 		}
 
+		errors = assets.ValidateMetadata(uploadRequest.MetadataUpdate, errors)
+
+		if uploadRequest.MimeType != "" && len(content) > 0 {
+			errors = policy.Validate(uploadRequest.MimeType, int64(len(content)), errors)
+			if !errors.InError() {
+				errors = assets.ValidateContent(uploadRequest.MimeType, content, errors)
+			}
+		}
+
 		if errors.InError() {
 			return errors.ToAPIResponse(ctx, responseHeaders), nil
 		}
 
+		if assets.IsSVG(uploadRequest.MimeType) {
+			content, err = assets.SanitizeSVG(content)
+			if err != nil {
+				zerolog.Ctx(ctx).Info().Err(err).Msg("unable to sanitize svg")
+				errors = errors.WithFieldError("content", "content is not a valid svg")
+				return errors.ToAPIResponse(ctx, responseHeaders), nil
+			}
+		}
+
+		// the processor strips metadata too, but it has to be gone before hashing or content addressed assets would be
+		// published with it
+		if imaging.Processable(uploadRequest.MimeType) {
+			content, err = imaging.Clean(uploadRequest.MimeType, content)
+			if err != nil {
+				zerolog.Ctx(ctx).Info().Err(err).Msg("unable to strip image metadata")
+				errors = errors.WithFieldError("content", "content is not a valid image")
+				return errors.ToAPIResponse(ctx, responseHeaders), nil
+			}
+		}
+
 		zerolog.Ctx(ctx).Info().Interface("user", principal).Msg("user uploading object")
 		// needs to be under article-asset in the bucket. If it ever needs to become configurable will deal with it
 		path := fmt.Sprintf("%s%s", assets.AssetKeyPrefix, uploadRequest.Path)
-		err = saveObject(ctx, targetBucket, path, bytes.NewReader(content), uploadRequest.MimeType, assetCacheDuration)
+		contentHash := audit.Hash(content)
+		storedPath := uploadRequest.Path
+		contentPath := ""
+		duplicate := false
+
+		existing, err := describeObject(ctx, targetBucket, path)
 		if err != nil {
-			zerolog.Ctx(ctx).Error().Err(err).Msg("upload failed")
-			return events.APIGatewayProxyResponse{}, err
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		existingDetails, err := fetchDetails(ctx, uploadRequest.Path)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		replacing := existing != nil || (existingDetails != nil && existingDetails.ContentPath != "")
+		if replacing && !uploadRequest.Overwrite {
+			return response.HandleConflict(ctx, responseHeaders, fmt.Sprintf("an asset already exists at %s, set overwrite to replace it", uploadRequest.Path), nil), nil
+		}
+
+		if uploadRequest.ContentAddressed {
+			if existing != nil {
+				return response.HandleConflict(ctx, responseHeaders, fmt.Sprintf("a regular asset already exists at %s", uploadRequest.Path), nil), nil
+			}
+			contentPath = assets.ContentPath(contentHash, uploadRequest.Path)
+			storedPath = contentPath
+			stored, err := describeObject(ctx, targetBucket, assets.AssetKeyPrefix+contentPath)
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+			duplicate = stored != nil
 		}
-		responseHeaders["Location"] = fmt.Sprintf("%s/%s", baseAssetURL, uploadRequest.Path)
+
+		if duplicate {
+			zerolog.Ctx(ctx).Info().Str("contentPath", contentPath).Msg("content already stored, only adding alias")
+		} else {
+			// nothing goes public without being scanned, so it waits in quarantine until the scanner is happy with it
+			quarantineKey := assets.QuarantineKey(contentHash, uploadRequest.Path)
+			err = stageObject(ctx, targetBucket, quarantineKey, bytes.NewReader(content), uploadRequest.MimeType)
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+			scanResult, err := scanner.Scan(ctx, bytes.NewReader(content), int64(len(content)))
+			if isTooLarge(err) {
+				zerolog.Ctx(ctx).Warn().Err(err).Str("key", quarantineKey).Msg("upload too large to scan")
+				return response.HandleTooLarge(ctx, responseHeaders, "content is too large to be scanned"), nil
+			}
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+			if scanResult.Infected() {
+				zerolog.Ctx(ctx).Warn().Interface("user", principal).Str("key", quarantineKey).Str("signature", scanResult.Signature).Msg("upload failed scanning, leaving it in quarantine")
+				auditEntry := audit.NewEntry(ctx, principal, audit.ActionAssetQuarantine, quarantineKey)
+				auditEntry.AfterHash = contentHash
+				// the upload is already sitting in quarantine, so an audit failure is logged in full rather than failing the
+				// request
+				err = recordAudit(ctx, auditEntry)
+				if err != nil {
+					zerolog.Ctx(ctx).Error().Stack().Err(err).Interface("auditEntry", auditEntry).Msg("error recording audit entry for quarantined upload")
+				}
+				errors = errors.WithFieldError("content", fmt.Sprintf("content failed malware scanning: %s", scanResult.Signature))
+				return errors.ToAPIResponse(ctx, responseHeaders), nil
+			}
+
+			// aliases don't need versions kept, what they pointed at stays put under its content path
+			if existing != nil {
+				_, err = keepVersion(ctx, targetBucket, uploadRequest.Path)
+				if err != nil {
+					return response.HandleError(ctx, responseHeaders, err), nil
+				}
+			}
+			err = copyObject(ctx, targetBucket, quarantineKey, assets.AssetKeyPrefix+storedPath, uploadRequest.MimeType, assets.CacheDuration)
+			if err != nil {
+				zerolog.Ctx(ctx).Error().Err(err).Msg("upload failed")
+				return events.APIGatewayProxyResponse{}, err
+			}
+			err = recordScan(ctx, storedPath, scanResult)
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+			// anything left behind gets cleaned up by the bucket lifecycle rules, so a failure here isn't fatal
+			err = removeObject(ctx, targetBucket, quarantineKey)
+			if err != nil {
+				zerolog.Ctx(ctx).Warn().Err(err).Str("key", quarantineKey).Msg("unable to remove promoted upload from quarantine")
+			}
+		}
+
+		err = recordUpload(ctx, uploadRequest.Path, contentPath, assets.NewUpload(principal), uploadRequest.MetadataUpdate)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		auditEntry := audit.NewEntry(ctx, principal, audit.ActionAssetUpload, path)
+		auditEntry.AfterHash = contentHash
+		// the asset is already stored, failing now would only have the client retry an upload that was applied
+		err = recordAudit(ctx, auditEntry)
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Stack().Err(err).Interface("auditEntry", auditEntry).Msg("error recording audit entry for uploaded asset")
+		}
+		responseHeaders["Location"] = fmt.Sprintf("%s/%s", baseAssetURL, storedPath)
 
 		responseHeaders["content-type"] = "application/json"
 
+		responseCode := http.StatusCreated
+		if replacing {
+			responseCode = http.StatusOK
+		}
+
+		if !uploadRequest.ContentAddressed {
+			return events.APIGatewayProxyResponse{
+				StatusCode: responseCode,
+				Headers:    responseHeaders,
+			}, nil
+		}
+
+		responseBody, err := json.Marshal(contentAddressedResult{
+			Path:      uploadRequest.Path,
+			URL:       responseHeaders["Location"],
+			Duplicate: duplicate,
+		})
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
 		return events.APIGatewayProxyResponse{
-			StatusCode: http.StatusCreated,
+			StatusCode: responseCode,
 			Headers:    responseHeaders,
+			Body:       string(responseBody),
 		}, nil
 	}
 }
 
+func isTooLarge(err error) bool {
+	return err != nil && errors.Cause(err) == scan.ErrTooLarge
+}
+
 func main() {
 	err := xray.Configure(xray.Config{
 		LogLevel: "warn",
@@ -118,11 +293,28 @@ func main() {
 	allowedDomains := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
 	targetBucket := os.Getenv("ASSET_BUCKET")
 	baseAssetURL := os.Getenv("BASE_ASSET_URL")
+	auditTable := os.Getenv("AUDIT_TABLE")
+	assetTable := os.Getenv("ASSET_TABLE")
+
+	routes, err := auth.ParseRouteTable([]byte(os.Getenv("ROUTE_TABLE")))
+	if err != nil {
+		panic(err)
+	}
+
+	policy, err := assets.ParsePolicy(os.Getenv("ALLOWED_ASSET_TYPES"))
+	if err != nil {
+		panic(err)
+	}
+	clamAVAddress := os.Getenv("CLAMAV_ADDRESS")
+	if scan.Enabled(clamAVAddress) {
+		// clamd won't take anything over its stream limit, so nothing bigger may be uploaded while scanning is on
+		policy = policy.Capped(scan.MaxStreamLength)
+	}
 
 	s3Client := s3.RawClient(sess)
-	saver := s3.NewPublicObjectSaver(s3Client)
+	dynamoClient := dynamo.RawClient(sess)
 
-	handler := newHandler(logging.NewPreparer(), cors.NewResponseHeaderBuilder(allowedDomains), auth.NewPrincipalExtractor(), targetBucket, saver, baseAssetURL)
+	handler := newHandler(logging.NewPreparer(), cors.NewResponseHeaderBuilder(allowedDomains), auth.NewPrincipalExtractor(), auth.NewRouteAuthorizer(routes), targetBucket, policy, s3.NewObjectDescriber(s3Client), s3.NewObjectSaver(s3Client), scan.NewScanner(clamAVAddress, scan.DefaultTimeout), s3.NewPublicObjectCopier(s3Client), s3.NewObjectRemover(s3Client), assets.NewDetailsFetcher(dynamoClient, assetTable), assets.NewVersionKeeper(s3.NewObjectCopier(s3Client)), assets.NewUploadRecorder(dynamoClient, assetTable), assets.NewScanRecorder(dynamoClient, assetTable), audit.NewRecorder(dynamoClient, auditTable), baseAssetURL)
 
 	lambda.Start(handler)
 }
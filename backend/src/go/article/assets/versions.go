@@ -0,0 +1,87 @@
+package assets
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+// VersionKeyPrefix is where prior versions of overwritten assets are kept. It is outside AssetKeyPrefix so versions
+// are neither public nor picked up by the asset processor.
+const VersionKeyPrefix = "asset-versions/"
+
+var versionIDPattern = regexp.MustCompile(`^[0-9]{20}$`)
+
+// Version is a prior version of an asset
+type Version struct {
+	ID string
+	// Replaced is when the version stopped being the current one
+	Replaced time.Time
+	Size     int64
+}
+
+// VersionID identifies a version replaced at the given time, IDs sort in the order versions were replaced
+func VersionID(replaced time.Time) string {
+	return fmt.Sprintf("%020d", replaced.UnixNano())
+}
+
+// ValidVersionID reports if id could have come from VersionID
+func ValidVersionID(id string) bool {
+	return versionIDPattern.MatchString(id)
+}
+
+// VersionPrefix is the key prefix prior versions of the asset at path (relative to AssetKeyPrefix) are kept under
+func VersionPrefix(path string) string {
+	return VersionKeyPrefix + path + "/"
+}
+
+// VersionKey is the object key of a specific prior version of the asset at path
+func VersionKey(path string, id string) string {
+	return VersionPrefix(path) + id
+}
+
+// Versions picks out the prior versions of the asset at path from objects listed under its VersionPrefix, newest first
+func Versions(objects []s3.Object, path string) []Version {
+	ret := make([]Version, 0)
+	for _, o := range objects {
+		id := strings.TrimPrefix(o.Path, VersionPrefix(path))
+		// anything with a further slash belongs to an asset nested under path rather than path itself
+		if id == o.Path || !ValidVersionID(id) {
+			continue
+		}
+		nanos, _ := strconv.ParseInt(id, 10, 64)
+		ret = append(ret, Version{
+			ID:       id,
+			Replaced: time.Unix(0, nanos),
+			Size:     o.Size,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].ID > ret[j].ID
+	})
+	return ret
+}
+
+// VersionKeeper copies the current content of the asset at path (relative to AssetKeyPrefix) aside before it is
+// replaced, returning the ID of the version it was kept as
+type VersionKeeper func(ctx context.Context, bucket string, path string) (string, error)
+
+func NewVersionKeeper(copyObject s3.ObjectCopier) VersionKeeper {
+	return func(ctx context.Context, bucket string, path string) (string, error) {
+		id := VersionID(time.Now())
+		err := copyObject(ctx, bucket, AssetKeyPrefix+path, VersionKey(path, id))
+		if err != nil {
+			return "", err
+		}
+		zerolog.Ctx(ctx).Info().Str("path", path).Str("version", id).Msg("kept prior version of asset")
+		return id, nil
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/article/assets"
+	"github.com/jonsabados/sabadoscodes.com/auth"
+	"github.com/jonsabados/sabadoscodes.com/cors"
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/response"
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+type versionDetails struct {
+	Version  string    `json:"version"`
+	Replaced time.Time `json:"replaced"`
+	Size     int64     `json:"size"`
+}
+
+type listResponse struct {
+	Results []versionDetails `json:"results"`
+}
+
+func newHandler(prepLogs logging.Preparer,
+	corsHeaders cors.ResponseHeaderBuilder,
+	extractPrincipal auth.PrincipalExtractor,
+	authorize auth.RouteAuthorizer,
+	targetBucket string,
+	listObjects s3.ObjectLister) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		ctx, _ = prepLogs(ctx)
+		responseHeaders := corsHeaders(request.Headers)
+
+		principal, err := extractPrincipal(request)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		if !authorize(principal, request) {
+			zerolog.Ctx(ctx).Warn().Interface("user", principal).Msg("user not authorized for route")
+			return response.HandleForbidden(ctx, responseHeaders, "not permitted"), nil
+		}
+
+		errors := httputil.ErrorTracker{}
+		path, err := url.PathUnescape(request.PathParameters["path"])
+		if err != nil {
+			zerolog.Ctx(ctx).Info().Err(err).Msg("invalid path")
+			errors = errors.WithFieldError("path", "invalid path")
+		} else {
+			errors = assets.ValidatePath(errors, "path", path)
+		}
+		if errors.InError() {
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		objects, err := listObjects(ctx, targetBucket, assets.VersionPrefix(path))
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		// an asset that was never overwritten just has no prior versions, which isn't worth a 404
+		results := make([]versionDetails, 0)
+		for _, v := range assets.Versions(objects, path) {
+			results = append(results, versionDetails{
+				Version:  v.ID,
+				Replaced: v.Replaced,
+				Size:     v.Size,
+			})
+		}
+
+		responseBody, err := json.Marshal(listResponse{
+			Results: results,
+		})
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		responseHeaders["content-type"] = "application/json"
+
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusOK,
+			Headers:    responseHeaders,
+			Body:       string(responseBody),
+		}, nil
+	}
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	allowedDomains := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
+	targetBucket := os.Getenv("ASSET_BUCKET")
+
+	routes, err := auth.ParseRouteTable([]byte(os.Getenv("ROUTE_TABLE")))
+	if err != nil {
+		panic(err)
+	}
+
+	s3Client := s3.RawClient(sess)
+
+	handler := newHandler(logging.NewPreparer(), cors.NewResponseHeaderBuilder(allowedDomains), auth.NewPrincipalExtractor(), auth.NewRouteAuthorizer(routes), targetBucket, s3.NewObjectLister(s3Client))
+
+	lambda.Start(handler)
+}
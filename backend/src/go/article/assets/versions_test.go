@@ -0,0 +1,58 @@
+package assets
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+func TestVersionID(t *testing.T) {
+	id := VersionID(time.Unix(1, 5))
+	assert.Equal(t, "00000000001000000005", id)
+	assert.True(t, ValidVersionID(id))
+	assert.False(t, ValidVersionID("1000000005"))
+	assert.False(t, ValidVersionID("0000000000100000000a"))
+	assert.False(t, ValidVersionID("../0000000001000000005"))
+}
+
+func TestVersionKey(t *testing.T) {
+	assert.Equal(t, "asset-versions/some/cat.jpg/00000000001000000005", VersionKey("some/cat.jpg", "00000000001000000005"))
+}
+
+func TestVersions(t *testing.T) {
+	objects := []s3.Object{
+		{Path: "asset-versions/cat.jpg/00000000001000000005", Size: 10},
+		{Path: "asset-versions/cat.jpg/00000000003000000000", Size: 30},
+		{Path: "asset-versions/cat.jpg/00000000002000000000", Size: 20},
+		{Path: "asset-versions/cat.jpg/nested.png/00000000004000000000", Size: 40},
+		{Path: "asset-versions/cat.jpg/junk", Size: 50},
+		{Path: "asset-versions/cat.jpg.bak/00000000005000000000", Size: 60},
+	}
+	assert.Equal(t, []Version{
+		{ID: "00000000003000000000", Replaced: time.Unix(3, 0), Size: 30},
+		{ID: "00000000002000000000", Replaced: time.Unix(2, 0), Size: 20},
+		{ID: "00000000001000000005", Replaced: time.Unix(1, 5), Size: 10},
+	}, Versions(objects, "cat.jpg"))
+}
+
+func TestNewVersionKeeper(t *testing.T) {
+	asserter := assert.New(t)
+
+	var copiedFrom, copiedTo string
+	copyObject := func(ctx context.Context, bucket string, sourceKey string, targetKey string) error {
+		asserter.Equal("bucket", bucket)
+		copiedFrom = sourceKey
+		copiedTo = targetKey
+		return nil
+	}
+
+	id, err := NewVersionKeeper(copyObject)(context.Background(), "bucket", "some/cat.jpg")
+	asserter.NoError(err)
+	asserter.True(ValidVersionID(id))
+	asserter.Equal("article-assets/some/cat.jpg", copiedFrom)
+	asserter.Equal(VersionKey("some/cat.jpg", id), copiedTo)
+}
@@ -0,0 +1,56 @@
+package article
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	markdownImage    = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`)
+	markdownLink     = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	markdownHTMLTag  = regexp.MustCompile(`<[^>]+>`)
+	markdownEmphasis = regexp.MustCompile("[*_`~]+")
+)
+
+// Excerpt gives the opening prose of an article's markdown as plain text, cut at a word boundary to no more than
+// maxLength characters (plus an ellipsis when cut). Headings, code blocks, images, tables and quotes are skipped.
+func Excerpt(content string, maxLength int) string {
+	words := make([]string, 0)
+	inCode := false
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		if trimmed == "" {
+			// the excerpt is the first paragraph with anything in it
+			if len(words) > 0 {
+				break
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "|") || strings.HasPrefix(trimmed, ">") ||
+			strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t") {
+			continue
+		}
+		trimmed = markdownImage.ReplaceAllString(trimmed, "")
+		trimmed = markdownLink.ReplaceAllString(trimmed, "$1")
+		trimmed = markdownHTMLTag.ReplaceAllString(trimmed, "")
+		trimmed = markdownEmphasis.ReplaceAllString(trimmed, "")
+		words = append(words, strings.Fields(trimmed)...)
+	}
+
+	ret := strings.Join(words, " ")
+	if len([]rune(ret)) <= maxLength {
+		return ret
+	}
+	cut := []rune(ret)[:maxLength]
+	if i := strings.LastIndex(string(cut), " "); i > 0 {
+		return strings.TrimRight(string(cut)[:i], ",.;:-") + "…"
+	}
+	return string(cut) + "…"
+}
@@ -0,0 +1,52 @@
+package article
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExcerpt(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		content   string
+		maxLength int
+		expected  string
+	}{
+		{
+			"first paragraph only",
+			"First paragraph.\nStill first.\n\nSecond paragraph.",
+			100,
+			"First paragraph. Still first.",
+		},
+		{
+			"skips headings, images and code",
+			"# Title\n\n![diagram](https://example.com/a.png)\n\n```go\nfunc main() {}\n```\n\nThe *real* start, with a [link](https://example.com) and `code`.",
+			100,
+			"The real start, with a link and code.",
+		},
+		{
+			"cut at a word boundary",
+			"Lambdas are neat, until they aren't.",
+			20,
+			"Lambdas are neat…",
+		},
+		{
+			"single long word",
+			"Supercalifragilistic",
+			5,
+			"Super…",
+		},
+		{
+			"nothing but a heading",
+			"# Title",
+			100,
+			"",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Excerpt(tc.content, tc.maxLength))
+		})
+	}
+}
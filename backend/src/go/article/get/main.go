@@ -51,8 +51,8 @@ func newHandler(prepLogs logging.Preparer,
 			return response.HandleNtFound(ctx, responseHeaders), nil
 		}
 
-		// only folks with article publish can see unpublished articles
-		if a.PublishDate == nil && !principal.HasRole(auth.RoleArticlePublish) {
+		// only folks with article publish, or the article's own authors, can see unpublished articles
+		if a.PublishDate == nil && !principal.HasRole(auth.RoleArticlePublish) && !a.IsAuthor(principal.UserID) {
 			return response.HandleNtFound(ctx, responseHeaders), nil
 		}
 
@@ -39,7 +39,7 @@ func newHandler(prepLogs logging.Preparer,
 		}
 
 		published := true
-		if principal.HasRole(auth.RoleArticlePublish) {
+		if principal.HasRole(auth.RoleArticlePublish) || principal.HasRole(auth.RoleArticleAuthor) {
 			if queryParam, hasParam := request.QueryStringParameters["published"]; hasParam {
 				published, err = strconv.ParseBool(queryParam)
 				if err != nil {
@@ -55,6 +55,17 @@ func newHandler(prepLogs logging.Preparer,
 			return response.HandleError(ctx, responseHeaders, err), nil
 		}
 
+		// authors only get to see their own drafts
+		if !published && !principal.HasRole(auth.RoleArticlePublish) {
+			ownArticles := make([]article.Summary, 0)
+			for _, a := range articles {
+				if a.IsAuthor(principal.UserID) {
+					ownArticles = append(ownArticles, a)
+				}
+			}
+			articles = ownArticles
+		}
+
 		content, err := json.Marshal(response.ListResponse{
 			Results: articles,
 		})
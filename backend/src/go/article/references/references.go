@@ -0,0 +1,267 @@
+package references
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/article/assets"
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+const (
+	fieldAssetPath = "AssetPath"
+	fieldSlug      = "Slug"
+
+	slugIndex = "Slug"
+
+	// dynamo caps batch writes at 25 items
+	maxBatchSize = 25
+
+	// unprocessed items mean the table is being throttled, so retries back off from firstRetryDelay up to maxRetryDelay,
+	// giving up after maxRetries in a row that didn't get everything through
+	firstRetryDelay = 50 * time.Millisecond
+	maxRetryDelay   = 5 * time.Second
+	maxRetries      = 10
+)
+
+// urlTerminators are the characters that end a url in markdown or html content
+const urlTerminators = " \t\r\n\"'`()<>[]{}|\\^"
+
+// Extract finds every asset referenced by content through a url starting with baseAssetURL, returning the asset paths
+// (relative to assets.AssetKeyPrefix) sorted and without duplicates
+func Extract(content string, baseAssetURL string) []string {
+	prefix := strings.TrimSuffix(baseAssetURL, "/") + "/"
+	found := make(map[string]bool)
+	remaining := content
+	for {
+		start := strings.Index(remaining, prefix)
+		if start < 0 {
+			break
+		}
+		remaining = remaining[start+len(prefix):]
+		end := strings.IndexAny(remaining, urlTerminators)
+		if end < 0 {
+			end = len(remaining)
+		}
+		path := remaining[:end]
+		if cut := strings.IndexAny(path, "?#"); cut >= 0 {
+			path = path[:cut]
+		}
+		if unescaped, err := url.PathUnescape(path); err == nil {
+			path = unescaped
+		}
+		if path != "" {
+			found[path] = true
+		}
+		remaining = remaining[end:]
+	}
+	ret := make([]string, 0, len(found))
+	for p := range found {
+		ret = append(ret, p)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// MissingFinder returns the referenced asset paths that don't exist
+type MissingFinder func(ctx context.Context, paths []string) ([]string, error)
+
+func NewMissingFinder(describeObject s3.ObjectDescriber, bucket string) MissingFinder {
+	return func(ctx context.Context, paths []string) ([]string, error) {
+		ret := make([]string, 0)
+		for _, p := range paths {
+			info, err := describeObject(ctx, bucket, assets.AssetKeyPrefix+p)
+			if err != nil {
+				return nil, err
+			}
+			if info == nil {
+				ret = append(ret, p)
+			}
+		}
+		return ret, nil
+	}
+}
+
+// Orphans returns the asset paths that nothing references, either directly or through one of their variants
+func Orphans(assetPaths []string, referenced map[string][]string) []string {
+	used := make(map[string]bool)
+	for p := range referenced {
+		used[assets.SourcePath(p)] = true
+	}
+	ret := make([]string, 0)
+	for _, p := range assetPaths {
+		if !used[p] {
+			ret = append(ret, p)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Indexer replaces the asset references recorded for an article
+type Indexer func(ctx context.Context, slug string, paths []string) error
+
+func NewIndexer(db *dynamodb.DynamoDB, referenceTable string) Indexer {
+	return func(ctx context.Context, slug string, paths []string) error {
+		existing := make(map[string]bool)
+		err := db.QueryPagesWithContext(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(referenceTable),
+			IndexName:              aws.String(slugIndex),
+			KeyConditionExpression: aws.String("#slug = :slug"),
+			ExpressionAttributeNames: map[string]*string{
+				"#slug": aws.String(fieldSlug),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":slug": {S: aws.String(slug)},
+			},
+		}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+			for _, item := range page.Items {
+				existing[*item[fieldAssetPath].S] = true
+			}
+			return true
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		writes := make([]*dynamodb.WriteRequest, 0)
+		for _, p := range paths {
+			if existing[p] {
+				delete(existing, p)
+				continue
+			}
+			writes = append(writes, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: referenceKey(p, slug)}})
+		}
+		for p := range existing {
+			writes = append(writes, &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{Key: referenceKey(p, slug)}})
+		}
+		zerolog.Ctx(ctx).Debug().Str("slug", slug).Int("changes", len(writes)).Msg("updating asset references")
+		return batchWrite(ctx, db, referenceTable, writes)
+	}
+}
+
+func referenceKey(path string, slug string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		fieldAssetPath: {S: aws.String(path)},
+		fieldSlug:      {S: aws.String(slug)},
+	}
+}
+
+func batchWrite(ctx context.Context, db *dynamodb.DynamoDB, table string, writes []*dynamodb.WriteRequest) error {
+	retries := 0
+	for len(writes) > 0 {
+		batchSize := len(writes)
+		if batchSize > maxBatchSize {
+			batchSize = maxBatchSize
+		}
+		res, err := db.BatchWriteItemWithContext(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]*dynamodb.WriteRequest{
+				table: writes[:batchSize],
+			},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		unprocessed := res.UnprocessedItems[table]
+		writes = append(unprocessed, writes[batchSize:]...)
+		if len(unprocessed) == 0 {
+			retries = 0
+			continue
+		}
+		if retries >= maxRetries {
+			return errors.Errorf("%d reference writes still unprocessed after %d retries", len(unprocessed), retries)
+		}
+		delay := retryDelay(retries)
+		retries++
+		zerolog.Ctx(ctx).Debug().Int("unprocessed", len(unprocessed)).Dur("delay", delay).Msg("retrying unprocessed reference writes")
+		select {
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+	return nil
+}
+
+// retryDelay is how long to wait before the given retry (counting from 0) of unprocessed writes
+func retryDelay(retry int) time.Duration {
+	delay := firstRetryDelay
+	for i := 0; i < retry && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// Finder gives the slugs of the articles referencing the asset at path, either directly or through one of its variants,
+// sorted and without duplicates. Paths are matched exactly as Extract recorded them, so escaped links are found and
+// cat.jpg.bak isn't mistaken for cat.jpg.
+type Finder func(ctx context.Context, path string) ([]string, error)
+
+func NewFinder(db *dynamodb.DynamoDB, referenceTable string, listObjects s3.ObjectLister, bucket string) Finder {
+	return func(ctx context.Context, path string) ([]string, error) {
+		variants, err := listObjects(ctx, bucket, assets.VariantKeyPrefix+path+"/")
+		if err != nil {
+			return nil, err
+		}
+		found := make(map[string]bool)
+		for _, p := range assets.ReferencePaths(path, variants) {
+			err := db.QueryPagesWithContext(ctx, &dynamodb.QueryInput{
+				TableName:              aws.String(referenceTable),
+				KeyConditionExpression: aws.String("#path = :path"),
+				ExpressionAttributeNames: map[string]*string{
+					"#path": aws.String(fieldAssetPath),
+				},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":path": {S: aws.String(p)},
+				},
+			}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+				for _, item := range page.Items {
+					found[*item[fieldSlug].S] = true
+				}
+				return true
+			})
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+		ret := make([]string, 0, len(found))
+		for slug := range found {
+			ret = append(ret, slug)
+		}
+		sort.Strings(ret)
+		return ret, nil
+	}
+}
+
+// Lister returns every recorded reference, as the slugs of the articles referencing each asset path
+type Lister func(ctx context.Context) (map[string][]string, error)
+
+func NewLister(db *dynamodb.DynamoDB, referenceTable string) Lister {
+	return func(ctx context.Context) (map[string][]string, error) {
+		ret := make(map[string][]string)
+		err := db.ScanPagesWithContext(ctx, &dynamodb.ScanInput{
+			TableName: aws.String(referenceTable),
+		}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+			for _, item := range page.Items {
+				path := *item[fieldAssetPath].S
+				ret[path] = append(ret[path], *item[fieldSlug].S)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return ret, nil
+	}
+}
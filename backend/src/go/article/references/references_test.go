@@ -0,0 +1,93 @@
+package references
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+const baseAssetURL = "https://sabadoscodes.com/article-assets"
+
+func TestExtract(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		content  string
+		expected []string
+	}{
+		{
+			"nothing",
+			"just some words",
+			[]string{},
+		},
+		{
+			"markdown image",
+			"look ![a cat](https://sabadoscodes.com/article-assets/cats/cat.jpg) at this",
+			[]string{"cats/cat.jpg"},
+		},
+		{
+			"html with srcset",
+			`<img src="https://sabadoscodes.com/article-assets/cat.jpg" srcset="https://sabadoscodes.com/article-assets/_variants/cat.jpg/320w.jpg 320w">`,
+			[]string{"_variants/cat.jpg/320w.jpg", "cat.jpg"},
+		},
+		{
+			"duplicates, query strings and encoding",
+			"https://sabadoscodes.com/article-assets/my%20cat.jpg?v=1 and https://sabadoscodes.com/article-assets/my%20cat.jpg#top",
+			[]string{"my cat.jpg"},
+		},
+		{
+			"at the very end",
+			"https://sabadoscodes.com/article-assets/cat.jpg",
+			[]string{"cat.jpg"},
+		},
+		{
+			"other urls",
+			"https://example.com/article-assets/cat.jpg https://sabadoscodes.com/article-assets/",
+			[]string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Extract(tc.content, baseAssetURL))
+		})
+	}
+}
+
+func TestExtract_TrailingSlashOnBaseURL(t *testing.T) {
+	assert.Equal(t, []string{"cat.jpg"}, Extract("https://sabadoscodes.com/article-assets/cat.jpg", baseAssetURL+"/"))
+}
+
+func TestNewMissingFinder(t *testing.T) {
+	describe := func(ctx context.Context, bucket, object string) (*s3.ObjectInfo, error) {
+		assert.Equal(t, "bucket", bucket)
+		if object == "article-assets/cat.jpg" {
+			return &s3.ObjectInfo{ContentType: "image/jpeg", Size: 10}, nil
+		}
+		return nil, nil
+	}
+	missing, err := NewMissingFinder(describe, "bucket")(context.Background(), []string{"cat.jpg", "dog.jpg"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dog.jpg"}, missing)
+}
+
+func TestRetryDelay(t *testing.T) {
+	asserter := assert.New(t)
+	asserter.Equal(50*time.Millisecond, retryDelay(0))
+	asserter.Equal(100*time.Millisecond, retryDelay(1))
+	asserter.Equal(3200*time.Millisecond, retryDelay(6))
+	asserter.Equal(5*time.Second, retryDelay(7))
+	asserter.Equal(5*time.Second, retryDelay(maxRetries))
+}
+
+func TestOrphans(t *testing.T) {
+	assetPaths := []string{"dog.jpg", "cat.jpg", "bird.png", "fish.png"}
+	referenced := map[string][]string{
+		"cat.jpg":                     {"cats"},
+		"_variants/bird.png/320w.png": {"birds"},
+		"missing.png":                 {"oops"},
+	}
+	assert.Equal(t, []string{"dog.jpg", "fish.png"}, Orphans(assetPaths, referenced))
+}
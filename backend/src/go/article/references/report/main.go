@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+
+	"github.com/jonsabados/sabadoscodes.com/article"
+	"github.com/jonsabados/sabadoscodes.com/article/assets"
+	"github.com/jonsabados/sabadoscodes.com/article/references"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/mail"
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+const reportTemplate = "asset-reference-report"
+
+type brokenReference struct {
+	Path  string   `json:"path"`
+	Slugs []string `json:"slugs"`
+}
+
+// reportData is what the asset-reference-report mail template is rendered with
+type reportData struct {
+	Orphans []string
+	Broken  []brokenReference
+}
+
+func newHandler(prepLogs logging.Preparer,
+	assetBucket string,
+	baseAssetURL string,
+	listArticles article.Lister,
+	fetchArticle article.Fetcher,
+	indexReferences references.Indexer,
+	listReferences references.Lister,
+	listObjects s3.ObjectLister,
+	sendEmail mail.TemplatedSender,
+	reportFrom string,
+	reportTo string) func(ctx context.Context) error {
+
+	return func(ctx context.Context) error {
+		ctx, logger := prepLogs(ctx)
+
+		// the index is maintained on save, but articles saved before it existed (or restored from backup) won't be in it
+		err := reindex(ctx, listArticles, fetchArticle, indexReferences, baseAssetURL)
+		if err != nil {
+			logger.Error().Stack().Err(err).Msg("error reindexing articles")
+			return err
+		}
+
+		objects, err := listObjects(ctx, assetBucket, assets.AssetKeyPrefix)
+		if err != nil {
+			logger.Error().Stack().Err(err).Msg("error listing assets")
+			return err
+		}
+		existing := make(map[string]bool)
+		assetPaths := make([]string, 0)
+		for _, o := range objects {
+			path := strings.TrimPrefix(o.Path, assets.AssetKeyPrefix)
+			existing[path] = true
+			if !assets.IsVariantKey(o.Path) {
+				assetPaths = append(assetPaths, path)
+			}
+		}
+
+		referenced, err := listReferences(ctx)
+		if err != nil {
+			logger.Error().Stack().Err(err).Msg("error listing references")
+			return err
+		}
+
+		orphans := references.Orphans(assetPaths, referenced)
+		broken := make([]brokenReference, 0)
+		for path, slugs := range referenced {
+			if !existing[path] {
+				broken = append(broken, brokenReference{Path: path, Slugs: slugs})
+			}
+		}
+		logger.Info().Strs("orphans", orphans).Interface("broken", broken).Msg("asset reference report")
+
+		if reportTo == "" || (len(orphans) == 0 && len(broken) == 0) {
+			return nil
+		}
+		orphanURLs := make([]string, len(orphans))
+		for i, p := range orphans {
+			orphanURLs[i] = fmt.Sprintf("%s/%s", strings.TrimSuffix(baseAssetURL, "/"), p)
+		}
+		err = sendEmail(ctx, reportFrom, reportTo, reportTemplate, mail.DefaultLocale, reportData{Orphans: orphanURLs, Broken: broken})
+		if err != nil {
+			logger.Error().Stack().Err(err).Msg("error sending report")
+			return err
+		}
+		return nil
+	}
+}
+
+func reindex(ctx context.Context, listArticles article.Lister, fetchArticle article.Fetcher, indexReferences references.Indexer, baseAssetURL string) error {
+	for _, published := range []bool{true, false} {
+		summaries, err := listArticles(ctx, published)
+		if err != nil {
+			return err
+		}
+		for _, summary := range summaries {
+			a, err := fetchArticle(ctx, summary.Slug)
+			if err != nil {
+				return err
+			}
+			if a == nil {
+				continue
+			}
+			err = indexReferences(ctx, a.Slug, references.Extract(a.Content, baseAssetURL))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	assetBucket := os.Getenv("ASSET_BUCKET")
+	baseAssetURL := os.Getenv("BASE_ASSET_URL")
+	articleTable := os.Getenv("ARTICLE_TABLE")
+	referenceTable := os.Getenv("REFERENCE_TABLE")
+
+	dynamoClient := dynamo.RawClient(sess)
+	listArticles := article.NewLister(dynamoClient, articleTable)
+	fetchArticle := article.NewFetcher(dynamoClient, articleTable)
+	indexReferences := references.NewIndexer(dynamoClient, referenceTable)
+	listReferences := references.NewLister(dynamoClient, referenceTable)
+	s3Client := s3.RawClient(sess)
+	listObjects := s3.NewObjectLister(s3Client)
+	templateSource := mail.NewTemplateSource(os.Getenv("TEMPLATE_BUCKET"), s3.NewObjectDescriber(s3Client), s3.NewObjectFetcher(s3Client))
+	sendMessage := mail.NewSuppressingMessageSender(mail.NewSuppressionChecker(dynamoClient, os.Getenv("SUPPRESSION_TABLE")), mail.NewMessageSender(mail.NewRawClient(sess)))
+	sendEmail := mail.NewTemplatedSender(mail.NewTemplateRenderer(templateSource), mail.NewSender(sendMessage))
+
+	handler := newHandler(logging.NewPreparer(), assetBucket, baseAssetURL, listArticles, fetchArticle, indexReferences, listReferences, listObjects, sendEmail, os.Getenv("MAIL_FROM"), os.Getenv("REPORT_TO"))
+
+	lambda.Start(handler)
+}
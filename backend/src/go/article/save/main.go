@@ -15,15 +15,20 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
 	"github.com/jonsabados/sabadoscodes.com/article"
+	"github.com/jonsabados/sabadoscodes.com/article/references"
+	"github.com/jonsabados/sabadoscodes.com/audit"
 	"github.com/jonsabados/sabadoscodes.com/auth"
 	"github.com/jonsabados/sabadoscodes.com/cors"
 	"github.com/jonsabados/sabadoscodes.com/dynamo"
 	"github.com/jonsabados/sabadoscodes.com/httputil"
 	"github.com/jonsabados/sabadoscodes.com/logging"
 	"github.com/jonsabados/sabadoscodes.com/response"
+	"github.com/jonsabados/sabadoscodes.com/s3"
+	"github.com/jonsabados/sabadoscodes.com/subscription"
 )
 
 type inboundRequest struct {
@@ -31,14 +36,31 @@ type inboundRequest struct {
 	PublishDate *time.Time `json:"publishDate"`
 	Title       string     `json:"title"`
 	Content     string     `json:"content"`
+	// CoAuthors is optional, when omitted any existing co-authors are retained
+	CoAuthors *[]string `json:"coAuthors"`
+}
+
+type warning struct {
+	URL     string `json:"url"`
+	Message string `json:"message"`
+}
+
+type saveResponse struct {
+	Warnings []warning `json:"warnings"`
 }
 
 func newHandler(prepLogs logging.Preparer,
 	corsHeaders cors.ResponseHeaderBuilder,
 	extractPrincipal auth.PrincipalExtractor,
+	authorize auth.RouteAuthorizer,
 	fetchArticle article.Fetcher,
 	saveArticle article.Saver,
-	baseArticleURL string) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	recordAudit audit.Recorder,
+	findMissingAssets references.MissingFinder,
+	indexReferences references.Indexer,
+	notifyPublished subscription.PublishNotifier,
+	baseArticleURL string,
+	baseAssetURL string) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 
 	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 		ctx, _ = prepLogs(ctx)
@@ -49,6 +71,13 @@ func newHandler(prepLogs logging.Preparer,
 			return response.HandleError(ctx, responseHeaders, err), nil
 		}
 
+		if !authorize(principal, request) {
+			zerolog.Ctx(ctx).Warn().Interface("user", principal).Msg("user not authorized for route")
+			return response.HandleForbidden(ctx, responseHeaders, "not permitted"), nil
+		}
+
+		isPublisher := principal.HasRole(auth.RoleArticlePublish)
+
 		errors := httputil.ErrorTracker{}
 		putRequest := new(inboundRequest)
 		err = json.Unmarshal([]byte(request.Body), putRequest)
@@ -80,7 +109,46 @@ func newHandler(prepLogs logging.Preparer,
 			return response.HandleError(ctx, responseHeaders, err), nil
 		}
 
+		owner := principal.UserID
+		var coAuthors []string
+		var existingPublishDate *time.Time
+		if existing != nil {
+			owner = existing.Owner
+			coAuthors = existing.CoAuthors
+			existingPublishDate = existing.PublishDate
+		}
+
+		if !isPublisher {
+			if existing != nil && !existing.IsAuthor(principal.UserID) {
+				zerolog.Ctx(ctx).Warn().Interface("user", principal).Str("owner", existing.Owner).Msg("user attempting to edit article they are not an author of")
+				return response.HandleForbidden(ctx, responseHeaders, "only the authors of an article may edit it"), nil
+			}
+			if !samePublishDate(existingPublishDate, putRequest.PublishDate) {
+				zerolog.Ctx(ctx).Warn().Interface("user", principal).Msg("non publisher attempting to change publish date")
+				return response.HandleForbidden(ctx, responseHeaders, "only publishers may set the publish date"), nil
+			}
+		}
+
+		if putRequest.CoAuthors != nil {
+			if existing != nil && !isPublisher && existing.Owner != principal.UserID {
+				return response.HandleForbidden(ctx, responseHeaders, "only the owner of an article may change its co-authors"), nil
+			}
+			coAuthors = *putRequest.CoAuthors
+		}
+
+		toSave := article.Article{
+			Summary: article.Summary{
+				Slug:        slug,
+				PublishDate: putRequest.PublishDate,
+				Title:       putRequest.Title,
+				Owner:       owner,
+				CoAuthors:   coAuthors,
+			},
+			Content:     putRequest.Content,
+		}
+
 		var responseCode int
+		auditEntry := audit.NewEntry(ctx, principal, audit.ActionArticleCreate, slug)
 		if existing == nil {
 			zerolog.Ctx(ctx).Info().Interface("user", principal).Msg("user putting new article")
 			responseCode = http.StatusCreated
@@ -88,29 +156,101 @@ func newHandler(prepLogs logging.Preparer,
 		} else {
 			zerolog.Ctx(ctx).Info().Interface("user", principal).Interface("original", existing).Msg("user over-writing article")
 			responseCode = http.StatusNoContent
+			auditEntry.Action = audit.ActionArticleUpdate
+			auditEntry.BeforeHash, err = hashArticle(*existing)
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+		}
+		auditEntry.AfterHash, err = hashArticle(toSave)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
 		}
 
-		err = saveArticle(ctx, article.Article{
-			Summary: article.Summary{
-				Slug:        slug,
-				PublishDate: putRequest.PublishDate,
-				Title:       putRequest.Title,
-			},
-			Content:     putRequest.Content,
-		})
+		referencedAssets := references.Extract(toSave.Content, baseAssetURL)
+		// broken references don't stop the save, there may be good reasons for them (an upload in progress say)
+		missingAssets, err := findMissingAssets(ctx, referencedAssets)
 		if err != nil {
 			return response.HandleError(ctx, responseHeaders, err), nil
 		}
 
+		// subscribers only hear about an article the first time it is published, not when it is edited afterwards. The
+		// event is queued ahead of the save, so a failure here fails the request with nothing saved and a retry tries
+		// again. Should the save then fail the notify lambda finds the article unpublished and drops the event.
+		if existingPublishDate == nil && toSave.PublishDate != nil {
+			zerolog.Ctx(ctx).Info().Str("slug", slug).Msg("article published, notifying subscribers")
+			err = notifyPublished(ctx, slug)
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+		}
+
+		err = saveArticle(ctx, toSave)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		err = indexReferences(ctx, slug, referencedAssets)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		// the save has already happened, failing the request now would only have the client retry an edit that was
+		// applied. The entry goes to the logs in full instead so it can be put back by hand.
+		err = recordAudit(ctx, auditEntry)
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Stack().Err(err).Interface("auditEntry", auditEntry).Msg("error recording audit entry for saved article")
+		}
+
 		responseHeaders["content-type"] = "application/json"
 
+		if len(missingAssets) == 0 {
+			return events.APIGatewayProxyResponse{
+				StatusCode: responseCode,
+				Headers:    responseHeaders,
+			}, nil
+		}
+
+		zerolog.Ctx(ctx).Info().Strs("missingAssets", missingAssets).Msg("article references missing assets")
+		body := saveResponse{Warnings: make([]warning, 0, len(missingAssets))}
+		for _, p := range missingAssets {
+			body.Warnings = append(body.Warnings, warning{
+				URL:     fmt.Sprintf("%s/%s", baseAssetURL, p),
+				Message: "referenced asset does not exist",
+			})
+		}
+		responseBody, err := json.Marshal(body)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		// no content isn't an option when there is content to return
+		if responseCode == http.StatusNoContent {
+			responseCode = http.StatusOK
+		}
 		return events.APIGatewayProxyResponse{
 			StatusCode: responseCode,
 			Headers:    responseHeaders,
+			Body:       string(responseBody),
 		}, nil
 	}
 }
 
+func hashArticle(a article.Article) (string, error) {
+	content, err := json.Marshal(a)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return audit.Hash(content), nil
+}
+
+// samePublishDate compares publish dates at the resolution they are persisted with (seconds)
+func samePublishDate(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Unix() == b.Unix()
+}
+
 func main() {
 	err := xray.Configure(xray.Config{
 		LogLevel: "warn",
@@ -127,12 +267,23 @@ func main() {
 	allowedDomains := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
 	baseArticleURL := os.Getenv("BASE_ARTICLE_URL")
 	articleTable := os.Getenv("ARTICLE_TABLE")
+	auditTable := os.Getenv("AUDIT_TABLE")
+	assetBucket := os.Getenv("ASSET_BUCKET")
+	baseAssetURL := os.Getenv("BASE_ASSET_URL")
+	referenceTable := os.Getenv("REFERENCE_TABLE")
+	publishedQueueURL := os.Getenv("PUBLISHED_QUEUE_URL")
+
+	routes, err := auth.ParseRouteTable([]byte(os.Getenv("ROUTE_TABLE")))
+	if err != nil {
+		panic(err)
+	}
 
 	dynamoClient := dynamo.RawClient(sess)
 	fetcher := article.NewFetcher(dynamoClient, articleTable)
 	saver := article.NewSaver(dynamoClient, articleTable)
+	findMissing := references.NewMissingFinder(s3.NewObjectDescriber(s3.RawClient(sess)), assetBucket)
 
-	handler := newHandler(logging.NewPreparer(), cors.NewResponseHeaderBuilder(allowedDomains), auth.NewPrincipalExtractor(), fetcher, saver, baseArticleURL)
+	handler := newHandler(logging.NewPreparer(), cors.NewResponseHeaderBuilder(allowedDomains), auth.NewPrincipalExtractor(), auth.NewRouteAuthorizer(routes), fetcher, saver, audit.NewRecorder(dynamoClient, auditTable), findMissing, references.NewIndexer(dynamoClient, referenceTable), subscription.NewPublishNotifier(subscription.NewRawSQSClient(sess), publishedQueueURL), baseArticleURL, baseAssetURL)
 
 	lambda.Start(handler)
 }
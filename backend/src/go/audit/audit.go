@@ -0,0 +1,271 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+
+	"github.com/jonsabados/sabadoscodes.com/auth"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+)
+
+const (
+	// every entry lives in a single partition, volume is low enough that it is never going to be a hot key and it
+	// keeps time range queries simple
+	auditPartition = "Audit"
+
+	fieldPartition  = "Partition"
+	fieldSortKey    = "SortKey"
+	fieldUserID     = "UserID"
+	fieldUserEmail  = "UserEmail"
+	fieldAction     = "Action"
+	fieldTarget     = "Target"
+	fieldBeforeHash = "BeforeHash"
+	fieldAfterHash  = "AfterHash"
+	fieldRequestID  = "RequestID"
+	fieldTimestamp  = "Timestamp"
+
+	MaxPageSize = 100
+)
+
+type Action string
+
+const (
+	ActionArticleCreate Action = "article.create"
+	ActionArticleUpdate Action = "article.update"
+	ActionAssetUpload   Action = "asset.upload"
+	ActionAssetDelete   Action = "asset.delete"
+	ActionAssetMove     Action = "asset.move"
+	ActionAssetMetadata Action = "asset.metadata"
+	ActionAssetRestore  Action = "asset.restore"
+	// ActionAssetQuarantine is an upload held back because scanning found something in it
+	ActionAssetQuarantine Action = "asset.quarantine"
+	// ActionMailVerdict is inbound mail tagged, quarantined or dropped for failing spam, virus or authentication checks
+	ActionMailVerdict Action = "mail.verdict"
+	// ActionMailSuppress is an address put on the suppression list after it bounced or its owner complained
+	ActionMailSuppress Action = "mail.suppress"
+	// ActionMailUnsuppress is an address taken off the suppression list by an admin
+	ActionMailUnsuppress Action = "mail.unsuppress"
+)
+
+// Entry is a single record of a privileged action. Before and after hashes are hex encoded SHA-256 sums of the
+// target's content, BeforeHash is empty when the target did not previously exist or its content is unknown.
+type Entry struct {
+	UserID     string    `json:"userId"`
+	UserEmail  string    `json:"userEmail"`
+	Action     Action    `json:"action"`
+	Target     string    `json:"target"`
+	BeforeHash string    `json:"beforeHash,omitempty"`
+	AfterHash  string    `json:"afterHash,omitempty"`
+	RequestID  string    `json:"requestId"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// NewEntry creates an entry for the given principal, stamped with the current time and lambda request ID
+func NewEntry(ctx context.Context, principal auth.Principal, action Action, target string) Entry {
+	ret := Entry{
+		UserID:    principal.UserID,
+		UserEmail: principal.Email,
+		Action:    action,
+		Target:    target,
+		Timestamp: time.Now(),
+	}
+	if awsCtx, inLambda := lambdacontext.FromContext(ctx); inLambda {
+		ret.RequestID = awsCtx.AwsRequestID
+	}
+	return ret
+}
+
+// Hash produces the hash used for before and after values in audit entries
+func Hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// HashReader is Hash for content that is too large to comfortably hold in memory
+func HashReader(content io.Reader) (string, error) {
+	hash := sha256.New()
+	_, err := io.Copy(hash, content)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Recorder appends an entry to the audit log
+type Recorder func(ctx context.Context, entry Entry) error
+
+func NewRecorder(db *dynamodb.DynamoDB, auditTable string) Recorder {
+	return func(ctx context.Context, entry Entry) error {
+		item := map[string]*dynamodb.AttributeValue{
+			fieldPartition: {S: aws.String(auditPartition)},
+			fieldSortKey:   {S: aws.String(sortKey(entry))},
+			fieldUserID:    {S: aws.String(entry.UserID)},
+			fieldUserEmail: {S: aws.String(entry.UserEmail)},
+			fieldAction:    {S: aws.String(string(entry.Action))},
+			fieldTarget:    {S: aws.String(entry.Target)},
+			fieldRequestID: {S: aws.String(entry.RequestID)},
+			fieldTimestamp: {N: aws.String(strconv.FormatInt(entry.Timestamp.UnixNano(), 10))},
+		}
+		if entry.BeforeHash != "" {
+			item[fieldBeforeHash] = &dynamodb.AttributeValue{S: aws.String(entry.BeforeHash)}
+		}
+		if entry.AfterHash != "" {
+			item[fieldAfterHash] = &dynamodb.AttributeValue{S: aws.String(entry.AfterHash)}
+		}
+		_, err := db.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(auditTable),
+			Item:      item,
+			// append only, never clobber an existing entry
+			ConditionExpression: aws.String(fmt.Sprintf("attribute_not_exists(%s)", fieldSortKey)),
+		})
+		return errors.WithStack(err)
+	}
+}
+
+// Query narrows down audit entries, zero values mean no restriction
+type Query struct {
+	UserID string
+	Action Action
+	From   time.Time
+	To     time.Time
+	Cursor string
+	Limit  int
+}
+
+type Page struct {
+	Entries    []Entry `json:"results"`
+	NextCursor string  `json:"nextCursor,omitempty"`
+}
+
+// ErrInvalidCursor is returned when a query carries a cursor that was not produced by a previous query
+var ErrInvalidCursor = dynamo.ErrInvalidCursor
+
+// Lister finds audit entries, newest first
+type Lister func(ctx context.Context, query Query) (Page, error)
+
+func NewLister(db *dynamodb.DynamoDB, auditTable string) Lister {
+	return func(ctx context.Context, query Query) (Page, error) {
+		from := time.Unix(0, 0)
+		if !query.From.IsZero() {
+			from = query.From
+		}
+		to := time.Now()
+		if !query.To.IsZero() {
+			to = query.To
+		}
+		limit := query.Limit
+		if limit <= 0 || limit > MaxPageSize {
+			limit = MaxPageSize
+		}
+
+		input := &dynamodb.QueryInput{
+			TableName:              aws.String(auditTable),
+			KeyConditionExpression: aws.String("#partition = :partition AND #sortKey BETWEEN :from AND :to"),
+			ExpressionAttributeNames: map[string]*string{
+				"#partition": aws.String(fieldPartition),
+				"#sortKey":   aws.String(fieldSortKey),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":partition": {S: aws.String(auditPartition)},
+				":from":      {S: aws.String(dynamo.TimeKey(from))},
+				// sort keys have a suffix after the time, so bump the upper bound to include everything in the last ns
+				":to": {S: aws.String(dynamo.TimeKey(to) + "~")},
+			},
+			ScanIndexForward: aws.Bool(false),
+		}
+
+		filter := ""
+		if query.UserID != "" {
+			filter = "#user = :user"
+			input.ExpressionAttributeNames["#user"] = aws.String(fieldUserID)
+			input.ExpressionAttributeValues[":user"] = &dynamodb.AttributeValue{S: aws.String(query.UserID)}
+		}
+		if query.Action != "" {
+			if filter != "" {
+				filter += " AND "
+			}
+			filter += "#action = :action"
+			input.ExpressionAttributeNames["#action"] = aws.String(fieldAction)
+			input.ExpressionAttributeValues[":action"] = &dynamodb.AttributeValue{S: aws.String(string(query.Action))}
+		}
+		if filter != "" {
+			input.FilterExpression = aws.String(filter)
+		}
+
+		if query.Cursor != "" {
+			startKey, err := dynamo.DecodeCursor(query.Cursor, fieldPartition, auditPartition, fieldSortKey)
+			if err != nil {
+				return Page{}, err
+			}
+			input.ExclusiveStartKey = startKey
+		}
+
+		// Limit caps what is read before filtering, so with a filter a single query can come back short or even empty
+		// while there is more to read. Keep going until the page is full or everything has been read.
+		ret := Page{
+			Entries: make([]Entry, 0, limit),
+		}
+		for {
+			input.Limit = aws.Int64(int64(limit - len(ret.Entries)))
+			res, err := db.QueryWithContext(ctx, input)
+			if err != nil {
+				return Page{}, errors.WithStack(err)
+			}
+			for _, item := range res.Items {
+				e, err := toEntry(item)
+				if err != nil {
+					return Page{}, err
+				}
+				ret.Entries = append(ret.Entries, e)
+			}
+			if len(res.LastEvaluatedKey) == 0 {
+				return ret, nil
+			}
+			if len(ret.Entries) >= limit {
+				ret.NextCursor, err = dynamo.EncodeCursor(res.LastEvaluatedKey)
+				if err != nil {
+					return Page{}, err
+				}
+				return ret, nil
+			}
+			input.ExclusiveStartKey = res.LastEvaluatedKey
+		}
+	}
+}
+
+func toEntry(item map[string]*dynamodb.AttributeValue) (Entry, error) {
+	nanos, err := strconv.ParseInt(*item[fieldTimestamp].N, 10, 64)
+	if err != nil {
+		return Entry{}, errors.Errorf("invalid timestamp %s on audit entry %s", *item[fieldTimestamp].N, *item[fieldSortKey].S)
+	}
+	ret := Entry{
+		UserID:    *item[fieldUserID].S,
+		UserEmail: *item[fieldUserEmail].S,
+		Action:    Action(*item[fieldAction].S),
+		Target:    *item[fieldTarget].S,
+		RequestID: *item[fieldRequestID].S,
+		Timestamp: time.Unix(0, nanos),
+	}
+	if item[fieldBeforeHash] != nil {
+		ret.BeforeHash = *item[fieldBeforeHash].S
+	}
+	if item[fieldAfterHash] != nil {
+		ret.AfterHash = *item[fieldAfterHash].S
+	}
+	return ret, nil
+}
+
+func sortKey(entry Entry) string {
+	// request ID keeps keys unique if two entries land in the same nanosecond
+	return dynamo.TimeSortKey(entry.Timestamp, fmt.Sprintf("%s#%s", entry.RequestID, entry.Target))
+}
@@ -0,0 +1,44 @@
+package audit
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jonsabados/sabadoscodes.com/auth"
+)
+
+func TestNewEntry(t *testing.T) {
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: "request-1234"})
+	principal := auth.Principal{UserID: "1234", Email: "bob@testing.com"}
+
+	before := time.Now()
+	res := NewEntry(ctx, principal, ActionArticleUpdate, "some-slug")
+
+	assert.Equal(t, "1234", res.UserID)
+	assert.Equal(t, "bob@testing.com", res.UserEmail)
+	assert.Equal(t, ActionArticleUpdate, res.Action)
+	assert.Equal(t, "some-slug", res.Target)
+	assert.Equal(t, "request-1234", res.RequestID)
+	assert.False(t, res.Timestamp.Before(before))
+}
+
+func TestHash(t *testing.T) {
+	assert.Equal(t, "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", Hash([]byte("foo")))
+}
+
+func TestHashReader(t *testing.T) {
+	hash, err := HashReader(strings.NewReader("foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, Hash([]byte("foo")), hash)
+}
+
+func Test_sortKey_OrdersChronologically(t *testing.T) {
+	early := sortKey(Entry{Timestamp: time.Unix(9, 0), RequestID: "zzz"})
+	late := sortKey(Entry{Timestamp: time.Unix(10, 0), RequestID: "aaa"})
+	assert.True(t, early < late)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/audit"
+	"github.com/jonsabados/sabadoscodes.com/auth"
+	"github.com/jonsabados/sabadoscodes.com/cors"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/response"
+)
+
+func newHandler(prepLogs logging.Preparer,
+	corsHeaders cors.ResponseHeaderBuilder,
+	extractPrincipal auth.PrincipalExtractor,
+	authorize auth.RouteAuthorizer,
+	listEntries audit.Lister) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		ctx, _ = prepLogs(ctx)
+		responseHeaders := corsHeaders(request.Headers)
+
+		principal, err := extractPrincipal(request)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		if !authorize(principal, request) {
+			zerolog.Ctx(ctx).Warn().Interface("user", principal).Msg("user not authorized for route")
+			return response.HandleForbidden(ctx, responseHeaders, "not permitted"), nil
+		}
+
+		errors := httputil.ErrorTracker{}
+		params := request.QueryStringParameters
+		query := audit.Query{
+			UserID: params["user"],
+			Action: audit.Action(params["action"]),
+			Cursor: params["cursor"],
+		}
+		if from, hasParam := params["from"]; hasParam {
+			query.From, err = time.Parse(time.RFC3339, from)
+			if err != nil {
+				errors = errors.WithFieldError("from", "must be an RFC3339 timestamp")
+			}
+		}
+		if to, hasParam := params["to"]; hasParam {
+			query.To, err = time.Parse(time.RFC3339, to)
+			if err != nil {
+				errors = errors.WithFieldError("to", "must be an RFC3339 timestamp")
+			}
+		}
+		if limit, hasParam := params["limit"]; hasParam {
+			query.Limit, err = strconv.Atoi(limit)
+			if err != nil || query.Limit < 1 || query.Limit > audit.MaxPageSize {
+				errors = errors.WithFieldError("limit", "must be a number between 1 and 100")
+			}
+		}
+		if errors.InError() {
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		page, err := listEntries(ctx, query)
+		if err == audit.ErrInvalidCursor {
+			errors = errors.WithFieldError("cursor", "invalid cursor")
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		responseBody, err := json.Marshal(page)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		responseHeaders["content-type"] = "application/json"
+
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusOK,
+			Headers:    responseHeaders,
+			Body:       string(responseBody),
+		}, nil
+	}
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	allowedDomains := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
+	auditTable := os.Getenv("AUDIT_TABLE")
+
+	routes, err := auth.ParseRouteTable([]byte(os.Getenv("ROUTE_TABLE")))
+	if err != nil {
+		panic(err)
+	}
+
+	dynamoClient := dynamo.RawClient(sess)
+	lister := audit.NewLister(dynamoClient, auditTable)
+
+	handler := newHandler(logging.NewPreparer(), cors.NewResponseHeaderBuilder(allowedDomains), auth.NewPrincipalExtractor(), auth.NewRouteAuthorizer(routes), lister)
+
+	lambda.Start(handler)
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"time"
+
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/pkg/errors"
 )
@@ -14,6 +16,10 @@ type Principal struct {
 	Email  string `json:"email"`
 	Name   string `json:"name"`
 	Roles  []Role `json:"roles"`
+	// SessionID is set when the principal was established from a session token rather than a google ID token
+	SessionID string `json:"sessionId,omitempty"`
+	// Expires is when the credentials the principal was established from stop being valid, zero if not applicable
+	Expires time.Time `json:"-"`
 }
 
 func (p Principal) HasRole(role Role) bool {
@@ -30,23 +36,16 @@ var Anonymous = Principal{
 	Name:   "Anonymous User",
 }
 
+// PolicyBuilder creates the policy for a principal. Policies cover every route the principal may access across the
+// stage rather than just the method being invoked. API gateway doesn't cache them (it can't tell when a token expires
+// or is revoked), verified tokens are cached by NewCachingAuthenticator instead.
 type PolicyBuilder func(ctx context.Context, principal Principal) (events.APIGatewayCustomAuthorizerPolicy, error)
 
-func NewPolicyBuilder(region string, accountID string, apiID string, stage string) PolicyBuilder {
+func NewPolicyBuilder(region string, accountID string, apiID string, stage string, routes RouteTable) PolicyBuilder {
 	return func(ctx context.Context, principal Principal) (events.APIGatewayCustomAuthorizerPolicy, error) {
-		statement := []events.IAMPolicyStatement{
-			createAllowStatement(fmt.Sprintf("arn:aws:execute-api:%s:%s:%s/%s/%s/%s", region, accountID, apiID, stage, "GET", "self")),
-			createAllowStatement(fmt.Sprintf("arn:aws:execute-api:%s:%s:%s/%s/%s/%s", region, accountID, apiID, stage, "GET", "article/")),
-			createAllowStatement(fmt.Sprintf("arn:aws:execute-api:%s:%s:%s/%s/%s/%s", region, accountID, apiID, stage, "GET", "article/slug/*")),
-		}
-		for _, r := range principal.Roles {
-			switch r {
-			case RoleAssetPublish:
-				statement = append(statement, createAllowStatement(fmt.Sprintf("arn:aws:execute-api:%s:%s:%s/%s/%s/%s", region, accountID, apiID, stage, "POST", "article/asset")))
-				statement = append(statement, createAllowStatement(fmt.Sprintf("arn:aws:execute-api:%s:%s:%s/%s/%s/%s", region, accountID, apiID, stage, "GET", "article/asset")))
-			case RoleArticlePublish:
-				statement = append(statement, createAllowStatement(fmt.Sprintf("arn:aws:execute-api:%s:%s:%s/%s/%s/%s", region, accountID, apiID, stage, "PUT", "article/slug/*")))
-			}
+		statement := make([]events.IAMPolicyStatement, 0)
+		for _, r := range routes.PermittedRoutes(principal) {
+			statement = append(statement, createAllowStatement(fmt.Sprintf("arn:aws:execute-api:%s:%s:%s/%s/%s/%s", region, accountID, apiID, stage, r.Method, r.Resource)))
 		}
 		return events.APIGatewayCustomAuthorizerPolicy{
 			Version:   "2012-10-17",
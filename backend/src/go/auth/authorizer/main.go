@@ -7,15 +7,23 @@ import (
 	"fmt"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-xray-sdk-go/xray"
 	"github.com/jonsabados/sabadoscodes.com/auth"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
 	"github.com/jonsabados/sabadoscodes.com/httputil"
 	"github.com/jonsabados/sabadoscodes.com/logging"
+	sessions "github.com/jonsabados/sabadoscodes.com/session"
 	"net/http"
 	"os"
 	"strings"
 )
 
+// authCacheSize is the number of verified tokens kept in memory, it only needs to cover the users active while a single
+// lambda instance is warm
+const authCacheSize = 256
+
 func newHandler(prepLogs logging.Preparer, authenticate auth.Authenticator, buildPolicy auth.PolicyBuilder) func(ctx context.Context, request events.APIGatewayCustomAuthorizerRequest) (events.APIGatewayCustomAuthorizerResponse, error) {
 	return func(ctx context.Context, request events.APIGatewayCustomAuthorizerRequest) (events.APIGatewayCustomAuthorizerResponse, error) {
 		ctx, logger := prepLogs(ctx)
@@ -66,17 +74,43 @@ func main() {
 		panic(err)
 	}
 
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
 	googleClientID := os.Getenv("GOOGLE_CLIENT_ID")
 	rootUser := os.Getenv("ROOT_USER")
+	authors := strings.Split(os.Getenv("AUTHOR_USERS"), ",")
 	region := os.Getenv("AWS_REGION")
 	accountID := os.Getenv("ACCOUNT_ID")
 	apiID := os.Getenv("API_ID")
 	stage := os.Getenv("STAGE")
+	sessionTable := os.Getenv("SESSION_TABLE")
+	sessionSigningKey, err := sessions.SigningKey(os.Getenv("SESSION_SIGNING_KEY"))
+	if err != nil {
+		panic(err)
+	}
 	clientFactory := httputil.NewXRAYAwareHTTPClientFactory(http.DefaultClient)
 	certFetcher := auth.NewGoogleCertFetcher(auth.GoogleCertEndpoint, clientFactory)
-	roleOracle := auth.NewRoleOracle(rootUser)
-	authenticator := auth.NewGoogleAuthenticator(googleClientID, certFetcher, roleOracle)
-	policyBuilder := auth.NewPolicyBuilder(region, accountID, apiID, stage)
+	roleOracle := auth.NewRoleOracle(rootUser, authors)
+	googleAuthenticator := auth.NewCachingAuthenticator(auth.NewGoogleAuthenticator(googleClientID, certFetcher, roleOracle), authCacheSize)
+
+	// session tokens aren't cached at all (the gateway doesn't cache results either) so revocation applies immediately
+	dynamoClient := dynamo.RawClient(sess)
+	sessionAuthenticator := sessions.NewAuthenticator(sessionSigningKey, sessions.NewFetcher(dynamoClient, sessionTable))
+	authenticator := auth.Authenticator(func(ctx context.Context, token string) (auth.Principal, error) {
+		if sessions.IsSessionToken(token) {
+			return sessionAuthenticator(ctx, token)
+		}
+		return googleAuthenticator(ctx, token)
+	})
+
+	routes, err := auth.ParseRouteTable([]byte(os.Getenv("ROUTE_TABLE")))
+	if err != nil {
+		panic(err)
+	}
+	policyBuilder := auth.NewPolicyBuilder(region, accountID, apiID, stage, routes)
 
 	lambda.Start(newHandler(logging.NewPreparer(), authenticator, policyBuilder))
 }
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type cachedPrincipal struct {
+	key       string
+	principal Principal
+}
+
+// NewCachingAuthenticator wraps an Authenticator with an in memory LRU cache of successfully verified tokens, keyed by
+// the SHA-256 of the token so raw tokens are never held onto. Entries are only good until the token expires, and
+// principals without an expiration are never cached. Failures are never cached either.
+func NewCachingAuthenticator(base Authenticator, maxEntries int) Authenticator {
+	var mutex sync.Mutex
+	lru := list.New()
+	entries := make(map[string]*list.Element)
+
+	return func(ctx context.Context, token string) (Principal, error) {
+		logger := zerolog.Ctx(ctx)
+		hash := sha256.Sum256([]byte(token))
+		key := hex.EncodeToString(hash[:])
+
+		mutex.Lock()
+		if e, inCache := entries[key]; inCache {
+			cached := e.Value.(cachedPrincipal)
+			if time.Now().Before(cached.principal.Expires) {
+				lru.MoveToFront(e)
+				mutex.Unlock()
+				logger.Debug().Str("tokenHash", key).Msg("authentication cache hit")
+				return cached.principal, nil
+			}
+			lru.Remove(e)
+			delete(entries, key)
+		}
+		mutex.Unlock()
+
+		logger.Debug().Str("tokenHash", key).Msg("authentication cache miss")
+		principal, err := base(ctx, token)
+		if err != nil {
+			return Principal{}, err
+		}
+
+		if principal.Expires.IsZero() || !time.Now().Before(principal.Expires) {
+			return principal, nil
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		if e, inCache := entries[key]; inCache {
+			// someone else verified the same token while we were, just refresh it
+			e.Value = cachedPrincipal{key, principal}
+			lru.MoveToFront(e)
+		} else {
+			entries[key] = lru.PushFront(cachedPrincipal{key, principal})
+		}
+		for lru.Len() > maxEntries {
+			oldest := lru.Back()
+			lru.Remove(oldest)
+			delete(entries, oldest.Value.(cachedPrincipal).key)
+		}
+		return principal, nil
+	}
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCachingAuthenticator(t *testing.T) {
+	asserter := assert.New(t)
+	ctx := context.Background()
+
+	callCounts := make(map[string]int)
+	expirations := map[string]time.Time{
+		"one":     time.Now().Add(time.Hour),
+		"two":     time.Now().Add(time.Hour),
+		"three":   time.Now().Add(time.Hour),
+		"short":   time.Now().Add(time.Millisecond * 50),
+		"forever": {},
+	}
+	base := Authenticator(func(ctx context.Context, token string) (Principal, error) {
+		callCounts[token]++
+		if token == "bad" {
+			return Principal{}, errors.New("nope")
+		}
+		return Principal{UserID: token, Expires: expirations[token]}, nil
+	})
+
+	testInstance := NewCachingAuthenticator(base, 2)
+
+	for i := 0; i < 3; i++ {
+		res, err := testInstance(ctx, "one")
+		asserter.NoError(err)
+		asserter.Equal("one", res.UserID)
+	}
+	asserter.Equal(1, callCounts["one"])
+
+	// failures aren't cached
+	for i := 0; i < 2; i++ {
+		_, err := testInstance(ctx, "bad")
+		asserter.EqualError(err, "nope")
+	}
+	asserter.Equal(2, callCounts["bad"])
+
+	// principals without an expiration aren't cached
+	for i := 0; i < 2; i++ {
+		_, err := testInstance(ctx, "forever")
+		asserter.NoError(err)
+	}
+	asserter.Equal(2, callCounts["forever"])
+
+	// entries don't outlive the token
+	_, _ = testInstance(ctx, "short")
+	_, _ = testInstance(ctx, "short")
+	asserter.Equal(1, callCounts["short"])
+	time.Sleep(time.Millisecond * 60)
+	_, _ = testInstance(ctx, "short")
+	asserter.Equal(2, callCounts["short"])
+
+	// least recently used goes first: cache holds short & one, touching one then adding two should evict short
+	_, _ = testInstance(ctx, "one")
+	_, _ = testInstance(ctx, "two")
+	asserter.Equal(1, callCounts["one"])
+	_, _ = testInstance(ctx, "one")
+	asserter.Equal(1, callCounts["one"])
+	_, _ = testInstance(ctx, "three")
+	_, _ = testInstance(ctx, "one")
+	asserter.Equal(1, callCounts["one"])
+	_, _ = testInstance(ctx, "two")
+	asserter.Equal(2, callCounts["two"])
+}
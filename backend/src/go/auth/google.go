@@ -104,10 +104,11 @@ func (a *googleAuthenticator) authenticate(ctx context.Context, token string) (P
 	}
 
 	return Principal{
-		UserID: payload.Sub,
-		Email:  payload.Email,
-		Name:   payload.Name,
-		Roles:  a.getRoles(ctx, payload.Email),
+		UserID:  payload.Sub,
+		Email:   payload.Email,
+		Name:    payload.Name,
+		Roles:   a.getRoles(ctx, payload.Email),
+		Expires: time.Unix(payload.Exp, 0),
 	}, nil
 }
 
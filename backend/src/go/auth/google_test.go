@@ -249,10 +249,11 @@ func TestNewGoogleAuthenticator_HappyPath_FirstKey(t *testing.T) {
 
 	asserter.NoError(err)
 	asserter.Equal(Principal{
-		UserID: subject,
-		Email:  email,
-		Name:   name,
-		Roles:  expectedRoles,
+		UserID:  subject,
+		Email:   email,
+		Name:    name,
+		Roles:   expectedRoles,
+		Expires: time.Unix(expires.Unix(), 0),
 	}, res)
 }
 
@@ -328,10 +329,11 @@ func TestNewGoogleAuthenticator_HappyPath_NotFirstKey(t *testing.T) {
 
 	asserter.NoError(err)
 	asserter.Equal(Principal{
-		UserID: subject,
-		Email:  email,
-		Name:   name,
-		Roles:  expectedRoles,
+		UserID:  subject,
+		Email:   email,
+		Name:    name,
+		Roles:   expectedRoles,
+		Expires: time.Unix(expires.Unix(), 0),
 	}, res)
 }
 
@@ -412,10 +414,11 @@ func TestNewGoogleAuthenticator_HappyPath_Caching(t *testing.T) {
 	res, err := testInstance(context.Background(), jwt)
 	asserter.NoError(err)
 	asserter.Equal(Principal{
-		UserID: subject,
-		Email:  email,
-		Name:   name,
-		Roles:  expectedRoles,
+		UserID:  subject,
+		Email:   email,
+		Name:    name,
+		Roles:   expectedRoles,
+		Expires: time.Unix(expires.Unix(), 0),
 	}, res)
 
 	asserter.Equal(1, fetchCount)
@@ -423,10 +426,11 @@ func TestNewGoogleAuthenticator_HappyPath_Caching(t *testing.T) {
 	res, err = testInstance(context.Background(), jwt)
 	asserter.NoError(err)
 	asserter.Equal(Principal{
-		UserID: subject,
-		Email:  email,
-		Name:   name,
-		Roles:  expectedRoles,
+		UserID:  subject,
+		Email:   email,
+		Name:    name,
+		Roles:   expectedRoles,
+		Expires: time.Unix(expires.Unix(), 0),
 	}, res)
 	asserter.Equal(1, fetchCount)
 
@@ -434,10 +438,11 @@ func TestNewGoogleAuthenticator_HappyPath_Caching(t *testing.T) {
 	res, err = testInstance(context.Background(), jwt)
 	asserter.NoError(err)
 	asserter.Equal(Principal{
-		UserID: subject,
-		Email:  email,
-		Name:   name,
-		Roles:  expectedRoles,
+		UserID:  subject,
+		Email:   email,
+		Name:    name,
+		Roles:   expectedRoles,
+		Expires: time.Unix(expires.Unix(), 0),
 	}, res)
 	asserter.Equal(2, fetchCount)
 }
@@ -521,10 +526,11 @@ func TestNewGoogleAuthenticator_FailureToFetchCertOnFirstTry(t *testing.T) {
 	res, err := testInstance(context.Background(), jwt)
 	asserter.NoError(err)
 	asserter.Equal(Principal{
-		UserID: subject,
-		Email:  email,
-		Name:   name,
-		Roles:  expectedRoles,
+		UserID:  subject,
+		Email:   email,
+		Name:    name,
+		Roles:   expectedRoles,
+		Expires: time.Unix(expires.Unix(), 0),
 	}, res)
 }
 
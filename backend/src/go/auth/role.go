@@ -10,16 +10,30 @@ type Role string
 const (
 	RoleAssetPublish = "article_asset_publish"
 	RoleArticlePublish = "article_publish"
+	// RoleArticleAuthor allows creating articles and editing ones the user owns or co-authors, publishing is reserved for
+	// RoleArticlePublish
+	RoleArticleAuthor = "article_author"
+	// RoleAdmin covers site administration, such as reviewing the audit log
+	RoleAdmin = "admin"
 )
 
 type RoleOracle func(ctx context.Context, emailAddress string) []Role
 
-func NewRoleOracle(rootUser string) RoleOracle {
+func NewRoleOracle(rootUser string, authors []string) RoleOracle {
 	return func(ctx context.Context, emailAddress string) []Role {
 		ret := make([]Role, 0)
 		if strings.ToLower(emailAddress) == strings.ToLower(rootUser) {
 			ret = append(ret, RoleAssetPublish)
 			ret = append(ret, RoleArticlePublish)
+			ret = append(ret, RoleAdmin)
+			return ret
+		}
+		for _, a := range authors {
+			a = strings.TrimSpace(a)
+			if a != "" && strings.ToLower(emailAddress) == strings.ToLower(a) {
+				ret = append(ret, RoleArticleAuthor)
+				break
+			}
 		}
 		return ret
 	}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRoleOracle(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		email    string
+		expected []Role
+	}{
+		{
+			"root user",
+			"Root@Testing.com",
+			[]Role{RoleAssetPublish, RoleArticlePublish, RoleAdmin},
+		},
+		{
+			"author",
+			"author@testing.com",
+			[]Role{RoleArticleAuthor},
+		},
+		{
+			"nobody",
+			"someone@testing.com",
+			[]Role{},
+		},
+		{
+			"blank",
+			"",
+			[]Role{},
+		},
+	}
+	testInstance := NewRoleOracle("root@testing.com", []string{"", " Author@testing.com"})
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.expected, testInstance(context.Background(), tc.email))
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pkg/errors"
+
+	"github.com/jonsabados/sabadoscodes.com/wildcard"
+)
+
+// Route describes an API route and who may invoke it. Resource is relative to the stage and may contain * wildcards,
+// which match any sequence of characters (including /) the same way they do within execute-api ARNs. A route is either
+// open to everyone including the anonymous user, open to any signed in user, or restricted to principals having at
+// least one of Roles.
+type Route struct {
+	Method        string `json:"method"`
+	Resource      string `json:"resource"`
+	Anonymous     bool   `json:"anonymous,omitempty"`
+	Authenticated bool   `json:"authenticated,omitempty"`
+	Roles         []Role `json:"roles,omitempty"`
+}
+
+// PermitsPrincipal reports if the principal is allowed to invoke the route
+func (r Route) PermitsPrincipal(principal Principal) bool {
+	if r.Anonymous {
+		return true
+	}
+	if r.Authenticated {
+		return principal.UserID != Anonymous.UserID
+	}
+	for _, role := range r.Roles {
+		if principal.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports if a request for the given method and resource path falls under the route
+func (r Route) Matches(method string, resource string) bool {
+	if r.Method != "*" && !strings.EqualFold(r.Method, method) {
+		return false
+	}
+	return wildcard.Match(normalizeResource(r.Resource), normalizeResource(resource))
+}
+
+// RouteTable is the full list of API routes and the permissions required to access them. It is the single source of
+// truth for authorization, used both when building IAM policies in the authorizer and when handlers double check
+// access.
+type RouteTable []Route
+
+// ParseRouteTable reads a route table from its json representation, validating each entry
+func ParseRouteTable(raw []byte) (RouteTable, error) {
+	ret := make(RouteTable, 0)
+	err := json.Unmarshal(raw, &ret)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for i, r := range ret {
+		if r.Method == "" || r.Resource == "" {
+			return nil, errors.Errorf("route %d: method and resource are required", i)
+		}
+		modes := 0
+		for _, set := range []bool{r.Anonymous, r.Authenticated, len(r.Roles) > 0} {
+			if set {
+				modes++
+			}
+		}
+		if modes != 1 {
+			return nil, errors.Errorf("route %d (%s %s): exactly one of anonymous, authenticated or roles must be set", i, r.Method, r.Resource)
+		}
+	}
+	return ret, nil
+}
+
+// PermittedRoutes returns all routes the principal is allowed to invoke
+func (t RouteTable) PermittedRoutes(principal Principal) []Route {
+	ret := make([]Route, 0)
+	for _, r := range t {
+		if r.PermitsPrincipal(principal) {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+// Authorized reports if the principal may invoke the given method on the given resource path. Anything not in the
+// table is denied.
+func (t RouteTable) Authorized(principal Principal, method string, resource string) bool {
+	for _, r := range t {
+		if r.Matches(method, resource) && r.PermitsPrincipal(principal) {
+			return true
+		}
+	}
+	return false
+}
+
+// RouteAuthorizer verifies that a principal is allowed to make the given request
+type RouteAuthorizer func(principal Principal, request events.APIGatewayProxyRequest) bool
+
+func NewRouteAuthorizer(routes RouteTable) RouteAuthorizer {
+	return func(principal Principal, request events.APIGatewayProxyRequest) bool {
+		return routes.Authorized(principal, request.HTTPMethod, request.Path)
+	}
+}
+
+func normalizeResource(resource string) string {
+	return strings.Trim(resource, "/")
+}
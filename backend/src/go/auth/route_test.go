@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+const infrastructureDir = "../../../../infrastructure"
+
+func loadRouteTable(t *testing.T) RouteTable {
+	raw, err := ioutil.ReadFile(filepath.Join(infrastructureDir, "routes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret, err := ParseRouteTable(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func TestParseRouteTable_Invalid(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		input string
+	}{
+		{"garbage", "not json"},
+		{"missing method", `[{"resource": "foo", "anonymous": true}]`},
+		{"missing resource", `[{"method": "GET", "anonymous": true}]`},
+		{"neither anonymous nor roles", `[{"method": "GET", "resource": "foo"}]`},
+		{"both anonymous and roles", `[{"method": "GET", "resource": "foo", "anonymous": true, "roles": ["article_publish"]}]`},
+		{"both anonymous and authenticated", `[{"method": "GET", "resource": "foo", "anonymous": true, "authenticated": true}]`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := ParseRouteTable([]byte(tc.input))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRouteTable_Authorized(t *testing.T) {
+	routes := loadRouteTable(t)
+	publisher := Principal{UserID: "pub", Roles: []Role{RoleArticlePublish}}
+	author := Principal{UserID: "author", Roles: []Role{RoleArticleAuthor}}
+	assetPublisher := Principal{UserID: "assets", Roles: []Role{RoleAssetPublish}}
+
+	testCases := []struct {
+		desc      string
+		principal Principal
+		method    string
+		path      string
+		expected  bool
+	}{
+		{"anonymous read", Anonymous, "GET", "/article/slug/foo", true},
+		{"anonymous list", Anonymous, "GET", "/article", true},
+		{"anonymous save", Anonymous, "PUT", "/article/slug/foo", false},
+		{"publisher save", publisher, "PUT", "/article/slug/foo", true},
+		{"author save", author, "PUT", "/article/slug/foo", true},
+		{"author upload", author, "POST", "/article/asset", false},
+		{"asset publisher upload", assetPublisher, "POST", "/article/asset", true},
+		{"lower case method", assetPublisher, "post", "/article/asset", true},
+		{"unknown route", publisher, "DELETE", "/article/slug/foo", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.expected, NewRouteAuthorizer(routes)(tc.principal, events.APIGatewayProxyRequest{
+				HTTPMethod: tc.method,
+				Path:       tc.path,
+			}))
+		})
+	}
+}
+
+func TestNewPolicyBuilder(t *testing.T) {
+	routes := RouteTable{
+		{Method: "GET", Resource: "self", Anonymous: true},
+		{Method: "PUT", Resource: "article/slug/*", Roles: []Role{RoleArticlePublish, RoleArticleAuthor}},
+	}
+	testInstance := NewPolicyBuilder("us-east-1", "1234", "api", "main", routes)
+
+	policy, err := testInstance(context.Background(), Anonymous)
+	assert.NoError(t, err)
+	assert.Equal(t, events.APIGatewayCustomAuthorizerPolicy{
+		Version: "2012-10-17",
+		Statement: []events.IAMPolicyStatement{
+			createAllowStatement("arn:aws:execute-api:us-east-1:1234:api/main/GET/self"),
+		},
+	}, policy)
+
+	policy, err = testInstance(context.Background(), Principal{Roles: []Role{RoleArticleAuthor}})
+	assert.NoError(t, err)
+	assert.Equal(t, events.APIGatewayCustomAuthorizerPolicy{
+		Version: "2012-10-17",
+		Statement: []events.IAMPolicyStatement{
+			createAllowStatement("arn:aws:execute-api:us-east-1:1234:api/main/GET/self"),
+			createAllowStatement("arn:aws:execute-api:us-east-1:1234:api/main/PUT/article/slug/*"),
+		},
+	}, policy)
+}
+
+type gatewayMethod struct {
+	method string
+	path   string
+}
+
+var (
+	tfBlockStart = regexp.MustCompile(`^resource "(aws_api_gateway_resource|aws_api_gateway_method)" "(\w+)" \{`)
+	tfAttribute  = regexp.MustCompile(`^\s*(\w+)\s*=\s*"?([^"]*)"?\s*$`)
+	tfResourceID = regexp.MustCompile(`^aws_api_gateway_resource\.(\w+)\.id$`)
+)
+
+// readGatewayMethods pulls every custom authorized method out of the terraform for the api so the route table can
+// be checked against what is actually deployed
+func readGatewayMethods(t *testing.T) []gatewayMethod {
+	files, err := filepath.Glob(filepath.Join(infrastructureDir, "*.tf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources := make(map[string]map[string]string)
+	methods := make([]map[string]string, 0)
+	for _, f := range files {
+		in, err := os.Open(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var current map[string]string
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if match := tfBlockStart.FindStringSubmatch(line); match != nil {
+				current = make(map[string]string)
+				if match[1] == "aws_api_gateway_resource" {
+					resources[match[2]] = current
+				} else {
+					methods = append(methods, current)
+				}
+			} else if line == "}" {
+				current = nil
+			} else if current != nil {
+				if match := tfAttribute.FindStringSubmatch(line); match != nil {
+					current[match[1]] = match[2]
+				}
+			}
+		}
+		_ = in.Close()
+	}
+
+	var resolvePath func(resourceRef string) string
+	resolvePath = func(resourceRef string) string {
+		match := tfResourceID.FindStringSubmatch(resourceRef)
+		if match == nil {
+			return ""
+		}
+		resource, exists := resources[match[1]]
+		if !exists {
+			t.Fatalf("unknown resource %s", resourceRef)
+		}
+		part := resource["path_part"]
+		// path parameters can be anything, so stand in a concrete value
+		if strings.HasPrefix(part, "{") {
+			part = "placeholder"
+		}
+		parent := resolvePath(resource["parent_id"])
+		if parent == "" {
+			return part
+		}
+		return parent + "/" + part
+	}
+
+	ret := make([]gatewayMethod, 0)
+	for _, m := range methods {
+		if m["authorization"] != "CUSTOM" {
+			continue
+		}
+		ret = append(ret, gatewayMethod{m["http_method"], resolvePath(m["resource_id"])})
+	}
+	return ret
+}
+
+func TestRouteTable_CoversAPIGatewayRoutes(t *testing.T) {
+	routes := loadRouteTable(t)
+	gatewayMethods := readGatewayMethods(t)
+	assert.NotEmpty(t, gatewayMethods)
+
+	for _, m := range gatewayMethods {
+		covered := false
+		for _, r := range routes {
+			if r.Matches(m.method, m.path) {
+				covered = true
+				break
+			}
+		}
+		assert.True(t, covered, "%s %s is not in the route table", m.method, m.path)
+	}
+
+	for _, r := range routes {
+		used := false
+		for _, m := range gatewayMethods {
+			if r.Matches(m.method, m.path) {
+				used = true
+				break
+			}
+		}
+		assert.True(t, used, "route %s %s does not match anything in api gateway", r.Method, r.Resource)
+	}
+}
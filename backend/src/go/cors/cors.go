@@ -18,7 +18,7 @@ func NewResponseHeaderBuilder(allowedDomains []string) ResponseHeaderBuilder {
 			headers["Access-Control-Allow-Origin"] = origin
 			headers["Access-Control-Allow-Headers"] = "Authorization,Content-Type"
 			headers["Access-Control-Expose-Headers"] = "Location"
-			headers["Access-Control-Allow-Methods"] = "OPTIONS,HEAD,GET,POST,PUT,DELETE"
+			headers["Access-Control-Allow-Methods"] = "OPTIONS,HEAD,GET,POST,PUT,PATCH,DELETE"
 		}
 		headers["Vary"] = "Origin"
 		return headers
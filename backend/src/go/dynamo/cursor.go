@@ -0,0 +1,63 @@
+package dynamo
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidCursor is returned when decoding a cursor that was not produced by EncodeCursor for the same partition
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// TimeKey renders a time so that lexical ordering matches chronological ordering, for tables that keep everything in a
+// single partition sorted by time
+func TimeKey(t time.Time) string {
+	return fmt.Sprintf("%020d", t.UnixNano())
+}
+
+// TimeSortKey gives a sort key ordered by the given time, the suffix keeping keys unique when things land in the same
+// nanosecond
+func TimeSortKey(t time.Time, suffix string) string {
+	return fmt.Sprintf("%s#%s", TimeKey(t), suffix)
+}
+
+// EncodeCursor turns the last evaluated key of a query into an opaque cursor. Keys must be made up entirely of string
+// attributes.
+func EncodeCursor(key map[string]*dynamodb.AttributeValue) (string, error) {
+	flat := make(map[string]string)
+	for k, v := range key {
+		flat[k] = aws.StringValue(v.S)
+	}
+	raw, err := json.Marshal(flat)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// DecodeCursor turns a cursor back into an exclusive start key, refusing anything that is not a key within the given
+// partition
+func DecodeCursor(cursor string, partitionField string, partition string, sortKeyField string) (map[string]*dynamodb.AttributeValue, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	flat := make(map[string]string)
+	err = json.Unmarshal(raw, &flat)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if flat[partitionField] != partition || flat[sortKeyField] == "" {
+		return nil, ErrInvalidCursor
+	}
+	ret := make(map[string]*dynamodb.AttributeValue)
+	for k, v := range flat {
+		ret[k] = &dynamodb.AttributeValue{S: aws.String(v)}
+	}
+	return ret, nil
+}
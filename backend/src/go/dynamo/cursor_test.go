@@ -0,0 +1,49 @@
+package dynamo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeSortKey_OrdersChronologically(t *testing.T) {
+	early := TimeSortKey(time.Unix(9, 0), "zzz")
+	late := TimeSortKey(time.Unix(10, 0), "aaa")
+	assert.True(t, early < late)
+	assert.True(t, late < TimeKey(time.Unix(10, 0))+"~")
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	key := map[string]*dynamodb.AttributeValue{
+		"Partition": {S: aws.String("Stuff")},
+		"SortKey":   {S: aws.String("00000000000000000001#abc")},
+	}
+	cursor, err := EncodeCursor(key)
+	assert.NoError(t, err)
+	decoded, err := DecodeCursor(cursor, "Partition", "Stuff", "SortKey")
+	assert.NoError(t, err)
+	assert.Equal(t, key, decoded)
+}
+
+func TestDecodeCursor_Invalid(t *testing.T) {
+	otherPartition, _ := EncodeCursor(map[string]*dynamodb.AttributeValue{
+		"Partition": {S: aws.String("SomethingElse")},
+		"SortKey":   {S: aws.String("123")},
+	})
+	noSortKey, _ := EncodeCursor(map[string]*dynamodb.AttributeValue{
+		"Partition": {S: aws.String("Stuff")},
+	})
+	testCases := []string{
+		"not base 64!",
+		"bm90IGpzb24",
+		otherPartition,
+		noSortKey,
+	}
+	for _, tc := range testCases {
+		_, err := DecodeCursor(tc, "Partition", "Stuff", "SortKey")
+		assert.Equal(t, ErrInvalidCursor, err, tc)
+	}
+}
@@ -1,8 +1,9 @@
 module github.com/jonsabados/sabadoscodes.com
 
-go 1.15
+go 1.22.2
 
 require (
+	github.com/HugoSmits86/nativewebp v0.9.3
 	github.com/aws/aws-lambda-go v1.23.0
 	github.com/aws/aws-sdk-go v1.37.30
 	github.com/aws/aws-xray-sdk-go v1.3.0
@@ -10,4 +11,14 @@ require (
 	github.com/pkg/errors v0.9.1
 	github.com/rs/zerolog v1.20.0
 	github.com/stretchr/testify v1.6.1
+	golang.org/x/image v0.18.0
+	golang.org/x/net v0.25.0
+	golang.org/x/text v0.16.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776 // indirect
 )
@@ -0,0 +1,418 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+// ArchiveKeyPrefix is where archived messages live in the mail bucket
+const ArchiveKeyPrefix = "archive/"
+
+const (
+	// every archived message lives in a single partition, keeping date range searches simple
+	archivePartition = "Archive"
+
+	// the index on message ID, for finding a single archived message
+	archiveMessageIDIndex = "MessageID"
+
+	fieldPartition       = "Partition"
+	fieldSortKey         = "SortKey"
+	fieldObjectKey       = "ObjectKey"
+	fieldFrom            = "From"
+	fieldTo              = "To"
+	fieldSubject         = "Subject"
+	fieldDate            = "Date"
+	fieldHeaderMessageID = "HeaderMessageID"
+	fieldReceived        = "Received"
+	fieldVerdicts        = "Verdicts"
+	// lower cased copies of from, to and subject, dynamo has no case insensitive contains
+	fieldFromSearch    = "FromSearch"
+	fieldToSearch      = "ToSearch"
+	fieldSubjectSearch = "SubjectSearch"
+
+	MaxArchivePageSize = 100
+)
+
+// ArchivedMessage is what is indexed about an archived message, enough to find it without opening it
+type ArchivedMessage struct {
+	MessageID string   `json:"messageId"`
+	From      []string `json:"from"`
+	To        []string `json:"to"`
+	Subject   string   `json:"subject"`
+	// Date is the date header, as sent
+	Date string `json:"date"`
+	// HeaderMessageID is the message-id header, as opposed to the ID SES gave the message
+	HeaderMessageID string    `json:"headerMessageId"`
+	Received        time.Time `json:"received"`
+	// Verdicts are the statuses of the checks SES ran, keyed by check
+	Verdicts map[VerdictCheck]string `json:"verdicts"`
+	// ObjectKey is where the raw message lives in the mail bucket
+	ObjectKey string `json:"-"`
+}
+
+// ArchiveKey gives where a message received at the given time is archived, under a dated prefix so the bucket can be
+// browsed by day
+func ArchiveKey(messageID string, received time.Time) string {
+	return fmt.Sprintf("%s%s/%s", ArchiveKeyPrefix, received.UTC().Format("2006/01/02"), messageID)
+}
+
+// NewArchivedMessage takes what is indexed from the event SES sent for a message
+func NewArchivedMessage(record events.SimpleEmailRecord) ArchivedMessage {
+	message := record.SES.Mail
+	receipt := record.SES.Receipt
+	to := message.CommonHeaders.To
+	if len(to) == 0 {
+		to = receipt.Recipients
+	}
+	return ArchivedMessage{
+		MessageID:       message.MessageID,
+		From:            message.CommonHeaders.From,
+		To:              to,
+		Subject:         message.CommonHeaders.Subject,
+		Date:            message.CommonHeaders.Date,
+		HeaderMessageID: message.CommonHeaders.MessageID,
+		Received:        message.Timestamp,
+		Verdicts: map[VerdictCheck]string{
+			VerdictCheckSpam:  receipt.SpamVerdict.Status,
+			VerdictCheckVirus: receipt.VirusVerdict.Status,
+			VerdictCheckSPF:   receipt.SPFVerdict.Status,
+			VerdictCheckDKIM:  receipt.DKIMVerdict.Status,
+			VerdictCheckDMARC: receipt.DMARCVerdict.Status,
+		},
+		ObjectKey: ArchiveKey(message.MessageID, message.Timestamp),
+	}
+}
+
+// Archiver moves the message SES stored in the mail bucket into the archive and indexes it
+type Archiver func(ctx context.Context, record events.SimpleEmailRecord) error
+
+func NewArchiver(mailBucket string, copyObject s3.ObjectCopier, removeObject s3.ObjectRemover, indexMessage ArchiveIndexer) Archiver {
+	return func(ctx context.Context, record events.SimpleEmailRecord) error {
+		archived := NewArchivedMessage(record)
+		err := copyObject(ctx, mailBucket, archived.MessageID, archived.ObjectKey)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		err = indexMessage(ctx, archived)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		err = removeObject(ctx, mailBucket, archived.MessageID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		return nil
+	}
+}
+
+// ArchiveIndexer records an archived message in the archive index
+type ArchiveIndexer func(ctx context.Context, message ArchivedMessage) error
+
+func NewArchiveIndexer(db *dynamodb.DynamoDB, archiveTable string) ArchiveIndexer {
+	return func(ctx context.Context, message ArchivedMessage) error {
+		verdicts := make(map[string]*dynamodb.AttributeValue)
+		for check, status := range message.Verdicts {
+			if status != "" {
+				verdicts[string(check)] = &dynamodb.AttributeValue{S: aws.String(status)}
+			}
+		}
+		item := map[string]*dynamodb.AttributeValue{
+			fieldPartition:     {S: aws.String(archivePartition)},
+			fieldSortKey:       {S: aws.String(dynamo.TimeSortKey(message.Received, message.MessageID))},
+			fieldMessageID:     {S: aws.String(message.MessageID)},
+			fieldObjectKey:     {S: aws.String(message.ObjectKey)},
+			fieldReceived:      {N: aws.String(strconv.FormatInt(message.Received.UnixNano(), 10))},
+			fieldVerdicts:      {M: verdicts},
+			fieldFromSearch:    {S: aws.String(searchable(strings.Join(message.From, "\n")))},
+			fieldToSearch:      {S: aws.String(searchable(strings.Join(message.To, "\n")))},
+			fieldSubjectSearch: {S: aws.String(searchable(message.Subject))},
+		}
+		// dynamo refuses empty lists and strings in places, so anything blank is left off
+		// string sets refuse duplicates, and nothing stops a message naming the same address twice
+		from := uniqueAddresses(message.From)
+		if len(from) > 0 {
+			item[fieldFrom] = &dynamodb.AttributeValue{SS: aws.StringSlice(from)}
+		}
+		to := uniqueAddresses(message.To)
+		if len(to) > 0 {
+			item[fieldTo] = &dynamodb.AttributeValue{SS: aws.StringSlice(to)}
+		}
+		if message.Subject != "" {
+			item[fieldSubject] = &dynamodb.AttributeValue{S: aws.String(message.Subject)}
+		}
+		if message.Date != "" {
+			item[fieldDate] = &dynamodb.AttributeValue{S: aws.String(message.Date)}
+		}
+		if message.HeaderMessageID != "" {
+			item[fieldHeaderMessageID] = &dynamodb.AttributeValue{S: aws.String(message.HeaderMessageID)}
+		}
+		_, err := db.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(archiveTable),
+			Item:      item,
+		})
+		return errors.WithStack(err)
+	}
+}
+
+// ArchiveQuery narrows down archived messages, zero values mean no restriction. From, To and Subject match anywhere
+// in the field, ignoring case.
+type ArchiveQuery struct {
+	From    string
+	To      string
+	Subject string
+	After   time.Time
+	Before  time.Time
+	Cursor  string
+	Limit   int
+}
+
+type ArchivePage struct {
+	Messages   []ArchivedMessage `json:"results"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+}
+
+// ErrInvalidArchiveCursor is returned when a query carries a cursor that was not produced by a previous query
+var ErrInvalidArchiveCursor = dynamo.ErrInvalidCursor
+
+// ArchiveSearcher finds archived messages, newest first
+type ArchiveSearcher func(ctx context.Context, query ArchiveQuery) (ArchivePage, error)
+
+func NewArchiveSearcher(db *dynamodb.DynamoDB, archiveTable string) ArchiveSearcher {
+	return func(ctx context.Context, query ArchiveQuery) (ArchivePage, error) {
+		after := time.Unix(0, 0)
+		if !query.After.IsZero() {
+			after = query.After
+		}
+		before := time.Now()
+		if !query.Before.IsZero() {
+			before = query.Before
+		}
+		limit := query.Limit
+		if limit <= 0 || limit > MaxArchivePageSize {
+			limit = MaxArchivePageSize
+		}
+
+		input := &dynamodb.QueryInput{
+			TableName:              aws.String(archiveTable),
+			KeyConditionExpression: aws.String("#partition = :partition AND #sortKey BETWEEN :after AND :before"),
+			ExpressionAttributeNames: map[string]*string{
+				"#partition": aws.String(fieldPartition),
+				"#sortKey":   aws.String(fieldSortKey),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":partition": {S: aws.String(archivePartition)},
+				":after":     {S: aws.String(dynamo.TimeKey(after))},
+				// sort keys have the message ID after the time, so bump the upper bound to include everything in the last ns
+				":before": {S: aws.String(dynamo.TimeKey(before) + "~")},
+			},
+			ScanIndexForward: aws.Bool(false),
+		}
+
+		filters := make([]string, 0)
+		addFilter := func(name, field, value string) {
+			if value == "" {
+				return
+			}
+			filters = append(filters, fmt.Sprintf("contains(#%s, :%s)", name, name))
+			input.ExpressionAttributeNames["#"+name] = aws.String(field)
+			input.ExpressionAttributeValues[":"+name] = &dynamodb.AttributeValue{S: aws.String(searchable(value))}
+		}
+		addFilter("from", fieldFromSearch, query.From)
+		addFilter("to", fieldToSearch, query.To)
+		addFilter("subject", fieldSubjectSearch, query.Subject)
+		if len(filters) > 0 {
+			input.FilterExpression = aws.String(strings.Join(filters, " AND "))
+		}
+
+		if query.Cursor != "" {
+			startKey, err := dynamo.DecodeCursor(query.Cursor, fieldPartition, archivePartition, fieldSortKey)
+			if err != nil {
+				return ArchivePage{}, err
+			}
+			input.ExclusiveStartKey = startKey
+		}
+
+		// Limit caps what is read before filtering, so with a filter a single query can come back short or even empty
+		// while there is more to read. Keep going until the page is full or everything has been read.
+		ret := ArchivePage{
+			Messages: make([]ArchivedMessage, 0, limit),
+		}
+		for {
+			input.Limit = aws.Int64(int64(limit - len(ret.Messages)))
+			res, err := db.QueryWithContext(ctx, input)
+			if err != nil {
+				return ArchivePage{}, errors.WithStack(err)
+			}
+			for _, item := range res.Items {
+				m, err := toArchivedMessage(item)
+				if err != nil {
+					return ArchivePage{}, err
+				}
+				ret.Messages = append(ret.Messages, m)
+			}
+			if len(res.LastEvaluatedKey) == 0 {
+				return ret, nil
+			}
+			if len(ret.Messages) >= limit {
+				ret.NextCursor, err = dynamo.EncodeCursor(res.LastEvaluatedKey)
+				if err != nil {
+					return ArchivePage{}, err
+				}
+				return ret, nil
+			}
+			input.ExclusiveStartKey = res.LastEvaluatedKey
+		}
+	}
+}
+
+// ArchiveFetcher finds a single archived message, giving nil if there is no such message
+type ArchiveFetcher func(ctx context.Context, messageID string) (*ArchivedMessage, error)
+
+func NewArchiveFetcher(db *dynamodb.DynamoDB, archiveTable string) ArchiveFetcher {
+	return func(ctx context.Context, messageID string) (*ArchivedMessage, error) {
+		res, err := db.QueryWithContext(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(archiveTable),
+			IndexName:              aws.String(archiveMessageIDIndex),
+			KeyConditionExpression: aws.String("#messageId = :messageId"),
+			ExpressionAttributeNames: map[string]*string{
+				"#messageId": aws.String(fieldMessageID),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":messageId": {S: aws.String(messageID)},
+			},
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if len(res.Items) == 0 {
+			return nil, nil
+		}
+		ret, err := toArchivedMessage(res.Items[0])
+		if err != nil {
+			return nil, err
+		}
+		return &ret, nil
+	}
+}
+
+// ArchivePurger removes archived messages, and their index entries, received before the given time. It gives the
+// number of messages removed.
+type ArchivePurger func(ctx context.Context, receivedBefore time.Time) (int, error)
+
+func NewArchivePurger(db *dynamodb.DynamoDB, archiveTable string, mailBucket string, removeObject s3.ObjectRemover) ArchivePurger {
+	return func(ctx context.Context, receivedBefore time.Time) (int, error) {
+		purged := 0
+		input := &dynamodb.QueryInput{
+			TableName:              aws.String(archiveTable),
+			KeyConditionExpression: aws.String("#partition = :partition AND #sortKey < :before"),
+			ExpressionAttributeNames: map[string]*string{
+				"#partition": aws.String(fieldPartition),
+				"#sortKey":   aws.String(fieldSortKey),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":partition": {S: aws.String(archivePartition)},
+				":before":    {S: aws.String(dynamo.TimeKey(receivedBefore))},
+			},
+			ProjectionExpression: aws.String("#partition, #sortKey, #objectKey"),
+		}
+		input.ExpressionAttributeNames["#objectKey"] = aws.String(fieldObjectKey)
+
+		for {
+			res, err := db.QueryWithContext(ctx, input)
+			if err != nil {
+				return purged, errors.WithStack(err)
+			}
+			for _, item := range res.Items {
+				objectKey := aws.StringValue(item[fieldObjectKey].S)
+				// message first, an index entry without its message is merely untidy where the reverse is a message
+				// nothing will ever clean up
+				err = removeObject(ctx, mailBucket, objectKey)
+				if err != nil {
+					return purged, errors.WithStack(err)
+				}
+				_, err = db.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+					TableName: aws.String(archiveTable),
+					Key: map[string]*dynamodb.AttributeValue{
+						fieldPartition: item[fieldPartition],
+						fieldSortKey:   item[fieldSortKey],
+					},
+				})
+				if err != nil {
+					return purged, errors.WithStack(err)
+				}
+				zerolog.Ctx(ctx).Debug().Str("key", objectKey).Msg("purged archived message")
+				purged++
+			}
+			if len(res.LastEvaluatedKey) == 0 {
+				return purged, nil
+			}
+			input.ExclusiveStartKey = res.LastEvaluatedKey
+		}
+	}
+}
+
+func toArchivedMessage(item map[string]*dynamodb.AttributeValue) (ArchivedMessage, error) {
+	nanos, err := strconv.ParseInt(aws.StringValue(item[fieldReceived].N), 10, 64)
+	if err != nil {
+		return ArchivedMessage{}, errors.Errorf("invalid received time %s on archived message %s", aws.StringValue(item[fieldReceived].N), aws.StringValue(item[fieldMessageID].S))
+	}
+	ret := ArchivedMessage{
+		MessageID: aws.StringValue(item[fieldMessageID].S),
+		From:      make([]string, 0),
+		To:        make([]string, 0),
+		Received:  time.Unix(0, nanos).UTC(),
+		Verdicts:  make(map[VerdictCheck]string),
+		ObjectKey: aws.StringValue(item[fieldObjectKey].S),
+	}
+	if item[fieldFrom] != nil {
+		ret.From = aws.StringValueSlice(item[fieldFrom].SS)
+	}
+	if item[fieldTo] != nil {
+		ret.To = aws.StringValueSlice(item[fieldTo].SS)
+	}
+	if item[fieldSubject] != nil {
+		ret.Subject = aws.StringValue(item[fieldSubject].S)
+	}
+	if item[fieldDate] != nil {
+		ret.Date = aws.StringValue(item[fieldDate].S)
+	}
+	if item[fieldHeaderMessageID] != nil {
+		ret.HeaderMessageID = aws.StringValue(item[fieldHeaderMessageID].S)
+	}
+	if item[fieldVerdicts] != nil {
+		for check, status := range item[fieldVerdicts].M {
+			ret.Verdicts[VerdictCheck(check)] = aws.StringValue(status.S)
+		}
+	}
+	return ret, nil
+}
+
+func searchable(s string) string {
+	return strings.ToLower(s)
+}
+
+// uniqueAddresses drops repeats of an address, ignoring case, keeping the first spelling seen
+func uniqueAddresses(addresses []string) []string {
+	seen := make(map[string]bool)
+	ret := make([]string, 0, len(addresses))
+	for _, a := range addresses {
+		if seen[searchable(a)] {
+			continue
+		}
+		seen[searchable(a)] = true
+		ret = append(ret, a)
+	}
+	return ret
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/auth"
+	"github.com/jonsabados/sabadoscodes.com/cors"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/mail"
+	"github.com/jonsabados/sabadoscodes.com/response"
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+const downloadURLLifetime = time.Minute * 5
+
+type downloadResponse struct {
+	mail.ArchivedMessage
+	DownloadURL     string    `json:"downloadUrl"`
+	DownloadExpires time.Time `json:"downloadExpires"`
+}
+
+func newHandler(prepLogs logging.Preparer,
+	corsHeaders cors.ResponseHeaderBuilder,
+	extractPrincipal auth.PrincipalExtractor,
+	authorize auth.RouteAuthorizer,
+	mailBucket string,
+	fetchArchived mail.ArchiveFetcher,
+	presignGet s3.PresignedGetCreator) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		ctx, _ = prepLogs(ctx)
+		responseHeaders := corsHeaders(request.Headers)
+
+		principal, err := extractPrincipal(request)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		if !authorize(principal, request) {
+			zerolog.Ctx(ctx).Warn().Interface("user", principal).Msg("user not authorized for route")
+			return response.HandleForbidden(ctx, responseHeaders, "not permitted"), nil
+		}
+
+		errors := httputil.ErrorTracker{}
+		messageID, err := url.PathUnescape(request.PathParameters["messageId"])
+		if err != nil || strings.TrimSpace(messageID) == "" {
+			errors = errors.WithFieldError("messageId", "invalid message id")
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		archived, err := fetchArchived(ctx, messageID)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		if archived == nil {
+			return response.HandleNtFound(ctx, responseHeaders), nil
+		}
+
+		zerolog.Ctx(ctx).Info().Interface("user", principal).Str("id", messageID).Msg("user downloading archived mail")
+		presigned, err := presignGet(ctx, mailBucket, archived.ObjectKey, fmt.Sprintf("%s.eml", messageID), downloadURLLifetime)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		responseBody, err := json.Marshal(downloadResponse{
+			ArchivedMessage: *archived,
+			DownloadURL:     presigned.URL,
+			DownloadExpires: presigned.Expires,
+		})
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		responseHeaders["content-type"] = "application/json"
+
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusOK,
+			Headers:    responseHeaders,
+			Body:       string(responseBody),
+		}, nil
+	}
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	allowedDomains := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
+	mailBucket := os.Getenv("MAIL_BUCKET")
+	archiveTable := os.Getenv("ARCHIVE_TABLE")
+
+	routes, err := auth.ParseRouteTable([]byte(os.Getenv("ROUTE_TABLE")))
+	if err != nil {
+		panic(err)
+	}
+
+	dynamoClient := dynamo.RawClient(sess)
+	s3Client := s3.RawClient(sess)
+
+	handler := newHandler(logging.NewPreparer(),
+		cors.NewResponseHeaderBuilder(allowedDomains),
+		auth.NewPrincipalExtractor(),
+		auth.NewRouteAuthorizer(routes),
+		mailBucket,
+		mail.NewArchiveFetcher(dynamoClient, archiveTable),
+		s3.NewPresignedGetCreator(s3Client))
+
+	lambda.Start(handler)
+}
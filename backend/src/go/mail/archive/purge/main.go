@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/mail"
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+func newHandler(prepLogs logging.Preparer,
+	retention time.Duration,
+	purgeArchive mail.ArchivePurger) func(ctx context.Context) error {
+
+	return func(ctx context.Context) error {
+		ctx, logger := prepLogs(ctx)
+
+		cutoff := time.Now().Add(-retention)
+		purged, err := purgeArchive(ctx, cutoff)
+		if err != nil {
+			logger.Error().Stack().Err(err).Int("purged", purged).Msg("error purging mail archive")
+			return err
+		}
+		logger.Info().Time("cutoff", cutoff).Int("purged", purged).Msg("mail archive purged")
+		return nil
+	}
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	retentionDays, err := strconv.Atoi(os.Getenv("ARCHIVE_RETENTION_DAYS"))
+	if err != nil {
+		panic(err)
+	}
+
+	dynamoClient := dynamo.RawClient(sess)
+	s3Client := s3.RawClient(sess)
+	purger := mail.NewArchivePurger(dynamoClient, os.Getenv("ARCHIVE_TABLE"), os.Getenv("MAIL_BUCKET"), s3.NewObjectRemover(s3Client))
+
+	lambda.Start(newHandler(logging.NewPreparer(), time.Duration(retentionDays)*24*time.Hour, purger))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/auth"
+	"github.com/jonsabados/sabadoscodes.com/cors"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/mail"
+	"github.com/jonsabados/sabadoscodes.com/response"
+)
+
+func newHandler(prepLogs logging.Preparer,
+	corsHeaders cors.ResponseHeaderBuilder,
+	extractPrincipal auth.PrincipalExtractor,
+	authorize auth.RouteAuthorizer,
+	searchArchive mail.ArchiveSearcher) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		ctx, _ = prepLogs(ctx)
+		responseHeaders := corsHeaders(request.Headers)
+
+		principal, err := extractPrincipal(request)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		if !authorize(principal, request) {
+			zerolog.Ctx(ctx).Warn().Interface("user", principal).Msg("user not authorized for route")
+			return response.HandleForbidden(ctx, responseHeaders, "not permitted"), nil
+		}
+
+		errors := httputil.ErrorTracker{}
+		params := request.QueryStringParameters
+		query := mail.ArchiveQuery{
+			From:    params["from"],
+			To:      params["to"],
+			Subject: params["subject"],
+			Cursor:  params["cursor"],
+		}
+		if after, hasParam := params["after"]; hasParam {
+			query.After, err = time.Parse(time.RFC3339, after)
+			if err != nil {
+				errors = errors.WithFieldError("after", "must be an RFC3339 timestamp")
+			}
+		}
+		if before, hasParam := params["before"]; hasParam {
+			query.Before, err = time.Parse(time.RFC3339, before)
+			if err != nil {
+				errors = errors.WithFieldError("before", "must be an RFC3339 timestamp")
+			}
+		}
+		if limit, hasParam := params["limit"]; hasParam {
+			query.Limit, err = strconv.Atoi(limit)
+			if err != nil || query.Limit < 1 || query.Limit > mail.MaxArchivePageSize {
+				errors = errors.WithFieldError("limit", "must be a number between 1 and 100")
+			}
+		}
+		if errors.InError() {
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		zerolog.Ctx(ctx).Info().Interface("user", principal).Interface("query", query).Msg("user searching mail archive")
+		page, err := searchArchive(ctx, query)
+		if err == mail.ErrInvalidArchiveCursor {
+			errors = errors.WithFieldError("cursor", "invalid cursor")
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		responseBody, err := json.Marshal(page)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		responseHeaders["content-type"] = "application/json"
+
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusOK,
+			Headers:    responseHeaders,
+			Body:       string(responseBody),
+		}, nil
+	}
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	allowedDomains := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
+	archiveTable := os.Getenv("ARCHIVE_TABLE")
+
+	routes, err := auth.ParseRouteTable([]byte(os.Getenv("ROUTE_TABLE")))
+	if err != nil {
+		panic(err)
+	}
+
+	dynamoClient := dynamo.RawClient(sess)
+	searcher := mail.NewArchiveSearcher(dynamoClient, archiveTable)
+
+	handler := newHandler(logging.NewPreparer(), cors.NewResponseHeaderBuilder(allowedDomains), auth.NewPrincipalExtractor(), auth.NewRouteAuthorizer(routes), searcher)
+
+	lambda.Start(handler)
+}
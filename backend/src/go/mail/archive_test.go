@@ -0,0 +1,167 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+)
+
+func archiveRecord() events.SimpleEmailRecord {
+	return events.SimpleEmailRecord{
+		SES: events.SimpleEmailService{
+			Mail: events.SimpleEmailMessage{
+				MessageID: "12345",
+				Timestamp: time.Date(2021, 3, 7, 23, 30, 0, 0, time.FixedZone("CST", -6*60*60)),
+				CommonHeaders: events.SimpleEmailCommonHeaders{
+					From:      []string{"Bob Smith <bob@example.com>"},
+					To:        []string{"support@sabadoscodes.com"},
+					MessageID: "<abc@example.com>",
+					Date:      "Sun, 07 Mar 2021 23:29:58 -0600",
+					Subject:   "Help with the site",
+				},
+			},
+			Receipt: events.SimpleEmailReceipt{
+				Recipients:   []string{"support@sabadoscodes.com"},
+				SpamVerdict:  events.SimpleEmailVerdict{Status: "PASS"},
+				VirusVerdict: events.SimpleEmailVerdict{Status: "PASS"},
+				SPFVerdict:   events.SimpleEmailVerdict{Status: "FAIL"},
+				DKIMVerdict:  events.SimpleEmailVerdict{Status: "GRAY"},
+				DMARCVerdict: events.SimpleEmailVerdict{Status: "PASS"},
+			},
+		},
+	}
+}
+
+func TestArchiveKey(t *testing.T) {
+	received := time.Date(2021, 3, 7, 23, 30, 0, 0, time.FixedZone("CST", -6*60*60))
+	assert.Equal(t, "archive/2021/03/08/12345", ArchiveKey("12345", received))
+}
+
+func TestNewArchivedMessage(t *testing.T) {
+	asserter := assert.New(t)
+
+	record := archiveRecord()
+	res := NewArchivedMessage(record)
+	asserter.Equal(ArchivedMessage{
+		MessageID:       "12345",
+		From:            []string{"Bob Smith <bob@example.com>"},
+		To:              []string{"support@sabadoscodes.com"},
+		Subject:         "Help with the site",
+		Date:            "Sun, 07 Mar 2021 23:29:58 -0600",
+		HeaderMessageID: "<abc@example.com>",
+		Received:        record.SES.Mail.Timestamp,
+		Verdicts: map[VerdictCheck]string{
+			VerdictCheckSpam:  "PASS",
+			VerdictCheckVirus: "PASS",
+			VerdictCheckSPF:   "FAIL",
+			VerdictCheckDKIM:  "GRAY",
+			VerdictCheckDMARC: "PASS",
+		},
+		ObjectKey: "archive/2021/03/08/12345",
+	}, res)
+
+	// bcc'd mail has no to header worth speaking of
+	record.SES.Mail.CommonHeaders.To = nil
+	record.SES.Receipt.Recipients = []string{"billing@sabadoscodes.com"}
+	asserter.Equal([]string{"billing@sabadoscodes.com"}, NewArchivedMessage(record).To)
+}
+
+func Test_NewArchiver(t *testing.T) {
+	asserter := assert.New(t)
+
+	inputCtx := context.WithValue(context.Background(), "foo", "bar")
+	steps := make([]string, 0)
+	copyObject := func(ctx context.Context, bucket string, sourceKey string, targetKey string) error {
+		steps = append(steps, "copy")
+		asserter.Equal(inputCtx, ctx)
+		asserter.Equal("somebucket", bucket)
+		asserter.Equal("12345", sourceKey)
+		asserter.Equal("archive/2021/03/08/12345", targetKey)
+		return nil
+	}
+	indexMessage := func(ctx context.Context, message ArchivedMessage) error {
+		steps = append(steps, "index")
+		asserter.Equal(inputCtx, ctx)
+		asserter.Equal(NewArchivedMessage(archiveRecord()), message)
+		return nil
+	}
+	removeObject := func(ctx context.Context, bucket, object string) error {
+		steps = append(steps, "remove")
+		asserter.Equal("somebucket", bucket)
+		asserter.Equal("12345", object)
+		return nil
+	}
+
+	err := NewArchiver("somebucket", copyObject, removeObject, indexMessage)(inputCtx, archiveRecord())
+	asserter.NoError(err)
+	asserter.Equal([]string{"copy", "index", "remove"}, steps)
+}
+
+func Test_NewArchiver_Fails_LeavesOriginal(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		copyErr   error
+		indexErr  error
+		expectErr string
+	}{
+		{"copy fails", errors.New("KaBOOm!"), nil, "KaBOOm!"},
+		{"index fails", nil, errors.New("KaPow!"), "KaPow!"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			copyObject := func(ctx context.Context, bucket string, sourceKey string, targetKey string) error {
+				return tc.copyErr
+			}
+			indexMessage := func(ctx context.Context, message ArchivedMessage) error {
+				return tc.indexErr
+			}
+			removeObject := func(ctx context.Context, bucket, object string) error {
+				asserter.Fail("object should have been left in bucket")
+				return nil
+			}
+
+			err := NewArchiver("somebucket", copyObject, removeObject, indexMessage)(context.Background(), archiveRecord())
+			asserter.EqualError(err, tc.expectErr)
+		})
+	}
+}
+
+func Test_toArchivedMessage(t *testing.T) {
+	asserter := assert.New(t)
+
+	res, err := toArchivedMessage(map[string]*dynamodb.AttributeValue{
+		fieldMessageID: {S: aws.String("12345")},
+		fieldObjectKey: {S: aws.String("archive/2021/03/08/12345")},
+		fieldReceived:  {N: aws.String("1615181400000000000")},
+		fieldFrom:      {SS: aws.StringSlice([]string{"bob@example.com"})},
+		fieldVerdicts:  {M: map[string]*dynamodb.AttributeValue{"spf": {S: aws.String("FAIL")}}},
+	})
+	asserter.NoError(err)
+	asserter.Equal(ArchivedMessage{
+		MessageID: "12345",
+		From:      []string{"bob@example.com"},
+		To:        []string{},
+		Received:  time.Date(2021, 3, 8, 5, 30, 0, 0, time.UTC),
+		Verdicts:  map[VerdictCheck]string{VerdictCheckSPF: "FAIL"},
+		ObjectKey: "archive/2021/03/08/12345",
+	}, res)
+
+	_, err = toArchivedMessage(map[string]*dynamodb.AttributeValue{
+		fieldMessageID: {S: aws.String("12345")},
+		fieldReceived:  {N: aws.String("yesterday")},
+	})
+	asserter.EqualError(err, "invalid received time yesterday on archived message 12345")
+}
+
+func Test_uniqueAddresses(t *testing.T) {
+	assert.Equal(t, []string{"Bob@example.com", "alice@example.com"}, uniqueAddresses([]string{"Bob@example.com", "alice@example.com", "bob@example.com"}))
+	assert.Equal(t, []string{}, uniqueAddresses(nil))
+}
@@ -0,0 +1,138 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pkg/errors"
+
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+// DeadLetterKeyPrefix is where messages that couldn't be processed live in the mail bucket, each as the raw message
+// under its ID with the details of what went wrong alongside it
+const DeadLetterKeyPrefix = "dead-letter/"
+
+// deadLetterDetailsSuffix is added to the message key for the details
+const deadLetterDetailsSuffix = ".json"
+
+// DeadLetter is what is kept about a message that couldn't be processed, enough to replay it later
+type DeadLetter struct {
+	MessageID string    `json:"messageId"`
+	Error     string    `json:"error"`
+	Failed    time.Time `json:"failed"`
+	// Record is the event SES sent for the message
+	Record events.SimpleEmailRecord `json:"record"`
+}
+
+// DeadLetterMessageKey is where the raw message for a dead letter lives
+func DeadLetterMessageKey(messageID string) string {
+	return DeadLetterKeyPrefix + messageID
+}
+
+// DeadLetterDetailsKey is where the details of a dead letter live
+func DeadLetterDetailsKey(messageID string) string {
+	return DeadLetterKeyPrefix + messageID + deadLetterDetailsSuffix
+}
+
+// DeadLetterer sets aside a message that couldn't be processed, along with why
+type DeadLetterer func(ctx context.Context, record events.SimpleEmailRecord, cause error) error
+
+// NewDeadLetterer creates a DeadLetterer that saves the details first so there is a record of the failure even if the
+// message itself has already gone from the bucket
+func NewDeadLetterer(mailBucket string, saveObject s3.ObjectSaver, describeObject s3.ObjectDescriber, copyObject s3.ObjectCopier, removeObject s3.ObjectRemover) DeadLetterer {
+	return func(ctx context.Context, record events.SimpleEmailRecord, cause error) error {
+		messageID := record.SES.Mail.MessageID
+		details, err := json.Marshal(DeadLetter{
+			MessageID: messageID,
+			Error:     fmt.Sprintf("%v", cause),
+			Failed:    time.Now(),
+			Record:    record,
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		err = saveObject(ctx, mailBucket, DeadLetterDetailsKey(messageID), bytes.NewReader(details), "application/json")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		info, err := describeObject(ctx, mailBucket, messageID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if info == nil {
+			// already dealt with or never stored, the details are all there is
+			return nil
+		}
+		return moveMessage(ctx, mailBucket, messageID, DeadLetterKeyPrefix, copyObject, removeObject)
+	}
+}
+
+// DeadLetterLister finds the dead letters in the mail bucket
+type DeadLetterLister func(ctx context.Context) ([]DeadLetter, error)
+
+func NewDeadLetterLister(mailBucket string, listObjects s3.ObjectLister, fetchObject s3.ObjectFetcher) DeadLetterLister {
+	return func(ctx context.Context) ([]DeadLetter, error) {
+		objects, err := listObjects(ctx, mailBucket, DeadLetterKeyPrefix)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		ret := make([]DeadLetter, 0)
+		for _, o := range objects {
+			if !strings.HasSuffix(o.Path, deadLetterDetailsSuffix) {
+				continue
+			}
+			content, err := fetchObject(ctx, mailBucket, o.Path)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			raw, err := io.ReadAll(content)
+			_ = content.Close()
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			deadLetter := DeadLetter{}
+			err = json.Unmarshal(raw, &deadLetter)
+			if err != nil {
+				return nil, errors.Wrapf(err, "reading %s", o.Path)
+			}
+			ret = append(ret, deadLetter)
+		}
+		return ret, nil
+	}
+}
+
+// DeadLetterRestorer puts a dead lettered message back where the forwarder expects to find it and clears away the
+// dead letter, ready for it to be processed again
+type DeadLetterRestorer func(ctx context.Context, messageID string) error
+
+func NewDeadLetterRestorer(mailBucket string, describeObject s3.ObjectDescriber, copyObject s3.ObjectCopier, removeObject s3.ObjectRemover) DeadLetterRestorer {
+	return func(ctx context.Context, messageID string) error {
+		info, err := describeObject(ctx, mailBucket, DeadLetterMessageKey(messageID))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if info != nil {
+			err = copyObject(ctx, mailBucket, DeadLetterMessageKey(messageID), messageID)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			err = removeObject(ctx, mailBucket, DeadLetterMessageKey(messageID))
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		err = removeObject(ctx, mailBucket, DeadLetterDetailsKey(messageID))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		return nil
+	}
+}
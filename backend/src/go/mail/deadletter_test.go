@@ -0,0 +1,143 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+func deadLetterRecord(messageID string) events.SimpleEmailRecord {
+	return events.SimpleEmailRecord{
+		SES: events.SimpleEmailService{
+			Mail: events.SimpleEmailMessage{
+				MessageID: messageID,
+				Source:    "bob@example.com",
+			},
+		},
+	}
+}
+
+func Test_NewDeadLetterer(t *testing.T) {
+	asserter := assert.New(t)
+
+	record := deadLetterRecord("12345")
+	saved := make(map[string]string)
+	saveObject := func(ctx context.Context, bucket string, objectKey string, object io.ReadSeeker, mimeType string) error {
+		asserter.Equal("somebucket", bucket)
+		asserter.Equal("application/json", mimeType)
+		content, _ := ioutil.ReadAll(object)
+		saved[objectKey] = string(content)
+		return nil
+	}
+	describeObject := func(ctx context.Context, bucket, object string) (*s3.ObjectInfo, error) {
+		asserter.Equal("12345", object)
+		return &s3.ObjectInfo{}, nil
+	}
+	copied := make(map[string]string)
+	copyObject := func(ctx context.Context, bucket string, sourceKey string, targetKey string) error {
+		copied[sourceKey] = targetKey
+		return nil
+	}
+	removed := make([]string, 0)
+	removeObject := func(ctx context.Context, bucket, object string) error {
+		removed = append(removed, object)
+		return nil
+	}
+
+	before := time.Now()
+	err := NewDeadLetterer("somebucket", saveObject, describeObject, copyObject, removeObject)(context.Background(), record, errors.New("KaBOOm!"))
+	asserter.NoError(err)
+
+	if asserter.Contains(saved, "dead-letter/12345.json") {
+		deadLetter := DeadLetter{}
+		asserter.NoError(json.Unmarshal([]byte(saved["dead-letter/12345.json"]), &deadLetter))
+		asserter.Equal("12345", deadLetter.MessageID)
+		asserter.Equal("KaBOOm!", deadLetter.Error)
+		asserter.False(deadLetter.Failed.Before(before))
+		asserter.Equal(record, deadLetter.Record)
+	}
+	asserter.Equal(map[string]string{"12345": "dead-letter/12345"}, copied)
+	asserter.Equal([]string{"12345"}, removed)
+}
+
+func Test_NewDeadLetterer_MessageGone_KeepsDetails(t *testing.T) {
+	asserter := assert.New(t)
+
+	saved := false
+	saveObject := func(ctx context.Context, bucket string, objectKey string, object io.ReadSeeker, mimeType string) error {
+		saved = true
+		return nil
+	}
+	describeObject := func(ctx context.Context, bucket, object string) (*s3.ObjectInfo, error) {
+		return nil, nil
+	}
+	copyObject := func(ctx context.Context, bucket string, sourceKey string, targetKey string) error {
+		asserter.Fail("nothing to copy")
+		return nil
+	}
+
+	err := NewDeadLetterer("somebucket", saveObject, describeObject, copyObject, nil)(context.Background(), deadLetterRecord("12345"), errors.New("KaBOOm!"))
+	asserter.NoError(err)
+	asserter.True(saved)
+}
+
+func Test_NewDeadLetterLister(t *testing.T) {
+	asserter := assert.New(t)
+
+	listObjects := func(ctx context.Context, bucket string, prefix string) ([]s3.Object, error) {
+		asserter.Equal("somebucket", bucket)
+		asserter.Equal(DeadLetterKeyPrefix, prefix)
+		return []s3.Object{
+			{Path: "dead-letter/12345"},
+			{Path: "dead-letter/12345.json"},
+			{Path: "dead-letter/67890.json"},
+		}, nil
+	}
+	fetchObject := func(ctx context.Context, bucket, object string) (io.ReadCloser, error) {
+		id := strings.TrimSuffix(strings.TrimPrefix(object, DeadLetterKeyPrefix), ".json")
+		content, _ := json.Marshal(DeadLetter{MessageID: id, Error: "KaBOOm!", Record: deadLetterRecord(id)})
+		return ioutil.NopCloser(strings.NewReader(string(content))), nil
+	}
+
+	deadLetters, err := NewDeadLetterLister("somebucket", listObjects, fetchObject)(context.Background())
+	asserter.NoError(err)
+	if asserter.Len(deadLetters, 2) {
+		asserter.Equal("12345", deadLetters[0].MessageID)
+		asserter.Equal("67890", deadLetters[1].MessageID)
+		asserter.Equal("bob@example.com", deadLetters[1].Record.SES.Mail.Source)
+	}
+}
+
+func Test_NewDeadLetterRestorer(t *testing.T) {
+	asserter := assert.New(t)
+
+	describeObject := func(ctx context.Context, bucket, object string) (*s3.ObjectInfo, error) {
+		asserter.Equal("dead-letter/12345", object)
+		return &s3.ObjectInfo{}, nil
+	}
+	copied := make(map[string]string)
+	copyObject := func(ctx context.Context, bucket string, sourceKey string, targetKey string) error {
+		copied[sourceKey] = targetKey
+		return nil
+	}
+	removed := make([]string, 0)
+	removeObject := func(ctx context.Context, bucket, object string) error {
+		removed = append(removed, object)
+		return nil
+	}
+
+	err := NewDeadLetterRestorer("somebucket", describeObject, copyObject, removeObject)(context.Background(), "12345")
+	asserter.NoError(err)
+	asserter.Equal(map[string]string{"dead-letter/12345": "12345"}, copied)
+	asserter.Equal([]string{"dead-letter/12345", "dead-letter/12345.json"}, removed)
+}
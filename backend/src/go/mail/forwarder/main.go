@@ -3,34 +3,190 @@ package main
 import (
 	"context"
 	"fmt"
+	netmail "net/mail"
+	"os"
+	"strconv"
+	"strings"
+
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-xray-sdk-go/xray"
-	"github.com/jonsabados/sabadoscodes.com/mail"
-	"github.com/jonsabados/sabadoscodes.com/s3"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
-	"os"
+
+	"github.com/jonsabados/sabadoscodes.com/audit"
+	"github.com/jonsabados/sabadoscodes.com/auth"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/mail"
+	"github.com/jonsabados/sabadoscodes.com/s3"
 )
 
-func NewRequestHandler(logger zerolog.Logger, forwardEmail mail.Forwarder, subjectToSend, sendFrom, sendTo string) func(ctx context.Context, events events.SimpleEmailEvent) error {
+// sesPrincipal is who verdict decisions are recorded against in the audit log
+var sesPrincipal = auth.Principal{
+	UserID: "ses",
+	Name:   "Inbound Mail",
+}
+
+func NewRequestHandler(logger zerolog.Logger,
+	verdictPolicy mail.VerdictPolicy,
+	loadRoutes mail.RoutingTableLoader,
+	forwardEmail mail.Forwarder,
+	archiveEmail mail.Archiver,
+	quarantineEmail mail.Quarantiner,
+	discardEmail mail.Discarder,
+	deadLetter mail.DeadLetterer,
+	lookupProcessed mail.ProcessedLookup,
+	recordProcessed mail.ProcessedRecorder,
+	recordAudit audit.Recorder,
+	archiveForwarded bool,
+	subjectToSend, sendFrom string) func(ctx context.Context, events events.SimpleEmailEvent) error {
+
+	// the forward is the copy that matters, the original is only kept around when archiving everything
+	cleanUpForwarded := func(ctx context.Context, e events.SimpleEmailRecord) error {
+		if archiveForwarded {
+			return archiveEmail(ctx, e)
+		}
+		return discardEmail(ctx, e.SES.Mail.MessageID)
+	}
+
+	// process deals with a message, giving mail.OutcomeForwarded for forwarded messages still needing cleaning up
+	process := func(ctx context.Context, e events.SimpleEmailRecord) (string, error) {
+		messageID := e.SES.Mail.MessageID
+
+		verdict := verdictPolicy.Decide(e.SES.Receipt)
+		logger.Info().Str("id", messageID).Str("action", string(verdict.Action)).Interface("failed", verdict.Failed).Msg("verdict decided")
+		if verdict.Action != mail.VerdictActionForward {
+			err := recordAudit(ctx, audit.NewEntry(ctx, sesPrincipal, audit.ActionMailVerdict, verdictTarget(e.SES.Mail, verdict)))
+			if err != nil {
+				return "", errors.WithStack(err)
+			}
+		}
+		switch verdict.Action {
+		case mail.VerdictActionDrop:
+			return string(verdict.Action), discardEmail(ctx, messageID)
+		case mail.VerdictActionQuarantine:
+			return string(verdict.Action), quarantineEmail(ctx, messageID)
+		}
+		subjectTag := ""
+		if verdict.Action == mail.VerdictActionTag {
+			subjectTag = verdict.SubjectTag()
+		}
+
+		routes, err := loadRoutes(ctx)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		route := routes.Route(e.SES.Receipt.Recipients, senders(e.SES.Mail), e.SES.Mail.CommonHeaders.Subject)
+		logger.Info().Str("id", messageID).Str("rule", route.Rule).Str("action", string(route.Action)).Strs("destinations", route.Destinations).Msg("routing email")
+
+		switch route.Action {
+		case mail.RouteActionForward:
+			fullSubject := fmt.Sprintf("%s (%s)", subjectToSend, messageID)
+			err = forwardEmail(ctx, messageID, fullSubject, subjectTag, sendFrom, route.Destinations)
+			if err != nil {
+				break
+			}
+			return mail.OutcomeForwarded, nil
+		case mail.RouteActionArchive:
+			err = archiveEmail(ctx, e)
+		case mail.RouteActionDrop:
+			err = discardEmail(ctx, messageID)
+		default:
+			err = errors.Errorf("unknown route action %s", route.Action)
+		}
+		return string(route.Action), err
+	}
+
 	return func(ctx context.Context, events events.SimpleEmailEvent) error {
 		ctx = logger.WithContext(ctx)
+		// one bad message shouldn't hold up the rest, anything that can't be dealt with is dead lettered and only
+		// failing to do even that fails the invocation
+		var unhandled error
 		for _, e := range events.Records {
-			logger.Info().Str("id", e.SES.Mail.MessageID).Msg("processing item")
-			fullSubject := fmt.Sprintf("%s (%s)", subjectToSend, e.SES.Mail.MessageID)
-			err := forwardEmail(ctx, e.SES.Mail.MessageID, fullSubject, sendFrom, sendTo)
+			messageID := e.SES.Mail.MessageID
+			logger.Info().Str("id", messageID).Msg("processing item")
+
+			outcome, err := lookupProcessed(ctx, messageID)
 			if err != nil {
-				logger.Error().Str("error", fmt.Sprintf("%+v", err)).Msg("error sending email")
-				return errors.WithStack(err)
+				logger.Error().Str("error", fmt.Sprintf("%+v", err)).Str("id", messageID).Msg("error checking if email was processed")
+				unhandled = errors.WithStack(err)
+				continue
+			}
+			switch {
+			case outcome == mail.OutcomeForwarded:
+				logger.Info().Str("id", messageID).Msg("email already forwarded, finishing cleaning it up")
+			case outcome != "":
+				logger.Info().Str("id", messageID).Str("outcome", outcome).Msg("email already processed, skipping")
+				continue
+			default:
+				outcome, err = process(ctx, e)
+				if err != nil {
+					logger.Error().Str("error", fmt.Sprintf("%+v", err)).Str("id", messageID).Msg("error processing email, dead lettering it")
+					outcome = mail.OutcomeDeadLetter
+					err = deadLetter(ctx, e, err)
+					if err != nil {
+						logger.Error().Str("error", fmt.Sprintf("%+v", err)).Str("id", messageID).Msg("error dead lettering email")
+						unhandled = errors.WithStack(err)
+						continue
+					}
+				} else if outcome == mail.OutcomeForwarded {
+					err = recordProcessed(ctx, messageID, outcome)
+					if err != nil {
+						logger.Error().Str("error", fmt.Sprintf("%+v", err)).Str("id", messageID).Msg("error recording email as forwarded")
+					}
+				}
+			}
+
+			// once forwarded a message must never be dead lettered, replaying it would forward it again. Failing to
+			// clean up the original fails the invocation instead, and the retry picks up from here.
+			if outcome == mail.OutcomeForwarded {
+				err = cleanUpForwarded(ctx, e)
+				if err != nil {
+					logger.Error().Str("error", fmt.Sprintf("%+v", err)).Str("id", messageID).Msg("error cleaning up forwarded email, leaving it for a retry")
+					unhandled = errors.WithStack(err)
+					continue
+				}
+				outcome = string(mail.RouteActionForward)
+			}
+
+			err = recordProcessed(ctx, messageID, outcome)
+			if err != nil {
+				// the work is done and the message is gone from where a retry would look for it, so failing the
+				// invocation would only make things worse
+				logger.Error().Str("error", fmt.Sprintf("%+v", err)).Str("id", messageID).Msg("error recording email as processed")
 			}
 		}
-		return nil
+		return unhandled
 	}
 }
 
+func verdictTarget(message events.SimpleEmailMessage, verdict mail.VerdictDecision) string {
+	failed := make([]string, len(verdict.Failed))
+	for i, f := range verdict.Failed {
+		failed[i] = string(f)
+	}
+	return fmt.Sprintf("%s from %s: %s (failed %s)", message.MessageID, message.Source, verdict.Action, strings.Join(failed, ", "))
+}
+
+// senders gives both the envelope sender and the from header addresses, as either may be what a rule is after
+func senders(message events.SimpleEmailMessage) []string {
+	ret := make([]string, 0, len(message.CommonHeaders.From)+1)
+	if message.Source != "" {
+		ret = append(ret, message.Source)
+	}
+	for _, from := range message.CommonHeaders.From {
+		address, err := netmail.ParseAddress(from)
+		if err != nil {
+			ret = append(ret, strings.TrimSpace(from))
+			continue
+		}
+		ret = append(ret, address.Address)
+	}
+	return ret
+}
+
 func main() {
 	err := xray.Configure(xray.Config{
 		LogLevel: "warn",
@@ -50,13 +206,64 @@ func main() {
 	}
 	logger := zerolog.New(os.Stdout).Level(logLevel)
 
+	mailBucket := os.Getenv("MAIL_BUCKET")
+
 	s3Client := s3.RawClient(sess)
 	getObject := s3.NewObjectFetcher(s3Client)
 	deleteObject := s3.NewObjectRemover(s3Client)
 
+	dynamoClient := dynamo.RawClient(sess)
+
 	sesClient := mail.NewRawClient(sess)
-	mailSender := mail.NewSender(sesClient)
+	// no suppression check here, everything forwarded goes to our own mailboxes and dropping it would lose the mail
+	mailSender := mail.NewMessageSender(sesClient)
+
+	attachOriginal, err := strconv.ParseBool(os.Getenv("ATTACH_ORIGINAL"))
+	if err != nil {
+		panic(err)
+	}
+
+	// without a routing document everything goes to MAIL_TO
+	loadRoutes := mail.NewStaticRoutingTableLoader(mail.NewForwardingTable(os.Getenv("MAIL_TO")))
+	if routingKey := os.Getenv("ROUTING_CONFIG_KEY"); routingKey != "" {
+		loadRoutes = mail.NewS3RoutingTableLoader(mailBucket, routingKey, getObject, mail.DefaultRoutingReloadInterval)
+	}
+
+	verdictPolicy, err := mail.ParseVerdictPolicy(os.Getenv("VERDICT_POLICY"))
+	if err != nil {
+		panic(err)
+	}
+
+	archiveForwarded, err := strconv.ParseBool(os.Getenv("ARCHIVE_FORWARDED"))
+	if err != nil {
+		panic(err)
+	}
+
+	copyObject := s3.NewObjectCopier(s3Client)
+	linkOriginal := mail.NewOriginalLinker(mailBucket, copyObject, s3.NewPresignedGetCreator(s3Client), mail.DefaultLargeMessageLinkLifetime)
+	forwarder := mail.NewForwarder(mailBucket, getObject, mailSender, linkOriginal, attachOriginal)
+	archiver := mail.NewArchiver(mailBucket, copyObject, deleteObject, mail.NewArchiveIndexer(dynamoClient, os.Getenv("ARCHIVE_TABLE")))
+	quarantiner := mail.NewQuarantiner(mailBucket, copyObject, deleteObject)
+	discarder := mail.NewDiscarder(mailBucket, deleteObject)
+	deadLetterer := mail.NewDeadLetterer(mailBucket, s3.NewObjectSaver(s3Client), s3.NewObjectDescriber(s3Client), copyObject, deleteObject)
+
+	processedTable := os.Getenv("PROCESSED_TABLE")
+	lookupProcessed := mail.NewProcessedLookup(dynamoClient, processedTable)
+	recordProcessed := mail.NewProcessedRecorder(dynamoClient, processedTable, mail.DefaultProcessedRetention)
+	recordAudit := audit.NewRecorder(dynamoClient, os.Getenv("AUDIT_TABLE"))
 
-	forwarder := mail.NewForwarder(os.Getenv("MAIL_BUCKET"), getObject, mailSender, deleteObject)
-	lambda.Start(NewRequestHandler(logger, forwarder, os.Getenv("SUBJECT_TO_SEND"), os.Getenv("MAIL_FROM"), os.Getenv("MAIL_TO")))
+	lambda.Start(NewRequestHandler(logger,
+		verdictPolicy,
+		loadRoutes,
+		forwarder,
+		archiver,
+		quarantiner,
+		discarder,
+		deadLetterer,
+		lookupProcessed,
+		recordProcessed,
+		recordAudit,
+		archiveForwarded,
+		os.Getenv("SUBJECT_TO_SEND"),
+		os.Getenv("MAIL_FROM")))
 }
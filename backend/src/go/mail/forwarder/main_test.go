@@ -4,14 +4,89 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"testing"
+
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
-	"os"
-	"testing"
+
+	"github.com/jonsabados/sabadoscodes.com/audit"
+	"github.com/jonsabados/sabadoscodes.com/mail"
 )
 
-func Test_NewRequestHandler_BubblesErrors(t *testing.T) {
+func emailRecord(messageID, recipient, source, from, subject string) events.SimpleEmailRecord {
+	return events.SimpleEmailRecord{
+		SES: events.SimpleEmailService{
+			Mail: events.SimpleEmailMessage{
+				MessageID: messageID,
+				Source:    source,
+				CommonHeaders: events.SimpleEmailCommonHeaders{
+					From:    []string{from},
+					Subject: subject,
+				},
+			},
+			Receipt: events.SimpleEmailReceipt{
+				Recipients: []string{recipient},
+			},
+		},
+	}
+}
+
+func testRoutes() mail.RoutingTableLoader {
+	table, err := mail.ParseRoutingTable([]byte(`{
+		"rules": [
+			{"name": "billing", "recipients": ["billing@*"], "action": "forward", "destinations": ["accounts@testing.com", "boss@testing.com"]},
+			{"name": "newsletters", "senders": ["*@news.example.com"], "action": "archive"},
+			{"name": "spam", "subject": "(?i)free money", "action": "drop"}
+		],
+		"default": {"action": "forward", "destinations": ["someone@testing.com"]}
+	}`))
+	if err != nil {
+		panic(err)
+	}
+	return mail.NewStaticRoutingTableLoader(table)
+}
+
+func noQuarantine(t *testing.T) mail.Quarantiner {
+	return func(ctx context.Context, messageID string) error {
+		assert.Fail(t, "nothing should be quarantined")
+		return nil
+	}
+}
+
+func noDeadLetters(t *testing.T) mail.DeadLetterer {
+	return func(ctx context.Context, record events.SimpleEmailRecord, cause error) error {
+		assert.Fail(t, "nothing should be dead lettered")
+		return nil
+	}
+}
+
+// discardAll throws away whatever it is given, for tests that don't care what becomes of forwarded mail
+func discardAll(ctx context.Context, messageID string) error {
+	return nil
+}
+
+func notProcessed(ctx context.Context, messageID string) (string, error) {
+	return "", nil
+}
+
+// processedRecorder keeps the recorded outcomes by message ID
+func processedRecorder(outcomes map[string]string) mail.ProcessedRecorder {
+	return func(ctx context.Context, messageID string, outcome string) error {
+		outcomes[messageID] = outcome
+		return nil
+	}
+}
+
+func noAudit(t *testing.T) audit.Recorder {
+	return func(ctx context.Context, entry audit.Entry) error {
+		assert.Fail(t, "nothing should be audited")
+		return nil
+	}
+}
+
+func Test_NewRequestHandler_FailuresAreDeadLettered(t *testing.T) {
 	asserter := assert.New(t)
 
 	logger := zerolog.New(os.Stdout).Level(zerolog.Disabled)
@@ -19,45 +94,179 @@ func Test_NewRequestHandler_BubblesErrors(t *testing.T) {
 	inputCtx := context.WithValue(context.Background(), "foo", "bar")
 	inputSubject := "testing for fun and profit"
 	inputSendFrom := "mcTester@foo.com"
-	inputSendTo := "someone@testing.com"
 
 	messageIDOne := "1234"
 	messageIDTwo := "4321"
 
 	input := events.SimpleEmailEvent{
 		Records: []events.SimpleEmailRecord{
-			{
-				SES: events.SimpleEmailService{
-					Mail: events.SimpleEmailMessage{
-						MessageID: messageIDOne,
-					},
-					Receipt: events.SimpleEmailReceipt{},
-				},
-			},
-			{
-				SES: events.SimpleEmailService{
-					Mail: events.SimpleEmailMessage{
-						MessageID: messageIDTwo,
-					},
-					Receipt: events.SimpleEmailReceipt{},
-				},
-			},
+			emailRecord(messageIDOne, "support@sabadoscodes.com", "bob@example.com", "Bob <bob@example.com>", "help"),
+			emailRecord(messageIDTwo, "support@sabadoscodes.com", "bob@example.com", "Bob <bob@example.com>", "help"),
 		},
 	}
 
 	expectedError := "KaPow!"
-	forwarder := func(ctx context.Context, messageID, subjectToSend, sendFrom, forwardTo string) error {
+	forwarded := make([]string, 0)
+	forwarder := func(ctx context.Context, messageID, subjectToSend, subjectTag, sendFrom string, forwardTo []string) error {
 		asserter.Equal(inputCtx, ctx)
-		asserter.Equal(messageIDOne, messageID)
 		asserter.Equal(fmt.Sprintf("%s (%s)", inputSubject, messageID), subjectToSend)
 		asserter.Equal(inputSendFrom, sendFrom)
-		asserter.Equal(inputSendTo, forwardTo)
+		asserter.Equal([]string{"someone@testing.com"}, forwardTo)
+
+		forwarded = append(forwarded, messageID)
+		if messageID == messageIDOne {
+			return errors.New(expectedError)
+		}
+		return nil
+	}
+	deadLettered := make([]string, 0)
+	deadLetterer := func(ctx context.Context, record events.SimpleEmailRecord, cause error) error {
+		asserter.EqualError(cause, expectedError)
+		deadLettered = append(deadLettered, record.SES.Mail.MessageID)
+		return nil
+	}
+	processed := make(map[string]string)
+
+	err := NewRequestHandler(logger, mail.DefaultVerdictPolicy, testRoutes(), forwarder, nil, noQuarantine(t), discardAll, deadLetterer, notProcessed, processedRecorder(processed), noAudit(t), false, inputSubject, inputSendFrom)(inputCtx, input)
+	asserter.NoError(err)
+	asserter.Equal([]string{messageIDOne, messageIDTwo}, forwarded)
+	asserter.Equal([]string{messageIDOne}, deadLettered)
+	asserter.Equal(map[string]string{
+		messageIDOne: mail.OutcomeDeadLetter,
+		messageIDTwo: "forward",
+	}, processed)
+}
+
+func Test_NewRequestHandler_ErrorDeadLettering_BubblesError(t *testing.T) {
+	asserter := assert.New(t)
+
+	logger := zerolog.New(os.Stdout).Level(zerolog.Disabled)
+
+	input := events.SimpleEmailEvent{
+		Records: []events.SimpleEmailRecord{
+			emailRecord("1234", "support@sabadoscodes.com", "bob@example.com", "bob@example.com", "help"),
+			emailRecord("4321", "support@sabadoscodes.com", "bob@example.com", "bob@example.com", "help"),
+		},
+	}
+
+	loadRoutes := func(ctx context.Context) (mail.RoutingTable, error) {
+		return mail.RoutingTable{}, errors.New("KaPow!")
+	}
+	forwarder := func(ctx context.Context, messageID, subjectToSend, subjectTag, sendFrom string, forwardTo []string) error {
+		asserter.Fail("nothing should be forwarded")
+		return nil
+	}
+	attempted := make([]string, 0)
+	deadLetterer := func(ctx context.Context, record events.SimpleEmailRecord, cause error) error {
+		asserter.EqualError(cause, "KaPow!")
+		attempted = append(attempted, record.SES.Mail.MessageID)
+		return errors.New("KaBOOm!")
+	}
+	processed := make(map[string]string)
+
+	err := NewRequestHandler(logger, mail.DefaultVerdictPolicy, loadRoutes, forwarder, nil, nil, nil, deadLetterer, notProcessed, processedRecorder(processed), nil, false, "subject", "mcTester@foo.com")(context.Background(), input)
+	asserter.EqualError(err, "KaBOOm!")
+	asserter.Equal([]string{"1234", "4321"}, attempted)
+	asserter.Empty(processed)
+}
+
+func Test_NewRequestHandler_SkipsProcessed(t *testing.T) {
+	asserter := assert.New(t)
+
+	logger := zerolog.New(os.Stdout).Level(zerolog.Disabled)
+
+	input := events.SimpleEmailEvent{
+		Records: []events.SimpleEmailRecord{
+			emailRecord("done", "support@sabadoscodes.com", "bob@example.com", "bob@example.com", "help"),
+			emailRecord("broken", "support@sabadoscodes.com", "bob@example.com", "bob@example.com", "help"),
+			emailRecord("new", "support@sabadoscodes.com", "bob@example.com", "bob@example.com", "help"),
+		},
+	}
+
+	lookupProcessed := func(ctx context.Context, messageID string) (string, error) {
+		switch messageID {
+		case "done":
+			return "forward", nil
+		case "broken":
+			return "", errors.New("KaPow!")
+		}
+		return "", nil
+	}
+	forwarded := make([]string, 0)
+	forwarder := func(ctx context.Context, messageID, subjectToSend, subjectTag, sendFrom string, forwardTo []string) error {
+		forwarded = append(forwarded, messageID)
+		return nil
+	}
+	processed := make(map[string]string)
+
+	err := NewRequestHandler(logger, mail.DefaultVerdictPolicy, testRoutes(), forwarder, nil, noQuarantine(t), discardAll, noDeadLetters(t), lookupProcessed, processedRecorder(processed), noAudit(t), false, "subject", "mcTester@foo.com")(context.Background(), input)
+	asserter.EqualError(err, "KaPow!")
+	asserter.Equal([]string{"new"}, forwarded)
+	asserter.Equal(map[string]string{"new": "forward"}, processed)
+}
+
+func Test_NewRequestHandler_CleanupFailureIsRetriedNotDeadLettered(t *testing.T) {
+	asserter := assert.New(t)
+
+	logger := zerolog.New(os.Stdout).Level(zerolog.Disabled)
 
-		return errors.New(expectedError)
+	input := events.SimpleEmailEvent{
+		Records: []events.SimpleEmailRecord{
+			emailRecord("1234", "support@sabadoscodes.com", "bob@example.com", "bob@example.com", "help"),
+		},
 	}
 
-	err := NewRequestHandler(logger, forwarder, inputSubject, inputSendFrom, inputSendTo)(inputCtx, input)
-	asserter.EqualError(err, expectedError)
+	forwarded := make([]string, 0)
+	forwarder := func(ctx context.Context, messageID, subjectToSend, subjectTag, sendFrom string, forwardTo []string) error {
+		forwarded = append(forwarded, messageID)
+		return nil
+	}
+	discardErr := errors.New("KaPow!")
+	discarded := make([]string, 0)
+	discarder := func(ctx context.Context, messageID string) error {
+		discarded = append(discarded, messageID)
+		return discardErr
+	}
+	processed := make(map[string]string)
+	lookupProcessed := func(ctx context.Context, messageID string) (string, error) {
+		return processed[messageID], nil
+	}
+	handler := NewRequestHandler(logger, mail.DefaultVerdictPolicy, testRoutes(), forwarder, nil, noQuarantine(t), discarder, noDeadLetters(t), lookupProcessed, processedRecorder(processed), noAudit(t), false, "subject", "mcTester@foo.com")
+
+	err := handler(context.Background(), input)
+	asserter.EqualError(err, "KaPow!")
+	asserter.Equal([]string{"1234"}, forwarded)
+	asserter.Equal(map[string]string{"1234": mail.OutcomeForwarded}, processed)
+
+	// the retry only has the cleaning up left to do
+	discardErr = nil
+	err = handler(context.Background(), input)
+	asserter.NoError(err)
+	asserter.Equal([]string{"1234"}, forwarded)
+	asserter.Equal([]string{"1234", "1234"}, discarded)
+	asserter.Equal(map[string]string{"1234": "forward"}, processed)
+}
+
+func Test_NewRequestHandler_ErrorRecordingProcessed_Ignored(t *testing.T) {
+	asserter := assert.New(t)
+
+	logger := zerolog.New(os.Stdout).Level(zerolog.Disabled)
+
+	input := events.SimpleEmailEvent{
+		Records: []events.SimpleEmailRecord{
+			emailRecord("1234", "support@sabadoscodes.com", "bob@example.com", "bob@example.com", "help"),
+		},
+	}
+
+	forwarder := func(ctx context.Context, messageID, subjectToSend, subjectTag, sendFrom string, forwardTo []string) error {
+		return nil
+	}
+	recordProcessed := func(ctx context.Context, messageID string, outcome string) error {
+		return errors.New("KaPow!")
+	}
+
+	err := NewRequestHandler(logger, mail.DefaultVerdictPolicy, testRoutes(), forwarder, nil, noQuarantine(t), discardAll, noDeadLetters(t), notProcessed, recordProcessed, noAudit(t), false, "subject", "mcTester@foo.com")(context.Background(), input)
+	asserter.NoError(err)
 }
 
 func Test_NewRequestHandler_HappyPath(t *testing.T) {
@@ -68,45 +277,162 @@ func Test_NewRequestHandler_HappyPath(t *testing.T) {
 	inputCtx := context.WithValue(context.Background(), "foo", "bar")
 	inputSubject := "testing for fun and profit"
 	inputSendFrom := "mcTester@foo.com"
-	inputSendTo := "someone@testing.com"
-
-	messageIDOne := "1234"
-	messageIDTwo := "4321"
 
 	input := events.SimpleEmailEvent{
 		Records: []events.SimpleEmailRecord{
-			{
-				SES: events.SimpleEmailService{
-					Mail: events.SimpleEmailMessage{
-						MessageID: messageIDOne,
-					},
-					Receipt: events.SimpleEmailReceipt{},
-				},
-			},
-			{
-				SES: events.SimpleEmailService{
-					Mail: events.SimpleEmailMessage{
-						MessageID: messageIDTwo,
-					},
-					Receipt: events.SimpleEmailReceipt{},
-				},
-			},
+			emailRecord("default", "support@sabadoscodes.com", "bob@example.com", "Bob <bob@example.com>", "help"),
+			emailRecord("billing", "billing@sabadoscodes.com", "bob@example.com", "Bob <bob@example.com>", "invoice"),
+			emailRecord("newsletter", "support@sabadoscodes.com", "bounces@mailer.example.com", "News <weekly@news.example.com>", "this week"),
+			emailRecord("spam", "support@sabadoscodes.com", "spammer@example.com", "spammer@example.com", "FREE MONEY"),
 		},
 	}
 
-	processedMessages := make([]string, 0)
-	forwarder := func(ctx context.Context, messageID, subjectToSend, sendFrom, forwardTo string) error {
+	forwarded := make(map[string][]string)
+	forwarder := func(ctx context.Context, messageID, subjectToSend, subjectTag, sendFrom string, forwardTo []string) error {
 		asserter.Equal(inputCtx, ctx)
 		asserter.Equal(fmt.Sprintf("%s (%s)", inputSubject, messageID), subjectToSend)
 		asserter.Equal(inputSendFrom, sendFrom)
-		asserter.Equal(inputSendTo, forwardTo)
+		forwarded[messageID] = forwardTo
+		return nil
+	}
+	archived := make([]string, 0)
+	archiver := func(ctx context.Context, record events.SimpleEmailRecord) error {
+		archived = append(archived, record.SES.Mail.MessageID)
+		return nil
+	}
+	dropped := make([]string, 0)
+	discarder := func(ctx context.Context, messageID string) error {
+		dropped = append(dropped, messageID)
+		return nil
+	}
+
+	processed := make(map[string]string)
 
-		processedMessages = append(processedMessages, messageID)
+	err := NewRequestHandler(logger, mail.DefaultVerdictPolicy, testRoutes(), forwarder, archiver, noQuarantine(t), discarder, noDeadLetters(t), notProcessed, processedRecorder(processed), noAudit(t), false, inputSubject, inputSendFrom)(inputCtx, input)
+	asserter.NoError(err)
+	asserter.Equal(map[string][]string{
+		"default": {"someone@testing.com"},
+		"billing": {"accounts@testing.com", "boss@testing.com"},
+	}, forwarded)
+	asserter.Equal([]string{"newsletter"}, archived)
+	// forwarded mail is done with once it has gone
+	asserter.Equal([]string{"default", "billing", "spam"}, dropped)
+	asserter.Equal(map[string]string{
+		"default":    "forward",
+		"billing":    "forward",
+		"newsletter": "archive",
+		"spam":       "drop",
+	}, processed)
+}
+
+func Test_NewRequestHandler_Verdicts(t *testing.T) {
+	asserter := assert.New(t)
+
+	logger := zerolog.New(os.Stdout).Level(zerolog.Disabled)
 
+	withVerdicts := func(record events.SimpleEmailRecord, spam, virus, spf string) events.SimpleEmailRecord {
+		record.SES.Receipt.SpamVerdict.Status = spam
+		record.SES.Receipt.VirusVerdict.Status = virus
+		record.SES.Receipt.SPFVerdict.Status = spf
+		return record
+	}
+	input := events.SimpleEmailEvent{
+		Records: []events.SimpleEmailRecord{
+			withVerdicts(emailRecord("clean", "support@sabadoscodes.com", "bob@example.com", "bob@example.com", "help"), "PASS", "PASS", "PASS"),
+			withVerdicts(emailRecord("spoofed", "support@sabadoscodes.com", "bob@example.com", "bob@example.com", "help"), "PASS", "PASS", "FAIL"),
+			withVerdicts(emailRecord("spam", "billing@sabadoscodes.com", "bob@example.com", "bob@example.com", "help"), "FAIL", "PASS", "FAIL"),
+			withVerdicts(emailRecord("virus", "support@sabadoscodes.com", "bob@example.com", "bob@example.com", "help"), "FAIL", "FAIL", "PASS"),
+		},
+	}
+
+	forwarded := make(map[string]string)
+	forwarder := func(ctx context.Context, messageID, subjectToSend, subjectTag, sendFrom string, forwardTo []string) error {
+		forwarded[messageID] = subjectTag
+		return nil
+	}
+	archiver := func(ctx context.Context, record events.SimpleEmailRecord) error {
+		asserter.Fail("nothing should be archived")
+		return nil
+	}
+	quarantined := make([]string, 0)
+	quarantiner := func(ctx context.Context, messageID string) error {
+		quarantined = append(quarantined, messageID)
+		return nil
+	}
+	dropped := make([]string, 0)
+	discarder := func(ctx context.Context, messageID string) error {
+		dropped = append(dropped, messageID)
+		return nil
+	}
+	audited := make([]audit.Entry, 0)
+	recordAudit := func(ctx context.Context, entry audit.Entry) error {
+		audited = append(audited, entry)
+		return nil
+	}
+
+	processed := make(map[string]string)
+
+	err := NewRequestHandler(logger, mail.DefaultVerdictPolicy, testRoutes(), forwarder, archiver, quarantiner, discarder, noDeadLetters(t), notProcessed, processedRecorder(processed), recordAudit, false, "subject", "mcTester@foo.com")(context.Background(), input)
+	asserter.NoError(err)
+	asserter.Equal(map[string]string{
+		"clean":   "",
+		"spoofed": "[failed spf]",
+	}, forwarded)
+	asserter.Equal([]string{"spam"}, quarantined)
+	asserter.Equal([]string{"clean", "spoofed", "virus"}, dropped)
+	if asserter.Len(audited, 3) {
+		for _, a := range audited {
+			asserter.Equal(audit.ActionMailVerdict, a.Action)
+			asserter.Equal("ses", a.UserID)
+		}
+		asserter.Equal("spoofed from bob@example.com: tag (failed spf)", audited[0].Target)
+		asserter.Equal("spam from bob@example.com: quarantine (failed spam, spf)", audited[1].Target)
+		asserter.Equal("virus from bob@example.com: drop (failed virus, spam)", audited[2].Target)
+	}
+	asserter.Equal(map[string]string{
+		"clean":   "forward",
+		"spoofed": "forward",
+		"spam":    "quarantine",
+		"virus":   "drop",
+	}, processed)
+}
+
+func Test_NewRequestHandler_ArchiveForwarded(t *testing.T) {
+	asserter := assert.New(t)
+
+	logger := zerolog.New(os.Stdout).Level(zerolog.Disabled)
+
+	input := events.SimpleEmailEvent{
+		Records: []events.SimpleEmailRecord{
+			emailRecord("default", "support@sabadoscodes.com", "bob@example.com", "Bob <bob@example.com>", "help"),
+			emailRecord("newsletter", "support@sabadoscodes.com", "bounces@mailer.example.com", "News <weekly@news.example.com>", "this week"),
+			emailRecord("spam", "support@sabadoscodes.com", "spammer@example.com", "spammer@example.com", "FREE MONEY"),
+		},
+	}
+
+	forwarded := make([]string, 0)
+	forwarder := func(ctx context.Context, messageID, subjectToSend, subjectTag, sendFrom string, forwardTo []string) error {
+		forwarded = append(forwarded, messageID)
+		return nil
+	}
+	archived := make([]string, 0)
+	archiver := func(ctx context.Context, record events.SimpleEmailRecord) error {
+		if record.SES.Mail.MessageID == "default" {
+			asserter.Equal([]string{"default"}, forwarded, "forwarded mail should only be archived once it has gone")
+		}
+		archived = append(archived, record.SES.Mail.MessageID)
+		return nil
+	}
+	dropped := make([]string, 0)
+	discarder := func(ctx context.Context, messageID string) error {
+		dropped = append(dropped, messageID)
 		return nil
 	}
+	processed := make(map[string]string)
 
-	err := NewRequestHandler(logger, forwarder, inputSubject, inputSendFrom, inputSendTo)(inputCtx, input)
+	err := NewRequestHandler(logger, mail.DefaultVerdictPolicy, testRoutes(), forwarder, archiver, noQuarantine(t), discarder, noDeadLetters(t), notProcessed, processedRecorder(processed), noAudit(t), true, "subject", "mcTester@foo.com")(context.Background(), input)
 	asserter.NoError(err)
-	asserter.Equal([]string{messageIDOne, messageIDTwo}, processedMessages)
+	asserter.Equal([]string{"default"}, forwarded)
+	asserter.Equal([]string{"default", "newsletter"}, archived)
+	asserter.Equal([]string{"spam"}, dropped)
 }
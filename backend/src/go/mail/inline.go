@@ -0,0 +1,360 @@
+package mail
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// cssSelector is a simple compound selector, such as p.note or #footer, along with the selectors its ancestors must
+// match. Anything fancier (child combinators, attributes, pseudo classes) isn't inlined.
+type cssSelector struct {
+	// parts holds the compound selectors from the outermost ancestor down to the element itself
+	parts []compoundSelector
+}
+
+type compoundSelector struct {
+	tag     string
+	id      string
+	classes []string
+}
+
+type cssRule struct {
+	selector     cssSelector
+	specificity  [3]int
+	order        int
+	declarations []string
+}
+
+// InlineCSS moves the rules from the style elements of an html document onto the style attributes of the elements they
+// apply to, as plenty of mail clients ignore style elements. Styles already inline win, and rules that can't be inlined,
+// such as media queries, are kept in a style element in the head.
+func InlineCSS(document string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	styleElements := make([]*html.Node, 0)
+	var findStyles func(n *html.Node)
+	findStyles = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Style {
+			styleElements = append(styleElements, n)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			findStyles(c)
+		}
+	}
+	findStyles(doc)
+	if len(styleElements) == 0 {
+		return document, nil
+	}
+
+	css := &strings.Builder{}
+	for _, s := range styleElements {
+		for c := s.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.TextNode {
+				css.WriteString(c.Data)
+				css.WriteString("\n")
+			}
+		}
+		s.Parent.RemoveChild(s)
+	}
+	rules, leftover := parseCSS(css.String())
+
+	var apply func(n *html.Node)
+	apply = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			inlineRules(n, rules)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			apply(c)
+		}
+	}
+	apply(doc)
+
+	if leftover != "" {
+		head := findElement(doc, atom.Head)
+		if head != nil {
+			style := &html.Node{Type: html.ElementNode, Data: "style", DataAtom: atom.Style}
+			style.AppendChild(&html.Node{Type: html.TextNode, Data: leftover})
+			head.AppendChild(style)
+		}
+	}
+
+	ret := &strings.Builder{}
+	err = html.Render(ret, doc)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return ret.String(), nil
+}
+
+func inlineRules(n *html.Node, rules []cssRule) {
+	matching := make([]cssRule, 0)
+	for _, r := range rules {
+		if r.selector.matches(n) {
+			matching = append(matching, r)
+		}
+	}
+	if len(matching) == 0 {
+		return
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		a, b := matching[i], matching[j]
+		for k := range a.specificity {
+			if a.specificity[k] != b.specificity[k] {
+				return a.specificity[k] < b.specificity[k]
+			}
+		}
+		return a.order < b.order
+	})
+
+	declarations := make([]string, 0)
+	for _, r := range matching {
+		declarations = append(declarations, r.declarations...)
+	}
+	existing := -1
+	for i, a := range n.Attr {
+		if strings.EqualFold(a.Key, "style") {
+			existing = i
+			declarations = append(declarations, splitDeclarations(a.Val)...)
+		}
+	}
+	style := strings.Join(declarations, "; ")
+	if existing >= 0 {
+		n.Attr[existing].Val = style
+	} else {
+		n.Attr = append(n.Attr, html.Attribute{Key: "style", Val: style})
+	}
+}
+
+// parseCSS splits a style sheet into the rules that can be inlined and the css that has to stay in a style element
+func parseCSS(css string) ([]cssRule, string) {
+	css = stripCSSComments(css)
+	rules := make([]cssRule, 0)
+	leftover := &strings.Builder{}
+	order := 0
+	for {
+		css = strings.TrimSpace(css)
+		if css == "" {
+			break
+		}
+		open := strings.Index(css, "{")
+		if open < 0 {
+			break
+		}
+		prelude := strings.TrimSpace(css[:open])
+		end := matchingBrace(css, open)
+		body := css[open+1 : end]
+		block := css[:end+1]
+		if end == len(css) {
+			block = css + "}"
+			body = css[open+1:]
+		}
+		if end < len(css) {
+			css = css[end+1:]
+		} else {
+			css = ""
+		}
+
+		if strings.HasPrefix(prelude, "@") {
+			leftover.WriteString(block)
+			leftover.WriteString("\n")
+			continue
+		}
+		declarations := splitDeclarations(body)
+		kept := make([]string, 0)
+		for _, s := range strings.Split(prelude, ",") {
+			selector, ok := parseSelector(s)
+			if !ok {
+				kept = append(kept, strings.TrimSpace(s))
+				continue
+			}
+			rules = append(rules, cssRule{
+				selector:     selector,
+				specificity:  selector.specificity(),
+				order:        order,
+				declarations: declarations,
+			})
+			order++
+		}
+		if len(kept) > 0 {
+			leftover.WriteString(strings.Join(kept, ", "))
+			leftover.WriteString(" {")
+			leftover.WriteString(strings.Join(declarations, "; "))
+			leftover.WriteString("}\n")
+		}
+	}
+	return rules, strings.TrimSpace(leftover.String())
+}
+
+func parseSelector(s string) (cssSelector, bool) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || strings.ContainsAny(s, ">+~:[*") {
+		return cssSelector{}, false
+	}
+	ret := cssSelector{}
+	for _, f := range fields {
+		part, ok := parseCompound(f)
+		if !ok {
+			return cssSelector{}, false
+		}
+		ret.parts = append(ret.parts, part)
+	}
+	return ret, true
+}
+
+func parseCompound(s string) (compoundSelector, bool) {
+	ret := compoundSelector{}
+	kind := byte(0)
+	start := 0
+	flush := func(end int) bool {
+		name := s[start:end]
+		if name == "" {
+			return kind == 0 && end == 0
+		}
+		switch kind {
+		case 0:
+			ret.tag = strings.ToLower(name)
+		case '#':
+			ret.id = name
+		case '.':
+			ret.classes = append(ret.classes, name)
+		}
+		return true
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '#' || s[i] == '.' {
+			if !flush(i) {
+				return compoundSelector{}, false
+			}
+			kind = s[i]
+			start = i + 1
+		}
+	}
+	if !flush(len(s)) {
+		return compoundSelector{}, false
+	}
+	return ret, true
+}
+
+func (s cssSelector) specificity() [3]int {
+	ret := [3]int{}
+	for _, p := range s.parts {
+		if p.id != "" {
+			ret[0]++
+		}
+		ret[1] += len(p.classes)
+		if p.tag != "" {
+			ret[2]++
+		}
+	}
+	return ret
+}
+
+func (s cssSelector) matches(n *html.Node) bool {
+	last := len(s.parts) - 1
+	if !s.parts[last].matches(n) {
+		return false
+	}
+	// each remaining part needs to match some ancestor, in order heading up the tree
+	remaining := last - 1
+	for a := n.Parent; a != nil && remaining >= 0; a = a.Parent {
+		if a.Type == html.ElementNode && s.parts[remaining].matches(a) {
+			remaining--
+		}
+	}
+	return remaining < 0
+}
+
+func (c compoundSelector) matches(n *html.Node) bool {
+	if c.tag != "" && c.tag != n.Data {
+		return false
+	}
+	if c.id != "" && attribute(n, "id") != c.id {
+		return false
+	}
+	if len(c.classes) > 0 {
+		classes := make(map[string]bool)
+		for _, cls := range strings.Fields(attribute(n, "class")) {
+			classes[cls] = true
+		}
+		for _, cls := range c.classes {
+			if !classes[cls] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func attribute(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func splitDeclarations(s string) []string {
+	ret := make([]string, 0)
+	for _, d := range strings.Split(s, ";") {
+		d = strings.TrimSpace(d)
+		if d != "" {
+			ret = append(ret, d)
+		}
+	}
+	return ret
+}
+
+// matchingBrace gives the index of the brace closing the one at open, or the length of css if it's never closed
+func matchingBrace(css string, open int) int {
+	depth := 0
+	for i := open; i < len(css); i++ {
+		switch css[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(css)
+}
+
+func stripCSSComments(css string) string {
+	ret := &strings.Builder{}
+	for {
+		start := strings.Index(css, "/*")
+		if start < 0 {
+			ret.WriteString(css)
+			return ret.String()
+		}
+		ret.WriteString(css[:start])
+		end := strings.Index(css[start+2:], "*/")
+		if end < 0 {
+			return ret.String()
+		}
+		css = css[start+2+end+2:]
+	}
+}
@@ -0,0 +1,54 @@
+package mail
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInlineCSS(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{
+			"no styles",
+			`<html><head></head><body><p>hi</p></body></html>`,
+			`<html><head></head><body><p>hi</p></body></html>`,
+		},
+		{
+			"tag, class and id",
+			`<html><head><style>p { color: red } .note { font-size: 12px } #main { margin: 0 }</style></head><body><div id="main"><p class="note">hi</p></div></body></html>`,
+			`<html><head></head><body><div id="main" style="margin: 0"><p class="note" style="color: red; font-size: 12px">hi</p></div></body></html>`,
+		},
+		{
+			"specificity beats source order",
+			`<html><head><style>p.note { color: blue } p { color: red }</style></head><body><p class="note">hi</p><p>there</p></body></html>`,
+			`<html><head></head><body><p class="note" style="color: red; color: blue">hi</p><p style="color: red">there</p></body></html>`,
+		},
+		{
+			"existing inline styles win",
+			`<html><head><style>p { color: red }</style></head><body><p style="color: green;">hi</p></body></html>`,
+			`<html><head></head><body><p style="color: red; color: green">hi</p></body></html>`,
+		},
+		{
+			"descendant selectors and selector lists",
+			`<html><head><style>/* links */ .footer a, h1 { color: grey }</style></head><body><a>top</a><div class="footer"><span><a>bottom</a></span></div><h1>title</h1></body></html>`,
+			`<html><head></head><body><a>top</a><div class="footer"><span><a style="color: grey">bottom</a></span></div><h1 style="color: grey">title</h1></body></html>`,
+		},
+		{
+			"media queries and pseudo classes kept",
+			`<html><head><style>a { color: blue } a:hover { color: red } @media (max-width: 600px) { a { color: green } }</style></head><body><a>link</a></body></html>`,
+			`<html><head><style>a:hover {color: red}
+@media (max-width: 600px) { a { color: green } }</style></head><body><a style="color: blue">link</a></body></html>`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			res, err := InlineCSS(tc.input)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, res)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+// LargeMessageKeyPrefix is where originals too large to forward are kept for downloading
+const LargeMessageKeyPrefix = "large/"
+
+// DefaultLargeMessageLinkLifetime is how long links to large originals last. Links are signed with whatever
+// credentials created them, so can stop working sooner if those are temporary and expire first.
+const DefaultLargeMessageLinkLifetime = 12 * time.Hour
+
+// OriginalLinker copies the message stored under messageID in the mail bucket somewhere private, giving a link that
+// downloads the copy
+type OriginalLinker func(ctx context.Context, messageID string) (s3.PresignedRequest, error)
+
+func NewOriginalLinker(mailBucket string, copyObject s3.ObjectCopier, presignGet s3.PresignedGetCreator, lifetime time.Duration) OriginalLinker {
+	return func(ctx context.Context, messageID string) (s3.PresignedRequest, error) {
+		// a copy of its own, as the original may well be archived or deleted long before anyone follows the link
+		key := LargeMessageKeyPrefix + messageID
+		err := copyObject(ctx, mailBucket, messageID, key)
+		if err != nil {
+			return s3.PresignedRequest{}, errors.WithStack(err)
+		}
+		ret, err := presignGet(ctx, mailBucket, key, fmt.Sprintf("%s.eml", messageID), lifetime)
+		if err != nil {
+			return s3.PresignedRequest{}, errors.WithStack(err)
+		}
+		return ret, nil
+	}
+}
+
+// inlineParts gives the attachments html bodies reference with cid: urls, rewound so they can be sent again. Those
+// are the pictures in the body, which make no sense in a download, where regular attachments do.
+func inlineParts(attachments []Attachment) []Attachment {
+	ret := make([]Attachment, 0)
+	for _, a := range attachments {
+		if a.ContentID == "" {
+			continue
+		}
+		if seeker, ok := a.Body.(io.Seeker); ok {
+			_, err := seeker.Seek(0, io.SeekStart)
+			if err != nil {
+				continue
+			}
+		}
+		ret = append(ret, a)
+	}
+	return ret
+}
+
+func largeMessageText(size int, link s3.PresignedRequest) string {
+	return fmt.Sprintf("This email was too large to forward (%s). The original, attachments and all, can be downloaded until %s from:\n%s\n\n", megabytes(size), link.Expires.UTC().Format(time.RFC1123), link.URL)
+}
+
+func largeMessageHTML(size int, link s3.PresignedRequest) string {
+	return fmt.Sprintf(`<p style="padding: 0.5em; background: #fff3cd">This email was too large to forward (%s). <a href="%s">The original</a>, attachments and all, can be downloaded until %s.</p>`, megabytes(size), html.EscapeString(link.URL), link.Expires.UTC().Format(time.RFC1123))
+}
+
+func megabytes(size int) string {
+	return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+}
@@ -0,0 +1,55 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+func Test_NewOriginalLinker(t *testing.T) {
+	asserter := assert.New(t)
+
+	inputCtx := context.WithValue(context.Background(), "foo", "bar")
+	copied := false
+	copyObject := func(ctx context.Context, bucket string, sourceKey string, targetKey string) error {
+		copied = true
+		asserter.Equal(inputCtx, ctx)
+		asserter.Equal("somebucket", bucket)
+		asserter.Equal("12345", sourceKey)
+		asserter.Equal("large/12345", targetKey)
+		return nil
+	}
+	expected := s3.PresignedRequest{URL: "https://example.com/large/12345", Method: "GET", Expires: time.Now().Add(time.Hour)}
+	presignGet := func(ctx context.Context, bucket string, objectKey string, downloadName string, expiry time.Duration) (s3.PresignedRequest, error) {
+		asserter.True(copied, "the copy should exist before it is linked to")
+		asserter.Equal("somebucket", bucket)
+		asserter.Equal("large/12345", objectKey)
+		asserter.Equal("12345.eml", downloadName)
+		asserter.Equal(time.Hour, expiry)
+		return expected, nil
+	}
+
+	res, err := NewOriginalLinker("somebucket", copyObject, presignGet, time.Hour)(inputCtx, "12345")
+	asserter.NoError(err)
+	asserter.Equal(expected, res)
+}
+
+func Test_NewOriginalLinker_CopyFails_BubblesError(t *testing.T) {
+	asserter := assert.New(t)
+
+	copyObject := func(ctx context.Context, bucket string, sourceKey string, targetKey string) error {
+		return errors.New("KaBOOm!")
+	}
+	presignGet := func(ctx context.Context, bucket string, objectKey string, downloadName string, expiry time.Duration) (s3.PresignedRequest, error) {
+		asserter.Fail("nothing to link to")
+		return s3.PresignedRequest{}, nil
+	}
+
+	_, err := NewOriginalLinker("somebucket", copyObject, presignGet, time.Hour)(context.Background(), "12345")
+	asserter.EqualError(err, "KaBOOm!")
+}
@@ -1,6 +1,7 @@
 package mail
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
@@ -11,44 +12,87 @@ import (
 	"github.com/jordan-wright/email"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"html"
 	"io"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
 )
 
 type Attachment struct {
 	Name     string
 	MimeType string
 	Body     io.Reader
+	// ContentID, when set, makes the attachment an inline part that html bodies can reference with a cid: url
+	ContentID string
 }
 
-type Sender func(ctx context.Context, from, to, subject, htmlBody, textBody string, attachments ...Attachment) error
+// Message is everything needed to send an email
+type Message struct {
+	From        string
+	To          []string
+	ReplyTo     []string
+	Subject     string
+	HTMLBody    string
+	TextBody    string
+	Attachments []Attachment
+	// Headers are set on the message as is, such as List-Unsubscribe
+	Headers map[string]string
+}
 
-func NewSender(sesClient *ses.SES) Sender {
-	return func(ctx context.Context, from, to, subject, htmlBody, textBody string, attachments ...Attachment) error {
+// MaxMessageSize is the most SES will send as a single raw message, headers, encoding and all
+const MaxMessageSize = 10 * 1024 * 1024
+
+// ErrMessageTooLarge is the cause of errors sending messages that come out larger than MaxMessageSize
+var ErrMessageTooLarge = errors.New("message too large to send")
+
+type MessageSender func(ctx context.Context, message Message) error
+
+func NewMessageSender(sesClient *ses.SES) MessageSender {
+	return func(ctx context.Context, message Message) error {
 		e := &email.Email{
-			To:          []string{to},
-			From:        from,
-			Subject:     subject,
-			Text:        []byte(textBody),
-			HTML:        []byte(htmlBody),
+			To:      message.To,
+			ReplyTo: message.ReplyTo,
+			From:    message.From,
+			Subject: message.Subject,
+			Text:    []byte(message.TextBody),
+			HTML:    []byte(message.HTMLBody),
+		}
+		for k, v := range message.Headers {
+			if e.Headers == nil {
+				e.Headers = textproto.MIMEHeader{}
+			}
+			e.Headers.Set(k, v)
 		}
-		for _, a := range attachments {
-			_, err := e.Attach(a.Body, a.Name, a.MimeType)
+		for _, a := range message.Attachments {
+			attached, err := e.Attach(a.Body, a.Name, a.MimeType)
 			if err != nil {
 				return errors.WithStack(err)
 			}
+			if a.ContentID != "" {
+				attached.HTMLRelated = true
+				attached.Header.Set("Content-ID", fmt.Sprintf("<%s>", a.ContentID))
+			}
 		}
 
 		payload, err := e.Bytes()
 		if err != nil {
 			return errors.WithStack(err)
 		}
+		if len(payload) > MaxMessageSize {
+			return errors.Wrapf(ErrMessageTooLarge, "message is %d bytes, the limit is %d", len(payload), MaxMessageSize)
+		}
+
+		destinations := make([]*string, len(message.To))
+		for i, to := range message.To {
+			destinations[i] = aws.String(to)
+		}
 
-		zerolog.Ctx(ctx).Info().Str("source", from).Str("to", to).Msg("sending email")
+		zerolog.Ctx(ctx).Info().Str("source", message.From).Strs("to", message.To).Msg("sending email")
 		_, err = sesClient.SendRawEmailWithContext(ctx, &ses.SendRawEmailInput{
-			Source: aws.String(from),
-			Destinations: []*string{
-				aws.String(to),
-			},
+			Source:       aws.String(message.From),
+			Destinations: destinations,
 			RawMessage: &ses.RawMessage{
 				Data: payload,
 			},
@@ -60,33 +104,138 @@ func NewSender(sesClient *ses.SES) Sender {
 	}
 }
 
-type Forwarder func(ctx context.Context, messageID, subjectToSend, sendFrom, forwardTo string) error
+type Sender func(ctx context.Context, from, to, subject, htmlBody, textBody string, attachments ...Attachment) error
+
+// NewSender creates a Sender handing single recipient messages on to sendMessage, which is usually a
+// NewSuppressingMessageSender wrapping NewMessageSender
+func NewSender(sendMessage MessageSender) Sender {
+	return func(ctx context.Context, from, to, subject, htmlBody, textBody string, attachments ...Attachment) error {
+		return sendMessage(ctx, Message{
+			From:        from,
+			To:          []string{to},
+			Subject:     subject,
+			HTMLBody:    htmlBody,
+			TextBody:    textBody,
+			Attachments: attachments,
+		})
+	}
+}
+
+// Forwarder sends on the message stored under messageID in the mail bucket, using fallbackSubject if the message
+// doesn't have a subject of its own. A non blank subjectTag goes in front of the subject.
+type Forwarder func(ctx context.Context, messageID, fallbackSubject, subjectTag, sendFrom string, forwardTo []string) error
 
-func NewForwarder(mailBucket string, fetchObject s3.ObjectFetcher, sendEmail Sender, removeObject s3.ObjectRemover) Forwarder {
-	return func(ctx context.Context, messageID, subjectToSend, sendFrom, forwardTo string) error {
+// NewForwarder creates a Forwarder that sends a readable copy of the original message, with its text and (sanitized)
+// html inline, its attachments re-attached and replies going to the original sender. If attachOriginal is set the raw
+// message is attached as well. Messages that would be too large to send go out with only the inline parts their html
+// shows (or nothing at all if even those are too much), and a link to download the original in place of the rest. The
+// original is left in the mail bucket, what becomes of it is up to the caller.
+func NewForwarder(mailBucket string, fetchObject s3.ObjectFetcher, sendEmail MessageSender, linkOriginal OriginalLinker, attachOriginal bool) Forwarder {
+	return func(ctx context.Context, messageID, fallbackSubject, subjectTag, sendFrom string, forwardTo []string) error {
 		originalEmail, err := fetchObject(ctx, mailBucket, messageID)
 		if err != nil {
 			return errors.WithStack(err)
 		}
-		defer func() {
-			err := originalEmail.Close()
+		raw, err := io.ReadAll(originalEmail)
+		closeErr := originalEmail.Close()
+		if closeErr != nil {
+			zerolog.Ctx(ctx).Warn().Str("error", fmt.Sprintf("%+v", closeErr)).Msg("error closing stream")
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		includeOriginal := attachOriginal
+		parsed, err := ParseMessage(bytes.NewReader(raw))
+		if err != nil {
+			// still worth getting something through, the original will be attached so nothing is lost
+			zerolog.Ctx(ctx).Warn().Str("error", fmt.Sprintf("%+v", err)).Str("id", messageID).Msg("unable to parse email, forwarding it as an attachment")
+			parsed = &ParsedMessage{
+				Text: "The email could not be read, see the attached original.",
+			}
+			includeOriginal = true
+		}
+
+		message := Message{
+			From:        forwardingAddress(parsed.From, sendFrom),
+			To:          forwardTo,
+			ReplyTo:     replyAddresses(parsed),
+			Subject:     parsed.Subject,
+			HTMLBody:    forwardedHTML(parsed),
+			TextBody:    forwardedText(parsed),
+			Attachments: parsed.Attachments,
+		}
+		if message.Subject == "" {
+			message.Subject = fallbackSubject
+		}
+		if subjectTag != "" {
+			message.Subject = fmt.Sprintf("%s %s", subjectTag, message.Subject)
+		}
+		if includeOriginal {
+			message.Attachments = append(message.Attachments, Attachment{
+				Name:     fmt.Sprintf("%s.eml", messageID),
+				MimeType: "message/rfc822",
+				Body:     bytes.NewReader(raw),
+			})
+		}
+		err = sendEmail(ctx, message)
+		if errors.Cause(err) == ErrMessageTooLarge {
+			zerolog.Ctx(ctx).Warn().Str("id", messageID).Int("originalSize", len(raw)).Str("error", err.Error()).Msg("email too large to forward, sending a download link in place of its attachments")
+			var link s3.PresignedRequest
+			link, err = linkOriginal(ctx, messageID)
 			if err != nil {
-				zerolog.Ctx(ctx).Warn().Str("error", fmt.Sprintf("%+v", err)).Msg("error closing stream")
+				return errors.WithStack(err)
 			}
-		}()
-
-		htmlBody := "<p>See attached email</p>"
-		textBody := "See attached email"
-		err = sendEmail(ctx, sendFrom, forwardTo, subjectToSend, htmlBody, textBody, Attachment{
-			Name:     fmt.Sprintf("%s.eml", messageID),
-			MimeType: "message/rfc822",
-			Body:     originalEmail,
-		})
+			message.TextBody = largeMessageText(len(raw), link) + forwardedText(parsed)
+			message.HTMLBody = largeMessageHTML(len(raw), link) + forwardedHTML(parsed)
+			message.Attachments = inlineParts(parsed.Attachments)
+			err = sendEmail(ctx, message)
+			if errors.Cause(err) == ErrMessageTooLarge && len(message.Attachments) > 0 {
+				zerolog.Ctx(ctx).Warn().Str("id", messageID).Int("inlineParts", len(message.Attachments)).Msg("email too large to forward even with only its inline parts, dropping them too")
+				message.Attachments = nil
+				err = sendEmail(ctx, message)
+			}
+			if err == nil {
+				zerolog.Ctx(ctx).Info().Str("id", messageID).Time("linkExpires", link.Expires).Msg("forwarded download link for large email")
+			}
+		}
 		if err != nil {
 			return errors.WithStack(err)
 		}
+		return nil
+	}
+}
+
+// QuarantineKeyPrefix is where messages held back by the verdict policy live in the mail bucket
+const QuarantineKeyPrefix = "quarantine/"
+
+// Quarantiner moves the message stored under messageID in the mail bucket into quarantine
+type Quarantiner func(ctx context.Context, messageID string) error
+
+func NewQuarantiner(mailBucket string, copyObject s3.ObjectCopier, removeObject s3.ObjectRemover) Quarantiner {
+	return func(ctx context.Context, messageID string) error {
+		return moveMessage(ctx, mailBucket, messageID, QuarantineKeyPrefix, copyObject, removeObject)
+	}
+}
+
+func moveMessage(ctx context.Context, mailBucket, messageID, prefix string, copyObject s3.ObjectCopier, removeObject s3.ObjectRemover) error {
+	err := copyObject(ctx, mailBucket, messageID, prefix+messageID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = removeObject(ctx, mailBucket, messageID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Discarder throws away the message stored under messageID in the mail bucket
+type Discarder func(ctx context.Context, messageID string) error
 
-		err = removeObject(ctx, mailBucket, messageID)
+func NewDiscarder(mailBucket string, removeObject s3.ObjectRemover) Discarder {
+	return func(ctx context.Context, messageID string) error {
+		err := removeObject(ctx, mailBucket, messageID)
 		if err != nil {
 			return errors.WithStack(err)
 		}
@@ -94,6 +243,78 @@ func NewForwarder(mailBucket string, fetchObject s3.ObjectFetcher, sendEmail Sen
 	}
 }
 
+// forwardingAddress names the sender in the from address, the address itself has to stay one we can send as
+func forwardingAddress(originalFrom []*mail.Address, sendFrom string) string {
+	if len(originalFrom) == 0 {
+		return sendFrom
+	}
+	name := originalFrom[0].Name
+	if name == "" {
+		name = originalFrom[0].Address
+	}
+	// the mail library splits from on commas before parsing it
+	name = strings.ReplaceAll(name, ",", "")
+	return (&mail.Address{Name: fmt.Sprintf("%s via %s", name, sendFrom), Address: sendFrom}).String()
+}
+
+func replyAddresses(parsed *ParsedMessage) []string {
+	addresses := parsed.ReplyTo
+	if len(addresses) == 0 {
+		addresses = parsed.From
+	}
+	ret := make([]string, len(addresses))
+	for i, a := range addresses {
+		ret[i] = a.String()
+	}
+	return ret
+}
+
+func forwardedText(parsed *ParsedMessage) string {
+	text := parsed.Text
+	if text == "" && parsed.HTML != "" {
+		text = HTMLToText(parsed.HTML)
+	}
+	return summaryText(parsed) + text
+}
+
+func forwardedHTML(parsed *ParsedMessage) string {
+	body := SanitizeHTML(parsed.HTML)
+	if body == "" {
+		body = fmt.Sprintf(`<pre style="white-space: pre-wrap">%s</pre>`, html.EscapeString(parsed.Text))
+	}
+	return fmt.Sprintf(`<div style="border-bottom: 1px solid #ccc; margin-bottom: 1em; padding-bottom: 0.5em; color: #555"><pre style="white-space: pre-wrap; font-family: inherit; margin: 0">%s</pre></div>%s`, html.EscapeString(summaryText(parsed)), body)
+}
+
+// summaryText is the original headers worth knowing about, as the forwarded message can't carry them itself
+func summaryText(parsed *ParsedMessage) string {
+	summary := &strings.Builder{}
+	writeAddresses := func(label string, addresses []*mail.Address) {
+		if len(addresses) == 0 {
+			return
+		}
+		formatted := make([]string, len(addresses))
+		for i, a := range addresses {
+			if a.Name == "" {
+				formatted[i] = a.Address
+			} else {
+				formatted[i] = fmt.Sprintf("%s <%s>", a.Name, a.Address)
+			}
+		}
+		_, _ = fmt.Fprintf(summary, "%s: %s\n", label, strings.Join(formatted, ", "))
+	}
+	writeAddresses("From", parsed.From)
+	writeAddresses("To", parsed.To)
+	writeAddresses("Cc", parsed.Cc)
+	if !parsed.Date.IsZero() {
+		_, _ = fmt.Fprintf(summary, "Date: %s\n", parsed.Date.Format(time.RFC1123Z))
+	}
+	if summary.Len() == 0 {
+		return ""
+	}
+	summary.WriteString("\n")
+	return summary.String()
+}
+
 func NewRawClient(sess *session.Session) *ses.SES {
 	ret := ses.New(sess)
 	xray.AWS(ret.Client)
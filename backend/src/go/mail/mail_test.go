@@ -3,14 +3,45 @@ package mail
 import (
 	"bytes"
 	"context"
-	"errors"
 	"fmt"
-	"github.com/stretchr/testify/assert"
 	"io"
 	"io/ioutil"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jonsabados/sabadoscodes.com/s3"
 )
 
+const testEmail = "From: Bob Smith <bob@example.com>\r\n" +
+	"To: support@sabadoscodes.com\r\n" +
+	"Subject: Help with the site\r\n" +
+	"Date: Mon, 02 Jan 2006 15:04:05 -0700\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"inner\"\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"The site is broken\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p onclick=\"steal()\">The site is <b>broken</b></p><script>steal()</script>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"Content-Disposition: attachment; filename=\"notes.txt\"\r\n" +
+	"\r\n" +
+	"some notes\r\n" +
+	"--outer--\r\n"
+
 func Test_NewForwarder_ErrorReadingFromBucket_BubblesError(t *testing.T) {
 	asserter := assert.New(t)
 
@@ -20,7 +51,7 @@ func Test_NewForwarder_ErrorReadingFromBucket_BubblesError(t *testing.T) {
 	inputMessageID := "12345"
 	inputSubject := "testing FTW"
 	inputSendFrom := "bob@testing.com"
-	inputForwardTo := "mcTester@testing.com"
+	inputForwardTo := []string{"mcTester@testing.com"}
 
 	expectedError := "KaBOOm!"
 	objectFetcher := func(ctx context.Context, bucket, object string) (io.ReadCloser, error) {
@@ -30,17 +61,12 @@ func Test_NewForwarder_ErrorReadingFromBucket_BubblesError(t *testing.T) {
 		return nil, errors.New(expectedError)
 	}
 
-	sender := func(ctx context.Context, from, to, subject, htmlBody, textBody string, attachments ...Attachment) error {
+	sender := func(ctx context.Context, message Message) error {
 		asserter.Fail("no mail should have been sent")
 		return nil
 	}
 
-	objectRemover := func(ctx context.Context, bucket, object string) error {
-		asserter.Fail("object should have been left in bucket")
-		return nil
-	}
-
-	err := NewForwarder(bucketToUse, objectFetcher, sender, objectRemover)(inputCtx, inputMessageID, inputSubject, inputSendFrom, inputForwardTo)
+	err := NewForwarder(bucketToUse, objectFetcher, sender, nil, false)(inputCtx, inputMessageID, inputSubject, "", inputSendFrom, inputForwardTo)
 
 	asserter.EqualError(err, expectedError)
 }
@@ -54,48 +80,27 @@ func Test_NewForwarder_ErrorSending_BubblesError(t *testing.T) {
 	inputMessageID := "12345"
 	inputSubject := "testing FTW"
 	inputSendFrom := "bob@testing.com"
-	inputForwardTo := "mcTester@testing.com"
+	inputForwardTo := []string{"mcTester@testing.com"}
 
-	expectedAttachment := ioutil.NopCloser(bytes.NewReader([]byte("this would be an email")))
 	objectFetcher := func(ctx context.Context, bucket, object string) (io.ReadCloser, error) {
-		asserter.Equal(inputCtx, ctx)
-		asserter.Equal(bucketToUse, bucket)
-		asserter.Equal(inputMessageID, object)
-		return expectedAttachment, nil
+		return ioutil.NopCloser(strings.NewReader(testEmail)), nil
 	}
 
 	expectedError := "KaBOOm!"
 	mailSent := false
-	sender := func(ctx context.Context, from, to, subject, htmlBody, textBody string, attachments ...Attachment) error {
+	sender := func(ctx context.Context, message Message) error {
 		mailSent = true
 		asserter.Equal(inputCtx, ctx)
-		asserter.Equal(inputSendFrom, from)
-		asserter.Equal(inputForwardTo, to)
-		asserter.Equal(inputSubject, subject)
-		asserter.Equal("<p>See attached email</p>", htmlBody)
-		asserter.Equal("See attached email", textBody)
-		asserter.Equal([]Attachment{
-			{
-				Name:     fmt.Sprintf("%s.eml", inputMessageID),
-				MimeType: "message/rfc822",
-				Body:     expectedAttachment,
-			},
-		}, attachments)
 		return errors.New(expectedError)
 	}
 
-	objectRemover := func(ctx context.Context, bucket, object string) error {
-		asserter.Fail("object should have been left in bucket")
-		return nil
-	}
-
-	err := NewForwarder(bucketToUse, objectFetcher, sender, objectRemover)(inputCtx, inputMessageID, inputSubject, inputSendFrom, inputForwardTo)
+	err := NewForwarder(bucketToUse, objectFetcher, sender, nil, false)(inputCtx, inputMessageID, inputSubject, "", inputSendFrom, inputForwardTo)
 
 	asserter.True(mailSent)
 	asserter.EqualError(err, expectedError)
 }
 
-func Test_NewForwarder_ErrorCleaningBucket_BubblesError(t *testing.T) {
+func Test_NewForwarder_HappyPath(t *testing.T) {
 	asserter := assert.New(t)
 
 	bucketToUse := "somebucket"
@@ -103,103 +108,314 @@ func Test_NewForwarder_ErrorCleaningBucket_BubblesError(t *testing.T) {
 	inputCtx := context.WithValue(context.Background(), "foo", "bar")
 	inputMessageID := "12345"
 	inputSubject := "testing FTW"
-	inputSendFrom := "bob@testing.com"
-	inputForwardTo := "mcTester@testing.com"
+	inputSendFrom := "support@sabadoscodes.com"
+	inputForwardTo := []string{"mcTester@testing.com"}
 
-	expectedAttachment := ioutil.NopCloser(bytes.NewReader([]byte("this would be an email")))
 	objectFetcher := func(ctx context.Context, bucket, object string) (io.ReadCloser, error) {
 		asserter.Equal(inputCtx, ctx)
 		asserter.Equal(bucketToUse, bucket)
 		asserter.Equal(inputMessageID, object)
-		return expectedAttachment, nil
+		return ioutil.NopCloser(strings.NewReader(testEmail)), nil
 	}
 
 	mailSent := false
-	sender := func(ctx context.Context, from, to, subject, htmlBody, textBody string, attachments ...Attachment) error {
+	sender := func(ctx context.Context, message Message) error {
 		mailSent = true
 		asserter.Equal(inputCtx, ctx)
-		asserter.Equal(inputSendFrom, from)
-		asserter.Equal(inputForwardTo, to)
-		asserter.Equal(inputSubject, subject)
-		asserter.Equal("<p>See attached email</p>", htmlBody)
-		asserter.Equal("See attached email", textBody)
-		asserter.Equal([]Attachment{
-			{
-				Name:     fmt.Sprintf("%s.eml", inputMessageID),
-				MimeType: "message/rfc822",
-				Body:     expectedAttachment,
-			},
-		}, attachments)
+		asserter.Equal(`"Bob Smith via support@sabadoscodes.com" <support@sabadoscodes.com>`, message.From)
+		asserter.Equal(inputForwardTo, message.To)
+		asserter.Equal([]string{`"Bob Smith" <bob@example.com>`}, message.ReplyTo)
+		asserter.Equal("Help with the site", message.Subject)
+		asserter.Contains(message.TextBody, "From: Bob Smith <bob@example.com>\n")
+		asserter.Contains(message.TextBody, "Date: Mon, 02 Jan 2006 15:04:05 -0700\n")
+		asserter.True(strings.HasSuffix(message.TextBody, "\n\nThe site is broken"))
+		asserter.Contains(message.HTMLBody, "<p>The site is <b>broken</b></p>")
+		asserter.NotContains(message.HTMLBody, "steal")
+		if asserter.Len(message.Attachments, 1) {
+			asserter.Equal("notes.txt", message.Attachments[0].Name)
+			asserter.Equal("text/plain", message.Attachments[0].MimeType)
+			content, _ := ioutil.ReadAll(message.Attachments[0].Body)
+			asserter.Equal("some notes", string(content))
+		}
 		return nil
 	}
 
-	expectedError := "KaBOOm!"
-	objectRemoved := false
-	objectRemover := func(ctx context.Context, bucket, object string) error {
-		objectRemoved = true
-		asserter.Equal(inputCtx, ctx)
-		asserter.Equal(bucketToUse, bucket)
-		asserter.Equal(inputMessageID, object)
-		return errors.New(expectedError)
+	err := NewForwarder(bucketToUse, objectFetcher, sender, nil, false)(inputCtx, inputMessageID, inputSubject, "", inputSendFrom, inputForwardTo)
+
+	asserter.True(mailSent)
+	asserter.NoError(err)
+}
+
+func Test_NewForwarder_AttachOriginal(t *testing.T) {
+	asserter := assert.New(t)
+
+	inputMessageID := "12345"
+
+	objectFetcher := func(ctx context.Context, bucket, object string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(testEmail)), nil
 	}
 
-	err := NewForwarder(bucketToUse, objectFetcher, sender, objectRemover)(inputCtx, inputMessageID, inputSubject, inputSendFrom, inputForwardTo)
+	mailSent := false
+	sender := func(ctx context.Context, message Message) error {
+		mailSent = true
+		if asserter.Len(message.Attachments, 2) {
+			original := message.Attachments[1]
+			asserter.Equal(fmt.Sprintf("%s.eml", inputMessageID), original.Name)
+			asserter.Equal("message/rfc822", original.MimeType)
+			content, _ := ioutil.ReadAll(original.Body)
+			asserter.Equal(testEmail, string(content))
+		}
+		return nil
+	}
+
+	err := NewForwarder("somebucket", objectFetcher, sender, nil, true)(context.Background(), inputMessageID, "fallback", "", "support@sabadoscodes.com", []string{"mcTester@testing.com"})
 
 	asserter.True(mailSent)
-	asserter.True(objectRemoved)
-	asserter.EqualError(err, expectedError)
+	asserter.NoError(err)
 }
 
-func Test_NewForwarder_HappyPath(t *testing.T) {
+func Test_NewForwarder_UnparseableMessage_ForwardsOriginal(t *testing.T) {
 	asserter := assert.New(t)
 
-	bucketToUse := "somebucket"
-
-	inputCtx := context.WithValue(context.Background(), "foo", "bar")
 	inputMessageID := "12345"
 	inputSubject := "testing FTW"
-	inputSendFrom := "bob@testing.com"
-	inputForwardTo := "mcTester@testing.com"
+	inputSendFrom := "support@sabadoscodes.com"
+	raw := []byte("this is not an email")
 
-	expectedAttachment := ioutil.NopCloser(bytes.NewReader([]byte("this would be an email")))
 	objectFetcher := func(ctx context.Context, bucket, object string) (io.ReadCloser, error) {
-		asserter.Equal(inputCtx, ctx)
-		asserter.Equal(bucketToUse, bucket)
-		asserter.Equal(inputMessageID, object)
-		return expectedAttachment, nil
+		return ioutil.NopCloser(bytes.NewReader(raw)), nil
 	}
 
 	mailSent := false
-	sender := func(ctx context.Context, from, to, subject, htmlBody, textBody string, attachments ...Attachment) error {
+	sender := func(ctx context.Context, message Message) error {
 		mailSent = true
-		asserter.Equal(inputCtx, ctx)
-		asserter.Equal(inputSendFrom, from)
-		asserter.Equal(inputForwardTo, to)
-		asserter.Equal(inputSubject, subject)
-		asserter.Equal("<p>See attached email</p>", htmlBody)
-		asserter.Equal("See attached email", textBody)
-		asserter.Equal([]Attachment{
-			{
-				Name:     fmt.Sprintf("%s.eml", inputMessageID),
-				MimeType: "message/rfc822",
-				Body:     expectedAttachment,
-			},
-		}, attachments)
+		asserter.Equal(inputSendFrom, message.From)
+		asserter.Empty(message.ReplyTo)
+		asserter.Equal(inputSubject, message.Subject)
+		asserter.Equal("The email could not be read, see the attached original.", message.TextBody)
+		if asserter.Len(message.Attachments, 1) {
+			asserter.Equal(fmt.Sprintf("%s.eml", inputMessageID), message.Attachments[0].Name)
+			content, _ := ioutil.ReadAll(message.Attachments[0].Body)
+			asserter.Equal(raw, content)
+		}
 		return nil
 	}
 
-	objectRemoved := false
-	objectRemover := func(ctx context.Context, bucket, object string) error {
-		objectRemoved = true
+	err := NewForwarder("somebucket", objectFetcher, sender, nil, false)(context.Background(), inputMessageID, inputSubject, "", inputSendFrom, []string{"mcTester@testing.com"})
+
+	asserter.True(mailSent)
+	asserter.NoError(err)
+}
+
+func Test_NewForwarder_TooLarge_SendsLink(t *testing.T) {
+	asserter := assert.New(t)
+
+	inputCtx := context.WithValue(context.Background(), "foo", "bar")
+	objectFetcher := func(ctx context.Context, bucket, object string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(testEmail)), nil
+	}
+
+	linkExpires := time.Date(2021, 3, 8, 12, 0, 0, 0, time.UTC)
+	linkOriginal := func(ctx context.Context, messageID string) (s3.PresignedRequest, error) {
 		asserter.Equal(inputCtx, ctx)
-		asserter.Equal(bucketToUse, bucket)
-		asserter.Equal(inputMessageID, object)
+		asserter.Equal("12345", messageID)
+		return s3.PresignedRequest{URL: "https://example.com/large/12345?sig=a&b", Method: "GET", Expires: linkExpires}, nil
+	}
+
+	sent := make([]Message, 0)
+	sender := func(ctx context.Context, message Message) error {
+		sent = append(sent, message)
+		if len(sent) == 1 {
+			return errors.Wrap(ErrMessageTooLarge, "message is 11534336 bytes")
+		}
 		return nil
 	}
 
-	err := NewForwarder(bucketToUse, objectFetcher, sender, objectRemover)(inputCtx, inputMessageID, inputSubject, inputSendFrom, inputForwardTo)
+	err := NewForwarder("somebucket", objectFetcher, sender, linkOriginal, true)(inputCtx, "12345", "fallback", "", "support@sabadoscodes.com", []string{"mcTester@testing.com"})
+	asserter.NoError(err)
+	if asserter.Len(sent, 2) {
+		fallback := sent[1]
+		asserter.Equal(sent[0].Subject, fallback.Subject)
+		asserter.Equal(sent[0].To, fallback.To)
+		asserter.Equal(sent[0].ReplyTo, fallback.ReplyTo)
+		asserter.Empty(fallback.Attachments)
+		asserter.True(strings.HasPrefix(fallback.TextBody, "This email was too large to forward (0.0 MB). The original, attachments and all, can be downloaded until Mon, 08 Mar 2021 12:00:00 UTC from:\nhttps://example.com/large/12345?sig=a&b\n\n"))
+		asserter.True(strings.HasSuffix(fallback.TextBody, sent[0].TextBody))
+		asserter.Contains(fallback.HTMLBody, `<a href="https://example.com/large/12345?sig=a&amp;b">The original</a>`)
+		asserter.True(strings.HasSuffix(fallback.HTMLBody, sent[0].HTMLBody))
+	}
+}
+
+const inlineImageEmail = "From: bob@example.com\r\n" +
+	"To: support@sabadoscodes.com\r\n" +
+	"Subject: Look at this\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/related; boundary=\"related\"\r\n" +
+	"\r\n" +
+	"--related\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p><img src=\"cid:logo\"></p>\r\n" +
+	"--related\r\n" +
+	"Content-Type: image/png\r\n" +
+	"Content-ID: <logo>\r\n" +
+	"Content-Disposition: inline\r\n" +
+	"\r\n" +
+	"png bytes\r\n" +
+	"--related--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Disposition: attachment; filename=\"report.pdf\"\r\n" +
+	"\r\n" +
+	"pdf bytes\r\n" +
+	"--outer--\r\n"
+
+func Test_NewForwarder_TooLarge_KeepsInlineParts(t *testing.T) {
+	asserter := assert.New(t)
+
+	objectFetcher := func(ctx context.Context, bucket, object string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(inlineImageEmail)), nil
+	}
+	linkOriginal := func(ctx context.Context, messageID string) (s3.PresignedRequest, error) {
+		return s3.PresignedRequest{URL: "https://example.com/large/12345", Method: "GET", Expires: time.Now().Add(time.Hour)}, nil
+	}
+
+	sent := make([]Message, 0)
+	inlineBodies := make([]string, 0)
+	sender := func(ctx context.Context, message Message) error {
+		sent = append(sent, message)
+		for _, a := range message.Attachments {
+			body, err := io.ReadAll(a.Body)
+			asserter.NoError(err)
+			if a.ContentID != "" {
+				inlineBodies = append(inlineBodies, string(body))
+			}
+		}
+		if len(sent) == 1 {
+			return errors.WithStack(ErrMessageTooLarge)
+		}
+		return nil
+	}
+
+	err := NewForwarder("somebucket", objectFetcher, sender, linkOriginal, false)(context.Background(), "12345", "fallback", "", "support@sabadoscodes.com", []string{"mcTester@testing.com"})
+	asserter.NoError(err)
+	if asserter.Len(sent, 2) {
+		asserter.Len(sent[0].Attachments, 2)
+		if asserter.Len(sent[1].Attachments, 1) {
+			asserter.Equal("logo", sent[1].Attachments[0].ContentID)
+		}
+		asserter.Contains(sent[1].HTMLBody, `cid:logo`)
+	}
+	// the inline part goes out whole both times, not just the first
+	asserter.Equal([]string{"png bytes", "png bytes"}, inlineBodies)
+}
+
+func Test_NewForwarder_TooLarge_InlinePartsTooLarge_DropsThem(t *testing.T) {
+	asserter := assert.New(t)
+
+	objectFetcher := func(ctx context.Context, bucket, object string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(inlineImageEmail)), nil
+	}
+	linkOriginal := func(ctx context.Context, messageID string) (s3.PresignedRequest, error) {
+		return s3.PresignedRequest{URL: "https://example.com/large/12345", Method: "GET", Expires: time.Now().Add(time.Hour)}, nil
+	}
+
+	sent := make([]Message, 0)
+	sender := func(ctx context.Context, message Message) error {
+		sent = append(sent, message)
+		if len(message.Attachments) > 0 {
+			return errors.WithStack(ErrMessageTooLarge)
+		}
+		return nil
+	}
+
+	err := NewForwarder("somebucket", objectFetcher, sender, linkOriginal, false)(context.Background(), "12345", "fallback", "", "support@sabadoscodes.com", []string{"mcTester@testing.com"})
+	asserter.NoError(err)
+	if asserter.Len(sent, 3) {
+		asserter.Len(sent[1].Attachments, 1)
+		asserter.Empty(sent[2].Attachments)
+	}
+}
+
+func Test_NewForwarder_TooLarge_LinkFails_BubblesError(t *testing.T) {
+	asserter := assert.New(t)
+
+	objectFetcher := func(ctx context.Context, bucket, object string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(testEmail)), nil
+	}
+	linkOriginal := func(ctx context.Context, messageID string) (s3.PresignedRequest, error) {
+		return s3.PresignedRequest{}, errors.New("KaBOOm!")
+	}
+	sendCount := 0
+	sender := func(ctx context.Context, message Message) error {
+		sendCount++
+		return errors.WithStack(ErrMessageTooLarge)
+	}
+
+	err := NewForwarder("somebucket", objectFetcher, sender, linkOriginal, false)(context.Background(), "12345", "fallback", "", "support@sabadoscodes.com", []string{"mcTester@testing.com"})
+	asserter.EqualError(err, "KaBOOm!")
+	asserter.Equal(1, sendCount)
+}
+
+func Test_NewForwarder_SubjectTag(t *testing.T) {
+	asserter := assert.New(t)
+
+	objectFetcher := func(ctx context.Context, bucket, object string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(testEmail)), nil
+	}
+
+	mailSent := false
+	sender := func(ctx context.Context, message Message) error {
+		mailSent = true
+		asserter.Equal("[failed spf] Help with the site", message.Subject)
+		return nil
+	}
+
+	err := NewForwarder("somebucket", objectFetcher, sender, nil, false)(context.Background(), "12345", "fallback", "[failed spf]", "support@sabadoscodes.com", []string{"mcTester@testing.com"})
 
 	asserter.True(mailSent)
-	asserter.True(objectRemoved)
 	asserter.NoError(err)
 }
+
+func Test_NewQuarantiner(t *testing.T) {
+	asserter := assert.New(t)
+
+	copied := false
+	copyObject := func(ctx context.Context, bucket string, sourceKey string, targetKey string) error {
+		copied = true
+		asserter.Equal("somebucket", bucket)
+		asserter.Equal("12345", sourceKey)
+		asserter.Equal("quarantine/12345", targetKey)
+		return nil
+	}
+	removed := false
+	removeObject := func(ctx context.Context, bucket, object string) error {
+		removed = true
+		asserter.True(copied, "object should be copied before being removed")
+		asserter.Equal("12345", object)
+		return nil
+	}
+
+	err := NewQuarantiner("somebucket", copyObject, removeObject)(context.Background(), "12345")
+	asserter.NoError(err)
+	asserter.True(removed)
+}
+
+func Test_NewDiscarder(t *testing.T) {
+	asserter := assert.New(t)
+
+	removed := false
+	removeObject := func(ctx context.Context, bucket, object string) error {
+		removed = true
+		asserter.Equal("somebucket", bucket)
+		asserter.Equal("12345", object)
+		return nil
+	}
+
+	err := NewDiscarder("somebucket", removeObject)(context.Background(), "12345")
+	asserter.NoError(err)
+	asserter.True(removed)
+}
@@ -0,0 +1,212 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// maxPartDepth is how deeply multipart parts may nest before a message is considered broken
+const maxPartDepth = 10
+
+// ParsedMessage is what is worth knowing about a received email
+type ParsedMessage struct {
+	From        []*mail.Address
+	ReplyTo     []*mail.Address
+	To          []*mail.Address
+	Cc          []*mail.Address
+	Subject     string
+	Date        time.Time
+	Text        string
+	HTML        string
+	Attachments []Attachment
+}
+
+var headerDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// ParseMessage reads a MIME email, decoding its headers, bodies and attachments. Text and html bodies are converted to
+// utf-8, anything else that isn't a body becomes an attachment. Malformed addresses and dates are skipped rather than
+// failing the whole message.
+func ParseMessage(r io.Reader) (*ParsedMessage, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	subject, err := headerDecoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	ret := &ParsedMessage{
+		From:    parseAddresses(msg.Header, "From"),
+		ReplyTo: parseAddresses(msg.Header, "Reply-To"),
+		To:      parseAddresses(msg.Header, "To"),
+		Cc:      parseAddresses(msg.Header, "Cc"),
+		Subject: subject,
+	}
+	date, err := msg.Header.Date()
+	if err == nil {
+		ret.Date = date
+	}
+
+	err = ret.readPart(textproto.MIMEHeader(msg.Header), msg.Body, 0)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func parseAddresses(header mail.Header, field string) []*mail.Address {
+	value := header.Get(field)
+	if value == "" {
+		return nil
+	}
+	parser := &mail.AddressParser{WordDecoder: headerDecoder}
+	addresses, err := parser.ParseList(value)
+	if err != nil {
+		return nil
+	}
+	return addresses
+}
+
+func (p *ParsedMessage) readPart(header textproto.MIMEHeader, body io.Reader, depth int) error {
+	if depth > maxPartDepth {
+		return errors.Errorf("message parts nested more than %d deep", maxPartDepth)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+		if header.Get("Content-Type") != "" {
+			mediaType = "application/octet-stream"
+		}
+		params = map[string]string{}
+	}
+	body = decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body)
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		parts := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := parts.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			err = p.readPart(part.Header, part, depth+1)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	disposition, dispositionParams, err := mime.ParseMediaType(header.Get("Content-Disposition"))
+	if err != nil {
+		disposition = ""
+		dispositionParams = map[string]string{}
+	}
+	filename := dispositionParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if decoded, err := headerDecoder.DecodeHeader(filename); err == nil {
+		filename = decoded
+	}
+
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if (mediaType == "text/plain" || mediaType == "text/html") && disposition != "attachment" && filename == "" {
+		text := decodeCharset(params["charset"], content)
+		if mediaType == "text/plain" {
+			p.Text = appendBody(p.Text, text, "\n\n")
+		} else {
+			p.HTML = appendBody(p.HTML, text, "\n")
+		}
+		return nil
+	}
+
+	attachment := Attachment{
+		Name:     attachmentName(filename, mediaType, len(p.Attachments)+1),
+		MimeType: mediaType,
+		Body:     bytes.NewReader(content),
+	}
+	if disposition != "attachment" {
+		attachment.ContentID = strings.Trim(header.Get("Content-Id"), "<> ")
+	}
+	p.Attachments = append(p.Attachments, attachment)
+	return nil
+}
+
+func appendBody(existing, addition, separator string) string {
+	if existing == "" {
+		return addition
+	}
+	return existing + separator + addition
+}
+
+func attachmentName(filename, mediaType string, number int) string {
+	// only the name is any use, and a path could end up somewhere unexpected when saved
+	filename = filename[strings.LastIndexAny(filename, `/\`)+1:]
+	if filename != "" {
+		return filename
+	}
+	if mediaType == "message/rfc822" {
+		return fmt.Sprintf("attachment-%d.eml", number)
+	}
+	extensions, err := mime.ExtensionsByType(mediaType)
+	if err != nil || len(extensions) == 0 {
+		return fmt.Sprintf("attachment-%d", number)
+	}
+	return fmt.Sprintf("attachment-%d%s", number, extensions[0])
+}
+
+func decodeTransferEncoding(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
+
+// decodeCharset converts content to utf-8, leaving it as is if the charset isn't known
+func decodeCharset(charset string, content []byte) string {
+	reader, err := charsetReader(charset, bytes.NewReader(content))
+	if err != nil {
+		return string(content)
+	}
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return string(content)
+	}
+	return string(decoded)
+}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	}
+	encoding, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return encoding.NewDecoder().Reader(input), nil
+}
@@ -0,0 +1,130 @@
+package mail
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMessage_SinglePart(t *testing.T) {
+	asserter := assert.New(t)
+
+	raw := "From: =?UTF-8?Q?Ren=C3=A9e?= <renee@example.com>\r\n" +
+		"Reply-To: replies@example.com\r\n" +
+		"To: a@example.com, B <b@example.com>\r\n" +
+		"Cc: c@example.com\r\n" +
+		"Subject: =?ISO-8859-1?Q?Caf=E9?= question\r\n" +
+		"Date: Mon, 02 Jan 2006 15:04:05 -0700\r\n" +
+		"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Is the caf=E9 open?\r\n"
+
+	parsed, err := ParseMessage(strings.NewReader(raw))
+	asserter.NoError(err)
+	if parsed == nil {
+		t.Fatal("expected a parsed message")
+	}
+
+	if asserter.Len(parsed.From, 1) {
+		asserter.Equal("Renée", parsed.From[0].Name)
+		asserter.Equal("renee@example.com", parsed.From[0].Address)
+	}
+	if asserter.Len(parsed.ReplyTo, 1) {
+		asserter.Equal("replies@example.com", parsed.ReplyTo[0].Address)
+	}
+	asserter.Len(parsed.To, 2)
+	asserter.Len(parsed.Cc, 1)
+	asserter.Equal("Café question", parsed.Subject)
+	asserter.True(time.Date(2006, 1, 2, 22, 4, 5, 0, time.UTC).Equal(parsed.Date))
+	asserter.Equal("Is the café open?\r\n", parsed.Text)
+	asserter.Empty(parsed.HTML)
+	asserter.Empty(parsed.Attachments)
+}
+
+func TestParseMessage_Multipart(t *testing.T) {
+	asserter := assert.New(t)
+
+	raw := "From: bob@example.com\r\n" +
+		"Subject: pictures\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+		"\r\n" +
+		"--outer\r\n" +
+		"Content-Type: multipart/related; boundary=\"related\"\r\n" +
+		"\r\n" +
+		"--related\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"PHA+PGltZyBzcmM9ImNpZDpsb2dvIj48L3A+\r\n" +
+		"--related\r\n" +
+		"Content-Type: image/png\r\n" +
+		"Content-ID: <logo>\r\n" +
+		"Content-Disposition: inline\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"cG5nIGJ5dGVz\r\n" +
+		"--related--\r\n" +
+		"--outer\r\n" +
+		"Content-Type: application/pdf; name=\"../../report.pdf\"\r\n" +
+		"Content-Disposition: attachment\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"cGRmIGJ5dGVz\r\n" +
+		"--outer\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"\r\n" +
+		"Subject: nested\r\n" +
+		"\r\n" +
+		"nested body\r\n" +
+		"--outer--\r\n"
+
+	parsed, err := ParseMessage(strings.NewReader(raw))
+	asserter.NoError(err)
+	if parsed == nil {
+		t.Fatal("expected a parsed message")
+	}
+
+	asserter.Empty(parsed.Text)
+	asserter.Equal(`<p><img src="cid:logo"></p>`, parsed.HTML)
+	if asserter.Len(parsed.Attachments, 3) {
+		asserter.Equal("attachment-1.png", parsed.Attachments[0].Name)
+		asserter.Equal("image/png", parsed.Attachments[0].MimeType)
+		asserter.Equal("logo", parsed.Attachments[0].ContentID)
+		content, _ := ioutil.ReadAll(parsed.Attachments[0].Body)
+		asserter.Equal("png bytes", string(content))
+
+		asserter.Equal("report.pdf", parsed.Attachments[1].Name)
+		asserter.Equal("application/pdf", parsed.Attachments[1].MimeType)
+		asserter.Empty(parsed.Attachments[1].ContentID)
+		content, _ = ioutil.ReadAll(parsed.Attachments[1].Body)
+		asserter.Equal("pdf bytes", string(content))
+
+		asserter.Equal("attachment-3.eml", parsed.Attachments[2].Name)
+		asserter.Equal("message/rfc822", parsed.Attachments[2].MimeType)
+		content, _ = ioutil.ReadAll(parsed.Attachments[2].Body)
+		asserter.Equal("Subject: nested\r\n\r\nnested body", string(content))
+	}
+}
+
+func TestParseMessage_MissingHeaders(t *testing.T) {
+	asserter := assert.New(t)
+
+	parsed, err := ParseMessage(strings.NewReader("From: not an address\r\nDate: yesterday\r\n\r\nhello"))
+	asserter.NoError(err)
+	if parsed == nil {
+		t.Fatal("expected a parsed message")
+	}
+	asserter.Empty(parsed.From)
+	asserter.True(parsed.Date.IsZero())
+	asserter.Empty(parsed.Subject)
+	asserter.Equal("hello", parsed.Text)
+}
+
+func TestParseMessage_NotAMessage(t *testing.T) {
+	_, err := ParseMessage(strings.NewReader("this is not an email"))
+	assert.Error(t, err)
+}
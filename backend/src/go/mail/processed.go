@@ -0,0 +1,86 @@
+package mail
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+)
+
+const (
+	fieldMessageID = "MessageID"
+	fieldOutcome   = "Outcome"
+	fieldProcessed = "Processed"
+	fieldExpires   = "Expires"
+)
+
+// OutcomeDeadLetter is the outcome recorded for messages that couldn't be processed
+const OutcomeDeadLetter = "dead-letter"
+
+// OutcomeForwarded is recorded as soon as a message has been forwarded, before the original is archived or discarded.
+// Messages left with it only need that cleaning up, forwarding them again would send a second copy.
+const OutcomeForwarded = "forwarded"
+
+// DefaultProcessedRetention is how long processed messages are remembered, well past anything SES would retry
+const DefaultProcessedRetention = 30 * 24 * time.Hour
+
+// ProcessedLookup finds what became of a message that has already been processed, giving a blank outcome for messages
+// that haven't been
+type ProcessedLookup func(ctx context.Context, messageID string) (string, error)
+
+func NewProcessedLookup(db *dynamodb.DynamoDB, processedTable string) ProcessedLookup {
+	return func(ctx context.Context, messageID string) (string, error) {
+		res, err := db.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+			TableName: aws.String(processedTable),
+			Key: map[string]*dynamodb.AttributeValue{
+				fieldMessageID: {S: aws.String(messageID)},
+			},
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		if res.Item == nil || res.Item[fieldOutcome] == nil {
+			return "", nil
+		}
+		return aws.StringValue(res.Item[fieldOutcome].S), nil
+	}
+}
+
+// ProcessedRecorder remembers what became of a message so it isn't processed again
+type ProcessedRecorder func(ctx context.Context, messageID string, outcome string) error
+
+// NewProcessedRecorder creates a ProcessedRecorder whose records expire, through the table's ttl, after retention
+func NewProcessedRecorder(db *dynamodb.DynamoDB, processedTable string, retention time.Duration) ProcessedRecorder {
+	return func(ctx context.Context, messageID string, outcome string) error {
+		now := time.Now()
+		_, err := db.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(processedTable),
+			Item: map[string]*dynamodb.AttributeValue{
+				fieldMessageID: {S: aws.String(messageID)},
+				fieldOutcome:   {S: aws.String(outcome)},
+				fieldProcessed: {N: aws.String(strconv.FormatInt(now.UnixNano(), 10))},
+				fieldExpires:   {N: aws.String(strconv.FormatInt(now.Add(retention).Unix(), 10))},
+			},
+		})
+		return errors.WithStack(err)
+	}
+}
+
+// ProcessedClearer forgets a message was processed, so it can be processed again
+type ProcessedClearer func(ctx context.Context, messageID string) error
+
+func NewProcessedClearer(db *dynamodb.DynamoDB, processedTable string) ProcessedClearer {
+	return func(ctx context.Context, messageID string) error {
+		_, err := db.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(processedTable),
+			Key: map[string]*dynamodb.AttributeValue{
+				fieldMessageID: {S: aws.String(messageID)},
+			},
+		})
+		return errors.WithStack(err)
+	}
+}
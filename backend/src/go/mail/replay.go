@@ -0,0 +1,67 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/pkg/errors"
+)
+
+// ForwarderInvoker hands an event to the forwarder lambda, waiting for it to finish
+type ForwarderInvoker func(ctx context.Context, event events.SimpleEmailEvent) error
+
+func NewForwarderInvoker(client *lambda.Lambda, functionName string) ForwarderInvoker {
+	return func(ctx context.Context, event events.SimpleEmailEvent) error {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		res, err := client.InvokeWithContext(ctx, &lambda.InvokeInput{
+			FunctionName:   aws.String(functionName),
+			InvocationType: aws.String(lambda.InvocationTypeRequestResponse),
+			Payload:        payload,
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if res.FunctionError != nil {
+			return errors.Errorf("%s failed: %s", functionName, string(res.Payload))
+		}
+		return nil
+	}
+}
+
+// Replayer runs a dead lettered message through the forwarder again
+type Replayer func(ctx context.Context, deadLetter DeadLetter) error
+
+// NewReplayer creates a Replayer that puts the message back, forgets it was ever processed and hands the original SES
+// event to the forwarder. Messages that fail again end up back in the dead letters, and the replay reports an error.
+func NewReplayer(restore DeadLetterRestorer, clearProcessed ProcessedClearer, invokeForwarder ForwarderInvoker, lookupProcessed ProcessedLookup) Replayer {
+	return func(ctx context.Context, deadLetter DeadLetter) error {
+		err := restore(ctx, deadLetter.MessageID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		err = clearProcessed(ctx, deadLetter.MessageID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		err = invokeForwarder(ctx, events.SimpleEmailEvent{
+			Records: []events.SimpleEmailRecord{deadLetter.Record},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		outcome, err := lookupProcessed(ctx, deadLetter.MessageID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if outcome == OutcomeDeadLetter {
+			return errors.Errorf("%s failed again and is back in the dead letters", deadLetter.MessageID)
+		}
+		return nil
+	}
+}
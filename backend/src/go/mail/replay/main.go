@@ -0,0 +1,98 @@
+// Command replay lists the messages the support mail forwarder couldn't process and runs them through it again. It is
+// run by hand with credentials able to read and write the mail bucket and processed mail table, and invoke the
+// forwarder.
+//
+//	go run ./mail/replay -bucket mail.example.com            # list dead letters
+//	go run ./mail/replay -bucket mail.example.com -id <id>   # replay one
+//	go run ./mail/replay -bucket mail.example.com -all       # replay everything
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awslambda "github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-xray-sdk-go/strategy/ctxmissing"
+	"github.com/aws/aws-xray-sdk-go/xray"
+
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/mail"
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+func main() {
+	bucket := flag.String("bucket", os.Getenv("MAIL_BUCKET"), "the mail bucket")
+	processedTable := flag.String("table", "ProcessedMail", "the processed mail table")
+	function := flag.String("function", "supportForwarder", "the forwarder lambda")
+	messageID := flag.String("id", "", "replay only the dead letter for this message")
+	all := flag.Bool("all", false, "replay every dead letter")
+	flag.Parse()
+
+	if *bucket == "" {
+		fmt.Fprintln(os.Stderr, "-bucket is required")
+		os.Exit(2)
+	}
+
+	// the clients are traced, but there is no lambda segment to trace them into out here
+	err := xray.Configure(xray.Config{
+		ContextMissingStrategy: ctxmissing.NewDefaultIgnoreErrorStrategy(),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	s3Client := s3.RawClient(sess)
+	dynamoClient := dynamo.RawClient(sess)
+	describeObject := s3.NewObjectDescriber(s3Client)
+	removeObject := s3.NewObjectRemover(s3Client)
+
+	ctx := context.Background()
+	deadLetters, err := mail.NewDeadLetterLister(*bucket, s3.NewObjectLister(s3Client), s3.NewObjectFetcher(s3Client))(ctx)
+	if err != nil {
+		panic(err)
+	}
+
+	if *messageID == "" && !*all {
+		for _, d := range deadLetters {
+			fmt.Printf("%s\t%s\t%s\t%s\n", d.MessageID, d.Failed.Format("2006-01-02 15:04:05"), d.Record.SES.Mail.CommonHeaders.Subject, d.Error)
+		}
+		return
+	}
+
+	replay := mail.NewReplayer(mail.NewDeadLetterRestorer(*bucket, describeObject, s3.NewObjectCopier(s3Client), removeObject),
+		mail.NewProcessedClearer(dynamoClient, *processedTable),
+		mail.NewForwarderInvoker(awslambda.New(sess), *function),
+		mail.NewProcessedLookup(dynamoClient, *processedTable))
+
+	failed := false
+	found := false
+	for _, d := range deadLetters {
+		if !*all && d.MessageID != *messageID {
+			continue
+		}
+		found = true
+		err := replay(ctx, d)
+		if err != nil {
+			failed = true
+			fmt.Fprintf(os.Stderr, "%s: %v\n", d.MessageID, err)
+			continue
+		}
+		fmt.Printf("%s: replayed\n", d.MessageID)
+	}
+	if !found && *messageID != "" {
+		fmt.Fprintf(os.Stderr, "no dead letter for %s\n", *messageID)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
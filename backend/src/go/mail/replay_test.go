@@ -0,0 +1,55 @@
+package mail
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewReplayer(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		outcome       string
+		expectedError string
+	}{
+		{"replay works", "forward", ""},
+		{"replay fails again", OutcomeDeadLetter, "12345 failed again and is back in the dead letters"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			deadLetter := DeadLetter{MessageID: "12345", Record: deadLetterRecord("12345")}
+			steps := make([]string, 0)
+			restore := func(ctx context.Context, messageID string) error {
+				asserter.Equal("12345", messageID)
+				steps = append(steps, "restore")
+				return nil
+			}
+			clearProcessed := func(ctx context.Context, messageID string) error {
+				asserter.Equal("12345", messageID)
+				steps = append(steps, "clear")
+				return nil
+			}
+			invoke := func(ctx context.Context, event events.SimpleEmailEvent) error {
+				asserter.Equal(events.SimpleEmailEvent{Records: []events.SimpleEmailRecord{deadLetter.Record}}, event)
+				steps = append(steps, "invoke")
+				return nil
+			}
+			lookup := func(ctx context.Context, messageID string) (string, error) {
+				steps = append(steps, "lookup")
+				return tc.outcome, nil
+			}
+
+			err := NewReplayer(restore, clearProcessed, invoke, lookup)(context.Background(), deadLetter)
+			if tc.expectedError == "" {
+				asserter.NoError(err)
+			} else {
+				asserter.EqualError(err, tc.expectedError)
+			}
+			asserter.Equal([]string{"restore", "clear", "invoke", "lookup"}, steps)
+		})
+	}
+}
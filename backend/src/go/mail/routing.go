@@ -0,0 +1,212 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/mail"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/s3"
+	"github.com/jonsabados/sabadoscodes.com/wildcard"
+)
+
+// DefaultRoutingReloadInterval is how long a routing table loaded from S3 is used before it is fetched again
+const DefaultRoutingReloadInterval = time.Minute
+
+type RouteAction string
+
+const (
+	// RouteActionForward sends the message on to the route's destinations
+	RouteActionForward RouteAction = "forward"
+	// RouteActionArchive keeps the message in the mail bucket without sending it anywhere
+	RouteActionArchive RouteAction = "archive"
+	// RouteActionDrop throws the message away
+	RouteActionDrop RouteAction = "drop"
+)
+
+// Route is what happens to a message, and the name of the rule that decided it
+type Route struct {
+	Rule         string      `json:"name,omitempty"`
+	Action       RouteAction `json:"action"`
+	Destinations []string    `json:"destinations,omitempty"`
+}
+
+// RoutingRule applies its route to messages matching all of the criteria it sets. Recipients and Senders are address
+// patterns where * matches any sequence of characters, and at least one of the message's addresses has to match one of
+// them. Subject is a regular expression that has to be found in the subject.
+type RoutingRule struct {
+	Route
+	Recipients []string `json:"recipients,omitempty"`
+	Senders    []string `json:"senders,omitempty"`
+	Subject    string   `json:"subject,omitempty"`
+
+	subjectPattern *regexp.Regexp
+}
+
+// Matches reports if a message sent to recipients, from senders, with the given subject falls under the rule
+func (r RoutingRule) Matches(recipients []string, senders []string, subject string) bool {
+	if len(r.Recipients) > 0 && !anyAddressMatches(r.Recipients, recipients) {
+		return false
+	}
+	if len(r.Senders) > 0 && !anyAddressMatches(r.Senders, senders) {
+		return false
+	}
+	if r.subjectPattern != nil && !r.subjectPattern.MatchString(subject) {
+		return false
+	}
+	return true
+}
+
+// RoutingTable decides what happens to inbound mail. Rules are checked in order with the first match winning, and
+// messages matching none of them get the default route.
+type RoutingTable struct {
+	Rules   []RoutingRule `json:"rules"`
+	Default Route         `json:"default"`
+}
+
+// Route works out what should happen to a message
+func (t RoutingTable) Route(recipients []string, senders []string, subject string) Route {
+	for _, r := range t.Rules {
+		if r.Matches(recipients, senders, subject) {
+			return r.Route
+		}
+	}
+	ret := t.Default
+	if ret.Rule == "" {
+		ret.Rule = "default"
+	}
+	return ret
+}
+
+// NewForwardingTable creates a routing table that forwards everything to the given destinations
+func NewForwardingTable(destinations ...string) RoutingTable {
+	return RoutingTable{
+		Rules: []RoutingRule{},
+		Default: Route{
+			Action:       RouteActionForward,
+			Destinations: destinations,
+		},
+	}
+}
+
+// ParseRoutingTable reads a routing table from its json representation, validating each rule
+func ParseRoutingTable(raw []byte) (RoutingTable, error) {
+	ret := RoutingTable{}
+	err := json.Unmarshal(raw, &ret)
+	if err != nil {
+		return RoutingTable{}, errors.WithStack(err)
+	}
+	for i, r := range ret.Rules {
+		err := validateRoute(r.Route)
+		if err != nil {
+			return RoutingTable{}, errors.Wrapf(err, "rule %d (%s)", i, r.Rule)
+		}
+		if r.Subject != "" {
+			ret.Rules[i].subjectPattern, err = regexp.Compile(r.Subject)
+			if err != nil {
+				return RoutingTable{}, errors.Wrapf(err, "rule %d (%s)", i, r.Rule)
+			}
+		}
+	}
+	err = validateRoute(ret.Default)
+	if err != nil {
+		return RoutingTable{}, errors.Wrap(err, "default")
+	}
+	return ret, nil
+}
+
+func validateRoute(r Route) error {
+	switch r.Action {
+	case RouteActionForward:
+		if len(r.Destinations) == 0 {
+			return errors.New("forward requires at least one destination")
+		}
+		for _, d := range r.Destinations {
+			_, err := mail.ParseAddress(d)
+			if err != nil {
+				return errors.Wrapf(err, "invalid destination %s", d)
+			}
+		}
+	case RouteActionArchive, RouteActionDrop:
+		if len(r.Destinations) > 0 {
+			return errors.Errorf("%s does not take destinations", r.Action)
+		}
+	default:
+		return errors.Errorf("unknown action %q", r.Action)
+	}
+	return nil
+}
+
+func anyAddressMatches(patterns []string, addresses []string) bool {
+	for _, p := range patterns {
+		for _, a := range addresses {
+			if wildcard.Match(strings.ToLower(p), strings.ToLower(a)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RoutingTableLoader provides the routing table to use
+type RoutingTableLoader func(ctx context.Context) (RoutingTable, error)
+
+// NewStaticRoutingTableLoader creates a RoutingTableLoader that always provides the same table
+func NewStaticRoutingTableLoader(table RoutingTable) RoutingTableLoader {
+	return func(ctx context.Context) (RoutingTable, error) {
+		return table, nil
+	}
+}
+
+// NewS3RoutingTableLoader creates a RoutingTableLoader reading the table from a json document in S3. The table is
+// held onto for reloadInterval, so changes to the document are picked up without a deploy. If a reload fails the
+// previous table keeps being used until one succeeds.
+func NewS3RoutingTableLoader(bucket, key string, fetchObject s3.ObjectFetcher, reloadInterval time.Duration) RoutingTableLoader {
+	var mutex sync.Mutex
+	var current *RoutingTable
+	var loaded time.Time
+
+	return func(ctx context.Context) (RoutingTable, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if current != nil && time.Since(loaded) < reloadInterval {
+			return *current, nil
+		}
+
+		table, err := fetchRoutingTable(ctx, bucket, key, fetchObject)
+		if err != nil {
+			if current == nil {
+				return RoutingTable{}, err
+			}
+			zerolog.Ctx(ctx).Warn().Str("error", fmt.Sprintf("%+v", err)).Msg("unable to reload routing table, using previous version")
+			// don't hammer away at a broken document on every message
+			loaded = time.Now()
+			return *current, nil
+		}
+		current = &table
+		loaded = time.Now()
+		return table, nil
+	}
+}
+
+func fetchRoutingTable(ctx context.Context, bucket, key string, fetchObject s3.ObjectFetcher) (RoutingTable, error) {
+	object, err := fetchObject(ctx, bucket, key)
+	if err != nil {
+		return RoutingTable{}, errors.WithStack(err)
+	}
+	raw, err := io.ReadAll(object)
+	_ = object.Close()
+	if err != nil {
+		return RoutingTable{}, errors.WithStack(err)
+	}
+	return ParseRoutingTable(raw)
+}
@@ -0,0 +1,157 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testRoutingTable = `{
+	"rules": [
+		{"name": "billing", "recipients": ["billing@*", "accounts@*"], "action": "forward", "destinations": ["a@testing.com", "b@testing.com"]},
+		{"name": "vendor invoices", "senders": ["*@vendor.example.com"], "subject": "(?i)^invoice", "action": "archive"},
+		{"name": "spam", "senders": ["*spam*"], "action": "drop"}
+	],
+	"default": {"action": "forward", "destinations": ["support@testing.com"]}
+}`
+
+func TestRoutingTable_Route(t *testing.T) {
+	table, err := ParseRoutingTable([]byte(testRoutingTable))
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		desc       string
+		recipients []string
+		senders    []string
+		subject    string
+		expected   Route
+	}{
+		{
+			"no rule matches",
+			[]string{"support@sabadoscodes.com"},
+			[]string{"bob@example.com"},
+			"hello",
+			Route{Rule: "default", Action: RouteActionForward, Destinations: []string{"support@testing.com"}},
+		},
+		{
+			"any recipient can match",
+			[]string{"support@sabadoscodes.com", "Accounts@SabadosCodes.com"},
+			[]string{"bob@example.com"},
+			"hello",
+			Route{Rule: "billing", Action: RouteActionForward, Destinations: []string{"a@testing.com", "b@testing.com"}},
+		},
+		{
+			"all criteria must match",
+			[]string{"support@sabadoscodes.com"},
+			[]string{"billing@vendor.example.com"},
+			"a question",
+			Route{Rule: "default", Action: RouteActionForward, Destinations: []string{"support@testing.com"}},
+		},
+		{
+			"sender and subject match",
+			[]string{"support@sabadoscodes.com"},
+			[]string{"bounces@mailer.example.com", "billing@vendor.example.com"},
+			"Invoice 1234",
+			Route{Rule: "vendor invoices", Action: RouteActionArchive},
+		},
+		{
+			"first match wins",
+			[]string{"billing@sabadoscodes.com"},
+			[]string{"spammer@example.com"},
+			"hello",
+			Route{Rule: "billing", Action: RouteActionForward, Destinations: []string{"a@testing.com", "b@testing.com"}},
+		},
+		{
+			"wildcards in the middle",
+			[]string{"support@sabadoscodes.com"},
+			[]string{"bigspammer@example.com"},
+			"hello",
+			Route{Rule: "spam", Action: RouteActionDrop},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.expected, table.Route(tc.recipients, tc.senders, tc.subject))
+		})
+	}
+}
+
+func TestParseRoutingTable_Invalid(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{"not json", `nope`, "invalid character 'o' in literal null (expecting 'u')"},
+		{"no default", `{"rules": []}`, `default: unknown action ""`},
+		{"forward without destinations", `{"rules": [{"name": "x", "action": "forward"}], "default": {"action": "drop"}}`, "rule 0 (x): forward requires at least one destination"},
+		{"bad destination", `{"default": {"action": "forward", "destinations": ["nope"]}}`, "default: invalid destination nope: mail: missing '@' or angle-addr"},
+		{"drop with destinations", `{"default": {"action": "drop", "destinations": ["a@testing.com"]}}`, "default: drop does not take destinations"},
+		{"bad subject", `{"rules": [{"name": "x", "subject": "(", "action": "drop"}], "default": {"action": "drop"}}`, "rule 0 (x): error parsing regexp: missing closing ): `(`"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := ParseRoutingTable([]byte(tc.input))
+			assert.EqualError(t, err, tc.expected)
+		})
+	}
+}
+
+func TestNewS3RoutingTableLoader(t *testing.T) {
+	asserter := assert.New(t)
+
+	documents := []string{testRoutingTable, `{"default": {"action": "drop"}}`}
+	fetches := 0
+	var fetchErr error
+	fetchObject := func(ctx context.Context, bucket, object string) (io.ReadCloser, error) {
+		asserter.Equal("somebucket", bucket)
+		asserter.Equal("config/routing.json", object)
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		doc := documents[fetches]
+		fetches++
+		return ioutil.NopCloser(strings.NewReader(doc)), nil
+	}
+
+	load := NewS3RoutingTableLoader("somebucket", "config/routing.json", fetchObject, 20*time.Millisecond)
+
+	table, err := load(context.Background())
+	asserter.NoError(err)
+	asserter.Len(table.Rules, 3)
+
+	// cached until the reload interval passes
+	table, err = load(context.Background())
+	asserter.NoError(err)
+	asserter.Len(table.Rules, 3)
+	asserter.Equal(1, fetches)
+
+	time.Sleep(25 * time.Millisecond)
+	table, err = load(context.Background())
+	asserter.NoError(err)
+	asserter.Empty(table.Rules)
+	asserter.Equal(RouteActionDrop, table.Default.Action)
+	asserter.Equal(2, fetches)
+
+	// failures keep the last good table around
+	fetchErr = errors.New("KaBOOm!")
+	time.Sleep(25 * time.Millisecond)
+	table, err = load(context.Background())
+	asserter.NoError(err)
+	asserter.Equal(RouteActionDrop, table.Default.Action)
+}
+
+func TestNewS3RoutingTableLoader_NothingLoaded_BubblesError(t *testing.T) {
+	fetchObject := func(ctx context.Context, bucket, object string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(`{"default": {}}`)), nil
+	}
+
+	_, err := NewS3RoutingTableLoader("somebucket", "config/routing.json", fetchObject, time.Minute)(context.Background())
+	assert.EqualError(t, err, `default: unknown action ""`)
+}
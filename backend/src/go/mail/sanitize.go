@@ -0,0 +1,230 @@
+package mail
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// droppedElements are removed along with everything in them
+var droppedElements = map[string]bool{
+	"script":   true,
+	"noscript": true,
+	"iframe":   true,
+	"frame":    true,
+	"frameset": true,
+	"object":   true,
+	"embed":    true,
+	"applet":   true,
+	"title":    true,
+	"textarea": true,
+	"select":   true,
+	"button":   true,
+	"template": true,
+	// svg animation can set attributes, links included, to whatever it likes
+	"animate": true,
+	"set":     true,
+}
+
+// droppedTags are removed but anything in them is kept
+var droppedTags = map[string]bool{
+	"html":  true,
+	"head":  true,
+	"body":  true,
+	"form":  true,
+	"base":  true,
+	"meta":  true,
+	"link":  true,
+	"input": true,
+}
+
+var urlAttributes = map[string]bool{
+	"href":       true,
+	"src":        true,
+	"xlink:href": true,
+	"background": true,
+	"poster":     true,
+	"action":     true,
+	"formaction": true,
+	"longdesc":   true,
+	"cite":       true,
+}
+
+var allowedSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+	"tel":    true,
+	"cid":    true,
+}
+
+var dangerousCSS = regexp.MustCompile(`(?i)expression\s*\(|javascript:|vbscript:|behavior\s*:|-moz-binding|@import`)
+
+var schemePattern = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.-]*):`)
+
+// SanitizeHTML strips anything from an html email that could run script, submit a form or otherwise misbehave when it
+// is displayed as part of another message. The document wrapper (html, head and body tags) goes too so the result can
+// be embedded.
+func SanitizeHTML(input string) string {
+	ret := &strings.Builder{}
+	tokenizer := html.NewTokenizer(strings.NewReader(input))
+	var skipping string
+	skipDepth := 0
+	inStyle := false
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			// either the end of the input or something unreadable, and nothing past that is trustworthy
+			return strings.TrimSpace(ret.String())
+		}
+		token := tokenizer.Token()
+
+		if skipping != "" {
+			switch {
+			case tokenType == html.StartTagToken && token.Data == skipping:
+				skipDepth++
+			case tokenType == html.EndTagToken && token.Data == skipping:
+				skipDepth--
+				if skipDepth == 0 {
+					skipping = ""
+				}
+			}
+			continue
+		}
+
+		switch tokenType {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if droppedElements[token.Data] {
+				if tokenType == html.StartTagToken {
+					skipping = token.Data
+					skipDepth = 1
+				}
+				continue
+			}
+			if droppedTags[token.Data] {
+				continue
+			}
+			token.Attr = sanitizeAttributes(token.Attr)
+			inStyle = token.Data == "style" && tokenType == html.StartTagToken
+			ret.WriteString(token.String())
+		case html.EndTagToken:
+			if droppedElements[token.Data] || droppedTags[token.Data] {
+				continue
+			}
+			if token.Data == "style" {
+				inStyle = false
+			}
+			ret.WriteString(token.String())
+		case html.TextToken:
+			if inStyle {
+				// css isn't html escaped, and the tokenizer has already stopped it at the closing tag
+				if !dangerousCSS.MatchString(token.Data) {
+					ret.WriteString(token.Data)
+				}
+				continue
+			}
+			ret.WriteString(token.String())
+		}
+		// comments and doctypes are dropped, conditional comments in particular can hide markup
+	}
+}
+
+func sanitizeAttributes(attributes []html.Attribute) []html.Attribute {
+	ret := make([]html.Attribute, 0, len(attributes))
+	for _, a := range attributes {
+		key := strings.ToLower(a.Key)
+		if a.Namespace != "" {
+			key = strings.ToLower(a.Namespace) + ":" + key
+		}
+		switch {
+		case strings.HasPrefix(key, "on"):
+			continue
+		case key == "style" && dangerousCSS.MatchString(a.Val):
+			continue
+		case key == "srcset" && !safeSrcset(a.Val):
+			continue
+		case urlAttributes[key] && !safeURL(a.Val, key == "src"):
+			continue
+		}
+		ret = append(ret, a)
+	}
+	return ret
+}
+
+func safeSrcset(value string) bool {
+	for _, candidate := range strings.Split(value, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) > 0 && !safeURL(fields[0], false) {
+			return false
+		}
+	}
+	return true
+}
+
+// safeURL reports if the url is relative or uses a scheme that can't run anything, with data urls allowed for images
+// when allowDataImages is set
+func safeURL(value string, allowDataImages bool) bool {
+	// browsers ignore whitespace and control characters in schemes, so strip them before looking
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value)
+	match := schemePattern.FindStringSubmatch(cleaned)
+	if match == nil {
+		return true
+	}
+	scheme := strings.ToLower(match[1])
+	if scheme == "data" {
+		return allowDataImages && strings.HasPrefix(strings.ToLower(cleaned), "data:image/")
+	}
+	return allowedSchemes[scheme]
+}
+
+// blockElements start a new line when html is converted to text
+var blockElements = map[string]bool{
+	"p": true, "div": true, "br": true, "tr": true, "li": true, "table": true, "blockquote": true, "pre": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "hr": true, "ul": true, "ol": true,
+}
+
+var whitespace = regexp.MustCompile(`\s+`)
+
+var excessNewlines = regexp.MustCompile(`\n{3,}`)
+
+// HTMLToText gives a readable plain text version of html, for messages that only came with an html body
+func HTMLToText(input string) string {
+	ret := &strings.Builder{}
+	tokenizer := html.NewTokenizer(strings.NewReader(input))
+	hidden := 0
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+		token := tokenizer.Token()
+		switch tokenType {
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			switch {
+			case token.Data == "script" || token.Data == "style" || token.Data == "head":
+				if tokenType == html.StartTagToken {
+					hidden++
+				} else if tokenType == html.EndTagToken && hidden > 0 {
+					hidden--
+				}
+			case blockElements[token.Data]:
+				ret.WriteString("\n")
+			}
+		case html.TextToken:
+			if hidden == 0 {
+				ret.WriteString(whitespace.ReplaceAllString(token.Data, " "))
+			}
+		}
+	}
+	lines := strings.Split(ret.String(), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSpace(l)
+	}
+	return strings.TrimSpace(excessNewlines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
@@ -0,0 +1,105 @@
+package mail
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{
+			"plain markup is untouched",
+			`<p class="intro">Hello <a href="https://example.com/?a=1&amp;b=2">there</a></p>`,
+			`<p class="intro">Hello <a href="https://example.com/?a=1&amp;b=2">there</a></p>`,
+		},
+		{
+			"document wrapper is removed",
+			`<!DOCTYPE html><html><head><title>Title</title><meta charset="utf-8"></head><body><p>Hi</p></body></html>`,
+			`<p>Hi</p>`,
+		},
+		{
+			"scripts are removed with their content",
+			`<p>a</p><script>alert("x")</script><p>b</p>`,
+			`<p>a</p><p>b</p>`,
+		},
+		{
+			"nested dropped elements",
+			`<object><object><p>x</p></object><p>y</p></object><p>z</p>`,
+			`<p>z</p>`,
+		},
+		{
+			"event handlers are removed",
+			`<img src="cid:logo" onerror="alert(1)" OnLoad="alert(2)">`,
+			`<img src="cid:logo">`,
+		},
+		{
+			"javascript links are removed",
+			`<a href="java&#x09;script:alert(1)">x</a><a href=" JavaScript:alert(1)">y</a>`,
+			`<a>x</a><a>y</a>`,
+		},
+		{
+			"data images are allowed as sources",
+			`<img src="data:image/png;base64,AAAA">`,
+			`<img src="data:image/png;base64,AAAA">`,
+		},
+		{
+			"other data urls are not",
+			`<a href="data:text/html;base64,AAAA">x</a><img src="data:text/html;base64,AAAA">`,
+			`<a>x</a><img>`,
+		},
+		{
+			"relative and mailto links are kept",
+			`<a href="#top">top</a><a href="mailto:bob@example.com">bob</a>`,
+			`<a href="#top">top</a><a href="mailto:bob@example.com">bob</a>`,
+		},
+		{
+			"styles are kept unescaped",
+			`<style>p > b { color: red; }</style><p style="color: blue">x</p>`,
+			`<style>p > b { color: red; }</style><p style="color: blue">x</p>`,
+		},
+		{
+			"dangerous styles are removed",
+			`<style>p { width: expression(alert(1)); }</style><p style="background: url(javascript:alert(1))">x</p>`,
+			`<style></style><p>x</p>`,
+		},
+		{
+			"forms are unwrapped",
+			`<form action="https://evil.example.com"><input name="password"><p>x</p><button>Go</button></form>`,
+			`<p>x</p>`,
+		},
+		{
+			"comments are removed",
+			`<!--[if mso]><script>alert(1)</script><![endif]--><p>x</p>`,
+			`<p>x</p>`,
+		},
+		{
+			"svg animation is removed",
+			`<svg><a><animate attributeName="href" values="javascript:alert(1)"/><text>x</text></a></svg>`,
+			`<svg><a><text>x</text></a></svg>`,
+		},
+		{
+			"text is escaped",
+			`<p>1 &lt; 2</p>`,
+			`<p>1 &lt; 2</p>`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.expected, SanitizeHTML(tc.input))
+		})
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	input := `<html><head><style>p { color: red; }</style><title>Title</title></head><body>
+<h1>Hello</h1>
+<p>This   is <b>some</b>
+text.</p><p>Second<br>line</p><script>alert(1)</script></body></html>`
+
+	assert.Equal(t, "Hello\n\nThis is some text.\n\nSecond\nline", HTMLToText(input))
+}
@@ -0,0 +1,271 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	fieldEmail      = "Email"
+	fieldReason     = "Reason"
+	fieldDetail     = "Detail"
+	fieldFeedbackID = "FeedbackID"
+	fieldSuppressed = "Suppressed"
+)
+
+type SuppressionReason string
+
+const (
+	SuppressionBounce    = SuppressionReason("bounce")
+	SuppressionComplaint = SuppressionReason("complaint")
+)
+
+// Suppression is an address mail is no longer sent to, because mail to it bounced for good or its owner complained
+type Suppression struct {
+	Email  string            `json:"email"`
+	Reason SuppressionReason `json:"reason"`
+	// Detail is what SES gave as the cause, the bounce type and diagnostic or the complaint feedback type
+	Detail     string    `json:"detail,omitempty"`
+	FeedbackID string    `json:"feedbackId,omitempty"`
+	Suppressed time.Time `json:"suppressed"`
+}
+
+// ErrSuppressed is the cause of errors sending messages when every recipient is on the suppression list
+var ErrSuppressed = errors.New("all recipients are suppressed")
+
+// SuppressionChecker gives true if mail to address should not be sent
+type SuppressionChecker func(ctx context.Context, address string) (bool, error)
+
+func NewSuppressionChecker(db *dynamodb.DynamoDB, suppressionTable string) SuppressionChecker {
+	return func(ctx context.Context, address string) (bool, error) {
+		res, err := db.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+			TableName: aws.String(suppressionTable),
+			Key: map[string]*dynamodb.AttributeValue{
+				fieldEmail: {S: aws.String(suppressionKey(address))},
+			},
+			ProjectionExpression: aws.String(fieldEmail),
+		})
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+		return res.Item != nil, nil
+	}
+}
+
+// Suppressor adds an address to the suppression list, replacing any earlier entry for it
+type Suppressor func(ctx context.Context, suppression Suppression) error
+
+func NewSuppressor(db *dynamodb.DynamoDB, suppressionTable string) Suppressor {
+	return func(ctx context.Context, suppression Suppression) error {
+		item := map[string]*dynamodb.AttributeValue{
+			fieldEmail:      {S: aws.String(suppressionKey(suppression.Email))},
+			fieldReason:     {S: aws.String(string(suppression.Reason))},
+			fieldSuppressed: {N: aws.String(strconv.FormatInt(suppression.Suppressed.UnixNano(), 10))},
+		}
+		if suppression.Detail != "" {
+			item[fieldDetail] = &dynamodb.AttributeValue{S: aws.String(suppression.Detail)}
+		}
+		if suppression.FeedbackID != "" {
+			item[fieldFeedbackID] = &dynamodb.AttributeValue{S: aws.String(suppression.FeedbackID)}
+		}
+		_, err := db.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(suppressionTable),
+			Item:      item,
+		})
+		return errors.WithStack(err)
+	}
+}
+
+// SuppressionLister gives every suppressed address, most recently suppressed first
+type SuppressionLister func(ctx context.Context) ([]Suppression, error)
+
+func NewSuppressionLister(db *dynamodb.DynamoDB, suppressionTable string) SuppressionLister {
+	return func(ctx context.Context) ([]Suppression, error) {
+		ret := make([]Suppression, 0)
+		var pageErr error
+		err := db.ScanPagesWithContext(ctx, &dynamodb.ScanInput{
+			TableName: aws.String(suppressionTable),
+		}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+			for _, item := range page.Items {
+				s, err := toSuppression(item)
+				if err != nil {
+					pageErr = err
+					return false
+				}
+				ret = append(ret, s)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if pageErr != nil {
+			return nil, pageErr
+		}
+		sortSuppressions(ret)
+		return ret, nil
+	}
+}
+
+// SuppressionRemover takes an address off the suppression list, giving false if it wasn't on it
+type SuppressionRemover func(ctx context.Context, address string) (bool, error)
+
+func NewSuppressionRemover(db *dynamodb.DynamoDB, suppressionTable string) SuppressionRemover {
+	return func(ctx context.Context, address string) (bool, error) {
+		_, err := db.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(suppressionTable),
+			Key: map[string]*dynamodb.AttributeValue{
+				fieldEmail: {S: aws.String(suppressionKey(address))},
+			},
+			ConditionExpression: aws.String("attribute_exists(#email)"),
+			ExpressionAttributeNames: map[string]*string{
+				"#email": aws.String(fieldEmail),
+			},
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return false, nil
+		}
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+		return true, nil
+	}
+}
+
+// NewSuppressingMessageSender creates a MessageSender that drops suppressed recipients before handing the message on
+// to sendMessage. If every recipient is suppressed nothing is sent, and the error given has ErrSuppressed as its cause.
+func NewSuppressingMessageSender(isSuppressed SuppressionChecker, sendMessage MessageSender) MessageSender {
+	return func(ctx context.Context, message Message) error {
+		to := make([]string, 0, len(message.To))
+		suppressed := make([]string, 0)
+		for _, address := range message.To {
+			s, err := isSuppressed(ctx, address)
+			if err != nil {
+				return err
+			}
+			if s {
+				suppressed = append(suppressed, address)
+			} else {
+				to = append(to, address)
+			}
+		}
+		if len(suppressed) > 0 {
+			zerolog.Ctx(ctx).Warn().Strs("suppressed", suppressed).Msg("not sending to suppressed addresses")
+		}
+		if len(to) == 0 {
+			return errors.Wrapf(ErrSuppressed, "not sending to %s", strings.Join(suppressed, ", "))
+		}
+		message.To = to
+		return sendMessage(ctx, message)
+	}
+}
+
+type sesFeedback struct {
+	NotificationType string `json:"notificationType"`
+	Bounce           *struct {
+		BounceType        string `json:"bounceType"`
+		BounceSubType     string `json:"bounceSubType"`
+		BouncedRecipients []struct {
+			EmailAddress   string `json:"emailAddress"`
+			DiagnosticCode string `json:"diagnosticCode"`
+		} `json:"bouncedRecipients"`
+		Timestamp  time.Time `json:"timestamp"`
+		FeedbackID string    `json:"feedbackId"`
+	} `json:"bounce"`
+	Complaint *struct {
+		ComplainedRecipients []struct {
+			EmailAddress string `json:"emailAddress"`
+		} `json:"complainedRecipients"`
+		ComplaintFeedbackType string    `json:"complaintFeedbackType"`
+		Timestamp             time.Time `json:"timestamp"`
+		FeedbackID            string    `json:"feedbackId"`
+	} `json:"complaint"`
+}
+
+// FeedbackSuppressions gives the addresses to suppress because of an SES bounce or complaint notification. Only
+// permanent bounces suppress anything, transient ones (a full mailbox say) may well go through later. Other
+// notifications (deliveries) give nothing.
+func FeedbackSuppressions(notification string) ([]Suppression, error) {
+	feedback := sesFeedback{}
+	err := json.Unmarshal([]byte(notification), &feedback)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	ret := make([]Suppression, 0)
+	switch {
+	case feedback.NotificationType == "Bounce" && feedback.Bounce != nil:
+		if feedback.Bounce.BounceType != "Permanent" {
+			return ret, nil
+		}
+		for _, r := range feedback.Bounce.BouncedRecipients {
+			detail := fmt.Sprintf("%s/%s", feedback.Bounce.BounceType, feedback.Bounce.BounceSubType)
+			if r.DiagnosticCode != "" {
+				detail = fmt.Sprintf("%s: %s", detail, r.DiagnosticCode)
+			}
+			ret = append(ret, Suppression{
+				Email:      suppressionKey(r.EmailAddress),
+				Reason:     SuppressionBounce,
+				Detail:     detail,
+				FeedbackID: feedback.Bounce.FeedbackID,
+				Suppressed: feedback.Bounce.Timestamp,
+			})
+		}
+	case feedback.NotificationType == "Complaint" && feedback.Complaint != nil:
+		for _, r := range feedback.Complaint.ComplainedRecipients {
+			ret = append(ret, Suppression{
+				Email:      suppressionKey(r.EmailAddress),
+				Reason:     SuppressionComplaint,
+				Detail:     feedback.Complaint.ComplaintFeedbackType,
+				FeedbackID: feedback.Complaint.FeedbackID,
+				Suppressed: feedback.Complaint.Timestamp,
+			})
+		}
+	}
+	return ret, nil
+}
+
+// suppressionKey is what addresses are stored under, SES doesn't preserve the case addresses were sent to with
+func suppressionKey(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
+
+func sortSuppressions(suppressions []Suppression) {
+	sort.SliceStable(suppressions, func(i, j int) bool {
+		return suppressions[i].Suppressed.After(suppressions[j].Suppressed)
+	})
+}
+
+func toSuppression(item map[string]*dynamodb.AttributeValue) (Suppression, error) {
+	ret := Suppression{
+		Email: aws.StringValue(item[fieldEmail].S),
+	}
+	if item[fieldReason] != nil {
+		ret.Reason = SuppressionReason(aws.StringValue(item[fieldReason].S))
+	}
+	if item[fieldDetail] != nil {
+		ret.Detail = aws.StringValue(item[fieldDetail].S)
+	}
+	if item[fieldFeedbackID] != nil {
+		ret.FeedbackID = aws.StringValue(item[fieldFeedbackID].S)
+	}
+	if item[fieldSuppressed] != nil {
+		nanos, err := strconv.ParseInt(aws.StringValue(item[fieldSuppressed].N), 10, 64)
+		if err != nil {
+			return Suppression{}, errors.Errorf("invalid suppressed time %s for %s", aws.StringValue(item[fieldSuppressed].N), ret.Email)
+		}
+		ret.Suppressed = time.Unix(0, nanos).UTC()
+	}
+	return ret, nil
+}
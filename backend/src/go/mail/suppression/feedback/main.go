@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+
+	"github.com/jonsabados/sabadoscodes.com/audit"
+	"github.com/jonsabados/sabadoscodes.com/auth"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/mail"
+)
+
+// sesPrincipal is who suppressions are recorded against in the audit log
+var sesPrincipal = auth.Principal{
+	UserID: "ses",
+	Name:   "Mail Feedback",
+}
+
+// newHandler creates the handler for the bounce and complaint notifications SES publishes to SNS
+func newHandler(prepLogs logging.Preparer,
+	suppress mail.Suppressor,
+	recordAudit audit.Recorder) func(ctx context.Context, event events.SNSEvent) error {
+
+	return func(ctx context.Context, event events.SNSEvent) error {
+		ctx, logger := prepLogs(ctx)
+
+		for _, r := range event.Records {
+			suppressions, err := mail.FeedbackSuppressions(r.SNS.Message)
+			if err != nil {
+				logger.Error().Stack().Err(err).Str("messageId", r.SNS.MessageID).Msg("error reading feedback notification")
+				return err
+			}
+			if len(suppressions) == 0 {
+				logger.Info().Str("messageId", r.SNS.MessageID).Msg("feedback notification doesn't call for suppression")
+				continue
+			}
+			for _, s := range suppressions {
+				logger.Warn().Str("reason", string(s.Reason)).Str("detail", s.Detail).Msg("suppressing address")
+				err = suppress(ctx, s)
+				if err != nil {
+					logger.Error().Stack().Err(err).Msg("error suppressing address")
+					return err
+				}
+				err = recordAudit(ctx, audit.NewEntry(ctx, sesPrincipal, audit.ActionMailSuppress, s.Email))
+				if err != nil {
+					logger.Error().Stack().Err(err).Msg("error recording audit entry")
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	dynamoClient := dynamo.RawClient(sess)
+
+	handler := newHandler(logging.NewPreparer(),
+		mail.NewSuppressor(dynamoClient, os.Getenv("SUPPRESSION_TABLE")),
+		audit.NewRecorder(dynamoClient, os.Getenv("AUDIT_TABLE")))
+
+	lambda.Start(handler)
+}
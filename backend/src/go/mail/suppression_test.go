@@ -0,0 +1,188 @@
+package mail
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeedbackSuppressions(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		notification string
+		expected     []Suppression
+	}{
+		{
+			desc: "permanent bounce",
+			notification: `{
+				"notificationType": "Bounce",
+				"bounce": {
+					"bounceType": "Permanent",
+					"bounceSubType": "General",
+					"bouncedRecipients": [
+						{"emailAddress": "Bob@Example.com", "diagnosticCode": "smtp; 550 5.1.1 user unknown"},
+						{"emailAddress": "alice@example.com"}
+					],
+					"timestamp": "2021-03-08T05:30:00.000Z",
+					"feedbackId": "bounce-feedback"
+				},
+				"mail": {"messageId": "some-message"}
+			}`,
+			expected: []Suppression{
+				{
+					Email:      "bob@example.com",
+					Reason:     SuppressionBounce,
+					Detail:     "Permanent/General: smtp; 550 5.1.1 user unknown",
+					FeedbackID: "bounce-feedback",
+					Suppressed: time.Date(2021, 3, 8, 5, 30, 0, 0, time.UTC),
+				},
+				{
+					Email:      "alice@example.com",
+					Reason:     SuppressionBounce,
+					Detail:     "Permanent/General",
+					FeedbackID: "bounce-feedback",
+					Suppressed: time.Date(2021, 3, 8, 5, 30, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			desc: "transient bounce",
+			notification: `{
+				"notificationType": "Bounce",
+				"bounce": {
+					"bounceType": "Transient",
+					"bounceSubType": "MailboxFull",
+					"bouncedRecipients": [{"emailAddress": "bob@example.com"}],
+					"timestamp": "2021-03-08T05:30:00.000Z",
+					"feedbackId": "bounce-feedback"
+				}
+			}`,
+			expected: []Suppression{},
+		},
+		{
+			desc: "complaint",
+			notification: `{
+				"notificationType": "Complaint",
+				"complaint": {
+					"complainedRecipients": [{"emailAddress": "bob@example.com"}],
+					"complaintFeedbackType": "abuse",
+					"timestamp": "2021-03-08T05:30:00.000Z",
+					"feedbackId": "complaint-feedback"
+				}
+			}`,
+			expected: []Suppression{
+				{
+					Email:      "bob@example.com",
+					Reason:     SuppressionComplaint,
+					Detail:     "abuse",
+					FeedbackID: "complaint-feedback",
+					Suppressed: time.Date(2021, 3, 8, 5, 30, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			desc:         "delivery",
+			notification: `{"notificationType": "Delivery", "delivery": {"recipients": ["bob@example.com"]}}`,
+			expected:     []Suppression{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			res, err := FeedbackSuppressions(tc.notification)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, res)
+		})
+	}
+}
+
+func TestFeedbackSuppressions_Invalid(t *testing.T) {
+	_, err := FeedbackSuppressions("not json")
+	assert.Error(t, err)
+}
+
+func TestNewSuppressingMessageSender(t *testing.T) {
+	isSuppressed := func(ctx context.Context, address string) (bool, error) {
+		return address == "bounced@example.com", nil
+	}
+
+	t.Run("some suppressed", func(t *testing.T) {
+		var sent *Message
+		send := NewSuppressingMessageSender(isSuppressed, func(ctx context.Context, message Message) error {
+			sent = &message
+			return nil
+		})
+		err := send(context.Background(), Message{
+			From:    "sender@example.com",
+			To:      []string{"bob@example.com", "bounced@example.com"},
+			Subject: "hello",
+		})
+		assert.NoError(t, err)
+		if assert.NotNil(t, sent) {
+			assert.Equal(t, []string{"bob@example.com"}, sent.To)
+			assert.Equal(t, "hello", sent.Subject)
+		}
+	})
+
+	t.Run("all suppressed", func(t *testing.T) {
+		send := NewSuppressingMessageSender(isSuppressed, func(ctx context.Context, message Message) error {
+			assert.Fail(t, "nothing should be sent")
+			return nil
+		})
+		err := send(context.Background(), Message{
+			From: "sender@example.com",
+			To:   []string{"bounced@example.com"},
+		})
+		assert.Equal(t, ErrSuppressed, errors.Cause(err))
+	})
+
+	t.Run("check fails", func(t *testing.T) {
+		expectedErr := errors.New("boom")
+		send := NewSuppressingMessageSender(func(ctx context.Context, address string) (bool, error) {
+			return false, expectedErr
+		}, func(ctx context.Context, message Message) error {
+			assert.Fail(t, "nothing should be sent")
+			return nil
+		})
+		err := send(context.Background(), Message{To: []string{"bob@example.com"}})
+		assert.Equal(t, expectedErr, err)
+	})
+}
+
+func Test_toSuppression(t *testing.T) {
+	asserter := assert.New(t)
+
+	res, err := toSuppression(map[string]*dynamodb.AttributeValue{
+		fieldEmail:      {S: aws.String("bob@example.com")},
+		fieldReason:     {S: aws.String("complaint")},
+		fieldDetail:     {S: aws.String("abuse")},
+		fieldFeedbackID: {S: aws.String("complaint-feedback")},
+		fieldSuppressed: {N: aws.String("1615181400000000000")},
+	})
+	asserter.NoError(err)
+	asserter.Equal(Suppression{
+		Email:      "bob@example.com",
+		Reason:     SuppressionComplaint,
+		Detail:     "abuse",
+		FeedbackID: "complaint-feedback",
+		Suppressed: time.Date(2021, 3, 8, 5, 30, 0, 0, time.UTC),
+	}, res)
+
+	_, err = toSuppression(map[string]*dynamodb.AttributeValue{
+		fieldEmail:      {S: aws.String("bob@example.com")},
+		fieldSuppressed: {N: aws.String("yesterday")},
+	})
+	asserter.EqualError(err, "invalid suppressed time yesterday for bob@example.com")
+}
+
+func Test_sortSuppressions(t *testing.T) {
+	older := Suppression{Email: "older@example.com", Suppressed: time.Date(2021, 3, 7, 0, 0, 0, 0, time.UTC)}
+	newer := Suppression{Email: "newer@example.com", Suppressed: time.Date(2021, 3, 8, 0, 0, 0, 0, time.UTC)}
+	suppressions := []Suppression{older, newer}
+	sortSuppressions(suppressions)
+	assert.Equal(t, []Suppression{newer, older}, suppressions)
+}
@@ -0,0 +1,293 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"reflect"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+// DefaultLocale is the locale of templates without one in their name, and what every locale falls back to
+const DefaultLocale = "en"
+
+// layoutTemplate is the name of the layout every template is rendered within
+const layoutTemplate = "layout"
+
+// templateFuncs are available to every template
+var templateFuncs = map[string]interface{}{
+	"join":  joinValues,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// ErrTemplateNotFound is given by template sources that don't have the file asked for
+var ErrTemplateNotFound = errors.New("template not found")
+
+// TemplateSource gives the contents of a template file, such as welcome.html.tmpl
+type TemplateSource func(ctx context.Context, fileName string) ([]byte, error)
+
+// NewEmbeddedTemplateSource creates a TemplateSource for the templates kept alongside the code, in mail/templates
+func NewEmbeddedTemplateSource() TemplateSource {
+	return func(ctx context.Context, fileName string) ([]byte, error) {
+		ret, err := fs.ReadFile(embeddedTemplates, "templates/"+fileName)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrTemplateNotFound
+		}
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return ret, nil
+	}
+}
+
+// NewS3TemplateSource creates a TemplateSource for templates kept under prefix in the given bucket
+func NewS3TemplateSource(bucket, prefix string, describeObject s3.ObjectDescriber, fetchObject s3.ObjectFetcher) TemplateSource {
+	return func(ctx context.Context, fileName string) ([]byte, error) {
+		key := prefix + fileName
+		info, err := describeObject(ctx, bucket, key)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if info == nil {
+			return nil, ErrTemplateNotFound
+		}
+		content, err := fetchObject(ctx, bucket, key)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		defer content.Close()
+		ret, err := io.ReadAll(content)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return ret, nil
+	}
+}
+
+// NewLayeredTemplateSource creates a TemplateSource that gives the file from the first of sources to have it, so
+// templates in S3 can override the ones kept alongside the code
+func NewLayeredTemplateSource(sources ...TemplateSource) TemplateSource {
+	return func(ctx context.Context, fileName string) ([]byte, error) {
+		for _, source := range sources {
+			ret, err := source(ctx, fileName)
+			if err == ErrTemplateNotFound {
+				continue
+			}
+			return ret, err
+		}
+		return nil, ErrTemplateNotFound
+	}
+}
+
+// NewTemplateSource creates the TemplateSource lambdas use, giving templates in the bucket precedence over the ones kept
+// alongside the code. Without a bucket it's just the embedded templates.
+func NewTemplateSource(templateBucket string, describeObject s3.ObjectDescriber, fetchObject s3.ObjectFetcher) TemplateSource {
+	if templateBucket == "" {
+		return NewEmbeddedTemplateSource()
+	}
+	return NewLayeredTemplateSource(NewS3TemplateSource(templateBucket, "", describeObject, fetchObject), NewEmbeddedTemplateSource())
+}
+
+// DefaultTemplateReloadInterval is how long NewCachingTemplateSource holds onto a file before fetching it again
+const DefaultTemplateReloadInterval = time.Minute
+
+type cachedTemplate struct {
+	content []byte
+	err     error
+	loaded  time.Time
+}
+
+// NewCachingTemplateSource creates a TemplateSource holding onto what source gives for each file for reloadInterval,
+// for rendering the same templates over and over without going back to S3 every time. Files that aren't found are
+// remembered as well, other errors aren't.
+func NewCachingTemplateSource(source TemplateSource, reloadInterval time.Duration) TemplateSource {
+	var mutex sync.Mutex
+	cache := make(map[string]cachedTemplate)
+
+	return func(ctx context.Context, fileName string) ([]byte, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if cached, ok := cache[fileName]; ok && time.Since(cached.loaded) < reloadInterval {
+			return cached.content, cached.err
+		}
+		content, err := source(ctx, fileName)
+		if err != nil && err != ErrTemplateNotFound {
+			return nil, err
+		}
+		cache[fileName] = cachedTemplate{content: content, err: err, loaded: time.Now()}
+		return content, err
+	}
+}
+
+// RenderedEmail is a template rendered with its data, ready to send
+type RenderedEmail struct {
+	Subject  string `json:"subject"`
+	HTMLBody string `json:"html"`
+	TextBody string `json:"text"`
+}
+
+// TemplateRenderer renders the named template with data. Templates are made up of:
+//
+//	<name>.txt.tmpl  - required, defining "subject" and "content" for the text body
+//	<name>.html.tmpl - optional, defining "content" for the html body
+//
+// each of which is rendered within the matching layout.txt.tmpl or layout.html.tmpl. Any of the files may have
+// versions for other locales, as in <name>.fr.txt.tmpl, with pt-BR falling back to pt then the default locale. CSS in
+// the html is inlined.
+type TemplateRenderer func(ctx context.Context, name, locale string, data interface{}) (RenderedEmail, error)
+
+func NewTemplateRenderer(source TemplateSource) TemplateRenderer {
+	return func(ctx context.Context, name, locale string, data interface{}) (RenderedEmail, error) {
+		locales := localeCandidates(locale)
+
+		textLayout, err := findTemplate(ctx, source, layoutTemplate, "txt", locales)
+		if err != nil {
+			return RenderedEmail{}, err
+		}
+		textContent, err := findTemplate(ctx, source, name, "txt", locales)
+		if err != nil {
+			return RenderedEmail{}, err
+		}
+		textTemplate, err := texttemplate.New(layoutTemplate).Funcs(templateFuncs).Parse(string(textLayout))
+		if err != nil {
+			return RenderedEmail{}, errors.Wrapf(err, "parsing text layout")
+		}
+		_, err = textTemplate.New(name).Parse(string(textContent))
+		if err != nil {
+			return RenderedEmail{}, errors.Wrapf(err, "parsing %s text", name)
+		}
+
+		subject := &bytes.Buffer{}
+		err = textTemplate.ExecuteTemplate(subject, "subject", data)
+		if err != nil {
+			return RenderedEmail{}, errors.Wrapf(err, "rendering %s subject", name)
+		}
+		text := &bytes.Buffer{}
+		err = textTemplate.ExecuteTemplate(text, layoutTemplate, data)
+		if err != nil {
+			return RenderedEmail{}, errors.Wrapf(err, "rendering %s text", name)
+		}
+		ret := RenderedEmail{
+			// subjects are one line no matter how the template was laid out
+			Subject:  strings.Join(strings.Fields(subject.String()), " "),
+			TextBody: strings.TrimSpace(text.String()) + "\n",
+		}
+
+		htmlContent, err := findTemplate(ctx, source, name, "html", locales)
+		if err == ErrTemplateNotFound {
+			return ret, nil
+		}
+		if err != nil {
+			return RenderedEmail{}, err
+		}
+		htmlLayout, err := findTemplate(ctx, source, layoutTemplate, "html", locales)
+		if err != nil {
+			return RenderedEmail{}, err
+		}
+		htmlTemplate, err := htmltemplate.New(layoutTemplate).Funcs(templateFuncs).Parse(string(htmlLayout))
+		if err != nil {
+			return RenderedEmail{}, errors.Wrapf(err, "parsing html layout")
+		}
+		_, err = htmlTemplate.New(name).Parse(string(htmlContent))
+		if err != nil {
+			return RenderedEmail{}, errors.Wrapf(err, "parsing %s html", name)
+		}
+		htmlBody := &bytes.Buffer{}
+		err = htmlTemplate.ExecuteTemplate(htmlBody, layoutTemplate, data)
+		if err != nil {
+			return RenderedEmail{}, errors.Wrapf(err, "rendering %s html", name)
+		}
+		ret.HTMLBody, err = InlineCSS(htmlBody.String())
+		if err != nil {
+			return RenderedEmail{}, errors.Wrapf(err, "inlining %s css", name)
+		}
+		return ret, nil
+	}
+}
+
+// TemplateSampleData gives the sample data for the named template, kept in <name>.sample.json, for previewing it
+type TemplateSampleData func(ctx context.Context, name string) ([]byte, error)
+
+func NewTemplateSampleData(source TemplateSource) TemplateSampleData {
+	return func(ctx context.Context, name string) ([]byte, error) {
+		return source(ctx, name+".sample.json")
+	}
+}
+
+// TemplatedSender renders the named template with data and sends it
+type TemplatedSender func(ctx context.Context, from, to, templateName, locale string, data interface{}, attachments ...Attachment) error
+
+func NewTemplatedSender(render TemplateRenderer, sendEmail Sender) TemplatedSender {
+	return func(ctx context.Context, from, to, templateName, locale string, data interface{}, attachments ...Attachment) error {
+		rendered, err := render(ctx, templateName, locale, data)
+		if err != nil {
+			return err
+		}
+		return sendEmail(ctx, from, to, rendered.Subject, rendered.HTMLBody, rendered.TextBody, attachments...)
+	}
+}
+
+func findTemplate(ctx context.Context, source TemplateSource, name, kind string, locales []string) ([]byte, error) {
+	for _, l := range locales {
+		fileName := name + "." + kind + ".tmpl"
+		if l != DefaultLocale {
+			fileName = name + "." + l + "." + kind + ".tmpl"
+		}
+		ret, err := source(ctx, fileName)
+		if err == ErrTemplateNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return ret, nil
+	}
+	return nil, ErrTemplateNotFound
+}
+
+// localeCandidates gives the locales to try for a template, most specific first
+func localeCandidates(locale string) []string {
+	ret := make([]string, 0)
+	locale = strings.ReplaceAll(strings.TrimSpace(locale), "_", "-")
+	for locale != "" {
+		ret = append(ret, locale)
+		cut := strings.LastIndex(locale, "-")
+		if cut < 0 {
+			break
+		}
+		locale = locale[:cut]
+	}
+	if len(ret) == 0 || ret[len(ret)-1] != DefaultLocale {
+		ret = append(ret, DefaultLocale)
+	}
+	return ret
+}
+
+// joinValues is strings.Join for any slice, so templates work the same with sample data read from json
+func joinValues(values interface{}, sep string) string {
+	v := reflect.ValueOf(values)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Sprint(values)
+	}
+	parts := make([]string, v.Len())
+	for i := range parts {
+		parts[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(parts, sep)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/auth"
+	"github.com/jonsabados/sabadoscodes.com/cors"
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/mail"
+	"github.com/jonsabados/sabadoscodes.com/response"
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+var validTemplateName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+var validLocale = regexp.MustCompile(`^[A-Za-z]{2,3}([-_][A-Za-z0-9]{2,8})*$`)
+
+func newHandler(prepLogs logging.Preparer,
+	corsHeaders cors.ResponseHeaderBuilder,
+	extractPrincipal auth.PrincipalExtractor,
+	authorize auth.RouteAuthorizer,
+	sampleData mail.TemplateSampleData,
+	render mail.TemplateRenderer) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		ctx, _ = prepLogs(ctx)
+		responseHeaders := corsHeaders(request.Headers)
+
+		principal, err := extractPrincipal(request)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		if !authorize(principal, request) {
+			zerolog.Ctx(ctx).Warn().Interface("user", principal).Msg("user not authorized for route")
+			return response.HandleForbidden(ctx, responseHeaders, "not permitted"), nil
+		}
+
+		errors := httputil.ErrorTracker{}
+		name, err := url.PathUnescape(request.PathParameters["name"])
+		if err != nil || !validTemplateName.MatchString(name) {
+			errors = errors.WithFieldError("name", "invalid template name")
+		}
+		locale, hasLocale := request.QueryStringParameters["locale"]
+		if !hasLocale {
+			locale = mail.DefaultLocale
+		} else if !validLocale.MatchString(locale) {
+			errors = errors.WithFieldError("locale", "invalid locale")
+		}
+		if errors.InError() {
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		raw, err := sampleData(ctx, name)
+		if err == mail.ErrTemplateNotFound {
+			return response.HandleNtFound(ctx, responseHeaders), nil
+		}
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		var data interface{}
+		err = json.Unmarshal(raw, &data)
+		if err != nil {
+			errors = errors.WithError("sample data for template is not valid json")
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		rendered, err := render(ctx, name, locale, data)
+		if err == mail.ErrTemplateNotFound {
+			return response.HandleNtFound(ctx, responseHeaders), nil
+		}
+		if err != nil {
+			// mistakes in the template are what editors are here to find, so they get to see them
+			zerolog.Ctx(ctx).Warn().Err(err).Str("template", name).Msg("error rendering template")
+			errors = errors.WithError(err.Error())
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		responseBody, err := json.Marshal(rendered)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		responseHeaders["content-type"] = "application/json"
+
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusOK,
+			Headers:    responseHeaders,
+			Body:       string(responseBody),
+		}, nil
+	}
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	allowedDomains := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
+
+	routes, err := auth.ParseRouteTable([]byte(os.Getenv("ROUTE_TABLE")))
+	if err != nil {
+		panic(err)
+	}
+
+	s3Client := s3.RawClient(sess)
+	templateSource := mail.NewTemplateSource(os.Getenv("TEMPLATE_BUCKET"), s3.NewObjectDescriber(s3Client), s3.NewObjectFetcher(s3Client))
+
+	handler := newHandler(logging.NewPreparer(),
+		cors.NewResponseHeaderBuilder(allowedDomains),
+		auth.NewPrincipalExtractor(),
+		auth.NewRouteAuthorizer(routes),
+		mail.NewTemplateSampleData(templateSource),
+		mail.NewTemplateRenderer(templateSource))
+
+	lambda.Start(handler)
+}
@@ -0,0 +1,274 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jonsabados/sabadoscodes.com/s3"
+)
+
+func mapTemplateSource(files map[string]string) TemplateSource {
+	return func(ctx context.Context, fileName string) ([]byte, error) {
+		content, ok := files[fileName]
+		if !ok {
+			return nil, ErrTemplateNotFound
+		}
+		return []byte(content), nil
+	}
+}
+
+func testTemplates() map[string]string {
+	return map[string]string{
+		"layout.txt.tmpl":     `{{template "content" .}}` + "\n-- footer",
+		"layout.html.tmpl":    `<html><head><style>p { color: red }</style></head><body>{{template "content" .}}</body></html>`,
+		"layout.fr.txt.tmpl":  `{{template "content" .}}` + "\n-- pied de page",
+		"welcome.txt.tmpl":    `{{define "subject"}}Welcome {{.Name}}{{end}}{{define "content"}}Hello {{.Name}}{{end}}`,
+		"welcome.html.tmpl":   `{{define "content"}}<p>Hello {{.Name}}</p>{{end}}`,
+		"welcome.fr.txt.tmpl": `{{define "subject"}}Bienvenue {{.Name}}{{end}}{{define "content"}}Bonjour {{.Name}}{{end}}`,
+		"plain.txt.tmpl": `{{define "subject"}}  Just
+  text {{end}}{{define "content"}}{{join .Items ", "}}{{end}}`,
+	}
+}
+
+func TestNewTemplateRenderer(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		name     string
+		locale   string
+		data     interface{}
+		expected RenderedEmail
+	}{
+		{
+			"default locale",
+			"welcome",
+			"en",
+			map[string]string{"Name": "<Bob>"},
+			RenderedEmail{
+				Subject:  "Welcome <Bob>",
+				HTMLBody: `<html><head></head><body><p style="color: red">Hello &lt;Bob&gt;</p></body></html>`,
+				TextBody: "Hello <Bob>\n-- footer\n",
+			},
+		},
+		{
+			"regional locale falls back to language",
+			"welcome",
+			"fr-CA",
+			map[string]string{"Name": "Bob"},
+			RenderedEmail{
+				Subject:  "Bienvenue Bob",
+				HTMLBody: `<html><head></head><body><p style="color: red">Hello Bob</p></body></html>`,
+				TextBody: "Bonjour Bob\n-- pied de page\n",
+			},
+		},
+		{
+			"unknown locale falls back to default",
+			"welcome",
+			"de",
+			map[string]string{"Name": "Bob"},
+			RenderedEmail{
+				Subject:  "Welcome Bob",
+				HTMLBody: `<html><head></head><body><p style="color: red">Hello Bob</p></body></html>`,
+				TextBody: "Hello Bob\n-- footer\n",
+			},
+		},
+		{
+			"text only",
+			"plain",
+			"",
+			map[string][]string{"Items": {"a", "b"}},
+			RenderedEmail{
+				Subject:  "Just text",
+				TextBody: "a, b\n-- footer\n",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			res, err := NewTemplateRenderer(mapTemplateSource(testTemplates()))(context.Background(), tc.name, tc.locale, tc.data)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, res)
+		})
+	}
+}
+
+func TestNewTemplateRenderer_Errors(t *testing.T) {
+	asserter := assert.New(t)
+
+	render := NewTemplateRenderer(mapTemplateSource(testTemplates()))
+	_, err := render(context.Background(), "nope", "en", nil)
+	asserter.Equal(ErrTemplateNotFound, err)
+
+	broken := testTemplates()
+	broken["welcome.txt.tmpl"] = `{{define "subject"}}{{.Name{{end}}`
+	_, err = NewTemplateRenderer(mapTemplateSource(broken))(context.Background(), "welcome", "en", nil)
+	asserter.Error(err)
+
+	sourceErr := errors.New("KaBOOM!")
+	failing := func(ctx context.Context, fileName string) ([]byte, error) {
+		return nil, sourceErr
+	}
+	_, err = NewTemplateRenderer(failing)(context.Background(), "welcome", "en", nil)
+	asserter.Equal(sourceErr, err)
+}
+
+func TestEmbeddedTemplates_RenderSamples(t *testing.T) {
+	source := NewEmbeddedTemplateSource()
+	render := NewTemplateRenderer(source)
+	sampleData := NewTemplateSampleData(source)
+
+	entries, err := embeddedTemplates.ReadDir("templates")
+	assert.NoError(t, err)
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".sample.json")
+		if name == e.Name() {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			raw, err := sampleData(context.Background(), name)
+			asserter.NoError(err)
+			var data interface{}
+			asserter.NoError(json.Unmarshal(raw, &data))
+
+			res, err := render(context.Background(), name, DefaultLocale, data)
+			asserter.NoError(err)
+			asserter.NotEmpty(res.Subject)
+			asserter.NotEmpty(res.TextBody)
+			asserter.NotContains(res.HTMLBody, "<no value>")
+			asserter.NotContains(res.TextBody, "<no value>")
+		})
+	}
+}
+
+func Test_NewEmbeddedTemplateSource_NotFound(t *testing.T) {
+	_, err := NewEmbeddedTemplateSource()(context.Background(), "nope.txt.tmpl")
+	assert.Equal(t, ErrTemplateNotFound, err)
+}
+
+func Test_NewS3TemplateSource(t *testing.T) {
+	asserter := assert.New(t)
+
+	describeObject := func(ctx context.Context, bucket, object string) (*s3.ObjectInfo, error) {
+		asserter.Equal("somebucket", bucket)
+		if object == "templates/welcome.txt.tmpl" {
+			return &s3.ObjectInfo{}, nil
+		}
+		return nil, nil
+	}
+	fetchObject := func(ctx context.Context, bucket, object string) (io.ReadCloser, error) {
+		asserter.Equal("somebucket", bucket)
+		asserter.Equal("templates/welcome.txt.tmpl", object)
+		return ioutil.NopCloser(strings.NewReader("hello")), nil
+	}
+
+	source := NewS3TemplateSource("somebucket", "templates/", describeObject, fetchObject)
+	res, err := source(context.Background(), "welcome.txt.tmpl")
+	asserter.NoError(err)
+	asserter.Equal("hello", string(res))
+
+	_, err = source(context.Background(), "other.txt.tmpl")
+	asserter.Equal(ErrTemplateNotFound, err)
+}
+
+func Test_NewLayeredTemplateSource(t *testing.T) {
+	asserter := assert.New(t)
+
+	overrides := mapTemplateSource(map[string]string{"welcome.txt.tmpl": "override"})
+	defaults := mapTemplateSource(map[string]string{"welcome.txt.tmpl": "default", "layout.txt.tmpl": "layout"})
+	source := NewLayeredTemplateSource(overrides, defaults)
+
+	res, err := source(context.Background(), "welcome.txt.tmpl")
+	asserter.NoError(err)
+	asserter.Equal("override", string(res))
+
+	res, err = source(context.Background(), "layout.txt.tmpl")
+	asserter.NoError(err)
+	asserter.Equal("layout", string(res))
+
+	_, err = source(context.Background(), "nope.txt.tmpl")
+	asserter.Equal(ErrTemplateNotFound, err)
+}
+
+func Test_NewCachingTemplateSource(t *testing.T) {
+	asserter := assert.New(t)
+
+	fetches := make(map[string]int)
+	failNext := true
+	source := func(ctx context.Context, fileName string) ([]byte, error) {
+		fetches[fileName]++
+		if fileName == "flaky.txt.tmpl" && failNext {
+			failNext = false
+			return nil, errors.New("KaBOOM!")
+		}
+		return mapTemplateSource(map[string]string{"welcome.txt.tmpl": "hello", "flaky.txt.tmpl": "flaky"})(ctx, fileName)
+	}
+	cached := NewCachingTemplateSource(source, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		res, err := cached(context.Background(), "welcome.txt.tmpl")
+		asserter.NoError(err)
+		asserter.Equal("hello", string(res))
+		_, err = cached(context.Background(), "nope.txt.tmpl")
+		asserter.Equal(ErrTemplateNotFound, err)
+	}
+	asserter.Equal(1, fetches["welcome.txt.tmpl"])
+	asserter.Equal(1, fetches["nope.txt.tmpl"])
+
+	// errors fetching aren't held onto
+	_, err := cached(context.Background(), "flaky.txt.tmpl")
+	asserter.EqualError(err, "KaBOOM!")
+	res, err := cached(context.Background(), "flaky.txt.tmpl")
+	asserter.NoError(err)
+	asserter.Equal("flaky", string(res))
+
+	expiring := NewCachingTemplateSource(source, 0)
+	_, _ = expiring(context.Background(), "welcome.txt.tmpl")
+	_, _ = expiring(context.Background(), "welcome.txt.tmpl")
+	asserter.Equal(3, fetches["welcome.txt.tmpl"])
+}
+
+func Test_NewTemplatedSender(t *testing.T) {
+	asserter := assert.New(t)
+
+	inputCtx := context.WithValue(context.Background(), "foo", "bar")
+	attachment := Attachment{Name: "a.txt", MimeType: "text/plain", Body: strings.NewReader("a")}
+	render := func(ctx context.Context, name, locale string, data interface{}) (RenderedEmail, error) {
+		asserter.Equal(inputCtx, ctx)
+		asserter.Equal("welcome", name)
+		asserter.Equal("fr", locale)
+		asserter.Equal("data", data)
+		return RenderedEmail{Subject: "subject", HTMLBody: "html", TextBody: "text"}, nil
+	}
+	sent := false
+	sendEmail := func(ctx context.Context, from, to, subject, htmlBody, textBody string, attachments ...Attachment) error {
+		sent = true
+		asserter.Equal(inputCtx, ctx)
+		asserter.Equal("from@example.com", from)
+		asserter.Equal("to@example.com", to)
+		asserter.Equal("subject", subject)
+		asserter.Equal("html", htmlBody)
+		asserter.Equal("text", textBody)
+		asserter.Equal([]Attachment{attachment}, attachments)
+		return nil
+	}
+
+	err := NewTemplatedSender(render, sendEmail)(inputCtx, "from@example.com", "to@example.com", "welcome", "fr", "data", attachment)
+	asserter.NoError(err)
+	asserter.True(sent)
+}
+
+func Test_localeCandidates(t *testing.T) {
+	assert.Equal(t, []string{"en"}, localeCandidates(""))
+	assert.Equal(t, []string{"en-US", "en"}, localeCandidates("en-US"))
+	assert.Equal(t, []string{"pt-BR", "pt", "en"}, localeCandidates("pt_BR"))
+	assert.Equal(t, []string{"zh-Hant-TW", "zh-Hant", "zh", "en"}, localeCandidates("zh-Hant-TW"))
+}
@@ -0,0 +1,45 @@
+package mail
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultSendRate is SES's sending rate, in messages per second, for accounts that haven't asked for more
+const DefaultSendRate = 14
+
+// Throttle blocks until the next message can be sent, giving an error if ctx ends first
+type Throttle func(ctx context.Context) error
+
+// NewThrottle creates a Throttle spacing sends out evenly to stay under perSecond messages a second
+func NewThrottle(perSecond float64) Throttle {
+	interval := time.Duration(float64(time.Second) / perSecond)
+	var mutex sync.Mutex
+	var next time.Time
+
+	return func(ctx context.Context) error {
+		mutex.Lock()
+		now := time.Now()
+		if next.Before(now) {
+			next = now
+		}
+		wait := next.Sub(now)
+		next = next.Add(interval)
+		mutex.Unlock()
+
+		if wait <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		case <-timer.C:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package mail
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewThrottle(t *testing.T) {
+	throttle := NewThrottle(100)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, throttle(context.Background()))
+	}
+	// the first goes right away, the rest 10ms apart
+	assert.True(t, time.Since(start) >= 40*time.Millisecond)
+}
+
+func TestNewThrottle_ContextEnds(t *testing.T) {
+	throttle := NewThrottle(0.1)
+	assert.NoError(t, throttle(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := throttle(ctx)
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+}
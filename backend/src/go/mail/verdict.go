@@ -0,0 +1,137 @@
+package mail
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pkg/errors"
+)
+
+// VerdictFail is the status SES gives a check the message failed
+const VerdictFail = "FAIL"
+
+// VerdictCheck is one of the checks SES runs on inbound mail
+type VerdictCheck string
+
+const (
+	VerdictCheckSpam  VerdictCheck = "spam"
+	VerdictCheckVirus VerdictCheck = "virus"
+	VerdictCheckSPF   VerdictCheck = "spf"
+	VerdictCheckDKIM  VerdictCheck = "dkim"
+	VerdictCheckDMARC VerdictCheck = "dmarc"
+)
+
+// verdictChecks is every check, in the order they are reported
+var verdictChecks = []VerdictCheck{VerdictCheckVirus, VerdictCheckSpam, VerdictCheckDMARC, VerdictCheckSPF, VerdictCheckDKIM}
+
+// VerdictAction is what happens to a message failing a check
+type VerdictAction string
+
+const (
+	// VerdictActionForward lets the message through as if the check passed
+	VerdictActionForward VerdictAction = "forward"
+	// VerdictActionTag lets the message through with the failed checks noted in its subject
+	VerdictActionTag VerdictAction = "tag"
+	// VerdictActionQuarantine moves the message under QuarantineKeyPrefix in the mail bucket instead of routing it
+	VerdictActionQuarantine VerdictAction = "quarantine"
+	// VerdictActionDrop throws the message away
+	VerdictActionDrop VerdictAction = "drop"
+)
+
+// verdictSeverity orders actions so the harshest one applying to a message wins
+var verdictSeverity = map[VerdictAction]int{
+	VerdictActionForward:    0,
+	VerdictActionTag:        1,
+	VerdictActionQuarantine: 2,
+	VerdictActionDrop:       3,
+}
+
+// VerdictPolicy says what to do with messages failing each check, checks it doesn't mention are ignored
+type VerdictPolicy map[VerdictCheck]VerdictAction
+
+// DefaultVerdictPolicy drops viruses, holds back spam and mail failing DMARC, and tags mail failing SPF or DKIM
+var DefaultVerdictPolicy = VerdictPolicy{
+	VerdictCheckVirus: VerdictActionDrop,
+	VerdictCheckSpam:  VerdictActionQuarantine,
+	VerdictCheckDMARC: VerdictActionQuarantine,
+	VerdictCheckSPF:   VerdictActionTag,
+	VerdictCheckDKIM:  VerdictActionTag,
+}
+
+// ParseVerdictPolicy reads a policy in the form check=action,check=action, for example "virus=drop,spf=tag". A blank
+// spec gives DefaultVerdictPolicy.
+func ParseVerdictPolicy(spec string) (VerdictPolicy, error) {
+	if strings.TrimSpace(spec) == "" {
+		return DefaultVerdictPolicy, nil
+	}
+	ret := make(VerdictPolicy)
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid verdict policy entry %q, expected check=action", entry)
+		}
+		check := VerdictCheck(strings.ToLower(strings.TrimSpace(parts[0])))
+		action := VerdictAction(strings.ToLower(strings.TrimSpace(parts[1])))
+		if !knownCheck(check) {
+			return nil, errors.Errorf("unknown verdict check %q", check)
+		}
+		if _, known := verdictSeverity[action]; !known {
+			return nil, errors.Errorf("unknown verdict action %q", action)
+		}
+		ret[check] = action
+	}
+	return ret, nil
+}
+
+func knownCheck(check VerdictCheck) bool {
+	for _, c := range verdictChecks {
+		if c == check {
+			return true
+		}
+	}
+	return false
+}
+
+// VerdictDecision is what the policy made of a message
+type VerdictDecision struct {
+	Action VerdictAction
+	// Failed is every check the message failed, including ones the policy ignores
+	Failed []VerdictCheck
+}
+
+// SubjectTag is what goes in front of the subject of a tagged message
+func (d VerdictDecision) SubjectTag() string {
+	failed := make([]string, len(d.Failed))
+	for i, f := range d.Failed {
+		failed[i] = string(f)
+	}
+	return fmt.Sprintf("[failed %s]", strings.Join(failed, ", "))
+}
+
+// Decide applies the policy to the verdicts SES reached for a message. Only outright failures count, checks that were
+// gray, disabled or couldn't be run are treated as passes.
+func (p VerdictPolicy) Decide(receipt events.SimpleEmailReceipt) VerdictDecision {
+	statuses := map[VerdictCheck]string{
+		VerdictCheckSpam:  receipt.SpamVerdict.Status,
+		VerdictCheckVirus: receipt.VirusVerdict.Status,
+		VerdictCheckSPF:   receipt.SPFVerdict.Status,
+		VerdictCheckDKIM:  receipt.DKIMVerdict.Status,
+		VerdictCheckDMARC: receipt.DMARCVerdict.Status,
+	}
+	ret := VerdictDecision{
+		Action: VerdictActionForward,
+		Failed: make([]VerdictCheck, 0),
+	}
+	for _, check := range verdictChecks {
+		if !strings.EqualFold(statuses[check], VerdictFail) {
+			continue
+		}
+		ret.Failed = append(ret.Failed, check)
+		action, inPolicy := p[check]
+		if inPolicy && verdictSeverity[action] > verdictSeverity[ret.Action] {
+			ret.Action = action
+		}
+	}
+	return ret
+}
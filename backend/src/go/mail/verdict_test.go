@@ -0,0 +1,93 @@
+package mail
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func receipt(spam, virus, spf, dkim, dmarc string) events.SimpleEmailReceipt {
+	return events.SimpleEmailReceipt{
+		SpamVerdict:  events.SimpleEmailVerdict{Status: spam},
+		VirusVerdict: events.SimpleEmailVerdict{Status: virus},
+		SPFVerdict:   events.SimpleEmailVerdict{Status: spf},
+		DKIMVerdict:  events.SimpleEmailVerdict{Status: dkim},
+		DMARCVerdict: events.SimpleEmailVerdict{Status: dmarc},
+	}
+}
+
+func TestVerdictPolicy_Decide(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		policy   VerdictPolicy
+		receipt  events.SimpleEmailReceipt
+		expected VerdictDecision
+	}{
+		{
+			"everything passes",
+			DefaultVerdictPolicy,
+			receipt("PASS", "PASS", "PASS", "PASS", "PASS"),
+			VerdictDecision{Action: VerdictActionForward, Failed: []VerdictCheck{}},
+		},
+		{
+			"gray and unprocessed verdicts are not failures",
+			DefaultVerdictPolicy,
+			receipt("GRAY", "PROCESSING_FAILED", "DISABLED", "GRAY", ""),
+			VerdictDecision{Action: VerdictActionForward, Failed: []VerdictCheck{}},
+		},
+		{
+			"single failure",
+			DefaultVerdictPolicy,
+			receipt("PASS", "PASS", "FAIL", "PASS", "PASS"),
+			VerdictDecision{Action: VerdictActionTag, Failed: []VerdictCheck{VerdictCheckSPF}},
+		},
+		{
+			"harshest action wins",
+			DefaultVerdictPolicy,
+			receipt("FAIL", "FAIL", "FAIL", "PASS", "PASS"),
+			VerdictDecision{Action: VerdictActionDrop, Failed: []VerdictCheck{VerdictCheckVirus, VerdictCheckSpam, VerdictCheckSPF}},
+		},
+		{
+			"checks outside the policy are reported but ignored",
+			VerdictPolicy{VerdictCheckVirus: VerdictActionDrop},
+			receipt("FAIL", "PASS", "PASS", "FAIL", "PASS"),
+			VerdictDecision{Action: VerdictActionForward, Failed: []VerdictCheck{VerdictCheckSpam, VerdictCheckDKIM}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.policy.Decide(tc.receipt))
+		})
+	}
+}
+
+func TestVerdictDecision_SubjectTag(t *testing.T) {
+	decision := VerdictDecision{Action: VerdictActionTag, Failed: []VerdictCheck{VerdictCheckSPF, VerdictCheckDKIM}}
+	assert.Equal(t, "[failed spf, dkim]", decision.SubjectTag())
+}
+
+func TestParseVerdictPolicy(t *testing.T) {
+	asserter := assert.New(t)
+
+	policy, err := ParseVerdictPolicy("")
+	asserter.NoError(err)
+	asserter.Equal(DefaultVerdictPolicy, policy)
+
+	policy, err = ParseVerdictPolicy("virus=drop, Spam=Tag,dmarc=forward")
+	asserter.NoError(err)
+	asserter.Equal(VerdictPolicy{
+		VerdictCheckVirus: VerdictActionDrop,
+		VerdictCheckSpam:  VerdictActionTag,
+		VerdictCheckDMARC: VerdictActionForward,
+	}, policy)
+
+	_, err = ParseVerdictPolicy("virus")
+	asserter.EqualError(err, `invalid verdict policy entry "virus", expected check=action`)
+
+	_, err = ParseVerdictPolicy("phishing=drop")
+	asserter.EqualError(err, `unknown verdict check "phishing"`)
+
+	_, err = ParseVerdictPolicy("virus=explode")
+	asserter.EqualError(err, `unknown verdict action "explode"`)
+}
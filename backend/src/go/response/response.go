@@ -19,40 +19,61 @@ type ErrorResponse struct {
 	RequestID string `json:"requestId"`
 }
 
+// ConflictResponse is an ErrorResponse with details about what the request conflicted with
+type ConflictResponse struct {
+	ErrorResponse
+	Details interface{} `json:"details,omitempty"`
+}
+
 func HandleError(ctx context.Context, responseHeaders map[string]string, err error) events.APIGatewayProxyResponse {
 	zerolog.Ctx(ctx).Error().Stack().Err(err).Msg("error encountered")
+	return errorResponse(ctx, responseHeaders, http.StatusInternalServerError, "an error has occurred")
+}
 
-	responseBody := ErrorResponse{
-		Message: "an error has occurred",
-	}
+func HandleNtFound(ctx context.Context, responseHeaders map[string]string) events.APIGatewayProxyResponse {
+	return errorResponse(ctx, responseHeaders, http.StatusNotFound, "requested entity not found")
+}
 
-	if awsCtx, inLambda := lambdacontext.FromContext(ctx); inLambda {
-		responseBody.RequestID = awsCtx.AwsRequestID
-	}
+func HandleUnauthorized(ctx context.Context, responseHeaders map[string]string, message string) events.APIGatewayProxyResponse {
+	return errorResponse(ctx, responseHeaders, http.StatusUnauthorized, message)
+}
 
-	content, err := json.Marshal(responseBody)
-	if err != nil {
-		panic(err)
-	}
+func HandleForbidden(ctx context.Context, responseHeaders map[string]string, message string) events.APIGatewayProxyResponse {
+	return errorResponse(ctx, responseHeaders, http.StatusForbidden, message)
+}
 
-	responseHeaders["content-type"] = "application/json"
+func HandleTooManyRequests(ctx context.Context, responseHeaders map[string]string, message string) events.APIGatewayProxyResponse {
+	return errorResponse(ctx, responseHeaders, http.StatusTooManyRequests, message)
+}
 
-	return events.APIGatewayProxyResponse{
-		StatusCode: http.StatusInternalServerError,
-		Body:       string(content),
-		Headers:    responseHeaders,
+func HandleTooLarge(ctx context.Context, responseHeaders map[string]string, message string) events.APIGatewayProxyResponse {
+	return errorResponse(ctx, responseHeaders, http.StatusRequestEntityTooLarge, message)
+}
+
+func HandleConflict(ctx context.Context, responseHeaders map[string]string, message string, details interface{}) events.APIGatewayProxyResponse {
+	responseBody := ConflictResponse{
+		ErrorResponse: ErrorResponse{Message: message},
+		Details:       details,
+	}
+	if awsCtx, inLambda := lambdacontext.FromContext(ctx); inLambda {
+		responseBody.RequestID = awsCtx.AwsRequestID
 	}
+	return jsonResponse(responseHeaders, http.StatusConflict, responseBody)
 }
 
-func HandleNtFound(ctx context.Context, responseHeaders map[string]string) events.APIGatewayProxyResponse {
+func errorResponse(ctx context.Context, responseHeaders map[string]string, statusCode int, message string) events.APIGatewayProxyResponse {
 	responseBody := ErrorResponse{
-		Message: "requested entity not found",
+		Message: message,
 	}
 
 	if awsCtx, inLambda := lambdacontext.FromContext(ctx); inLambda {
 		responseBody.RequestID = awsCtx.AwsRequestID
 	}
 
+	return jsonResponse(responseHeaders, statusCode, responseBody)
+}
+
+func jsonResponse(responseHeaders map[string]string, statusCode int, responseBody interface{}) events.APIGatewayProxyResponse {
 	content, err := json.Marshal(responseBody)
 	if err != nil {
 		panic(err)
@@ -61,7 +82,7 @@ func HandleNtFound(ctx context.Context, responseHeaders map[string]string) event
 	responseHeaders["content-type"] = "application/json"
 
 	return events.APIGatewayProxyResponse{
-		StatusCode: http.StatusNotFound,
+		StatusCode: statusCode,
 		Body:       string(content),
 		Headers:    responseHeaders,
 	}
@@ -4,18 +4,22 @@ import (
 	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-xray-sdk-go/xray"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"io"
+	"net/url"
+	"strings"
 	"time"
 )
 
 type Object struct {
-	Path string
-	Size int64
+	Path         string
+	Size         int64
+	LastModified time.Time
 }
 
 type ObjectFetcher func(ctx context.Context, bucket, object string) (io.ReadCloser, error)
@@ -34,6 +38,31 @@ func NewObjectFetcher(client *s3.S3) ObjectFetcher {
 	}
 }
 
+// ErrObjectChanged is the cause of errors from matching fetches and copies when the object is no longer the version
+// that was asked for
+var ErrObjectChanged = errors.New("object has changed")
+
+// MatchingObjectFetcher fetches an object only if it is still the version with the given ETag
+type MatchingObjectFetcher func(ctx context.Context, bucket, object, eTag string) (io.ReadCloser, error)
+
+func NewMatchingObjectFetcher(client *s3.S3) MatchingObjectFetcher {
+	return func(ctx context.Context, bucket, object, eTag string) (io.ReadCloser, error) {
+		zerolog.Ctx(ctx).Debug().Str("bucket", bucket).Str("key", object).Str("eTag", eTag).Msg("fetching object")
+		res, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket:  aws.String(bucket),
+			Key:     aws.String(object),
+			IfMatch: aws.String(eTag),
+		})
+		if isPreconditionFailed(err) {
+			return nil, errors.Wrapf(ErrObjectChanged, "fetching %s", object)
+		}
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return res.Body, nil
+	}
+}
+
 type ObjectRemover func(ctx context.Context, bucket, object string) error
 
 func NewObjectRemover(client *s3.S3) ObjectRemover {
@@ -51,20 +80,24 @@ type ObjectLister func(ctx context.Context, bucket string, filter string) ([]Obj
 
 func NewObjectLister(client *s3.S3) ObjectLister {
 	return func(ctx context.Context, bucket string, prefix string) ([]Object, error) {
-		res, err := client.ListObjectsWithContext(ctx, &s3.ListObjectsInput{
+		ret := make([]Object, 0)
+		// a single request tops out at 1000 keys, so keep following continuation tokens until everything is in hand
+		err := client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
 			Bucket: aws.String(bucket),
 			Prefix: aws.String(prefix),
+		}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, o := range page.Contents {
+				ret = append(ret, Object{
+					Path:         aws.StringValue(o.Key),
+					Size:         aws.Int64Value(o.Size),
+					LastModified: aws.TimeValue(o.LastModified),
+				})
+			}
+			return true
 		})
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
-		ret := make([]Object, 0)
-		for _, o := range res.Contents {
-			ret = append(ret, Object{
-				Path: *o.Key,
-				Size: *o.Size,
-			})
-		}
 		return ret, nil
 	}
 }
@@ -102,6 +135,174 @@ func NewPublicObjectSaver(client *s3.S3) PublicObjectSaver {
 	}
 }
 
+// ObjectInfo is what HeadObject tells us about an object
+type ObjectInfo struct {
+	ContentType string
+	Size        int64
+	ETag        string
+}
+
+// ObjectDescriber fetches details about an object, returning nil if it does not exist
+type ObjectDescriber func(ctx context.Context, bucket, object string) (*ObjectInfo, error)
+
+func NewObjectDescriber(client *s3.S3) ObjectDescriber {
+	return func(ctx context.Context, bucket, object string) (*ObjectInfo, error) {
+		res, err := client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(object),
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NotFound" {
+				return nil, nil
+			}
+			return nil, errors.WithStack(err)
+		}
+		return &ObjectInfo{
+			ContentType: aws.StringValue(res.ContentType),
+			Size:        aws.Int64Value(res.ContentLength),
+			ETag:        aws.StringValue(res.ETag),
+		}, nil
+	}
+}
+
+// PresignedRequest is a request that a client may make directly against s3, it must include the given headers
+type PresignedRequest struct {
+	URL     string
+	Method  string
+	Headers map[string]string
+	Expires time.Time
+}
+
+// PresignedPutCreator creates a presigned request for uploading a private object of exactly the given type and size
+type PresignedPutCreator func(ctx context.Context, bucket string, objectKey string, mimeType string, size int64, expiry time.Duration) (PresignedRequest, error)
+
+func NewPresignedPutCreator(client *s3.S3) PresignedPutCreator {
+	return func(ctx context.Context, bucket string, objectKey string, mimeType string, size int64, expiry time.Duration) (PresignedRequest, error) {
+		zerolog.Ctx(ctx).Info().Str("bucket", bucket).Str("key", objectKey).Msg("presigning upload")
+		req, _ := client.PutObjectRequest(&s3.PutObjectInput{
+			Bucket:        aws.String(bucket),
+			Key:           aws.String(objectKey),
+			ContentType:   aws.String(mimeType),
+			ContentLength: aws.Int64(size),
+			ACL:           aws.String("private"),
+		})
+		expires := time.Now().Add(expiry)
+		signedURL, signedHeaders, err := req.PresignRequest(expiry)
+		if err != nil {
+			return PresignedRequest{}, errors.WithStack(err)
+		}
+		headers := make(map[string]string)
+		for k, v := range signedHeaders {
+			// browsers refuse to let scripts set these, they get filled in on their own
+			if strings.EqualFold(k, "host") || strings.EqualFold(k, "content-length") || len(v) == 0 {
+				continue
+			}
+			headers[k] = v[0]
+		}
+		return PresignedRequest{
+			URL:     signedURL,
+			Method:  "PUT",
+			Headers: headers,
+			Expires: expires,
+		}, nil
+	}
+}
+
+// PresignedGetCreator creates a presigned request for downloading a private object, browsers save it as downloadName
+type PresignedGetCreator func(ctx context.Context, bucket string, objectKey string, downloadName string, expiry time.Duration) (PresignedRequest, error)
+
+func NewPresignedGetCreator(client *s3.S3) PresignedGetCreator {
+	return func(ctx context.Context, bucket string, objectKey string, downloadName string, expiry time.Duration) (PresignedRequest, error) {
+		zerolog.Ctx(ctx).Info().Str("bucket", bucket).Str("key", objectKey).Msg("presigning download")
+		req, _ := client.GetObjectRequest(&s3.GetObjectInput{
+			Bucket:                     aws.String(bucket),
+			Key:                        aws.String(objectKey),
+			ResponseContentDisposition: aws.String(fmt.Sprintf("attachment; filename=%q", downloadName)),
+		})
+		expires := time.Now().Add(expiry)
+		signedURL, err := req.Presign(expiry)
+		if err != nil {
+			return PresignedRequest{}, errors.WithStack(err)
+		}
+		return PresignedRequest{
+			URL:     signedURL,
+			Method:  "GET",
+			Headers: map[string]string{},
+			Expires: expires,
+		}, nil
+	}
+}
+
+// PublicObjectCopier copies an object within a bucket, making the copy public
+type PublicObjectCopier func(ctx context.Context, bucket string, sourceKey string, targetKey string, mimeType string, cacheDuration time.Duration) error
+
+func NewPublicObjectCopier(client *s3.S3) PublicObjectCopier {
+	return func(ctx context.Context, bucket string, sourceKey string, targetKey string, mimeType string, cacheDuration time.Duration) error {
+		zerolog.Ctx(ctx).Info().Str("bucket", bucket).Str("source", sourceKey).Str("key", targetKey).Msg("copying object")
+		_, err := client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+			Bucket:            aws.String(bucket),
+			Key:               aws.String(targetKey),
+			CopySource:        aws.String(copySource(bucket, sourceKey)),
+			ContentType:       aws.String(mimeType),
+			CacheControl:      aws.String(fmt.Sprintf("max-age=%d", int(cacheDuration.Seconds()))),
+			MetadataDirective: aws.String(s3.MetadataDirectiveReplace),
+			ACL:               aws.String("public-read"),
+		})
+		return errors.WithStack(err)
+	}
+}
+
+// ObjectCopier makes a private copy of an object within a bucket, keeping its content type and other metadata
+type ObjectCopier func(ctx context.Context, bucket string, sourceKey string, targetKey string) error
+
+func NewObjectCopier(client *s3.S3) ObjectCopier {
+	return func(ctx context.Context, bucket string, sourceKey string, targetKey string) error {
+		zerolog.Ctx(ctx).Info().Str("bucket", bucket).Str("source", sourceKey).Str("key", targetKey).Msg("copying object")
+		_, err := client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+			Bucket:            aws.String(bucket),
+			Key:               aws.String(targetKey),
+			CopySource:        aws.String(copySource(bucket, sourceKey)),
+			MetadataDirective: aws.String(s3.MetadataDirectiveCopy),
+			ACL:               aws.String("private"),
+		})
+		return errors.WithStack(err)
+	}
+}
+
+// MatchingObjectCopier is ObjectCopier that only copies the source if it is still the version with the given ETag
+type MatchingObjectCopier func(ctx context.Context, bucket string, sourceKey string, targetKey string, eTag string) error
+
+func NewMatchingObjectCopier(client *s3.S3) MatchingObjectCopier {
+	return func(ctx context.Context, bucket string, sourceKey string, targetKey string, eTag string) error {
+		zerolog.Ctx(ctx).Info().Str("bucket", bucket).Str("source", sourceKey).Str("key", targetKey).Str("eTag", eTag).Msg("copying object")
+		_, err := client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+			Bucket:            aws.String(bucket),
+			Key:               aws.String(targetKey),
+			CopySource:        aws.String(copySource(bucket, sourceKey)),
+			CopySourceIfMatch: aws.String(eTag),
+			MetadataDirective: aws.String(s3.MetadataDirectiveCopy),
+			ACL:               aws.String("private"),
+		})
+		if isPreconditionFailed(err) {
+			return errors.Wrapf(ErrObjectChanged, "copying %s", sourceKey)
+		}
+		return errors.WithStack(err)
+	}
+}
+
+func isPreconditionFailed(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == "PreconditionFailed"
+}
+
+func copySource(bucket string, key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
+
 func RawClient(sess *session.Session) *s3.S3 {
 	ret := s3.New(sess)
 	xray.AWS(ret.Client)
@@ -0,0 +1,202 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+type Verdict string
+
+const (
+	VerdictClean    Verdict = "clean"
+	VerdictInfected Verdict = "infected"
+	// VerdictNotScanned is what the no-op scanner gives, content is let through but nobody has looked at it
+	VerdictNotScanned Verdict = "not-scanned"
+
+	ScannerNone   = "none"
+	ScannerClamAV = "clamav"
+
+	// DefaultTimeout is how long a scan may take before any allowance for the size of the content, any deadline on the
+	// context still applies on top of it
+	DefaultTimeout = 10 * time.Second
+
+	// MaxStreamLength is the most clamd takes in a single scan, its default StreamMaxLength. Raise both together.
+	MaxStreamLength = 25 * 1024 * 1024
+
+	// scanRate is the bytes per second of content allowed for on top of the base timeout
+	scanRate = 2 * 1024 * 1024
+
+	// clamd closes the connection on anything bigger than its StreamMaxLength, chunks just need to stay well under it
+	clamAVChunkSize = 64 * 1024
+)
+
+// ErrTooLarge is the cause of errors scanning content bigger than the scanner will take
+var ErrTooLarge = errors.New("content is too large to scan")
+
+// Result is the outcome of scanning a piece of content
+type Result struct {
+	Verdict Verdict
+	// Signature names what was found in infected content
+	Signature string
+	Scanner   string
+	Scanned   time.Time
+}
+
+// Infected reports if the content must not be published
+func (r Result) Infected() bool {
+	return r.Verdict == VerdictInfected
+}
+
+// Scanner looks for malware in content, which is size bytes long
+type Scanner interface {
+	Scan(ctx context.Context, content io.Reader, size int64) (Result, error)
+}
+
+// NewScanner gives a ClamAV scanner for the clamd at address (host:port), or the no-op scanner if address is blank
+func NewScanner(address string, timeout time.Duration) Scanner {
+	if !Enabled(address) {
+		return NewNoopScanner()
+	}
+	return NewClamAVScanner(address, timeout)
+}
+
+// Enabled reports if NewScanner gives a scanner that actually looks at content for address
+func Enabled(address string) bool {
+	return strings.TrimSpace(address) != ""
+}
+
+type noopScanner struct{}
+
+func (n noopScanner) Scan(ctx context.Context, content io.Reader, size int64) (Result, error) {
+	return Result{
+		Verdict: VerdictNotScanned,
+		Scanner: ScannerNone,
+		Scanned: time.Now(),
+	}, nil
+}
+
+// NewNoopScanner gives a scanner that lets everything through, for when there is no scanning service to talk to
+func NewNoopScanner() Scanner {
+	return noopScanner{}
+}
+
+type clamAVScanner struct {
+	address string
+	timeout time.Duration
+}
+
+// NewClamAVScanner gives a scanner streaming content to clamd over TCP with the INSTREAM command. timeout bounds the
+// whole exchange for small content, bigger content gets longer in proportion to its size, and any deadline on the
+// context applies on top of that. Content over MaxStreamLength is refused without being sent.
+func NewClamAVScanner(address string, timeout time.Duration) Scanner {
+	return &clamAVScanner{
+		address: address,
+		timeout: timeout,
+	}
+}
+
+func (c *clamAVScanner) Scan(ctx context.Context, content io.Reader, size int64) (Result, error) {
+	if size > MaxStreamLength {
+		return Result{}, errors.Wrapf(ErrTooLarge, "%d bytes is over the %d byte limit", size, MaxStreamLength)
+	}
+	deadline := time.Now().Add(Timeout(c.timeout, size))
+	if ctxDeadline, hasDeadline := ctx.Deadline(); hasDeadline && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", c.address)
+	if err != nil {
+		return Result{}, errors.WithStack(err)
+	}
+	defer conn.Close()
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		return Result{}, errors.WithStack(err)
+	}
+
+	// the z prefix asks for null terminated replies
+	_, err = conn.Write([]byte("zINSTREAM\x00"))
+	if err != nil {
+		return Result{}, errors.WithStack(err)
+	}
+	err = writeChunks(conn, content)
+	if err != nil {
+		return Result{}, err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(err == io.EOF && reply != "") {
+		return Result{}, errors.WithStack(err)
+	}
+	ret, err := parseReply(strings.TrimRight(reply, "\x00"))
+	if err != nil {
+		return Result{}, err
+	}
+	zerolog.Ctx(ctx).Info().Str("verdict", string(ret.Verdict)).Str("signature", ret.Signature).Msg("content scanned")
+	return ret, nil
+}
+
+// Timeout is how long scanning size bytes may take, base plus time for the content at the expected scan rate
+func Timeout(base time.Duration, size int64) time.Duration {
+	return base + time.Duration(size)*time.Second/scanRate
+}
+
+// writeChunks sends content as length prefixed chunks, finishing with an empty chunk to mark the end
+func writeChunks(conn io.Writer, content io.Reader) error {
+	buf := make([]byte, clamAVChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := content.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			_, writeErr := conn.Write(size)
+			if writeErr == nil {
+				_, writeErr = conn.Write(buf[:n])
+			}
+			if writeErr != nil {
+				return errors.WithStack(writeErr)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	_, err := conn.Write([]byte{0, 0, 0, 0})
+	return errors.WithStack(err)
+}
+
+// parseReply makes sense of replies like "stream: OK" and "stream: Eicar-Signature FOUND"
+func parseReply(reply string) (Result, error) {
+	ret := Result{
+		Scanner: ScannerClamAV,
+		Scanned: time.Now(),
+	}
+	status := reply
+	if colon := strings.Index(reply, ": "); colon >= 0 {
+		status = reply[colon+2:]
+	}
+	switch {
+	case status == "OK":
+		ret.Verdict = VerdictClean
+	case strings.HasSuffix(status, " FOUND"):
+		ret.Verdict = VerdictInfected
+		ret.Signature = strings.TrimSuffix(status, " FOUND")
+	case strings.HasPrefix(status, "INSTREAM size limit exceeded"):
+		return Result{}, errors.Wrapf(ErrTooLarge, "clamd replied %q", reply)
+	default:
+		return Result{}, errors.Errorf("unexpected reply from clamd: %q", reply)
+	}
+	return ret, nil
+}
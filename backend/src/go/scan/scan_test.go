@@ -0,0 +1,164 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClamd is a stand in for clamd that speaks just enough of the INSTREAM protocol to test against
+type fakeClamd struct {
+	listener net.Listener
+	received chan []byte
+	reply    func(content []byte) string
+}
+
+func newFakeClamd(t *testing.T, reply func(content []byte) string) *fakeClamd {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret := &fakeClamd{
+		listener: listener,
+		received: make(chan []byte, 1),
+		reply:    reply,
+	}
+	go ret.serve()
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	return ret
+}
+
+func (f *fakeClamd) serve() {
+	conn, err := f.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	command := make([]byte, len("zINSTREAM\x00"))
+	_, err = io.ReadFull(conn, command)
+	if err != nil || string(command) != "zINSTREAM\x00" {
+		_, _ = conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+	content := bytes.Buffer{}
+	size := make([]byte, 4)
+	for {
+		_, err = io.ReadFull(conn, size)
+		if err != nil {
+			return
+		}
+		n := binary.BigEndian.Uint32(size)
+		if n == 0 {
+			break
+		}
+		_, err = io.CopyN(&content, conn, int64(n))
+		if err != nil {
+			return
+		}
+	}
+	f.received <- content.Bytes()
+	_, _ = conn.Write([]byte(f.reply(content.Bytes()) + "\x00"))
+}
+
+func (f *fakeClamd) address() string {
+	return f.listener.Addr().String()
+}
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+func eicarDetectingReply(content []byte) string {
+	if bytes.Contains(content, []byte("EICAR-STANDARD-ANTIVIRUS-TEST-FILE")) {
+		return "stream: Eicar-Test-Signature FOUND"
+	}
+	return "stream: OK"
+}
+
+func TestClamAVScannerClean(t *testing.T) {
+	daemon := newFakeClamd(t, eicarDetectingReply)
+	// bigger than a single chunk to make sure chunking holds together
+	content := strings.Repeat("perfectly innocent ", 10000)
+
+	res, err := NewClamAVScanner(daemon.address(), time.Second).Scan(context.Background(), strings.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+	assert.Equal(t, VerdictClean, res.Verdict)
+	assert.Equal(t, ScannerClamAV, res.Scanner)
+	assert.False(t, res.Infected())
+	assert.False(t, res.Scanned.IsZero())
+	assert.Equal(t, content, string(<-daemon.received))
+}
+
+func TestClamAVScannerInfected(t *testing.T) {
+	daemon := newFakeClamd(t, eicarDetectingReply)
+
+	res, err := NewClamAVScanner(daemon.address(), time.Second).Scan(context.Background(), strings.NewReader(eicar), int64(len(eicar)))
+	assert.NoError(t, err)
+	assert.Equal(t, VerdictInfected, res.Verdict)
+	assert.Equal(t, "Eicar-Test-Signature", res.Signature)
+	assert.True(t, res.Infected())
+}
+
+func TestClamAVScannerError(t *testing.T) {
+	daemon := newFakeClamd(t, func(content []byte) string {
+		return "stream: Can't allocate memory ERROR"
+	})
+
+	_, err := NewClamAVScanner(daemon.address(), time.Second).Scan(context.Background(), strings.NewReader("whatever"), 8)
+	assert.Error(t, err)
+	assert.NotEqual(t, ErrTooLarge, errors.Cause(err))
+}
+
+func TestClamAVScannerSizeLimitExceeded(t *testing.T) {
+	daemon := newFakeClamd(t, func(content []byte) string {
+		return "INSTREAM size limit exceeded. ERROR"
+	})
+
+	_, err := NewClamAVScanner(daemon.address(), time.Second).Scan(context.Background(), strings.NewReader("whatever"), 8)
+	assert.Equal(t, ErrTooLarge, errors.Cause(err))
+}
+
+func TestClamAVScannerTooLarge(t *testing.T) {
+	daemon := newFakeClamd(t, eicarDetectingReply)
+
+	_, err := NewClamAVScanner(daemon.address(), time.Second).Scan(context.Background(), strings.NewReader("whatever"), MaxStreamLength+1)
+	assert.Equal(t, ErrTooLarge, errors.Cause(err))
+	assert.Empty(t, daemon.received)
+}
+
+func TestTimeout(t *testing.T) {
+	assert.Equal(t, 10*time.Second, Timeout(10*time.Second, 0))
+	assert.Equal(t, 11*time.Second, Timeout(10*time.Second, 2*1024*1024))
+	assert.Equal(t, 22500*time.Millisecond, Timeout(10*time.Second, MaxStreamLength))
+}
+
+func TestClamAVScannerUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	_, err = NewClamAVScanner(address, time.Second).Scan(context.Background(), strings.NewReader("whatever"), 8)
+	assert.Error(t, err)
+}
+
+func TestNewScanner(t *testing.T) {
+	res, err := NewScanner("", time.Second).Scan(context.Background(), strings.NewReader(eicar), int64(len(eicar)))
+	assert.NoError(t, err)
+	assert.Equal(t, VerdictNotScanned, res.Verdict)
+	assert.Equal(t, ScannerNone, res.Scanner)
+	assert.False(t, res.Infected())
+
+	assert.IsType(t, &clamAVScanner{}, NewScanner("localhost:3310", time.Second))
+}
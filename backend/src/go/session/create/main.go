@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/auth"
+	"github.com/jonsabados/sabadoscodes.com/cors"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/response"
+	sessions "github.com/jonsabados/sabadoscodes.com/session"
+)
+
+type inboundRequest struct {
+	IDToken string `json:"idToken"`
+}
+
+func newHandler(prepLogs logging.Preparer,
+	corsHeaders cors.ResponseHeaderBuilder,
+	authenticate auth.Authenticator,
+	startSession sessions.Starter) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		ctx, _ = prepLogs(ctx)
+		responseHeaders := corsHeaders(request.Headers)
+
+		errors := httputil.ErrorTracker{}
+		createRequest := new(inboundRequest)
+		err := json.Unmarshal([]byte(request.Body), createRequest)
+		if err != nil {
+			zerolog.Ctx(ctx).Info().Err(err).Msg("unable to unmarshal request body")
+			errors = errors.WithError("invalid request body")
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		if createRequest.IDToken == "" {
+			errors = errors.WithFieldError("idToken", "idToken is required")
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		principal, err := authenticate(ctx, createRequest.IDToken)
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("id token authentication failed")
+			return response.HandleUnauthorized(ctx, responseHeaders, "invalid id token"), nil
+		}
+
+		tokens, err := startSession(ctx, principal)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		responseBody, err := json.Marshal(tokens)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		responseHeaders["content-type"] = "application/json"
+
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusCreated,
+			Headers:    responseHeaders,
+			Body:       string(responseBody),
+		}, nil
+	}
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	allowedDomains := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
+	googleClientID := os.Getenv("GOOGLE_CLIENT_ID")
+	rootUser := os.Getenv("ROOT_USER")
+	authors := strings.Split(os.Getenv("AUTHOR_USERS"), ",")
+	sessionTable := os.Getenv("SESSION_TABLE")
+	signingKey, err := sessions.SigningKey(os.Getenv("SESSION_SIGNING_KEY"))
+	if err != nil {
+		panic(err)
+	}
+
+	clientFactory := httputil.NewXRAYAwareHTTPClientFactory(http.DefaultClient)
+	certFetcher := auth.NewGoogleCertFetcher(auth.GoogleCertEndpoint, clientFactory)
+	authenticator := auth.NewGoogleAuthenticator(googleClientID, certFetcher, auth.NewRoleOracle(rootUser, authors))
+
+	dynamoClient := dynamo.RawClient(sess)
+	starter := sessions.NewStarter(signingKey, sessions.NewSaver(dynamoClient, sessionTable))
+
+	handler := newHandler(logging.NewPreparer(), cors.NewResponseHeaderBuilder(allowedDomains), authenticator, starter)
+
+	lambda.Start(handler)
+}
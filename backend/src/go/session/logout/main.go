@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/auth"
+	"github.com/jonsabados/sabadoscodes.com/cors"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/response"
+	sessions "github.com/jonsabados/sabadoscodes.com/session"
+)
+
+func newHandler(prepLogs logging.Preparer,
+	corsHeaders cors.ResponseHeaderBuilder,
+	extractPrincipal auth.PrincipalExtractor,
+	authorize auth.RouteAuthorizer,
+	revokeSession sessions.Revoker,
+	revokeUserSessions sessions.UserRevoker) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		ctx, _ = prepLogs(ctx)
+		responseHeaders := corsHeaders(request.Headers)
+
+		principal, err := extractPrincipal(request)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		if !authorize(principal, request) {
+			zerolog.Ctx(ctx).Warn().Interface("user", principal).Msg("user not authorized for route")
+			return response.HandleForbidden(ctx, responseHeaders, "not permitted"), nil
+		}
+
+		everywhere := false
+		if queryParam, hasParam := request.QueryStringParameters["everywhere"]; hasParam {
+			everywhere, err = strconv.ParseBool(queryParam)
+			if err != nil {
+				errors := httputil.ErrorTracker{}
+				errors = errors.WithFieldError("everywhere", "must be one of true or false")
+				return errors.ToAPIResponse(ctx, responseHeaders), nil
+			}
+		}
+
+		if everywhere {
+			count, err := revokeUserSessions(ctx, principal.UserID)
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+			zerolog.Ctx(ctx).Info().Str("userId", principal.UserID).Int("sessions", count).Msg("user logged out everywhere")
+		} else {
+			if principal.SessionID == "" {
+				errors := httputil.ErrorTracker{}
+				errors = errors.WithError("request was not made with a session token")
+				return errors.ToAPIResponse(ctx, responseHeaders), nil
+			}
+			err = revokeSession(ctx, principal.SessionID)
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+			zerolog.Ctx(ctx).Info().Str("userId", principal.UserID).Str("sessionId", principal.SessionID).Msg("user logged out")
+		}
+
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusNoContent,
+			Headers:    responseHeaders,
+		}, nil
+	}
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	allowedDomains := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
+	sessionTable := os.Getenv("SESSION_TABLE")
+
+	routes, err := auth.ParseRouteTable([]byte(os.Getenv("ROUTE_TABLE")))
+	if err != nil {
+		panic(err)
+	}
+
+	dynamoClient := dynamo.RawClient(sess)
+	revoker := sessions.NewRevoker(dynamoClient, sessionTable)
+	userRevoker := sessions.NewUserRevoker(dynamoClient, sessionTable, revoker)
+
+	handler := newHandler(logging.NewPreparer(), cors.NewResponseHeaderBuilder(allowedDomains), auth.NewPrincipalExtractor(), auth.NewRouteAuthorizer(routes), revoker, userRevoker)
+
+	lambda.Start(handler)
+}
@@ -0,0 +1,190 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/auth"
+)
+
+const (
+	TokenLifetime        = time.Minute * 15
+	RefreshTokenLifetime = time.Hour * 24 * 30
+
+	sessionIDBytes = 16
+	// how many exchanged refresh tokens are remembered per session for spotting re-use, a session refreshed every
+	// TokenLifetime covers a full day of use
+	maxRotatedHashes = 96
+)
+
+// ErrInvalidRefreshToken is returned when a refresh token is unknown, expired, revoked or has already been used
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// Tokens are handed to the client when a session is started or refreshed
+type Tokens struct {
+	SessionToken        string    `json:"sessionToken"`
+	SessionTokenExpires time.Time `json:"sessionTokenExpires"`
+	RefreshToken        string    `json:"refreshToken"`
+	RefreshTokenExpires time.Time `json:"refreshTokenExpires"`
+}
+
+// Starter begins a new session for an already authenticated principal
+type Starter func(ctx context.Context, principal auth.Principal) (Tokens, error)
+
+func NewStarter(signingKey []byte, saveSession Saver) Starter {
+	return func(ctx context.Context, principal auth.Principal) (Tokens, error) {
+		sessionID, err := randomString(sessionIDBytes)
+		if err != nil {
+			return Tokens{}, err
+		}
+		refreshToken, err := newRefreshToken(sessionID)
+		if err != nil {
+			return Tokens{}, err
+		}
+		now := time.Now()
+		s := Session{
+			ID:               sessionID,
+			UserID:           principal.UserID,
+			Email:            principal.Email,
+			Name:             principal.Name,
+			RefreshTokenHash: hashRefreshToken(refreshToken),
+			Created:          now,
+			Expires:          now.Add(RefreshTokenLifetime),
+		}
+		err = saveSession(ctx, s)
+		if err != nil {
+			return Tokens{}, err
+		}
+		zerolog.Ctx(ctx).Info().Str("sessionId", sessionID).Str("userId", principal.UserID).Msg("session started")
+		return issueTokens(signingKey, s, principal.Roles, refreshToken, now)
+	}
+}
+
+// Refresher exchanges a refresh token for a new session token and a new refresh token, the presented refresh token
+// can not be used again. Presenting an already used refresh token revokes the session, as it means the token has leaked.
+// Anything else that doesn't match is just refused, the session ID in a token is whatever the client sent so a made up
+// token must not be able to end somebody else's session.
+type Refresher func(ctx context.Context, refreshToken string) (Tokens, error)
+
+func NewRefresher(signingKey []byte, fetchSession Fetcher, rotate RefreshRotator, revoke Revoker, getRoles auth.RoleOracle) Refresher {
+	return func(ctx context.Context, refreshToken string) (Tokens, error) {
+		logger := zerolog.Ctx(ctx)
+		parts := strings.SplitN(refreshToken, ".", 2)
+		if len(parts) != 2 || !validSessionID(parts[0]) {
+			return Tokens{}, ErrInvalidRefreshToken
+		}
+		sessionID := parts[0]
+		s, err := fetchSession(ctx, sessionID)
+		if err != nil {
+			return Tokens{}, err
+		}
+		if s == nil || s.Revoked || s.Expires.Before(time.Now()) {
+			return Tokens{}, ErrInvalidRefreshToken
+		}
+
+		presentedHash := hashRefreshToken(refreshToken)
+		if presentedHash != s.RefreshTokenHash {
+			if !contains(s.RotatedHashes, presentedHash) {
+				logger.Warn().Str("sessionId", sessionID).Msg("unknown refresh token presented")
+				return Tokens{}, ErrInvalidRefreshToken
+			}
+			logger.Warn().Str("sessionId", sessionID).Msg("stale refresh token presented, revoking session")
+			err = revoke(ctx, sessionID)
+			if err != nil {
+				return Tokens{}, err
+			}
+			return Tokens{}, ErrInvalidRefreshToken
+		}
+
+		newToken, err := newRefreshToken(sessionID)
+		if err != nil {
+			return Tokens{}, err
+		}
+		now := time.Now()
+		s.RotatedHashes = append(s.RotatedHashes, presentedHash)
+		if len(s.RotatedHashes) > maxRotatedHashes {
+			s.RotatedHashes = s.RotatedHashes[len(s.RotatedHashes)-maxRotatedHashes:]
+		}
+		s.RefreshTokenHash = hashRefreshToken(newToken)
+		s.Expires = now.Add(RefreshTokenLifetime)
+		rotated, err := rotate(ctx, presentedHash, *s)
+		if err != nil {
+			return Tokens{}, err
+		}
+		if !rotated {
+			// lost a race with another refresh using the same token, or got revoked in the meantime
+			return Tokens{}, ErrInvalidRefreshToken
+		}
+		logger.Info().Str("sessionId", sessionID).Msg("session refreshed")
+		// roles are looked up again so that changes take effect without having to sign in again
+		return issueTokens(signingKey, *s, getRoles(ctx, s.Email), newToken, now)
+	}
+}
+
+func issueTokens(signingKey []byte, s Session, roles []auth.Role, refreshToken string, now time.Time) (Tokens, error) {
+	expires := now.Add(TokenLifetime)
+	sessionToken, err := signToken(signingKey, claims{
+		SessionID: s.ID,
+		Subject:   s.UserID,
+		Email:     s.Email,
+		Name:      s.Name,
+		Roles:     roles,
+		IssuedAt:  now.Unix(),
+		Expires:   expires.Unix(),
+	})
+	if err != nil {
+		return Tokens{}, err
+	}
+	return Tokens{
+		SessionToken:        sessionToken,
+		SessionTokenExpires: time.Unix(expires.Unix(), 0),
+		RefreshToken:        refreshToken,
+		RefreshTokenExpires: time.Unix(s.Expires.Unix(), 0),
+	}, nil
+}
+
+// refresh tokens are prefixed with the session ID so the session can be found without storing the token itself
+func newRefreshToken(sessionID string) (string, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return sessionID + "." + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+func hashRefreshToken(refreshToken string) string {
+	hash := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(hash[:])
+}
+
+func validSessionID(sessionID string) bool {
+	decoded, err := hex.DecodeString(sessionID)
+	return err == nil && len(decoded) == sessionIDBytes
+}
+
+func contains(hashes []string, hash string) bool {
+	for _, h := range hashes {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
+
+func randomString(byteCount int) (string, error) {
+	ret := make([]byte, byteCount)
+	_, err := rand.Read(ret)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return hex.EncodeToString(ret), nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/auth"
+	"github.com/jonsabados/sabadoscodes.com/cors"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/response"
+	sessions "github.com/jonsabados/sabadoscodes.com/session"
+)
+
+type inboundRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+func newHandler(prepLogs logging.Preparer,
+	corsHeaders cors.ResponseHeaderBuilder,
+	refreshSession sessions.Refresher) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		ctx, _ = prepLogs(ctx)
+		responseHeaders := corsHeaders(request.Headers)
+
+		errors := httputil.ErrorTracker{}
+		refreshRequest := new(inboundRequest)
+		err := json.Unmarshal([]byte(request.Body), refreshRequest)
+		if err != nil {
+			zerolog.Ctx(ctx).Info().Err(err).Msg("unable to unmarshal request body")
+			errors = errors.WithError("invalid request body")
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		if refreshRequest.RefreshToken == "" {
+			errors = errors.WithFieldError("refreshToken", "refreshToken is required")
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		tokens, err := refreshSession(ctx, refreshRequest.RefreshToken)
+		if err == sessions.ErrInvalidRefreshToken {
+			return response.HandleUnauthorized(ctx, responseHeaders, "invalid refresh token"), nil
+		}
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		responseBody, err := json.Marshal(tokens)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		responseHeaders["content-type"] = "application/json"
+
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusOK,
+			Headers:    responseHeaders,
+			Body:       string(responseBody),
+		}, nil
+	}
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	allowedDomains := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
+	rootUser := os.Getenv("ROOT_USER")
+	authors := strings.Split(os.Getenv("AUTHOR_USERS"), ",")
+	sessionTable := os.Getenv("SESSION_TABLE")
+	signingKey, err := sessions.SigningKey(os.Getenv("SESSION_SIGNING_KEY"))
+	if err != nil {
+		panic(err)
+	}
+
+	dynamoClient := dynamo.RawClient(sess)
+	refresher := sessions.NewRefresher(signingKey,
+		sessions.NewFetcher(dynamoClient, sessionTable),
+		sessions.NewRefreshRotator(dynamoClient, sessionTable),
+		sessions.NewRevoker(dynamoClient, sessionTable),
+		auth.NewRoleOracle(rootUser, authors))
+
+	handler := newHandler(logging.NewPreparer(), cors.NewResponseHeaderBuilder(allowedDomains), refresher)
+
+	lambda.Start(handler)
+}
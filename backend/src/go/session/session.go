@@ -0,0 +1,233 @@
+package session
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+)
+
+const (
+	fieldSessionID        = "SessionID"
+	fieldUserID           = "UserID"
+	fieldEmail            = "Email"
+	fieldName             = "Name"
+	fieldRefreshTokenHash = "RefreshTokenHash"
+	fieldRotatedHashes    = "RotatedHashes"
+	fieldCreated          = "Created"
+	fieldExpires          = "Expires"
+	fieldRevoked          = "Revoked"
+
+	userIndex = "UserID"
+)
+
+// Session is the server side record of a signed in user. The refresh token itself is never stored, only its hash.
+type Session struct {
+	ID               string
+	UserID           string
+	Email            string
+	Name             string
+	RefreshTokenHash string
+	// RotatedHashes are the hashes of refresh tokens that have already been exchanged, most recent last, so that
+	// re-use of one can be told apart from a token that was never issued
+	RotatedHashes []string
+	Created       time.Time
+	// Expires is when the current refresh token stops being valid, it is also used as the ttl on the record
+	Expires time.Time
+	Revoked bool
+}
+
+type Saver func(ctx context.Context, session Session) error
+
+func NewSaver(db *dynamodb.DynamoDB, sessionTable string) Saver {
+	return func(ctx context.Context, session Session) error {
+		_, err := db.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(sessionTable),
+			Item: map[string]*dynamodb.AttributeValue{
+				fieldSessionID:        {S: aws.String(session.ID)},
+				fieldUserID:           {S: aws.String(session.UserID)},
+				fieldEmail:            {S: aws.String(session.Email)},
+				fieldName:             {S: aws.String(session.Name)},
+				fieldRefreshTokenHash: {S: aws.String(session.RefreshTokenHash)},
+				fieldRotatedHashes:    {L: hashList(session.RotatedHashes)},
+				fieldCreated:          {N: aws.String(strconv.FormatInt(session.Created.Unix(), 10))},
+				fieldExpires:          {N: aws.String(strconv.FormatInt(session.Expires.Unix(), 10))},
+				fieldRevoked:          {BOOL: aws.Bool(session.Revoked)},
+			},
+		})
+		return errors.WithStack(err)
+	}
+}
+
+type Fetcher func(ctx context.Context, sessionID string) (*Session, error)
+
+func NewFetcher(db *dynamodb.DynamoDB, sessionTable string) Fetcher {
+	return func(ctx context.Context, sessionID string) (*Session, error) {
+		res, err := db.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+			TableName: aws.String(sessionTable),
+			Key: map[string]*dynamodb.AttributeValue{
+				fieldSessionID: {S: aws.String(sessionID)},
+			},
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if res.Item == nil {
+			return nil, nil
+		}
+		created, err := unixTime(res.Item, fieldCreated)
+		if err != nil {
+			return nil, err
+		}
+		expires, err := unixTime(res.Item, fieldExpires)
+		if err != nil {
+			return nil, err
+		}
+		rotated := make([]string, 0)
+		if res.Item[fieldRotatedHashes] != nil {
+			for _, h := range res.Item[fieldRotatedHashes].L {
+				rotated = append(rotated, aws.StringValue(h.S))
+			}
+		}
+		return &Session{
+			ID:               *res.Item[fieldSessionID].S,
+			UserID:           *res.Item[fieldUserID].S,
+			Email:            *res.Item[fieldEmail].S,
+			Name:             *res.Item[fieldName].S,
+			RefreshTokenHash: *res.Item[fieldRefreshTokenHash].S,
+			RotatedHashes:    rotated,
+			Created:          created,
+			Expires:          expires,
+			Revoked:          *res.Item[fieldRevoked].BOOL,
+		}, nil
+	}
+}
+
+// RefreshRotator stores the refresh token hash, rotated hashes and expiry of an updated session, but only if the stored
+// session still has the expected current hash and has not been revoked. It returns false when that is not the case.
+type RefreshRotator func(ctx context.Context, currentHash string, updated Session) (bool, error)
+
+func NewRefreshRotator(db *dynamodb.DynamoDB, sessionTable string) RefreshRotator {
+	return func(ctx context.Context, currentHash string, updated Session) (bool, error) {
+		_, err := db.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+			TableName: aws.String(sessionTable),
+			Key: map[string]*dynamodb.AttributeValue{
+				fieldSessionID: {S: aws.String(updated.ID)},
+			},
+			UpdateExpression:    aws.String("SET #hash = :newHash, #rotated = :rotated, #expires = :expires"),
+			ConditionExpression: aws.String("#hash = :currentHash AND #revoked = :false"),
+			ExpressionAttributeNames: map[string]*string{
+				"#hash":    aws.String(fieldRefreshTokenHash),
+				"#rotated": aws.String(fieldRotatedHashes),
+				"#expires": aws.String(fieldExpires),
+				"#revoked": aws.String(fieldRevoked),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":newHash":     {S: aws.String(updated.RefreshTokenHash)},
+				":rotated":     {L: hashList(updated.RotatedHashes)},
+				":currentHash": {S: aws.String(currentHash)},
+				":expires":     {N: aws.String(strconv.FormatInt(updated.Expires.Unix(), 10))},
+				":false":       {BOOL: aws.Bool(false)},
+			},
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+				return false, nil
+			}
+			return false, errors.WithStack(err)
+		}
+		return true, nil
+	}
+}
+
+type Revoker func(ctx context.Context, sessionID string) error
+
+func NewRevoker(db *dynamodb.DynamoDB, sessionTable string) Revoker {
+	return func(ctx context.Context, sessionID string) error {
+		_, err := db.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+			TableName: aws.String(sessionTable),
+			Key: map[string]*dynamodb.AttributeValue{
+				fieldSessionID: {S: aws.String(sessionID)},
+			},
+			UpdateExpression:    aws.String("SET #revoked = :true"),
+			ConditionExpression: aws.String("attribute_exists(#id)"),
+			ExpressionAttributeNames: map[string]*string{
+				"#revoked": aws.String(fieldRevoked),
+				"#id":      aws.String(fieldSessionID),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":true": {BOOL: aws.Bool(true)},
+			},
+		})
+		if err != nil {
+			// already gone (expired out via ttl most likely) which is as good as revoked
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+				return nil
+			}
+			return errors.WithStack(err)
+		}
+		return nil
+	}
+}
+
+// UserRevoker revokes every session belonging to a user, returning the number of sessions revoked
+type UserRevoker func(ctx context.Context, userID string) (int, error)
+
+func NewUserRevoker(db *dynamodb.DynamoDB, sessionTable string, revoke Revoker) UserRevoker {
+	return func(ctx context.Context, userID string) (int, error) {
+		sessionIDs := make([]string, 0)
+		err := db.QueryPagesWithContext(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(sessionTable),
+			IndexName:              aws.String(userIndex),
+			KeyConditionExpression: aws.String("#user = :user"),
+			FilterExpression:       aws.String("#revoked = :false"),
+			ExpressionAttributeNames: map[string]*string{
+				"#user":    aws.String(fieldUserID),
+				"#revoked": aws.String(fieldRevoked),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":user":  {S: aws.String(userID)},
+				":false": {BOOL: aws.Bool(false)},
+			},
+		}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+			for _, item := range page.Items {
+				sessionIDs = append(sessionIDs, *item[fieldSessionID].S)
+			}
+			return true
+		})
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+		for _, id := range sessionIDs {
+			err := revoke(ctx, id)
+			if err != nil {
+				return 0, err
+			}
+		}
+		return len(sessionIDs), nil
+	}
+}
+
+func unixTime(item map[string]*dynamodb.AttributeValue, field string) (time.Time, error) {
+	if item[field] == nil {
+		return time.Time{}, errors.Errorf("session %s missing %s", *item[fieldSessionID].S, field)
+	}
+	seconds, err := strconv.ParseInt(*item[field].N, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.Errorf("invalid timestamp %s for %s on session %s", *item[field].N, field, *item[fieldSessionID].S)
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+func hashList(hashes []string) []*dynamodb.AttributeValue {
+	ret := make([]*dynamodb.AttributeValue, 0, len(hashes))
+	for _, h := range hashes {
+		ret = append(ret, &dynamodb.AttributeValue{S: aws.String(h)})
+	}
+	return ret
+}
@@ -0,0 +1,198 @@
+package session
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jonsabados/sabadoscodes.com/auth"
+)
+
+var testKey = []byte("super secret signing key")
+
+// fakeStore is an in memory stand in for the dynamo backed session functions
+type fakeStore struct {
+	sessions map[string]Session
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{make(map[string]Session)}
+}
+
+func (f *fakeStore) save(ctx context.Context, s Session) error {
+	f.sessions[s.ID] = s
+	return nil
+}
+
+func (f *fakeStore) fetch(ctx context.Context, sessionID string) (*Session, error) {
+	s, exists := f.sessions[sessionID]
+	if !exists {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+func (f *fakeStore) rotate(ctx context.Context, currentHash string, updated Session) (bool, error) {
+	s, exists := f.sessions[updated.ID]
+	if !exists || s.Revoked || s.RefreshTokenHash != currentHash {
+		return false, nil
+	}
+	s.RefreshTokenHash = updated.RefreshTokenHash
+	s.RotatedHashes = updated.RotatedHashes
+	s.Expires = updated.Expires
+	f.sessions[updated.ID] = s
+	return true, nil
+}
+
+func (f *fakeStore) revoke(ctx context.Context, sessionID string) error {
+	s := f.sessions[sessionID]
+	s.Revoked = true
+	f.sessions[sessionID] = s
+	return nil
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	asserter := assert.New(t)
+	ctx := context.Background()
+	store := newFakeStore()
+
+	principal := auth.Principal{
+		UserID: "1234",
+		Email:  "bob@testing.com",
+		Name:   "Bob",
+		Roles:  []auth.Role{auth.RoleArticleAuthor},
+	}
+	refreshedRoles := []auth.Role{auth.RoleArticlePublish}
+	getRoles := func(ctx context.Context, email string) []auth.Role {
+		asserter.Equal(principal.Email, email)
+		return refreshedRoles
+	}
+
+	start := NewStarter(testKey, store.save)
+	refresh := NewRefresher(testKey, store.fetch, store.rotate, store.revoke, getRoles)
+	authenticate := NewAuthenticator(testKey, store.fetch)
+
+	tokens, err := start(ctx, principal)
+	asserter.NoError(err)
+	asserter.True(IsSessionToken(tokens.SessionToken))
+	asserter.False(IsSessionToken(tokens.RefreshToken))
+	asserter.Len(store.sessions, 1)
+	for _, s := range store.sessions {
+		asserter.NotContains(s.RefreshTokenHash, tokens.RefreshToken)
+	}
+
+	authenticated, err := authenticate(ctx, tokens.SessionToken)
+	asserter.NoError(err)
+	asserter.Equal(principal.UserID, authenticated.UserID)
+	asserter.Equal(principal.Roles, authenticated.Roles)
+	asserter.Equal(tokens.SessionTokenExpires, authenticated.Expires)
+	asserter.NotEmpty(authenticated.SessionID)
+
+	refreshed, err := refresh(ctx, tokens.RefreshToken)
+	asserter.NoError(err)
+	asserter.NotEqual(tokens.RefreshToken, refreshed.RefreshToken)
+
+	authenticated, err = authenticate(ctx, refreshed.SessionToken)
+	asserter.NoError(err)
+	asserter.Equal(refreshedRoles, authenticated.Roles)
+
+	// re-use of the old refresh token is treated as theft and kills the session
+	_, err = refresh(ctx, tokens.RefreshToken)
+	asserter.Equal(ErrInvalidRefreshToken, err)
+	_, err = refresh(ctx, refreshed.RefreshToken)
+	asserter.Equal(ErrInvalidRefreshToken, err)
+	_, err = authenticate(ctx, refreshed.SessionToken)
+	asserter.Error(err)
+}
+
+func TestNewRefresher_UnknownToken(t *testing.T) {
+	store := newFakeStore()
+	refresh := NewRefresher(testKey, store.fetch, store.rotate, store.revoke, auth.NewRoleOracle("", nil))
+	testCases := []string{
+		"",
+		".x",
+		"nothing",
+		"nope.nothing",
+		"0123456789abcdef0123456789abcdef.nothing",
+	}
+	for _, tc := range testCases {
+		_, err := refresh(context.Background(), tc)
+		assert.Equal(t, ErrInvalidRefreshToken, err, tc)
+	}
+}
+
+func TestNewRefresher_ForgedTokenLeavesSessionAlone(t *testing.T) {
+	asserter := assert.New(t)
+	ctx := context.Background()
+	store := newFakeStore()
+	getRoles := func(ctx context.Context, email string) []auth.Role {
+		return nil
+	}
+
+	tokens, err := NewStarter(testKey, store.save)(ctx, auth.Principal{UserID: "1234", Email: "bob@testing.com"})
+	asserter.NoError(err)
+	refresh := NewRefresher(testKey, store.fetch, store.rotate, store.revoke, getRoles)
+
+	// right session, but a secret that was never issued
+	sessionID := strings.SplitN(tokens.RefreshToken, ".", 2)[0]
+	_, err = refresh(ctx, sessionID+".made-up")
+	asserter.Equal(ErrInvalidRefreshToken, err)
+	asserter.False(store.sessions[sessionID].Revoked)
+
+	_, err = refresh(ctx, tokens.RefreshToken)
+	asserter.NoError(err)
+}
+
+func TestNewAuthenticator_BadTokens(t *testing.T) {
+	store := newFakeStore()
+	store.sessions["abc"] = Session{ID: "abc", UserID: "1234"}
+	authenticate := NewAuthenticator(testKey, store.fetch)
+
+	valid := claims{SessionID: "abc", Subject: "1234", Expires: time.Now().Add(time.Minute).Unix()}
+	goodToken, err := signToken(testKey, valid)
+	assert.NoError(t, err)
+	_, err = authenticate(context.Background(), goodToken)
+	assert.NoError(t, err)
+
+	wrongKey, _ := signToken([]byte("some other key"), valid)
+	expired, _ := signToken(testKey, claims{SessionID: "abc", Subject: "1234", Expires: time.Now().Add(-time.Minute).Unix()})
+	unknownSession, _ := signToken(testKey, claims{SessionID: "def", Subject: "1234", Expires: time.Now().Add(time.Minute).Unix()})
+	otherUser, _ := signToken(testKey, claims{SessionID: "abc", Subject: "4321", Expires: time.Now().Add(time.Minute).Unix()})
+	parts := strings.Split(goodToken, ".")
+	tampered := parts[0] + "." + parts[1] + "x." + parts[2]
+
+	testCases := []struct {
+		desc  string
+		token string
+	}{
+		{"garbage", "foo.bar.baz"},
+		{"wrong key", wrongKey},
+		{"expired", expired},
+		{"unknown session", unknownSession},
+		{"session belongs to someone else", otherUser},
+		{"tampered", tampered},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := authenticate(context.Background(), tc.token)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSigningKey(t *testing.T) {
+	asserter := assert.New(t)
+
+	key, err := SigningKey("0123456789abcdef0123456789abcdef")
+	asserter.NoError(err)
+	asserter.Equal([]byte("0123456789abcdef0123456789abcdef"), key)
+
+	_, err = SigningKey("")
+	asserter.EqualError(err, "signing key must be at least 32 bytes, got 0")
+
+	_, err = SigningKey("too short")
+	asserter.Error(err)
+}
@@ -0,0 +1,119 @@
+package session
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/jonsabados/sabadoscodes.com/auth"
+)
+
+// sessionTokenHeader is the fixed JWT header of every session token, which also makes them easy to tell apart from
+// google ID tokens
+var sessionTokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT","kid":"session"}`))
+
+type claims struct {
+	SessionID string      `json:"sid"`
+	Subject   string      `json:"sub"`
+	Email     string      `json:"email"`
+	Name      string      `json:"name"`
+	Roles     []auth.Role `json:"roles"`
+	IssuedAt  int64       `json:"iat"`
+	Expires   int64       `json:"exp"`
+}
+
+// MinSigningKeyLength is the shortest signing key accepted, anything shorter (an empty key from a missing parameter
+// especially) would make tokens easy to forge
+const MinSigningKeyLength = 32
+
+// SigningKey checks that key is long enough to sign tokens with, giving it as bytes
+func SigningKey(key string) ([]byte, error) {
+	if len(key) < MinSigningKeyLength {
+		return nil, errors.Errorf("signing key must be at least %d bytes, got %d", MinSigningKeyLength, len(key))
+	}
+	return []byte(key), nil
+}
+
+// IsSessionToken reports if the token looks like one of our session tokens, it does not validate it
+func IsSessionToken(token string) bool {
+	return strings.HasPrefix(token, sessionTokenHeader+".")
+}
+
+func signToken(signingKey []byte, c claims) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	unsigned := sessionTokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sign(signingKey, unsigned)), nil
+}
+
+func sign(signingKey []byte, content string) []byte {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(content))
+	return mac.Sum(nil)
+}
+
+func verifyToken(signingKey []byte, token string) (claims, error) {
+	if !IsSessionToken(token) {
+		return claims{}, errors.New("not a session token")
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims{}, errors.New("malformed session token")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims{}, errors.New("malformed session token signature")
+	}
+	if !hmac.Equal(signature, sign(signingKey, parts[0]+"."+parts[1])) {
+		return claims{}, errors.New("invalid session token signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims{}, errors.New("malformed session token payload")
+	}
+	ret := claims{}
+	err = json.Unmarshal(payload, &ret)
+	if err != nil {
+		return claims{}, errors.WithStack(err)
+	}
+	if ret.Expires < time.Now().Unix() {
+		return claims{}, errors.Errorf("expired session token, expiration: %s", time.Unix(ret.Expires, 0).Format(time.RFC3339))
+	}
+	return ret, nil
+}
+
+// NewAuthenticator creates an auth.Authenticator for session tokens. Besides checking the signature and expiration
+// the session is looked up on every call so revocation takes effect right away.
+func NewAuthenticator(signingKey []byte, fetchSession Fetcher) auth.Authenticator {
+	return func(ctx context.Context, token string) (auth.Principal, error) {
+		c, err := verifyToken(signingKey, token)
+		if err != nil {
+			return auth.Principal{}, err
+		}
+		s, err := fetchSession(ctx, c.SessionID)
+		if err != nil {
+			return auth.Principal{}, err
+		}
+		if s == nil || s.Revoked || s.UserID != c.Subject {
+			zerolog.Ctx(ctx).Info().Str("sessionId", c.SessionID).Msg("token presented for missing or revoked session")
+			return auth.Principal{}, errors.Errorf("session %s is no longer valid", c.SessionID)
+		}
+		return auth.Principal{
+			UserID:    c.Subject,
+			Email:     c.Email,
+			Name:      c.Name,
+			Roles:     c.Roles,
+			SessionID: c.SessionID,
+			Expires:   time.Unix(c.Expires, 0),
+		}, nil
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+
+	"github.com/jonsabados/sabadoscodes.com/cors"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/response"
+	"github.com/jonsabados/sabadoscodes.com/subscription"
+)
+
+// newHandler creates the handler for the link in confirmation mail, which sends the reader on to the site with the
+// outcome in the subscription query parameter
+func newHandler(prepLogs logging.Preparer,
+	corsHeaders cors.ResponseHeaderBuilder,
+	signingKey []byte,
+	confirm subscription.Confirmer,
+	siteURL string) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		ctx, logger := prepLogs(ctx)
+		responseHeaders := corsHeaders(request.Headers)
+		now := time.Now()
+
+		outcome := "invalid"
+		email, err := subscription.VerifyToken(signingKey, request.QueryStringParameters["token"], subscription.PurposeConfirm, now)
+		if err != nil {
+			logger.Info().Err(err).Msg("confirmation with invalid token")
+		} else {
+			confirmed, err := confirm(ctx, email, now)
+			if err != nil {
+				return response.HandleError(ctx, responseHeaders, err), nil
+			}
+			if confirmed {
+				logger.Info().Msg("subscription confirmed")
+				outcome = "confirmed"
+			}
+		}
+
+		responseHeaders["location"] = strings.TrimSuffix(siteURL, "/") + "/?subscription=" + outcome
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusFound,
+			Headers:    responseHeaders,
+		}, nil
+	}
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	allowedDomains := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
+
+	dynamoClient := dynamo.RawClient(sess)
+
+	signingKey, err := subscription.SigningKey(os.Getenv("SUBSCRIPTION_SIGNING_KEY"))
+	if err != nil {
+		panic(err)
+	}
+
+	handler := newHandler(logging.NewPreparer(),
+		cors.NewResponseHeaderBuilder(allowedDomains),
+		signingKey,
+		subscription.NewConfirmer(dynamoClient, os.Getenv("SUBSCRIBER_TABLE")),
+		os.Getenv("SITE_URL"))
+
+	lambda.Start(handler)
+}
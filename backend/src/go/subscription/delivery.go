@@ -0,0 +1,113 @@
+package subscription
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+)
+
+const (
+	fieldSlug      = "Slug"
+	fieldAttempted = "Attempted"
+	fieldError     = "Error"
+)
+
+// DeliveryRetention is how long the record of a post being sent to a subscriber is kept
+const DeliveryRetention = 90 * 24 * time.Hour
+
+type DeliveryStatus string
+
+const (
+	DeliverySent   = DeliveryStatus("sent")
+	DeliveryFailed = DeliveryStatus("failed")
+	// DeliverySuppressed is for subscribers on the mail suppression list, nothing was sent and nothing will be
+	DeliverySuppressed = DeliveryStatus("suppressed")
+)
+
+// Delivery records the outcome of mailing a subscriber about a post
+type Delivery struct {
+	Slug      string
+	Email     string
+	Status    DeliveryStatus
+	Attempted time.Time
+	// Error is why the send failed, for failed deliveries
+	Error string
+}
+
+// Done reports if nothing more is to be done for the delivery, failed deliveries are tried again
+func (d Delivery) Done() bool {
+	return d.Status == DeliverySent || d.Status == DeliverySuppressed
+}
+
+// DeliveryLookup finds the delivery of a post to a subscriber, giving nil if none has been attempted
+type DeliveryLookup func(ctx context.Context, slug, email string) (*Delivery, error)
+
+func NewDeliveryLookup(db *dynamodb.DynamoDB, deliveryTable string) DeliveryLookup {
+	return func(ctx context.Context, slug, email string) (*Delivery, error) {
+		res, err := db.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+			TableName: aws.String(deliveryTable),
+			Key: map[string]*dynamodb.AttributeValue{
+				fieldSlug:  {S: aws.String(slug)},
+				fieldEmail: {S: aws.String(email)},
+			},
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if res.Item == nil {
+			return nil, nil
+		}
+		ret, err := toDelivery(res.Item)
+		if err != nil {
+			return nil, err
+		}
+		return &ret, nil
+	}
+}
+
+// DeliveryRecorder records the outcome of mailing a subscriber about a post, replacing any earlier attempt
+type DeliveryRecorder func(ctx context.Context, delivery Delivery) error
+
+func NewDeliveryRecorder(db *dynamodb.DynamoDB, deliveryTable string) DeliveryRecorder {
+	return func(ctx context.Context, delivery Delivery) error {
+		item := map[string]*dynamodb.AttributeValue{
+			fieldSlug:      {S: aws.String(delivery.Slug)},
+			fieldEmail:     {S: aws.String(delivery.Email)},
+			fieldStatus:    {S: aws.String(string(delivery.Status))},
+			fieldAttempted: {N: aws.String(strconv.FormatInt(delivery.Attempted.UnixNano(), 10))},
+			fieldExpires:   {N: aws.String(strconv.FormatInt(delivery.Attempted.Add(DeliveryRetention).Unix(), 10))},
+		}
+		if delivery.Error != "" {
+			item[fieldError] = &dynamodb.AttributeValue{S: aws.String(delivery.Error)}
+		}
+		_, err := db.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(deliveryTable),
+			Item:      item,
+		})
+		return errors.WithStack(err)
+	}
+}
+
+func toDelivery(item map[string]*dynamodb.AttributeValue) (Delivery, error) {
+	ret := Delivery{
+		Slug:  aws.StringValue(item[fieldSlug].S),
+		Email: aws.StringValue(item[fieldEmail].S),
+	}
+	attempted, err := nanoTime(item, fieldAttempted)
+	if err != nil {
+		return Delivery{}, errors.Wrapf(err, "delivery of %s to %s", ret.Slug, ret.Email)
+	}
+	ret.Attempted = attempted
+	if item[fieldStatus] != nil {
+		ret.Status = DeliveryStatus(aws.StringValue(item[fieldStatus].S))
+	}
+	if item[fieldError] != nil {
+		ret.Error = aws.StringValue(item[fieldError].S)
+	}
+	return ret, nil
+}
@@ -0,0 +1,44 @@
+package subscription
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_toDelivery(t *testing.T) {
+	asserter := assert.New(t)
+
+	res, err := toDelivery(map[string]*dynamodb.AttributeValue{
+		fieldSlug:      {S: aws.String("some-post")},
+		fieldEmail:     {S: aws.String("bob@example.com")},
+		fieldStatus:    {S: aws.String("failed")},
+		fieldAttempted: {N: aws.String("1615181400000000000")},
+		fieldError:     {S: aws.String("throttled")},
+	})
+	asserter.NoError(err)
+	asserter.Equal(Delivery{
+		Slug:      "some-post",
+		Email:     "bob@example.com",
+		Status:    DeliveryFailed,
+		Attempted: time.Date(2021, 3, 8, 5, 30, 0, 0, time.UTC),
+		Error:     "throttled",
+	}, res)
+
+	_, err = toDelivery(map[string]*dynamodb.AttributeValue{
+		fieldSlug:      {S: aws.String("some-post")},
+		fieldEmail:     {S: aws.String("bob@example.com")},
+		fieldAttempted: {N: aws.String("yesterday")},
+	})
+	asserter.EqualError(err, "delivery of some-post to bob@example.com: invalid Attempted time yesterday")
+}
+
+func TestDelivery_Done(t *testing.T) {
+	asserter := assert.New(t)
+	asserter.True(Delivery{Status: DeliverySent}.Done())
+	asserter.True(Delivery{Status: DeliverySuppressed}.Done())
+	asserter.False(Delivery{Status: DeliveryFailed}.Done())
+}
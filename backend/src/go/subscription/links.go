@@ -0,0 +1,30 @@
+package subscription
+
+import (
+	"net/url"
+	"strings"
+)
+
+const (
+	ConfirmPath     = "/subscription/confirm"
+	UnsubscribePath = "/subscription/unsubscribe"
+)
+
+// ConfirmURL gives the link, on the api, that confirms the subscription the token was signed for
+func ConfirmURL(apiURL, token string) string {
+	return strings.TrimSuffix(apiURL, "/") + ConfirmPath + "?token=" + url.QueryEscape(token)
+}
+
+// UnsubscribeURL gives the link, on the api, that unsubscribes whoever the token was signed for
+func UnsubscribeURL(apiURL, token string) string {
+	return strings.TrimSuffix(apiURL, "/") + UnsubscribePath + "?token=" + url.QueryEscape(token)
+}
+
+// UnsubscribeHeaders gives the headers letting mail clients offer an unsubscribe button, which POSTs straight to the
+// unsubscribe link without the reader having to visit it (RFC 8058)
+func UnsubscribeHeaders(unsubscribeURL string) map[string]string {
+	return map[string]string{
+		"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
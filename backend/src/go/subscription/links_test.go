@@ -0,0 +1,16 @@
+package subscription
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinks(t *testing.T) {
+	assert.Equal(t, "https://api.example.com/subscription/confirm?token=abc%2B%3D", ConfirmURL("https://api.example.com/", "abc+="))
+	assert.Equal(t, "https://api.example.com/subscription/unsubscribe?token=abc", UnsubscribeURL("https://api.example.com", "abc"))
+	assert.Equal(t, map[string]string{
+		"List-Unsubscribe":      "<https://api.example.com/subscription/unsubscribe?token=abc>",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}, UnsubscribeHeaders("https://api.example.com/subscription/unsubscribe?token=abc"))
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/pkg/errors"
+
+	"github.com/jonsabados/sabadoscodes.com/article"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/mail"
+	"github.com/jonsabados/sabadoscodes.com/s3"
+	"github.com/jonsabados/sabadoscodes.com/subscription"
+)
+
+const (
+	newPostsTemplate = "new-posts"
+	excerptLength    = 300
+)
+
+type post struct {
+	Slug    string
+	Title   string
+	Excerpt string
+	URL     string
+}
+
+// newPostsData is what the new-posts mail template is rendered with
+type newPostsData struct {
+	Posts          []post
+	UnsubscribeURL string
+	SiteURL        string
+}
+
+// newHandler creates the handler for batches of published events. Articles published close together arrive in the
+// same batch and go out as a single digest. Deliveries are recorded per article and subscriber so that a batch that
+// is retried (after running out of time say) picks up where it left off rather than mailing anyone twice. Failed
+// sends fail the batch once everyone else has been mailed, so SQS hands it back and only those are tried again.
+func newHandler(prepLogs logging.Preparer,
+	fetchArticle article.Fetcher,
+	listSubscribers subscription.ConfirmedLister,
+	lookupDelivery subscription.DeliveryLookup,
+	recordDelivery subscription.DeliveryRecorder,
+	render mail.TemplateRenderer,
+	throttle mail.Throttle,
+	sendMessage mail.MessageSender,
+	signingKey []byte,
+	baseArticleURL string,
+	apiURL string,
+	siteURL string,
+	mailFrom string) func(ctx context.Context, event events.SQSEvent) error {
+
+	return func(ctx context.Context, event events.SQSEvent) error {
+		ctx, logger := prepLogs(ctx)
+
+		slugs, err := subscription.PublishedSlugs(event)
+		if err != nil {
+			logger.Error().Stack().Err(err).Msg("error reading published events")
+			return err
+		}
+
+		posts := make([]post, 0, len(slugs))
+		for _, slug := range slugs {
+			a, err := fetchArticle(ctx, slug)
+			if err != nil {
+				logger.Error().Stack().Err(err).Str("slug", slug).Msg("error fetching article")
+				return err
+			}
+			// unpublished (or deleted) between the save and now, nobody should hear about it
+			if a == nil || a.PublishDate == nil {
+				logger.Info().Str("slug", slug).Msg("article no longer published, skipping")
+				continue
+			}
+			posts = append(posts, post{
+				Slug:    a.Slug,
+				Title:   a.Title,
+				Excerpt: article.Excerpt(a.Content, excerptLength),
+				URL:     fmt.Sprintf("%s/%s", strings.TrimSuffix(baseArticleURL, "/"), a.Slug),
+			})
+		}
+		if len(posts) == 0 {
+			return nil
+		}
+
+		subscribers, err := listSubscribers(ctx)
+		if err != nil {
+			logger.Error().Stack().Err(err).Msg("error listing subscribers")
+			return err
+		}
+		logger.Info().Int("posts", len(posts)).Int("subscribers", len(subscribers)).Msg("notifying subscribers of new posts")
+
+		sent := 0
+		failed := 0
+		for _, s := range subscribers {
+			pending := make([]post, 0, len(posts))
+			for _, p := range posts {
+				delivery, err := lookupDelivery(ctx, p.Slug, s.Email)
+				if err != nil {
+					logger.Error().Stack().Err(err).Str("slug", p.Slug).Msg("error looking up delivery")
+					return err
+				}
+				// failed deliveries are given another go when the batch is retried
+				if delivery == nil || !delivery.Done() {
+					pending = append(pending, p)
+				}
+			}
+			if len(pending) == 0 {
+				continue
+			}
+
+			token, err := subscription.SignToken(signingKey, s.Email, subscription.PurposeUnsubscribe, time.Time{})
+			if err != nil {
+				logger.Error().Stack().Err(err).Msg("error signing unsubscribe token")
+				return err
+			}
+			unsubscribeURL := subscription.UnsubscribeURL(apiURL, token)
+			rendered, err := render(ctx, newPostsTemplate, mail.DefaultLocale, newPostsData{
+				Posts:          pending,
+				UnsubscribeURL: unsubscribeURL,
+				SiteURL:        siteURL,
+			})
+			if err != nil {
+				logger.Error().Stack().Err(err).Msg("error rendering new posts mail")
+				return err
+			}
+
+			// running out of time ends up here, the batch is retried and carries on from this subscriber
+			err = throttle(ctx)
+			if err != nil {
+				logger.Error().Stack().Err(err).Int("sent", sent).Msg("stopped before all subscribers were mailed")
+				return err
+			}
+			status := subscription.DeliverySent
+			errorMessage := ""
+			sendErr := sendMessage(ctx, mail.Message{
+				From:     mailFrom,
+				To:       []string{s.Email},
+				Subject:  rendered.Subject,
+				HTMLBody: rendered.HTMLBody,
+				TextBody: rendered.TextBody,
+				Headers:  subscription.UnsubscribeHeaders(unsubscribeURL),
+			})
+			// one bad address shouldn't hold up everyone else, the failure is recorded and the rest carry on
+			switch {
+			case errors.Cause(sendErr) == mail.ErrSuppressed:
+				// retrying would never get anywhere, so these don't fail the batch
+				logger.Info().Msg("subscriber is suppressed, not sending new posts mail")
+				status = subscription.DeliverySuppressed
+				errorMessage = sendErr.Error()
+			case sendErr != nil:
+				logger.Warn().Err(sendErr).Msg("error sending new posts mail")
+				status = subscription.DeliveryFailed
+				errorMessage = sendErr.Error()
+				failed++
+			default:
+				sent++
+			}
+
+			now := time.Now()
+			for _, p := range pending {
+				err = recordDelivery(ctx, subscription.Delivery{
+					Slug:      p.Slug,
+					Email:     s.Email,
+					Status:    status,
+					Attempted: now,
+					Error:     errorMessage,
+				})
+				if err != nil {
+					logger.Error().Stack().Err(err).Str("slug", p.Slug).Msg("error recording delivery")
+					return err
+				}
+			}
+		}
+		logger.Info().Int("sent", sent).Int("failed", failed).Msg("new posts notifications complete")
+		if failed > 0 {
+			return errors.Errorf("%d new posts mails failed, leaving the batch to be retried", failed)
+		}
+		return nil
+	}
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	articleTable := os.Getenv("ARTICLE_TABLE")
+	subscriberTable := os.Getenv("SUBSCRIBER_TABLE")
+	deliveryTable := os.Getenv("DELIVERY_TABLE")
+	sendRate := float64(mail.DefaultSendRate)
+	if os.Getenv("SEND_RATE") != "" {
+		sendRate, err = strconv.ParseFloat(os.Getenv("SEND_RATE"), 64)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	dynamoClient := dynamo.RawClient(sess)
+	s3Client := s3.RawClient(sess)
+	templateSource := mail.NewTemplateSource(os.Getenv("TEMPLATE_BUCKET"), s3.NewObjectDescriber(s3Client), s3.NewObjectFetcher(s3Client))
+	// the same template is rendered for every subscriber, no sense fetching it from s3 each time
+	templateSource = mail.NewCachingTemplateSource(templateSource, mail.DefaultTemplateReloadInterval)
+
+	signingKey, err := subscription.SigningKey(os.Getenv("SUBSCRIPTION_SIGNING_KEY"))
+	if err != nil {
+		panic(err)
+	}
+
+	handler := newHandler(logging.NewPreparer(),
+		article.NewFetcher(dynamoClient, articleTable),
+		subscription.NewConfirmedLister(dynamoClient, subscriberTable),
+		subscription.NewDeliveryLookup(dynamoClient, deliveryTable),
+		subscription.NewDeliveryRecorder(dynamoClient, deliveryTable),
+		mail.NewTemplateRenderer(templateSource),
+		mail.NewThrottle(sendRate),
+		mail.NewSuppressingMessageSender(mail.NewSuppressionChecker(dynamoClient, os.Getenv("SUPPRESSION_TABLE")), mail.NewMessageSender(mail.NewRawClient(sess))),
+		signingKey,
+		os.Getenv("BASE_ARTICLE_URL"),
+		os.Getenv("API_URL"),
+		os.Getenv("SITE_URL"),
+		os.Getenv("MAIL_FROM"))
+
+	lambda.Start(handler)
+}
@@ -0,0 +1,60 @@
+package subscription
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/pkg/errors"
+)
+
+// PublishedEvent is queued when an article is first published, for subscribers to be told about it
+type PublishedEvent struct {
+	Slug string `json:"slug"`
+}
+
+func NewRawSQSClient(sess *session.Session) *sqs.SQS {
+	client := sqs.New(sess)
+	xray.AWS(client.Client)
+	return client
+}
+
+// PublishNotifier queues the event that has subscribers told about a newly published article
+type PublishNotifier func(ctx context.Context, slug string) error
+
+func NewPublishNotifier(client *sqs.SQS, queueURL string) PublishNotifier {
+	return func(ctx context.Context, slug string) error {
+		body, err := json.Marshal(PublishedEvent{Slug: slug})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		_, err = client.SendMessageWithContext(ctx, &sqs.SendMessageInput{
+			QueueUrl:    aws.String(queueURL),
+			MessageBody: aws.String(string(body)),
+		})
+		return errors.WithStack(err)
+	}
+}
+
+// PublishedSlugs gives the slugs of the articles in a batch of PublishedEvent messages, in order and without repeats
+func PublishedSlugs(event events.SQSEvent) ([]string, error) {
+	ret := make([]string, 0, len(event.Records))
+	seen := make(map[string]bool)
+	for _, r := range event.Records {
+		published := PublishedEvent{}
+		err := json.Unmarshal([]byte(r.Body), &published)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid published event %s", r.MessageId)
+		}
+		if published.Slug == "" || seen[published.Slug] {
+			continue
+		}
+		seen[published.Slug] = true
+		ret = append(ret, published.Slug)
+	}
+	return ret, nil
+}
@@ -0,0 +1,30 @@
+package subscription
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishedSlugs(t *testing.T) {
+	asserter := assert.New(t)
+
+	res, err := PublishedSlugs(events.SQSEvent{
+		Records: []events.SQSMessage{
+			{MessageId: "1", Body: `{"slug":"first"}`},
+			{MessageId: "2", Body: `{"slug":"second"}`},
+			{MessageId: "3", Body: `{"slug":"first"}`},
+			{MessageId: "4", Body: `{}`},
+		},
+	})
+	asserter.NoError(err)
+	asserter.Equal([]string{"first", "second"}, res)
+
+	_, err = PublishedSlugs(events.SQSEvent{
+		Records: []events.SQSMessage{
+			{MessageId: "5", Body: `not json`},
+		},
+	})
+	asserter.Error(err)
+}
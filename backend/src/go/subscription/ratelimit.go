@@ -0,0 +1,55 @@
+package subscription
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+)
+
+const (
+	fieldLimitKey = "LimitKey"
+	fieldCount    = "Count"
+)
+
+// RateLimiter counts an attempt against key, such as an ip address, reporting if it is within the limit
+type RateLimiter func(ctx context.Context, key string, now time.Time) (bool, error)
+
+// NewRateLimiter creates a RateLimiter allowing limit attempts per key in each window. Counts are kept per fixed
+// window, and expire through the table's ttl once the window is over.
+func NewRateLimiter(db *dynamodb.DynamoDB, limitTable string, limit int, window time.Duration) RateLimiter {
+	return func(ctx context.Context, key string, now time.Time) (bool, error) {
+		windowStart := now.Truncate(window)
+		res, err := db.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+			TableName: aws.String(limitTable),
+			Key: map[string]*dynamodb.AttributeValue{
+				fieldLimitKey: {S: aws.String(rateLimitKey(key, windowStart))},
+			},
+			UpdateExpression: aws.String("ADD #count :one SET #expires = :expires"),
+			ExpressionAttributeNames: map[string]*string{
+				"#count":   aws.String(fieldCount),
+				"#expires": aws.String(fieldExpires),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":one":     {N: aws.String("1")},
+				":expires": {N: aws.String(strconv.FormatInt(windowStart.Add(window).Unix(), 10))},
+			},
+			ReturnValues: aws.String(dynamodb.ReturnValueUpdatedNew),
+		})
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+		count, err := strconv.Atoi(aws.StringValue(res.Attributes[fieldCount].N))
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+		return count <= limit, nil
+	}
+}
+
+func rateLimitKey(key string, windowStart time.Time) string {
+	return key + "#" + strconv.FormatInt(windowStart.Unix(), 10)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/pkg/errors"
+
+	"github.com/jonsabados/sabadoscodes.com/cors"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/httputil"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/mail"
+	"github.com/jonsabados/sabadoscodes.com/response"
+	"github.com/jonsabados/sabadoscodes.com/s3"
+	"github.com/jonsabados/sabadoscodes.com/subscription"
+)
+
+const confirmTemplate = "subscription-confirm"
+
+type inboundRequest struct {
+	Email string `json:"email"`
+}
+
+// confirmData is what the subscription-confirm mail template is rendered with
+type confirmData struct {
+	ConfirmURL string
+	SiteURL    string
+}
+
+func newHandler(prepLogs logging.Preparer,
+	corsHeaders cors.ResponseHeaderBuilder,
+	limitByIP subscription.RateLimiter,
+	limitByEmail subscription.RateLimiter,
+	fetchSubscriber subscription.Fetcher,
+	savePending subscription.PendingSaver,
+	sendEmail mail.TemplatedSender,
+	signingKey []byte,
+	apiURL string,
+	siteURL string,
+	mailFrom string) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		ctx, logger := prepLogs(ctx)
+		responseHeaders := corsHeaders(request.Headers)
+		now := time.Now()
+
+		sourceIP := request.RequestContext.Identity.SourceIP
+		allowed, err := limitByIP(ctx, "ip#"+sourceIP, now)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		if !allowed {
+			logger.Warn().Str("sourceIp", sourceIP).Msg("subscribe rate limit hit for ip")
+			return response.HandleTooManyRequests(ctx, responseHeaders, "too many requests, try again later"), nil
+		}
+
+		errors := httputil.ErrorTracker{}
+		subscribeRequest := new(inboundRequest)
+		err = json.Unmarshal([]byte(request.Body), subscribeRequest)
+		if err != nil {
+			logger.Info().Err(err).Msg("unable to unmarshal request body")
+			errors = errors.WithError("invalid request body")
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+		email, err := subscription.NormalizeEmail(subscribeRequest.Email)
+		if err != nil {
+			errors = errors.WithFieldError("email", "a valid email address is required")
+			return errors.ToAPIResponse(ctx, responseHeaders), nil
+		}
+
+		// keeps the endpoint from being used to flood someone's inbox with confirmation requests
+		allowed, err = limitByEmail(ctx, "email#"+email, now)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		if !allowed {
+			logger.Warn().Str("sourceIp", sourceIP).Msg("subscribe rate limit hit for email")
+			return response.HandleTooManyRequests(ctx, responseHeaders, "too many requests, try again later"), nil
+		}
+
+		accepted := events.APIGatewayProxyResponse{
+			StatusCode: http.StatusAccepted,
+			Headers:    responseHeaders,
+		}
+
+		existing, err := fetchSubscriber(ctx, email)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		// the response is the same either way, so the endpoint can't be used to find out who is subscribed
+		if existing != nil && existing.Status == subscription.StatusConfirmed {
+			logger.Info().Msg("subscribe requested for already confirmed subscriber")
+			return accepted, nil
+		}
+
+		err = savePending(ctx, email, sourceIP, now)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		token, err := subscription.SignToken(signingKey, email, subscription.PurposeConfirm, now.Add(subscription.ConfirmTokenLifetime))
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		err = sendEmail(ctx, mailFrom, email, confirmTemplate, mail.DefaultLocale, confirmData{
+			ConfirmURL: subscription.ConfirmURL(apiURL, token),
+			SiteURL:    siteURL,
+		})
+		// an address that bounced or complained gets the same response as any other, it just doesn't get mail
+		if isSuppressed(err) {
+			logger.Warn().Msg("subscribe requested for suppressed address")
+			return accepted, nil
+		}
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+
+		return accepted, nil
+	}
+}
+
+func isSuppressed(err error) bool {
+	return errors.Cause(err) == mail.ErrSuppressed
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	allowedDomains := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
+	subscriberTable := os.Getenv("SUBSCRIBER_TABLE")
+	rateLimitTable := os.Getenv("RATE_LIMIT_TABLE")
+	ipLimit, err := strconv.Atoi(os.Getenv("IP_LIMIT_PER_HOUR"))
+	if err != nil {
+		panic(err)
+	}
+	emailLimit, err := strconv.Atoi(os.Getenv("EMAIL_LIMIT_PER_DAY"))
+	if err != nil {
+		panic(err)
+	}
+
+	dynamoClient := dynamo.RawClient(sess)
+	s3Client := s3.RawClient(sess)
+	templateSource := mail.NewTemplateSource(os.Getenv("TEMPLATE_BUCKET"), s3.NewObjectDescriber(s3Client), s3.NewObjectFetcher(s3Client))
+	sendMessage := mail.NewSuppressingMessageSender(mail.NewSuppressionChecker(dynamoClient, os.Getenv("SUPPRESSION_TABLE")), mail.NewMessageSender(mail.NewRawClient(sess)))
+	sendEmail := mail.NewTemplatedSender(mail.NewTemplateRenderer(templateSource), mail.NewSender(sendMessage))
+
+	signingKey, err := subscription.SigningKey(os.Getenv("SUBSCRIPTION_SIGNING_KEY"))
+	if err != nil {
+		panic(err)
+	}
+
+	handler := newHandler(logging.NewPreparer(),
+		cors.NewResponseHeaderBuilder(allowedDomains),
+		subscription.NewRateLimiter(dynamoClient, rateLimitTable, ipLimit, time.Hour),
+		subscription.NewRateLimiter(dynamoClient, rateLimitTable, emailLimit, 24*time.Hour),
+		subscription.NewFetcher(dynamoClient, subscriberTable),
+		subscription.NewPendingSaver(dynamoClient, subscriberTable),
+		sendEmail,
+		signingKey,
+		os.Getenv("API_URL"),
+		os.Getenv("SITE_URL"),
+		os.Getenv("MAIL_FROM"))
+
+	lambda.Start(handler)
+}
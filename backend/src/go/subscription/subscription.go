@@ -0,0 +1,258 @@
+package subscription
+
+import (
+	"context"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+)
+
+const (
+	fieldEmail    = "Email"
+	fieldStatus   = "Status"
+	fieldSourceIP = "SourceIP"
+	fieldCreated  = "Created"
+	fieldUpdated  = "Updated"
+	fieldExpires  = "Expires"
+)
+
+// PendingRetention is how long subscribers have to confirm before they are forgotten, through the table's ttl
+const PendingRetention = 7 * 24 * time.Hour
+
+type Status string
+
+const (
+	StatusPending      = Status("pending")
+	StatusConfirmed    = Status("confirmed")
+	StatusUnsubscribed = Status("unsubscribed")
+)
+
+// Subscriber is someone who has asked for mail about new posts. SourceIP is where the subscription was asked for from,
+// kept as a record of consent.
+type Subscriber struct {
+	Email    string
+	Status   Status
+	SourceIP string
+	Created  time.Time
+	Updated  time.Time
+}
+
+// ErrInvalidEmail is given by NormalizeEmail for anything that isn't a bare email address
+var ErrInvalidEmail = errors.New("invalid email address")
+
+// NormalizeEmail checks that address is a bare email address (no display name) and lower cases it, so the same
+// subscriber can't be stored twice under different capitalization
+func NormalizeEmail(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Address != address || len(address) > 254 {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(address), nil
+}
+
+type Fetcher func(ctx context.Context, email string) (*Subscriber, error)
+
+func NewFetcher(db *dynamodb.DynamoDB, subscriberTable string) Fetcher {
+	return func(ctx context.Context, email string) (*Subscriber, error) {
+		res, err := db.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+			TableName: aws.String(subscriberTable),
+			Key: map[string]*dynamodb.AttributeValue{
+				fieldEmail: {S: aws.String(email)},
+			},
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if res.Item == nil {
+			return nil, nil
+		}
+		ret, err := toSubscriber(res.Item)
+		if err != nil {
+			return nil, err
+		}
+		return &ret, nil
+	}
+}
+
+// PendingSaver records a subscriber waiting on confirmation. Subscribers who are already confirmed are left alone,
+// anyone else (including those who unsubscribed before) starts over as pending.
+type PendingSaver func(ctx context.Context, email, sourceIP string, now time.Time) error
+
+func NewPendingSaver(db *dynamodb.DynamoDB, subscriberTable string) PendingSaver {
+	return func(ctx context.Context, email, sourceIP string, now time.Time) error {
+		_, err := db.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(subscriberTable),
+			Item: map[string]*dynamodb.AttributeValue{
+				fieldEmail:    {S: aws.String(email)},
+				fieldStatus:   {S: aws.String(string(StatusPending))},
+				fieldSourceIP: {S: aws.String(sourceIP)},
+				fieldCreated:  {N: aws.String(strconv.FormatInt(now.UnixNano(), 10))},
+				fieldUpdated:  {N: aws.String(strconv.FormatInt(now.UnixNano(), 10))},
+				fieldExpires:  {N: aws.String(strconv.FormatInt(now.Add(PendingRetention).Unix(), 10))},
+			},
+			ConditionExpression: aws.String("attribute_not_exists(#email) OR #status <> :confirmed"),
+			ExpressionAttributeNames: map[string]*string{
+				"#email":  aws.String(fieldEmail),
+				"#status": aws.String(fieldStatus),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":confirmed": {S: aws.String(string(StatusConfirmed))},
+			},
+		})
+		if isConditionFailure(err) {
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+}
+
+// Confirmer marks a pending subscriber as confirmed, giving false if there is no such subscriber or they have since
+// unsubscribed. Confirming an already confirmed subscriber is fine.
+type Confirmer func(ctx context.Context, email string, now time.Time) (bool, error)
+
+func NewConfirmer(db *dynamodb.DynamoDB, subscriberTable string) Confirmer {
+	return func(ctx context.Context, email string, now time.Time) (bool, error) {
+		_, err := db.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+			TableName: aws.String(subscriberTable),
+			Key: map[string]*dynamodb.AttributeValue{
+				fieldEmail: {S: aws.String(email)},
+			},
+			// confirmed subscribers are kept until they unsubscribe
+			UpdateExpression:    aws.String("SET #status = :confirmed, #updated = :updated REMOVE #expires"),
+			ConditionExpression: aws.String("#status IN (:pending, :confirmed)"),
+			ExpressionAttributeNames: map[string]*string{
+				"#status":  aws.String(fieldStatus),
+				"#updated": aws.String(fieldUpdated),
+				"#expires": aws.String(fieldExpires),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":pending":   {S: aws.String(string(StatusPending))},
+				":confirmed": {S: aws.String(string(StatusConfirmed))},
+				":updated":   {N: aws.String(strconv.FormatInt(now.UnixNano(), 10))},
+			},
+		})
+		if isConditionFailure(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+		return true, nil
+	}
+}
+
+// Unsubscriber stops mail going to a subscriber. Unsubscribing someone who isn't subscribed does nothing.
+type Unsubscriber func(ctx context.Context, email string, now time.Time) error
+
+func NewUnsubscriber(db *dynamodb.DynamoDB, subscriberTable string) Unsubscriber {
+	return func(ctx context.Context, email string, now time.Time) error {
+		_, err := db.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+			TableName: aws.String(subscriberTable),
+			Key: map[string]*dynamodb.AttributeValue{
+				fieldEmail: {S: aws.String(email)},
+			},
+			// the record is kept, without expiring, as a record of the request
+			UpdateExpression:    aws.String("SET #status = :unsubscribed, #updated = :updated REMOVE #expires"),
+			ConditionExpression: aws.String("attribute_exists(#email)"),
+			ExpressionAttributeNames: map[string]*string{
+				"#email":   aws.String(fieldEmail),
+				"#status":  aws.String(fieldStatus),
+				"#updated": aws.String(fieldUpdated),
+				"#expires": aws.String(fieldExpires),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":unsubscribed": {S: aws.String(string(StatusUnsubscribed))},
+				":updated":      {N: aws.String(strconv.FormatInt(now.UnixNano(), 10))},
+			},
+		})
+		if isConditionFailure(err) {
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+}
+
+// ConfirmedLister gives every confirmed subscriber
+type ConfirmedLister func(ctx context.Context) ([]Subscriber, error)
+
+func NewConfirmedLister(db *dynamodb.DynamoDB, subscriberTable string) ConfirmedLister {
+	return func(ctx context.Context) ([]Subscriber, error) {
+		ret := make([]Subscriber, 0)
+		var pageErr error
+		err := db.ScanPagesWithContext(ctx, &dynamodb.ScanInput{
+			TableName:        aws.String(subscriberTable),
+			FilterExpression: aws.String("#status = :confirmed"),
+			ExpressionAttributeNames: map[string]*string{
+				"#status": aws.String(fieldStatus),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":confirmed": {S: aws.String(string(StatusConfirmed))},
+			},
+		}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+			for _, item := range page.Items {
+				s, err := toSubscriber(item)
+				if err != nil {
+					pageErr = err
+					return false
+				}
+				ret = append(ret, s)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if pageErr != nil {
+			return nil, pageErr
+		}
+		return ret, nil
+	}
+}
+
+func toSubscriber(item map[string]*dynamodb.AttributeValue) (Subscriber, error) {
+	email := aws.StringValue(item[fieldEmail].S)
+	created, err := nanoTime(item, fieldCreated)
+	if err != nil {
+		return Subscriber{}, errors.Wrapf(err, "subscriber %s", email)
+	}
+	updated, err := nanoTime(item, fieldUpdated)
+	if err != nil {
+		return Subscriber{}, errors.Wrapf(err, "subscriber %s", email)
+	}
+	ret := Subscriber{
+		Email:   email,
+		Created: created,
+		Updated: updated,
+	}
+	if item[fieldStatus] != nil {
+		ret.Status = Status(aws.StringValue(item[fieldStatus].S))
+	}
+	if item[fieldSourceIP] != nil {
+		ret.SourceIP = aws.StringValue(item[fieldSourceIP].S)
+	}
+	return ret, nil
+}
+
+func nanoTime(item map[string]*dynamodb.AttributeValue, field string) (time.Time, error) {
+	if item[field] == nil {
+		return time.Time{}, nil
+	}
+	nanos, err := strconv.ParseInt(aws.StringValue(item[field].N), 10, 64)
+	if err != nil {
+		return time.Time{}, errors.Errorf("invalid %s time %s", field, aws.StringValue(item[field].N))
+	}
+	return time.Unix(0, nanos).UTC(), nil
+}
+
+func isConditionFailure(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
@@ -0,0 +1,63 @@
+package subscription
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	testCases := []struct {
+		input       string
+		expected    string
+		expectedErr error
+	}{
+		{"bob@example.com", "bob@example.com", nil},
+		{"  Bob@Example.COM ", "bob@example.com", nil},
+		{"", "", ErrInvalidEmail},
+		{"bob", "", ErrInvalidEmail},
+		{"Bob <bob@example.com>", "", ErrInvalidEmail},
+		{"bob@example.com, alice@example.com", "", ErrInvalidEmail},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			res, err := NormalizeEmail(tc.input)
+			assert.Equal(t, tc.expectedErr, err)
+			assert.Equal(t, tc.expected, res)
+		})
+	}
+}
+
+func Test_toSubscriber(t *testing.T) {
+	asserter := assert.New(t)
+
+	res, err := toSubscriber(map[string]*dynamodb.AttributeValue{
+		fieldEmail:    {S: aws.String("bob@example.com")},
+		fieldStatus:   {S: aws.String("confirmed")},
+		fieldSourceIP: {S: aws.String("127.0.0.1")},
+		fieldCreated:  {N: aws.String("1615181400000000000")},
+		fieldUpdated:  {N: aws.String("1615181500000000000")},
+	})
+	asserter.NoError(err)
+	asserter.Equal(Subscriber{
+		Email:    "bob@example.com",
+		Status:   StatusConfirmed,
+		SourceIP: "127.0.0.1",
+		Created:  time.Date(2021, 3, 8, 5, 30, 0, 0, time.UTC),
+		Updated:  time.Date(2021, 3, 8, 5, 31, 40, 0, time.UTC),
+	}, res)
+
+	_, err = toSubscriber(map[string]*dynamodb.AttributeValue{
+		fieldEmail:   {S: aws.String("bob@example.com")},
+		fieldCreated: {N: aws.String("yesterday")},
+	})
+	asserter.EqualError(err, "subscriber bob@example.com: invalid Created time yesterday")
+}
+
+func Test_rateLimitKey(t *testing.T) {
+	windowStart := time.Unix(1615181400, 0).Truncate(time.Hour)
+	assert.Equal(t, "ip#127.0.0.1#1615179600", rateLimitKey("ip#127.0.0.1", windowStart))
+}
@@ -0,0 +1,79 @@
+package subscription
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignToken_RoundTrip(t *testing.T) {
+	asserter := assert.New(t)
+
+	now := time.Unix(1615181400, 0)
+	key := []byte("super secret")
+
+	token, err := SignToken(key, "bob@example.com", PurposeConfirm, now.Add(time.Hour))
+	asserter.NoError(err)
+	email, err := VerifyToken(key, token, PurposeConfirm, now)
+	asserter.NoError(err)
+	asserter.Equal("bob@example.com", email)
+
+	// unsubscribe tokens go out without an expiration
+	token, err = SignToken(key, "bob@example.com", PurposeUnsubscribe, time.Time{})
+	asserter.NoError(err)
+	email, err = VerifyToken(key, token, PurposeUnsubscribe, now.Add(10*365*24*time.Hour))
+	asserter.NoError(err)
+	asserter.Equal("bob@example.com", email)
+}
+
+func TestVerifyToken_Invalid(t *testing.T) {
+	now := time.Unix(1615181400, 0)
+	key := []byte("super secret")
+
+	confirmToken, err := SignToken(key, "bob@example.com", PurposeConfirm, now.Add(time.Hour))
+	assert.NoError(t, err)
+	expiredToken, err := SignToken(key, "bob@example.com", PurposeConfirm, now.Add(-time.Second))
+	assert.NoError(t, err)
+	otherKeyToken, err := SignToken([]byte("other secret"), "bob@example.com", PurposeConfirm, now.Add(time.Hour))
+	assert.NoError(t, err)
+	parts := strings.Split(confirmToken, ".")
+	otherToken, err := SignToken(key, "alice@example.com", PurposeConfirm, now.Add(time.Hour))
+	assert.NoError(t, err)
+	tampered := strings.Split(otherToken, ".")[0] + "." + parts[1]
+
+	testCases := []struct {
+		desc    string
+		token   string
+		purpose Purpose
+	}{
+		{"blank", "", PurposeConfirm},
+		{"garbage", "not.a.token", PurposeConfirm},
+		{"bad signature encoding", parts[0] + ".!!!", PurposeConfirm},
+		{"expired", expiredToken, PurposeConfirm},
+		{"wrong purpose", confirmToken, PurposeUnsubscribe},
+		{"wrong key", otherKeyToken, PurposeConfirm},
+		{"tampered", tampered, PurposeConfirm},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := VerifyToken(key, tc.token, tc.purpose, now)
+			assert.Equal(t, ErrInvalidToken, err)
+		})
+	}
+}
+
+func TestSigningKey(t *testing.T) {
+	asserter := assert.New(t)
+
+	key, err := SigningKey("0123456789abcdef0123456789abcdef")
+	asserter.NoError(err)
+	asserter.Equal([]byte("0123456789abcdef0123456789abcdef"), key)
+
+	_, err = SigningKey("")
+	asserter.EqualError(err, "subscription signing key must be at least 32 bytes, got 0")
+
+	_, err = SigningKey("too short")
+	asserter.Error(err)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-xray-sdk-go/xray"
+
+	"github.com/jonsabados/sabadoscodes.com/cors"
+	"github.com/jonsabados/sabadoscodes.com/dynamo"
+	"github.com/jonsabados/sabadoscodes.com/logging"
+	"github.com/jonsabados/sabadoscodes.com/response"
+	"github.com/jonsabados/sabadoscodes.com/subscription"
+)
+
+// newHandler creates the handler for unsubscribe links. A GET is someone following the link in a mail, and is sent on
+// to the site with the outcome in the subscription query parameter. A POST is a mail client's one click unsubscribe
+// (RFC 8058), which only needs a status.
+func newHandler(prepLogs logging.Preparer,
+	corsHeaders cors.ResponseHeaderBuilder,
+	signingKey []byte,
+	unsubscribe subscription.Unsubscriber,
+	siteURL string) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		ctx, logger := prepLogs(ctx)
+		responseHeaders := corsHeaders(request.Headers)
+		now := time.Now()
+		oneClick := request.HTTPMethod == http.MethodPost
+
+		email, err := subscription.VerifyToken(signingKey, request.QueryStringParameters["token"], subscription.PurposeUnsubscribe, now)
+		if err != nil {
+			logger.Info().Err(err).Bool("oneClick", oneClick).Msg("unsubscribe with invalid token")
+			if oneClick {
+				return response.HandleNtFound(ctx, responseHeaders), nil
+			}
+			return redirect(responseHeaders, siteURL, "invalid"), nil
+		}
+
+		err = unsubscribe(ctx, email, now)
+		if err != nil {
+			return response.HandleError(ctx, responseHeaders, err), nil
+		}
+		logger.Info().Bool("oneClick", oneClick).Msg("unsubscribed")
+
+		if oneClick {
+			return events.APIGatewayProxyResponse{
+				StatusCode: http.StatusOK,
+				Headers:    responseHeaders,
+			}, nil
+		}
+		return redirect(responseHeaders, siteURL, "unsubscribed"), nil
+	}
+}
+
+func redirect(responseHeaders map[string]string, siteURL, outcome string) events.APIGatewayProxyResponse {
+	responseHeaders["location"] = strings.TrimSuffix(siteURL, "/") + "/?subscription=" + outcome
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusFound,
+		Headers:    responseHeaders,
+	}
+}
+
+func main() {
+	err := xray.Configure(xray.Config{
+		LogLevel: "warn",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	allowedDomains := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
+
+	dynamoClient := dynamo.RawClient(sess)
+
+	signingKey, err := subscription.SigningKey(os.Getenv("SUBSCRIPTION_SIGNING_KEY"))
+	if err != nil {
+		panic(err)
+	}
+
+	handler := newHandler(logging.NewPreparer(),
+		cors.NewResponseHeaderBuilder(allowedDomains),
+		signingKey,
+		subscription.NewUnsubscriber(dynamoClient, os.Getenv("SUBSCRIBER_TABLE")),
+		os.Getenv("SITE_URL"))
+
+	lambda.Start(handler)
+}
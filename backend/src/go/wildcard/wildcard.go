@@ -0,0 +1,23 @@
+package wildcard
+
+import "strings"
+
+// Match matches value against a pattern where * matches any sequence of characters, everything else must match exactly
+func Match(pattern string, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	for _, p := range parts[1 : len(parts)-1] {
+		idx := strings.Index(value, p)
+		if idx < 0 {
+			return false
+		}
+		value = value[idx+len(p):]
+	}
+	return strings.HasSuffix(value, parts[len(parts)-1])
+}
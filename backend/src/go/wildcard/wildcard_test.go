@@ -0,0 +1,34 @@
+package wildcard
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		value    string
+		expected bool
+	}{
+		{"article", "article", true},
+		{"article", "articles", false},
+		{"article/slug/*", "article/slug/foo", true},
+		{"article/slug/*", "article/slug/foo/bar", true},
+		{"article/slug/*", "article/asset", false},
+		{"*", "anything/at/all", true},
+		{"article/*/edit", "article/foo/edit", true},
+		{"article/*/edit", "article/foo/view", false},
+		{"a*b*c", "abc", true},
+		{"a*b*c", "acb", false},
+		{"*@example.com", "bob@example.com", true},
+		{"*@example.com", "bob@example.com.evil", false},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s %s", tc.pattern, tc.value), func(t *testing.T) {
+			assert.Equal(t, tc.expected, Match(tc.pattern, tc.value))
+		})
+	}
+}
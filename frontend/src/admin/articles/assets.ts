@@ -1,27 +1,66 @@
 import { apiBase } from '@/api/api'
 import axios from 'axios'
 
-export interface AssetListDto {
+export interface AssetMetadata {
+  altText?: string
+  caption?: string
+  credit?: string
+  licence?: string
+}
+
+export interface AssetListDto extends AssetMetadata {
   path: string
   size: number
   url: string
+  mimeType?: string
+  modified: string
+  contentAddressed?: boolean
+  width?: number
+  height?: number
+  uploaded?: {
+    userId: string
+    name: string
+    time: string
+  }
+  scan?: {
+    verdict: string
+    scanner: string
+    time: string
+  }
 }
 
 export async function listAssets(authToken: string): Promise<Array<AssetListDto>> {
   const endpoint = `${apiBase()}/article/asset`
-  const res = await axios.get(endpoint, {
+  const ret: Array<AssetListDto> = []
+  let cursor: string | undefined
+  do {
+    const res = await axios.get(endpoint, {
+      headers: {
+        'Authorization': authToken
+      },
+      params: cursor ? { cursor: cursor } : {}
+    })
+    ret.push(...res.data.results)
+    cursor = res.data.nextCursor
+  } while (cursor)
+  return ret
+}
+
+export async function updateAssetMetadata(authToken: string, path: string, metadata: AssetMetadata): Promise<AssetMetadata> {
+  const endpoint = `${apiBase()}/article/asset/object/${path.split('/').map(encodeURIComponent).join('/')}`
+  const res = await axios.patch(endpoint, JSON.stringify(metadata), {
     headers: {
       'Authorization': authToken
     }
   })
-  return res.data.results
+  return res.data
 }
 
 export type progressHandler = (progressEvent: ProgressEvent) => void
 
 export type uploadCompleteCallback = (location: string) => void
 
-export function uploadAsset(authToken: string, file: File, path: string, onComplete: uploadCompleteCallback, handleProgress?: progressHandler) : void {
+export function uploadAsset(authToken: string, file: File, path: string, onComplete: uploadCompleteCallback, handleProgress?: progressHandler, overwrite: boolean = false) : void {
   const endpoint = `${apiBase()}/article/asset`
   const reader = new FileReader()
 
@@ -30,7 +69,8 @@ export function uploadAsset(authToken: string, file: File, path: string, onCompl
     const payload = {
       content: content,
       mimeType: file.type,
-      path: path
+      path: path,
+      overwrite: overwrite
     }
     const res = await axios.post(endpoint, JSON.stringify(payload), {
       headers: {
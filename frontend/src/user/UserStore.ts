@@ -1,6 +1,8 @@
 import { Action, Module, Mutation, VuexModule } from 'vuex-module-decorators'
+import { AppStore } from '@/app/AppStore'
 import { currentUser, GoogleUser, isSignedIn, listenForUser } from '@/user/google'
 import { fetchSelf as apiFetchSelf, Self } from '@/user/self'
+import { endSession as apiEndSession, refreshSession as apiRefreshSession, SessionTokens, startSession as apiStartSession } from '@/user/session'
 
 export interface UserState {
   isReady: boolean
@@ -8,11 +10,20 @@ export interface UserState {
   idToken: string | null
 }
 
+// session tokens are refreshed a minute before they expire so requests never go out with a stale one
+const refreshLeadTime = 60 * 1000
+
+let refreshTimer: ReturnType<typeof setTimeout> | null = null
+
 @Module
 export class UserStore extends VuexModule<UserState> {
   static ACTION_INITIALIZE = 'initialize'
   static ACTION_FETCH_SELF = 'fetchSelf'
-  static MUTATION_SET_GOOGLE_USER = 'setGoogleUser'
+  static ACTION_GOOGLE_USER_CHANGED = 'googleUserChanged'
+  static ACTION_USE_SESSION = 'useSession'
+  static ACTION_REFRESH_SESSION = 'refreshSession'
+  static ACTION_END_SESSION = 'endSession'
+  static MUTATION_SET_SESSION = 'setSession'
   static MUTATION_SET_SELF = 'setSelf'
   static MUTATION_MARK_READY = 'markReady'
 
@@ -22,6 +33,9 @@ export class UserStore extends VuexModule<UserState> {
 
   authToken: string = 'anonymous'
 
+  // kept in memory only, a reload signs in with google again and starts a fresh session
+  refreshToken: string | null = null
+
   self: Self | null = null
 
   @Mutation
@@ -30,13 +44,15 @@ export class UserStore extends VuexModule<UserState> {
   }
 
   @Mutation
-  setGoogleUser(user: GoogleUser) {
-    if (user.isSignedIn()) {
+  setSession(tokens: SessionTokens | null) {
+    if (tokens) {
       this.signedIn = true
-      this.authToken = `Bearer ${user.getAuthResponse().id_token}`
+      this.authToken = `Bearer ${tokens.sessionToken}`
+      this.refreshToken = tokens.refreshToken
     } else {
       this.signedIn = false
       this.authToken = 'anonymous'
+      this.refreshToken = null
     }
   }
 
@@ -49,15 +65,81 @@ export class UserStore extends VuexModule<UserState> {
   async initialize() {
     // missing await is very intentional, don't wanna block
     listenForUser((user) => {
-      this.context.commit(UserStore.MUTATION_SET_GOOGLE_USER, user)
-      this.context.dispatch(UserStore.ACTION_FETCH_SELF)
+      this.context.dispatch(UserStore.ACTION_GOOGLE_USER_CHANGED, user)
     })
     const loggedIn = await isSignedIn()
     this.context.commit(UserStore.MUTATION_MARK_READY)
     if (loggedIn) {
       const user = await currentUser()
-      this.context.commit(UserStore.MUTATION_SET_GOOGLE_USER, user)
-      this.context.dispatch(UserStore.ACTION_FETCH_SELF)
+      this.context.dispatch(UserStore.ACTION_GOOGLE_USER_CHANGED, user)
+    }
+  }
+
+  @Action
+  async googleUserChanged(user: GoogleUser) {
+    if (!user.isSignedIn()) {
+      await this.context.dispatch(UserStore.ACTION_END_SESSION)
+      return
+    }
+    // google hands out new ID tokens as its own expire, those don't need a new session
+    if (this.refreshToken) {
+      return
+    }
+    // google's ID token is only used to start a session, everything after that uses the session token
+    try {
+      const tokens = await apiStartSession(user.getAuthResponse().id_token)
+      await this.context.dispatch(UserStore.ACTION_USE_SESSION, tokens)
+    } catch (e) {
+      await this.context.dispatch(AppStore.ACTION_REGISTER_REMOTE_ERROR, e)
+    }
+  }
+
+  @Action
+  async useSession(tokens: SessionTokens) {
+    this.context.commit(UserStore.MUTATION_SET_SESSION, tokens)
+    if (refreshTimer) {
+      clearTimeout(refreshTimer)
+    }
+    const refreshIn = Math.max(new Date(tokens.sessionTokenExpires).getTime() - Date.now() - refreshLeadTime, 0)
+    refreshTimer = setTimeout(() => {
+      this.context.dispatch(UserStore.ACTION_REFRESH_SESSION)
+    }, refreshIn)
+    // roles can change when a session is refreshed
+    await this.context.dispatch(UserStore.ACTION_FETCH_SELF)
+  }
+
+  @Action
+  async refreshSession() {
+    if (!this.refreshToken) {
+      return
+    }
+    try {
+      const tokens = await apiRefreshSession(this.refreshToken)
+      await this.context.dispatch(UserStore.ACTION_USE_SESSION, tokens)
+    } catch (e) {
+      // the session is gone (revoked, or expired while the tab slept) so there is nothing left to refresh
+      this.context.commit(UserStore.MUTATION_SET_SESSION, null)
+      this.context.commit(UserStore.MUTATION_SET_SELF, null)
+      await this.context.dispatch(AppStore.ACTION_REGISTER_REMOTE_ERROR, e)
+    }
+  }
+
+  @Action
+  async endSession() {
+    if (refreshTimer) {
+      clearTimeout(refreshTimer)
+      refreshTimer = null
+    }
+    const authToken = this.authToken
+    this.context.commit(UserStore.MUTATION_SET_SESSION, null)
+    this.context.commit(UserStore.MUTATION_SET_SELF, null)
+    if (authToken === 'anonymous') {
+      return
+    }
+    try {
+      await apiEndSession(authToken)
+    } catch (e) {
+      await this.context.dispatch(AppStore.ACTION_REGISTER_REMOTE_ERROR, e)
     }
   }
 
@@ -0,0 +1,42 @@
+import { apiBase } from '@/api/api'
+import axios from 'axios'
+
+export interface SessionTokens {
+  sessionToken: string
+  sessionTokenExpires: string
+  refreshToken: string
+  refreshTokenExpires: string
+}
+
+export async function startSession(idToken: string):Promise<SessionTokens> {
+  const endpoint = `${apiBase()}/session`
+  const res = await axios.post<SessionTokens>(endpoint, {
+    idToken: idToken
+  }, {
+    headers: {
+      'Authorization': 'anonymous'
+    }
+  })
+  return res.data
+}
+
+export async function refreshSession(refreshToken: string):Promise<SessionTokens> {
+  const endpoint = `${apiBase()}/session/refresh`
+  const res = await axios.post<SessionTokens>(endpoint, {
+    refreshToken: refreshToken
+  }, {
+    headers: {
+      'Authorization': 'anonymous'
+    }
+  })
+  return res.data
+}
+
+export async function endSession(authToken: string):Promise<void> {
+  const endpoint = `${apiBase()}/session`
+  await axios.delete(endpoint, {
+    headers: {
+      'Authorization': authToken
+    }
+  })
+}
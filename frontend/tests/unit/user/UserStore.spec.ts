@@ -0,0 +1,70 @@
+import MockStoreContext, { ActionType } from '../MockStoreContext'
+import { UserStore } from '@/user/UserStore'
+import { endSession, startSession } from '@/user/session'
+
+jest.mock('@/user/session')
+
+const startSessionMock = startSession as unknown as jest.Mock
+const endSessionMock = endSession as unknown as jest.Mock
+
+function googleUser(signedIn: boolean) {
+  return {
+    isSignedIn: () => signedIn,
+    getAuthResponse: () => ({
+      id_token: 'google-id-token'
+    })
+  }
+}
+
+describe('UserStore', () => {
+  beforeEach(() => {
+    startSessionMock.mockReset()
+    endSessionMock.mockReset()
+  })
+
+  describe('googleUserChanged', () => {
+    it('exchanges the google ID token for a session', async() => {
+      const mockContext = new MockStoreContext()
+
+      const testInstance = new UserStore({})
+      mockContext.attachToComponent(testInstance)
+
+      const tokens = {
+        sessionToken: 'session-token',
+        sessionTokenExpires: '2021-03-08T05:45:00Z',
+        refreshToken: 'refresh-token',
+        refreshTokenExpires: '2021-04-07T05:30:00Z'
+      }
+      startSessionMock.mockResolvedValue(tokens)
+
+      await testInstance.googleUserChanged(googleUser(true))
+
+      expect(startSessionMock).toHaveBeenCalledWith('google-id-token')
+      expect(mockContext.actionsSent).toEqual([
+        {
+          type: ActionType.Dispatch,
+          name: 'useSession',
+          payload: tokens
+        }
+      ])
+    })
+
+    it('ends the session when signed out of google', async() => {
+      const mockContext = new MockStoreContext()
+
+      const testInstance = new UserStore({})
+      mockContext.attachToComponent(testInstance)
+
+      await testInstance.googleUserChanged(googleUser(false))
+
+      expect(startSessionMock).not.toHaveBeenCalled()
+      expect(mockContext.actionsSent).toEqual([
+        {
+          type: ActionType.Dispatch,
+          name: 'endSession',
+          payload: undefined
+        }
+      ])
+    })
+  })
+})
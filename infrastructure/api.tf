@@ -40,7 +40,27 @@ resource "aws_api_gateway_deployment" "main" {
     aws_api_gateway_integration.article_asset_upload,
     aws_api_gateway_integration.article_list,
     aws_api_gateway_integration.article_save,
-    aws_api_gateway_integration.article_get
+    aws_api_gateway_integration.article_get,
+    aws_api_gateway_integration.session_create,
+    aws_api_gateway_integration.session_refresh,
+    aws_api_gateway_integration.session_logout,
+    aws_api_gateway_integration.audit_query,
+    aws_api_gateway_integration.article_asset_presign,
+    aws_api_gateway_integration.article_asset_complete,
+    aws_api_gateway_integration.article_asset_delete,
+    aws_api_gateway_integration.article_asset_move,
+    aws_api_gateway_integration.article_asset_metadata,
+    aws_api_gateway_integration.article_asset_versions,
+    aws_api_gateway_integration.article_asset_restore,
+    aws_api_gateway_integration.mail_archive_search,
+    aws_api_gateway_integration.mail_archive_download,
+    aws_api_gateway_integration.mail_template_preview,
+    aws_api_gateway_integration.subscription_subscribe,
+    aws_api_gateway_integration.subscription_confirm,
+    aws_api_gateway_integration.subscription_unsubscribe,
+    aws_api_gateway_integration.subscription_unsubscribe_one_click,
+    aws_api_gateway_integration.mail_suppression_list,
+    aws_api_gateway_integration.mail_suppression_remove
   ]
   rest_api_id = aws_api_gateway_rest_api.api.id
   stage_name  = "${local.workspace_prefix}main"
@@ -56,6 +56,59 @@ data "aws_iam_policy_document" "article_save_access_policy" {
       "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.article_store.name}"
     ]
   }
+
+  statement {
+    sid       = "AllowAuditLogAppend"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:PutItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.audit_log.name}"
+    ]
+  }
+
+  statement {
+    sid       = "AllowAssetBucketList"
+    effect    = "Allow"
+    actions   = [
+      "s3:ListBucket"
+    ]
+    resources = [aws_s3_bucket.article_assets_bucket.arn]
+  }
+
+  statement {
+    sid       = "AllowAssetBucketRead"
+    effect    = "Allow"
+    actions   = [
+      "s3:GetObject"
+    ]
+    resources = ["${aws_s3_bucket.article_assets_bucket.arn}/article-assets/*"]
+  }
+
+  statement {
+    sid       = "AllowReferenceIndexUpdate"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:Query",
+      "dynamodb:BatchWriteItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.article_asset_references.name}",
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.article_asset_references.name}/index/*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowPublishedQueueSend"
+    effect    = "Allow"
+    actions   = [
+      "sqs:SendMessage"
+    ]
+    resources = [aws_sqs_queue.article_published.arn]
+  }
 }
 
 module "article_save_lambda" {
@@ -64,10 +117,16 @@ module "article_save_lambda" {
   lambda_name      = "articleSave"
   lambda_policy    = data.aws_iam_policy_document.article_save_access_policy.json
   env_variables    = {
-    LOG_LEVEL        = "info"
-    ALLOWED_ORIGINS  = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
-    BASE_ARTICLE_URL = "https://${aws_api_gateway_domain_name.api.domain_name}/article/slug"
-    ARTICLE_TABLE    = aws_dynamodb_table.article_store.name
+    LOG_LEVEL           = "info"
+    ALLOWED_ORIGINS     = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
+    BASE_ARTICLE_URL    = "https://${aws_api_gateway_domain_name.api.domain_name}/article/slug"
+    ARTICLE_TABLE       = aws_dynamodb_table.article_store.name
+    ROUTE_TABLE         = local.route_table
+    AUDIT_TABLE         = aws_dynamodb_table.audit_log.name
+    ASSET_BUCKET        = aws_s3_bucket.article_assets_bucket.bucket
+    BASE_ASSET_URL      = "https://${aws_acm_certificate.ui_cert.domain_name}/article-assets"
+    REFERENCE_TABLE     = aws_dynamodb_table.article_asset_references.name
+    PUBLISHED_QUEUE_URL = aws_sqs_queue.article_published.id
   }
 }
 
@@ -1,3 +1,10 @@
+locals {
+  // mime type=max size pairs for what may be uploaded as an article asset, families like video/* work too
+  allowed_asset_types = "image/svg+xml=1MB,image/png=20MB,image/jpeg=20MB,image/gif=20MB,image/webp=20MB,application/pdf=50MB,video/mp4=100MB,video/webm=100MB"
+  // host:port of a clamd to scan uploads with, uploads go unscanned when blank
+  clamav_address      = ""
+}
+
 resource "aws_api_gateway_resource" "article_asset" {
   parent_id   = aws_api_gateway_resource.article.id
   path_part   = "asset"
@@ -39,6 +46,18 @@ data "aws_iam_policy_document" "article_asset_list_policy" {
     ]
     resources = [aws_s3_bucket.article_assets_bucket.arn]
   }
+
+  statement {
+    sid       = "AllowAssetTableRead"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:Scan",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.article_assets.name}"
+    ]
+  }
 }
 
 module "article_asset_list_lambda" {
@@ -51,6 +70,8 @@ module "article_asset_list_lambda" {
     ALLOWED_ORIGINS = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
     ASSET_BUCKET    = aws_s3_bucket.article_assets_bucket.bucket
     BASE_ASSET_URL  = "https://${aws_acm_certificate.ui_cert.domain_name}/article-assets"
+    ROUTE_TABLE     = local.route_table
+    ASSET_TABLE     = aws_dynamodb_table.article_assets.name
   }
 }
 
@@ -60,6 +81,16 @@ resource "aws_api_gateway_method" "article_asset_list" {
   http_method   = "GET"
   resource_id   = aws_api_gateway_resource.article_asset.id
   rest_api_id   = aws_api_gateway_rest_api.api.id
+
+  request_parameters = {
+    "method.request.querystring.prefix"    = false
+    "method.request.querystring.delimiter" = false
+    "method.request.querystring.mimeType"  = false
+    "method.request.querystring.sort"      = false
+    "method.request.querystring.order"     = false
+    "method.request.querystring.cursor"    = false
+    "method.request.querystring.limit"     = false
+  }
 }
 
 resource "aws_api_gateway_integration" "article_asset_list" {
@@ -107,6 +138,24 @@ data "aws_iam_policy_document" "article_asset_upload_policy" {
     resources = ["*"]
   }
 
+  statement {
+    sid       = "AllowAssetBucketList"
+    effect    = "Allow"
+    actions   = [
+      "s3:ListBucket"
+    ]
+    resources = [aws_s3_bucket.article_assets_bucket.arn]
+  }
+
+  statement {
+    sid       = "AllowAssetRead"
+    effect    = "Allow"
+    actions   = [
+      "s3:GetObject"
+    ]
+    resources = ["${aws_s3_bucket.article_assets_bucket.arn}/article-assets/*"]
+  }
+
   statement {
     sid       = "AllowAssetBucketUpload"
     effect    = "Allow"
@@ -116,6 +165,43 @@ data "aws_iam_policy_document" "article_asset_upload_policy" {
     ]
     resources = ["${aws_s3_bucket.article_assets_bucket.arn}/*"]
   }
+
+  statement {
+    sid       = "AllowQuarantineAccess"
+    effect    = "Allow"
+    actions   = [
+      "s3:GetObject",
+      "s3:PutObject",
+      "s3:PutObjectAcl",
+      "s3:DeleteObject"
+    ]
+    resources = ["${aws_s3_bucket.article_assets_bucket.arn}/quarantine/*"]
+  }
+
+  statement {
+    sid       = "AllowAssetTableUpdate"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:UpdateItem",
+      "dynamodb:GetItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.article_assets.name}"
+    ]
+  }
+
+  statement {
+    sid       = "AllowAuditLogAppend"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:PutItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.audit_log.name}"
+    ]
+  }
 }
 
 module "article_asset_upload_lambda" {
@@ -123,11 +209,19 @@ module "article_asset_upload_lambda" {
   workspace_prefix = local.workspace_prefix
   lambda_name      = "articleAssetUpload"
   lambda_policy    = data.aws_iam_policy_document.article_asset_upload_policy.json
+  // images are held in memory to strip their metadata, rotated photos get decoded to bake in the rotation
+  timeout          = 30
+  memory_size      = 1536
   env_variables    = {
-    LOG_LEVEL       = "info"
-    ALLOWED_ORIGINS = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
-    ASSET_BUCKET    = aws_s3_bucket.article_assets_bucket.bucket
-    BASE_ASSET_URL  = "https://${aws_acm_certificate.ui_cert.domain_name}/article-assets"
+    LOG_LEVEL           = "info"
+    ALLOWED_ORIGINS     = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
+    ASSET_BUCKET        = aws_s3_bucket.article_assets_bucket.bucket
+    BASE_ASSET_URL      = "https://${aws_acm_certificate.ui_cert.domain_name}/article-assets"
+    ROUTE_TABLE         = local.route_table
+    AUDIT_TABLE         = aws_dynamodb_table.audit_log.name
+    ASSET_TABLE         = aws_dynamodb_table.article_assets.name
+    ALLOWED_ASSET_TYPES = local.allowed_asset_types
+    CLAMAV_ADDRESS      = local.clamav_address
   }
 }
 
@@ -156,3 +250,874 @@ resource "aws_lambda_permission" "article_asset_upload_allow_gateway_invoke" {
 
   source_arn = "arn:aws:execute-api:us-east-1:${data.aws_caller_identity.current.account_id}:${aws_api_gateway_rest_api.api.id}/*/POST/${aws_api_gateway_resource.article.path_part}/${aws_api_gateway_resource.article_asset.path_part}"
 }
+
+resource "aws_api_gateway_resource" "article_asset_direct_upload" {
+  parent_id   = aws_api_gateway_resource.article_asset.id
+  path_part   = "upload"
+  rest_api_id = aws_api_gateway_rest_api.api.id
+}
+
+resource "aws_api_gateway_resource" "article_asset_direct_upload_by_id" {
+  parent_id   = aws_api_gateway_resource.article_asset_direct_upload.id
+  path_part   = "{uploadId}"
+  rest_api_id = aws_api_gateway_rest_api.api.id
+}
+
+data "aws_iam_policy_document" "article_asset_presign_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  // presigned urls carry the permissions of the lambda, so only allow writes to the pending upload area
+  statement {
+    sid       = "AllowPendingUpload"
+    effect    = "Allow"
+    actions   = [
+      "s3:PutObject"
+    ]
+    resources = ["${aws_s3_bucket.article_assets_bucket.arn}/pending-uploads/*"]
+  }
+}
+
+module "article_asset_presign_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "articleAssetPresign"
+  lambda_policy    = data.aws_iam_policy_document.article_asset_presign_policy.json
+  env_variables    = {
+    LOG_LEVEL           = "info"
+    ALLOWED_ORIGINS     = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
+    ASSET_BUCKET        = aws_s3_bucket.article_assets_bucket.bucket
+    ROUTE_TABLE         = local.route_table
+    ALLOWED_ASSET_TYPES = local.allowed_asset_types
+    CLAMAV_ADDRESS      = local.clamav_address
+  }
+}
+
+resource "aws_api_gateway_method" "article_asset_presign" {
+  authorization = "CUSTOM"
+  authorizer_id = aws_api_gateway_authorizer.gateway_authorizer.id
+  http_method   = "POST"
+  resource_id   = aws_api_gateway_resource.article_asset_direct_upload.id
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+}
+
+resource "aws_api_gateway_integration" "article_asset_presign" {
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = aws_api_gateway_resource.article_asset_direct_upload.id
+  http_method             = aws_api_gateway_method.article_asset_presign.http_method
+  integration_http_method = "POST"
+  type                    = "AWS_PROXY"
+  uri                     = module.article_asset_presign_lambda.invoke_arn
+}
+
+resource "aws_lambda_permission" "article_asset_presign_allow_gateway_invoke" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = module.article_asset_presign_lambda.function_name
+  principal     = "apigateway.amazonaws.com"
+
+  source_arn = "arn:aws:execute-api:us-east-1:${data.aws_caller_identity.current.account_id}:${aws_api_gateway_rest_api.api.id}/*/POST/${aws_api_gateway_resource.article.path_part}/${aws_api_gateway_resource.article_asset.path_part}/${aws_api_gateway_resource.article_asset_direct_upload.path_part}"
+}
+
+data "aws_iam_policy_document" "article_asset_complete_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowAssetBucketList"
+    effect    = "Allow"
+    actions   = [
+      "s3:ListBucket"
+    ]
+    resources = [aws_s3_bucket.article_assets_bucket.arn]
+  }
+
+  statement {
+    sid       = "AllowPendingUploadAccess"
+    effect    = "Allow"
+    actions   = [
+      "s3:GetObject",
+      "s3:DeleteObject"
+    ]
+    resources = ["${aws_s3_bucket.article_assets_bucket.arn}/pending-uploads/*"]
+  }
+
+  statement {
+    sid       = "AllowAssetRead"
+    effect    = "Allow"
+    actions   = [
+      "s3:GetObject"
+    ]
+    resources = ["${aws_s3_bucket.article_assets_bucket.arn}/article-assets/*"]
+  }
+
+  statement {
+    sid       = "AllowAssetPublish"
+    effect    = "Allow"
+    actions   = [
+      "s3:PutObject",
+      "s3:PutObjectAcl"
+    ]
+    resources = ["${aws_s3_bucket.article_assets_bucket.arn}/article-assets/*"]
+  }
+
+  statement {
+    sid       = "AllowKeepingVersions"
+    effect    = "Allow"
+    actions   = [
+      "s3:PutObject",
+      "s3:PutObjectAcl"
+    ]
+    resources = ["${aws_s3_bucket.article_assets_bucket.arn}/asset-versions/*"]
+  }
+
+  statement {
+    sid       = "AllowQuarantineAccess"
+    effect    = "Allow"
+    actions   = [
+      "s3:GetObject",
+      "s3:PutObject",
+      "s3:PutObjectAcl",
+      "s3:DeleteObject"
+    ]
+    resources = ["${aws_s3_bucket.article_assets_bucket.arn}/quarantine/*"]
+  }
+
+  statement {
+    sid       = "AllowAssetTableUpdate"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:UpdateItem",
+      "dynamodb:GetItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.article_assets.name}"
+    ]
+  }
+
+  statement {
+    sid       = "AllowAuditLogAppend"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:PutItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.audit_log.name}"
+    ]
+  }
+}
+
+module "article_asset_complete_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "articleAssetComplete"
+  lambda_policy    = data.aws_iam_policy_document.article_asset_complete_policy.json
+  // images are held in memory to strip their metadata, rotated photos get decoded to bake in the rotation
+  timeout          = 30
+  memory_size      = 1536
+  env_variables    = {
+    LOG_LEVEL           = "info"
+    ALLOWED_ORIGINS     = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
+    ASSET_BUCKET        = aws_s3_bucket.article_assets_bucket.bucket
+    BASE_ASSET_URL      = "https://${aws_acm_certificate.ui_cert.domain_name}/article-assets"
+    ROUTE_TABLE         = local.route_table
+    AUDIT_TABLE         = aws_dynamodb_table.audit_log.name
+    ASSET_TABLE         = aws_dynamodb_table.article_assets.name
+    ALLOWED_ASSET_TYPES = local.allowed_asset_types
+    CLAMAV_ADDRESS      = local.clamav_address
+  }
+}
+
+resource "aws_api_gateway_method" "article_asset_complete" {
+  authorization = "CUSTOM"
+  authorizer_id = aws_api_gateway_authorizer.gateway_authorizer.id
+  http_method   = "POST"
+  resource_id   = aws_api_gateway_resource.article_asset_direct_upload_by_id.id
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+
+  request_parameters = {
+    "method.request.path.uploadId" = true
+  }
+}
+
+resource "aws_api_gateway_integration" "article_asset_complete" {
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = aws_api_gateway_resource.article_asset_direct_upload_by_id.id
+  http_method             = aws_api_gateway_method.article_asset_complete.http_method
+  integration_http_method = "POST"
+  type                    = "AWS_PROXY"
+  uri                     = module.article_asset_complete_lambda.invoke_arn
+}
+
+resource "aws_lambda_permission" "article_asset_complete_allow_gateway_invoke" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = module.article_asset_complete_lambda.function_name
+  principal     = "apigateway.amazonaws.com"
+
+  source_arn = "arn:aws:execute-api:us-east-1:${data.aws_caller_identity.current.account_id}:${aws_api_gateway_rest_api.api.id}/*/POST/${aws_api_gateway_resource.article.path_part}/${aws_api_gateway_resource.article_asset.path_part}/${aws_api_gateway_resource.article_asset_direct_upload.path_part}/*"
+}
+
+resource "aws_api_gateway_resource" "article_asset_object" {
+  parent_id   = aws_api_gateway_resource.article_asset.id
+  path_part   = "object"
+  rest_api_id = aws_api_gateway_rest_api.api.id
+}
+
+resource "aws_api_gateway_resource" "article_asset_object_path" {
+  parent_id   = aws_api_gateway_resource.article_asset_object.id
+  path_part   = "{path+}"
+  rest_api_id = aws_api_gateway_rest_api.api.id
+}
+
+resource "aws_api_gateway_resource" "article_asset_move" {
+  parent_id   = aws_api_gateway_resource.article_asset.id
+  path_part   = "move"
+  rest_api_id = aws_api_gateway_rest_api.api.id
+}
+
+data "aws_iam_policy_document" "article_asset_delete_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowAssetBucketList"
+    effect    = "Allow"
+    actions   = [
+      "s3:ListBucket"
+    ]
+    resources = [aws_s3_bucket.article_assets_bucket.arn]
+  }
+
+  statement {
+    sid       = "AllowAssetAccess"
+    effect    = "Allow"
+    actions   = [
+      "s3:GetObject",
+      "s3:DeleteObject"
+    ]
+    resources = ["${aws_s3_bucket.article_assets_bucket.arn}/article-assets/*"]
+  }
+
+  statement {
+    sid       = "AllowReferenceQuery"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:Query",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.article_asset_references.name}"
+    ]
+  }
+
+  statement {
+    sid       = "AllowAssetTableAccess"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:GetItem",
+      "dynamodb:DeleteItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.article_assets.name}"
+    ]
+  }
+
+  statement {
+    sid       = "AllowAuditLogAppend"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:PutItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.audit_log.name}"
+    ]
+  }
+}
+
+module "article_asset_delete_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "articleAssetDelete"
+  lambda_policy    = data.aws_iam_policy_document.article_asset_delete_policy.json
+  timeout          = 15
+  env_variables    = {
+    LOG_LEVEL       = "info"
+    ALLOWED_ORIGINS = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
+    ASSET_BUCKET    = aws_s3_bucket.article_assets_bucket.bucket
+    BASE_ASSET_URL  = "https://${aws_acm_certificate.ui_cert.domain_name}/article-assets"
+    REFERENCE_TABLE = aws_dynamodb_table.article_asset_references.name
+    ASSET_TABLE     = aws_dynamodb_table.article_assets.name
+    AUDIT_TABLE     = aws_dynamodb_table.audit_log.name
+    ROUTE_TABLE     = local.route_table
+  }
+}
+
+resource "aws_api_gateway_method" "article_asset_delete" {
+  authorization = "CUSTOM"
+  authorizer_id = aws_api_gateway_authorizer.gateway_authorizer.id
+  http_method   = "DELETE"
+  resource_id   = aws_api_gateway_resource.article_asset_object_path.id
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+
+  request_parameters = {
+    "method.request.path.path"         = true
+    "method.request.querystring.force" = false
+  }
+}
+
+resource "aws_api_gateway_integration" "article_asset_delete" {
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = aws_api_gateway_resource.article_asset_object_path.id
+  http_method             = aws_api_gateway_method.article_asset_delete.http_method
+  integration_http_method = "POST"
+  type                    = "AWS_PROXY"
+  uri                     = module.article_asset_delete_lambda.invoke_arn
+}
+
+resource "aws_lambda_permission" "article_asset_delete_allow_gateway_invoke" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = module.article_asset_delete_lambda.function_name
+  principal     = "apigateway.amazonaws.com"
+
+  source_arn = "arn:aws:execute-api:us-east-1:${data.aws_caller_identity.current.account_id}:${aws_api_gateway_rest_api.api.id}/*/DELETE/${aws_api_gateway_resource.article.path_part}/${aws_api_gateway_resource.article_asset.path_part}/${aws_api_gateway_resource.article_asset_object.path_part}/*"
+}
+
+data "aws_iam_policy_document" "article_asset_move_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowAssetBucketList"
+    effect    = "Allow"
+    actions   = [
+      "s3:ListBucket"
+    ]
+    resources = [aws_s3_bucket.article_assets_bucket.arn]
+  }
+
+  statement {
+    sid       = "AllowAssetAccess"
+    effect    = "Allow"
+    actions   = [
+      "s3:GetObject",
+      "s3:PutObject",
+      "s3:PutObjectAcl",
+      "s3:DeleteObject"
+    ]
+    resources = ["${aws_s3_bucket.article_assets_bucket.arn}/article-assets/*"]
+  }
+
+  statement {
+    sid       = "AllowReferenceQuery"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:Query",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.article_asset_references.name}"
+    ]
+  }
+
+  statement {
+    sid       = "AllowAssetTableAccess"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:GetItem",
+      "dynamodb:UpdateItem",
+      "dynamodb:DeleteItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.article_assets.name}"
+    ]
+  }
+
+  statement {
+    sid       = "AllowAuditLogAppend"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:PutItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.audit_log.name}"
+    ]
+  }
+}
+
+module "article_asset_move_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "articleAssetMove"
+  lambda_policy    = data.aws_iam_policy_document.article_asset_move_policy.json
+  timeout          = 15
+  env_variables    = {
+    LOG_LEVEL       = "info"
+    ALLOWED_ORIGINS = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
+    ASSET_BUCKET    = aws_s3_bucket.article_assets_bucket.bucket
+    BASE_ASSET_URL  = "https://${aws_acm_certificate.ui_cert.domain_name}/article-assets"
+    REFERENCE_TABLE = aws_dynamodb_table.article_asset_references.name
+    ASSET_TABLE     = aws_dynamodb_table.article_assets.name
+    AUDIT_TABLE     = aws_dynamodb_table.audit_log.name
+    ROUTE_TABLE     = local.route_table
+  }
+}
+
+resource "aws_api_gateway_method" "article_asset_move" {
+  authorization = "CUSTOM"
+  authorizer_id = aws_api_gateway_authorizer.gateway_authorizer.id
+  http_method   = "POST"
+  resource_id   = aws_api_gateway_resource.article_asset_move.id
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+}
+
+resource "aws_api_gateway_integration" "article_asset_move" {
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = aws_api_gateway_resource.article_asset_move.id
+  http_method             = aws_api_gateway_method.article_asset_move.http_method
+  integration_http_method = "POST"
+  type                    = "AWS_PROXY"
+  uri                     = module.article_asset_move_lambda.invoke_arn
+}
+
+resource "aws_lambda_permission" "article_asset_move_allow_gateway_invoke" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = module.article_asset_move_lambda.function_name
+  principal     = "apigateway.amazonaws.com"
+
+  source_arn = "arn:aws:execute-api:us-east-1:${data.aws_caller_identity.current.account_id}:${aws_api_gateway_rest_api.api.id}/*/POST/${aws_api_gateway_resource.article.path_part}/${aws_api_gateway_resource.article_asset.path_part}/${aws_api_gateway_resource.article_asset_move.path_part}"
+}
+
+data "aws_iam_policy_document" "article_asset_metadata_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowAssetBucketList"
+    effect    = "Allow"
+    actions   = [
+      "s3:ListBucket"
+    ]
+    resources = [aws_s3_bucket.article_assets_bucket.arn]
+  }
+
+  statement {
+    sid       = "AllowAssetRead"
+    effect    = "Allow"
+    actions   = [
+      "s3:GetObject"
+    ]
+    resources = ["${aws_s3_bucket.article_assets_bucket.arn}/article-assets/*"]
+  }
+
+  statement {
+    sid       = "AllowAssetTableAccess"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:GetItem",
+      "dynamodb:UpdateItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.article_assets.name}"
+    ]
+  }
+
+  statement {
+    sid       = "AllowAuditLogAppend"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:PutItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.audit_log.name}"
+    ]
+  }
+}
+
+module "article_asset_metadata_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "articleAssetMetadata"
+  lambda_policy    = data.aws_iam_policy_document.article_asset_metadata_policy.json
+  env_variables    = {
+    LOG_LEVEL       = "info"
+    ALLOWED_ORIGINS = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
+    ASSET_BUCKET    = aws_s3_bucket.article_assets_bucket.bucket
+    BASE_ASSET_URL  = "https://${aws_acm_certificate.ui_cert.domain_name}/article-assets"
+    ASSET_TABLE     = aws_dynamodb_table.article_assets.name
+    AUDIT_TABLE     = aws_dynamodb_table.audit_log.name
+    ROUTE_TABLE     = local.route_table
+  }
+}
+
+resource "aws_api_gateway_method" "article_asset_metadata" {
+  authorization = "CUSTOM"
+  authorizer_id = aws_api_gateway_authorizer.gateway_authorizer.id
+  http_method   = "PATCH"
+  resource_id   = aws_api_gateway_resource.article_asset_object_path.id
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+
+  request_parameters = {
+    "method.request.path.path" = true
+  }
+}
+
+resource "aws_api_gateway_integration" "article_asset_metadata" {
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = aws_api_gateway_resource.article_asset_object_path.id
+  http_method             = aws_api_gateway_method.article_asset_metadata.http_method
+  integration_http_method = "POST"
+  type                    = "AWS_PROXY"
+  uri                     = module.article_asset_metadata_lambda.invoke_arn
+}
+
+resource "aws_lambda_permission" "article_asset_metadata_allow_gateway_invoke" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = module.article_asset_metadata_lambda.function_name
+  principal     = "apigateway.amazonaws.com"
+
+  source_arn = "arn:aws:execute-api:us-east-1:${data.aws_caller_identity.current.account_id}:${aws_api_gateway_rest_api.api.id}/*/PATCH/${aws_api_gateway_resource.article.path_part}/${aws_api_gateway_resource.article_asset.path_part}/${aws_api_gateway_resource.article_asset_object.path_part}/*"
+}
+
+resource "aws_api_gateway_resource" "article_asset_version" {
+  parent_id   = aws_api_gateway_resource.article_asset.id
+  path_part   = "version"
+  rest_api_id = aws_api_gateway_rest_api.api.id
+}
+
+resource "aws_api_gateway_resource" "article_asset_version_path" {
+  parent_id   = aws_api_gateway_resource.article_asset_version.id
+  path_part   = "{path+}"
+  rest_api_id = aws_api_gateway_rest_api.api.id
+}
+
+data "aws_iam_policy_document" "article_asset_versions_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowAssetBucketList"
+    effect    = "Allow"
+    actions   = [
+      "s3:ListBucket"
+    ]
+    resources = [aws_s3_bucket.article_assets_bucket.arn]
+  }
+}
+
+module "article_asset_versions_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "articleAssetVersions"
+  lambda_policy    = data.aws_iam_policy_document.article_asset_versions_policy.json
+  env_variables    = {
+    LOG_LEVEL       = "info"
+    ALLOWED_ORIGINS = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
+    ASSET_BUCKET    = aws_s3_bucket.article_assets_bucket.bucket
+    ROUTE_TABLE     = local.route_table
+  }
+}
+
+resource "aws_api_gateway_method" "article_asset_versions" {
+  authorization = "CUSTOM"
+  authorizer_id = aws_api_gateway_authorizer.gateway_authorizer.id
+  http_method   = "GET"
+  resource_id   = aws_api_gateway_resource.article_asset_version_path.id
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+
+  request_parameters = {
+    "method.request.path.path" = true
+  }
+}
+
+resource "aws_api_gateway_integration" "article_asset_versions" {
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = aws_api_gateway_resource.article_asset_version_path.id
+  http_method             = aws_api_gateway_method.article_asset_versions.http_method
+  integration_http_method = "POST"
+  type                    = "AWS_PROXY"
+  uri                     = module.article_asset_versions_lambda.invoke_arn
+}
+
+resource "aws_lambda_permission" "article_asset_versions_allow_gateway_invoke" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = module.article_asset_versions_lambda.function_name
+  principal     = "apigateway.amazonaws.com"
+
+  source_arn = "arn:aws:execute-api:us-east-1:${data.aws_caller_identity.current.account_id}:${aws_api_gateway_rest_api.api.id}/*/GET/${aws_api_gateway_resource.article.path_part}/${aws_api_gateway_resource.article_asset.path_part}/${aws_api_gateway_resource.article_asset_version.path_part}/*"
+}
+
+resource "aws_api_gateway_resource" "article_asset_restore" {
+  parent_id   = aws_api_gateway_resource.article_asset.id
+  path_part   = "restore"
+  rest_api_id = aws_api_gateway_rest_api.api.id
+}
+
+data "aws_iam_policy_document" "article_asset_restore_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowAssetBucketList"
+    effect    = "Allow"
+    actions   = [
+      "s3:ListBucket"
+    ]
+    resources = [aws_s3_bucket.article_assets_bucket.arn]
+  }
+
+  statement {
+    sid       = "AllowAssetAccess"
+    effect    = "Allow"
+    actions   = [
+      "s3:GetObject",
+      "s3:PutObject",
+      "s3:PutObjectAcl"
+    ]
+    resources = [
+      "${aws_s3_bucket.article_assets_bucket.arn}/article-assets/*",
+      "${aws_s3_bucket.article_assets_bucket.arn}/asset-versions/*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowAssetTableAccess"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:GetItem",
+      "dynamodb:UpdateItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.article_assets.name}"
+    ]
+  }
+
+  statement {
+    sid       = "AllowAuditLogAppend"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:PutItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.audit_log.name}"
+    ]
+  }
+}
+
+module "article_asset_restore_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "articleAssetRestore"
+  lambda_policy    = data.aws_iam_policy_document.article_asset_restore_policy.json
+  timeout          = 15
+  env_variables    = {
+    LOG_LEVEL       = "info"
+    ALLOWED_ORIGINS = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
+    ASSET_BUCKET    = aws_s3_bucket.article_assets_bucket.bucket
+    BASE_ASSET_URL  = "https://${aws_acm_certificate.ui_cert.domain_name}/article-assets"
+    ASSET_TABLE     = aws_dynamodb_table.article_assets.name
+    AUDIT_TABLE     = aws_dynamodb_table.audit_log.name
+    ROUTE_TABLE     = local.route_table
+  }
+}
+
+resource "aws_api_gateway_method" "article_asset_restore" {
+  authorization = "CUSTOM"
+  authorizer_id = aws_api_gateway_authorizer.gateway_authorizer.id
+  http_method   = "POST"
+  resource_id   = aws_api_gateway_resource.article_asset_restore.id
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+}
+
+resource "aws_api_gateway_integration" "article_asset_restore" {
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = aws_api_gateway_resource.article_asset_restore.id
+  http_method             = aws_api_gateway_method.article_asset_restore.http_method
+  integration_http_method = "POST"
+  type                    = "AWS_PROXY"
+  uri                     = module.article_asset_restore_lambda.invoke_arn
+}
+
+resource "aws_lambda_permission" "article_asset_restore_allow_gateway_invoke" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = module.article_asset_restore_lambda.function_name
+  principal     = "apigateway.amazonaws.com"
+
+  source_arn = "arn:aws:execute-api:us-east-1:${data.aws_caller_identity.current.account_id}:${aws_api_gateway_rest_api.api.id}/*/POST/${aws_api_gateway_resource.article.path_part}/${aws_api_gateway_resource.article_asset.path_part}/${aws_api_gateway_resource.article_asset_restore.path_part}"
+}
@@ -0,0 +1,93 @@
+resource "aws_api_gateway_resource" "audit" {
+  rest_api_id = aws_api_gateway_rest_api.api.id
+  parent_id   = aws_api_gateway_rest_api.api.root_resource_id
+  path_part   = "audit"
+}
+
+data "aws_iam_policy_document" "audit_query_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowAuditLogRead"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:Query",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.audit_log.name}"
+    ]
+  }
+}
+
+module "audit_query_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "auditQuery"
+  lambda_policy    = data.aws_iam_policy_document.audit_query_policy.json
+  env_variables    = {
+    LOG_LEVEL       = "info"
+    ALLOWED_ORIGINS = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
+    AUDIT_TABLE     = aws_dynamodb_table.audit_log.name
+    ROUTE_TABLE     = local.route_table
+  }
+}
+
+resource "aws_api_gateway_method" "audit_query" {
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+  resource_id   = aws_api_gateway_resource.audit.id
+  http_method   = "GET"
+  authorization = "CUSTOM"
+  authorizer_id = aws_api_gateway_authorizer.gateway_authorizer.id
+
+  request_parameters = {
+    "method.request.querystring.user"   = false
+    "method.request.querystring.action" = false
+    "method.request.querystring.from"   = false
+    "method.request.querystring.to"     = false
+    "method.request.querystring.cursor" = false
+    "method.request.querystring.limit"  = false
+  }
+}
+
+resource "aws_api_gateway_integration" "audit_query" {
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = aws_api_gateway_resource.audit.id
+  http_method             = aws_api_gateway_method.audit_query.http_method
+  integration_http_method = "POST"
+  type                    = "AWS_PROXY"
+  uri                     = module.audit_query_lambda.invoke_arn
+}
+
+resource "aws_lambda_permission" "audit_query_allow_gateway_invoke" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = module.audit_query_lambda.function_name
+  principal     = "apigateway.amazonaws.com"
+
+  source_arn = "arn:aws:execute-api:us-east-1:${data.aws_caller_identity.current.account_id}:${aws_api_gateway_rest_api.api.id}/*/GET/${aws_api_gateway_resource.audit.path_part}"
+}
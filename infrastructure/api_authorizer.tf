@@ -24,6 +24,18 @@ data "aws_iam_policy_document" "auth_lambda_policy" {
     ]
     resources = ["*"]
   }
+
+  statement {
+    sid       = "AllowSessionStoreRead"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:GetItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.session_store.name}"
+    ]
+  }
 }
 
 resource "aws_iam_role" "auth_lambda_role" {
@@ -56,10 +68,14 @@ resource "aws_lambda_function" "auth_lambda" {
     variables = {
       "LOG_LEVEL": "debug"
       "ROOT_USER": data.aws_ssm_parameter.root_user.value,
+      "AUTHOR_USERS": data.aws_ssm_parameter.author_users.value,
       "GOOGLE_CLIENT_ID": data.aws_ssm_parameter.google_client_id.value,
       "ACCOUNT_ID": data.aws_caller_identity.current.account_id,
       "API_ID": aws_api_gateway_rest_api.api.id,
-      "STAGE": "${local.workspace_prefix}main" // referencing the stage creates a circular dependency
+      "STAGE": "${local.workspace_prefix}main", // referencing the stage creates a circular dependency
+      "ROUTE_TABLE": local.route_table,
+      "SESSION_TABLE": aws_dynamodb_table.session_store.name,
+      "SESSION_SIGNING_KEY": data.aws_ssm_parameter.session_signing_key.value
     }
   }
 
@@ -114,4 +130,7 @@ resource "aws_api_gateway_authorizer" "gateway_authorizer" {
   authorizer_uri                 = aws_lambda_function.auth_lambda.invoke_arn
   authorizer_credentials         = aws_iam_role.api_gateway_authorizer_invocation_role.arn
   type                           = "TOKEN"
+  // no gateway caching, it can't see when a token expires or a session is revoked and would keep allowing the token
+  // until its ttl ran out. Google tokens are cached in the authorizer itself, only until they expire.
+  authorizer_result_ttl_in_seconds = 0
 }
\ No newline at end of file
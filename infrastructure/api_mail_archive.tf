@@ -0,0 +1,328 @@
+// the index of archived support mail. The mail itself only arrives in the default workspace, elsewhere this stays empty.
+resource "aws_dynamodb_table" "mail_archive" {
+  name         = "${local.workspace_prefix}MailArchive"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key  = "Partition"
+  range_key = "SortKey"
+
+  attribute {
+    name = "Partition"
+    type = "S"
+  }
+
+  attribute {
+    name = "SortKey"
+    type = "S"
+  }
+
+  attribute {
+    name = "MessageID"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "MessageID"
+    hash_key        = "MessageID"
+    projection_type = "ALL"
+  }
+
+  tags = {
+    Workspace = terraform.workspace
+  }
+}
+
+locals {
+  // how long archived mail is kept before the purge job removes it
+  mail_archive_retention_days = 365
+}
+
+resource "aws_api_gateway_resource" "mail" {
+  rest_api_id = aws_api_gateway_rest_api.api.id
+  parent_id   = aws_api_gateway_rest_api.api.root_resource_id
+  path_part   = "mail"
+}
+
+resource "aws_api_gateway_resource" "mail_archive" {
+  rest_api_id = aws_api_gateway_rest_api.api.id
+  parent_id   = aws_api_gateway_resource.mail.id
+  path_part   = "archive"
+}
+
+resource "aws_api_gateway_resource" "mail_archive_message" {
+  rest_api_id = aws_api_gateway_rest_api.api.id
+  parent_id   = aws_api_gateway_resource.mail_archive.id
+  path_part   = "message"
+}
+
+resource "aws_api_gateway_resource" "mail_archive_message_id" {
+  rest_api_id = aws_api_gateway_rest_api.api.id
+  parent_id   = aws_api_gateway_resource.mail_archive_message.id
+  path_part   = "{messageId}"
+}
+
+data "aws_iam_policy_document" "mail_archive_search_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowMailArchiveRead"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:Query",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      aws_dynamodb_table.mail_archive.arn
+    ]
+  }
+}
+
+module "mail_archive_search_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "mailArchiveSearch"
+  lambda_policy    = data.aws_iam_policy_document.mail_archive_search_policy.json
+  env_variables    = {
+    LOG_LEVEL       = "info"
+    ALLOWED_ORIGINS = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
+    ARCHIVE_TABLE   = aws_dynamodb_table.mail_archive.name
+    ROUTE_TABLE     = local.route_table
+  }
+}
+
+resource "aws_api_gateway_method" "mail_archive_search" {
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+  resource_id   = aws_api_gateway_resource.mail_archive.id
+  http_method   = "GET"
+  authorization = "CUSTOM"
+  authorizer_id = aws_api_gateway_authorizer.gateway_authorizer.id
+
+  request_parameters = {
+    "method.request.querystring.from"    = false
+    "method.request.querystring.to"      = false
+    "method.request.querystring.subject" = false
+    "method.request.querystring.after"   = false
+    "method.request.querystring.before"  = false
+    "method.request.querystring.cursor"  = false
+    "method.request.querystring.limit"   = false
+  }
+}
+
+resource "aws_api_gateway_integration" "mail_archive_search" {
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = aws_api_gateway_resource.mail_archive.id
+  http_method             = aws_api_gateway_method.mail_archive_search.http_method
+  integration_http_method = "POST"
+  type                    = "AWS_PROXY"
+  uri                     = module.mail_archive_search_lambda.invoke_arn
+}
+
+resource "aws_lambda_permission" "mail_archive_search_allow_gateway_invoke" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = module.mail_archive_search_lambda.function_name
+  principal     = "apigateway.amazonaws.com"
+
+  source_arn = "arn:aws:execute-api:us-east-1:${data.aws_caller_identity.current.account_id}:${aws_api_gateway_rest_api.api.id}/*/GET/${aws_api_gateway_resource.mail.path_part}/${aws_api_gateway_resource.mail_archive.path_part}"
+}
+
+data "aws_iam_policy_document" "mail_archive_download_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowMailArchiveRead"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:Query",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      aws_dynamodb_table.mail_archive.arn,
+      "${aws_dynamodb_table.mail_archive.arn}/index/*"
+    ]
+  }
+
+  // the presigned download links are signed as this lambda, so it needs to be able to read what they point at
+  statement {
+    sid       = "AllowArchivedMailRead"
+    effect    = "Allow"
+    actions   = [
+      "s3:GetObject"
+    ]
+    resources = [
+      "arn:aws:s3:::${local.mail_bucket_name}/archive/*"
+    ]
+  }
+}
+
+module "mail_archive_download_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "mailArchiveDownload"
+  lambda_policy    = data.aws_iam_policy_document.mail_archive_download_policy.json
+  env_variables    = {
+    LOG_LEVEL       = "info"
+    ALLOWED_ORIGINS = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
+    MAIL_BUCKET     = local.mail_bucket_name
+    ARCHIVE_TABLE   = aws_dynamodb_table.mail_archive.name
+    ROUTE_TABLE     = local.route_table
+  }
+}
+
+resource "aws_api_gateway_method" "mail_archive_download" {
+  authorization = "CUSTOM"
+  authorizer_id = aws_api_gateway_authorizer.gateway_authorizer.id
+  http_method   = "GET"
+  resource_id   = aws_api_gateway_resource.mail_archive_message_id.id
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+
+  request_parameters = {
+    "method.request.path.messageId" = true
+  }
+}
+
+resource "aws_api_gateway_integration" "mail_archive_download" {
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = aws_api_gateway_resource.mail_archive_message_id.id
+  http_method             = aws_api_gateway_method.mail_archive_download.http_method
+  integration_http_method = "POST"
+  type                    = "AWS_PROXY"
+  uri                     = module.mail_archive_download_lambda.invoke_arn
+}
+
+resource "aws_lambda_permission" "mail_archive_download_allow_gateway_invoke" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = module.mail_archive_download_lambda.function_name
+  principal     = "apigateway.amazonaws.com"
+
+  source_arn = "arn:aws:execute-api:us-east-1:${data.aws_caller_identity.current.account_id}:${aws_api_gateway_rest_api.api.id}/*/GET/${aws_api_gateway_resource.mail.path_part}/${aws_api_gateway_resource.mail_archive.path_part}/${aws_api_gateway_resource.mail_archive_message.path_part}/*"
+}
+
+data "aws_iam_policy_document" "mail_archive_purge_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowMailArchiveReadWrite"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:Query",
+      "dynamodb:DeleteItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      aws_dynamodb_table.mail_archive.arn
+    ]
+  }
+
+  statement {
+    sid       = "AllowArchivedMailDelete"
+    effect    = "Allow"
+    actions   = [
+      "s3:DeleteObject"
+    ]
+    resources = [
+      "arn:aws:s3:::${local.mail_bucket_name}/archive/*"
+    ]
+  }
+}
+
+module "mail_archive_purge_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "mailArchivePurge"
+  lambda_policy    = data.aws_iam_policy_document.mail_archive_purge_policy.json
+  timeout          = 300
+  env_variables    = {
+    LOG_LEVEL              = "info"
+    MAIL_BUCKET            = local.mail_bucket_name
+    ARCHIVE_TABLE          = aws_dynamodb_table.mail_archive.name
+    ARCHIVE_RETENTION_DAYS = local.mail_archive_retention_days
+  }
+}
+
+resource "aws_cloudwatch_event_target" "run_mail_archive_purge" {
+  rule      = aws_cloudwatch_event_rule.every_day_at_midnight.name
+  target_id = "mailArchivePurge"
+  arn       = module.mail_archive_purge_lambda.arn
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_to_call_mail_archive_purge" {
+  statement_id  = "AllowExecutionFromCloudWatch"
+  action        = "lambda:InvokeFunction"
+  function_name = module.mail_archive_purge_lambda.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.every_day_at_midnight.arn
+}
@@ -0,0 +1,312 @@
+// addresses mail is no longer sent to because it bounced for good or the recipient complained, every lambda that
+// sends mail checks it first
+resource "aws_dynamodb_table" "mail_suppression" {
+  name         = "${local.workspace_prefix}MailSuppression"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key = "Email"
+
+  attribute {
+    name = "Email"
+    type = "S"
+  }
+
+  tags = {
+    Workspace = terraform.workspace
+  }
+}
+
+// SES publishes bounces and complaints for mail sent from the domain here, mail is only set up in the default workspace
+resource "aws_sns_topic" "mail_feedback" {
+  name = "mail-feedback"
+
+  tags = {
+    Workspace = terraform.workspace
+  }
+
+  count = terraform.workspace == "default" ? 1 : 0
+}
+
+resource "aws_ses_identity_notification_topic" "mail_bounce" {
+  topic_arn                = aws_sns_topic.mail_feedback[0].arn
+  notification_type        = "Bounce"
+  identity                 = aws_ses_domain_identity.ses_domain[0].domain
+  include_original_headers = false
+
+  count = terraform.workspace == "default" ? 1 : 0
+}
+
+resource "aws_ses_identity_notification_topic" "mail_complaint" {
+  topic_arn                = aws_sns_topic.mail_feedback[0].arn
+  notification_type        = "Complaint"
+  identity                 = aws_ses_domain_identity.ses_domain[0].domain
+  include_original_headers = false
+
+  count = terraform.workspace == "default" ? 1 : 0
+}
+
+data "aws_iam_policy_document" "mail_feedback_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowSuppressionWrite"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:PutItem"
+    ]
+    resources = [
+      aws_dynamodb_table.mail_suppression.arn
+    ]
+  }
+
+  statement {
+    sid       = "AllowAuditLogAppend"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:PutItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.audit_log.name}"
+    ]
+  }
+}
+
+module "mail_feedback_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "mailFeedback"
+  lambda_policy    = data.aws_iam_policy_document.mail_feedback_policy.json
+  env_variables    = {
+    LOG_LEVEL         = "info"
+    SUPPRESSION_TABLE = aws_dynamodb_table.mail_suppression.name
+    AUDIT_TABLE       = aws_dynamodb_table.audit_log.name
+  }
+}
+
+resource "aws_sns_topic_subscription" "mail_feedback" {
+  topic_arn = aws_sns_topic.mail_feedback[0].arn
+  protocol  = "lambda"
+  endpoint  = module.mail_feedback_lambda.arn
+
+  count = terraform.workspace == "default" ? 1 : 0
+}
+
+resource "aws_lambda_permission" "mail_feedback_allow_sns_invoke" {
+  statement_id  = "AllowExecutionFromSNS"
+  action        = "lambda:InvokeFunction"
+  function_name = module.mail_feedback_lambda.function_name
+  principal     = "sns.amazonaws.com"
+  source_arn    = aws_sns_topic.mail_feedback[0].arn
+
+  count = terraform.workspace == "default" ? 1 : 0
+}
+
+resource "aws_api_gateway_resource" "mail_suppression" {
+  rest_api_id = aws_api_gateway_rest_api.api.id
+  parent_id   = aws_api_gateway_resource.mail.id
+  path_part   = "suppression"
+}
+
+resource "aws_api_gateway_resource" "mail_suppression_email" {
+  rest_api_id = aws_api_gateway_rest_api.api.id
+  parent_id   = aws_api_gateway_resource.mail_suppression.id
+  path_part   = "{email}"
+}
+
+data "aws_iam_policy_document" "mail_suppression_list_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowSuppressionScan"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:Scan"
+    ]
+    resources = [
+      aws_dynamodb_table.mail_suppression.arn
+    ]
+  }
+}
+
+module "mail_suppression_list_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "mailSuppressionList"
+  lambda_policy    = data.aws_iam_policy_document.mail_suppression_list_policy.json
+  env_variables    = {
+    LOG_LEVEL         = "info"
+    ALLOWED_ORIGINS   = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
+    SUPPRESSION_TABLE = aws_dynamodb_table.mail_suppression.name
+    ROUTE_TABLE       = local.route_table
+  }
+}
+
+resource "aws_api_gateway_method" "mail_suppression_list" {
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+  resource_id   = aws_api_gateway_resource.mail_suppression.id
+  http_method   = "GET"
+  authorization = "CUSTOM"
+  authorizer_id = aws_api_gateway_authorizer.gateway_authorizer.id
+}
+
+resource "aws_api_gateway_integration" "mail_suppression_list" {
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = aws_api_gateway_resource.mail_suppression.id
+  http_method             = aws_api_gateway_method.mail_suppression_list.http_method
+  integration_http_method = "POST"
+  type                    = "AWS_PROXY"
+  uri                     = module.mail_suppression_list_lambda.invoke_arn
+}
+
+resource "aws_lambda_permission" "mail_suppression_list_allow_gateway_invoke" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = module.mail_suppression_list_lambda.function_name
+  principal     = "apigateway.amazonaws.com"
+
+  source_arn = "arn:aws:execute-api:us-east-1:${data.aws_caller_identity.current.account_id}:${aws_api_gateway_rest_api.api.id}/*/GET/${aws_api_gateway_resource.mail.path_part}/${aws_api_gateway_resource.mail_suppression.path_part}"
+}
+
+data "aws_iam_policy_document" "mail_suppression_remove_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowSuppressionDelete"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:DeleteItem"
+    ]
+    resources = [
+      aws_dynamodb_table.mail_suppression.arn
+    ]
+  }
+
+  statement {
+    sid       = "AllowAuditLogAppend"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:PutItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.audit_log.name}"
+    ]
+  }
+}
+
+module "mail_suppression_remove_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "mailSuppressionRemove"
+  lambda_policy    = data.aws_iam_policy_document.mail_suppression_remove_policy.json
+  env_variables    = {
+    LOG_LEVEL         = "info"
+    ALLOWED_ORIGINS   = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
+    SUPPRESSION_TABLE = aws_dynamodb_table.mail_suppression.name
+    AUDIT_TABLE       = aws_dynamodb_table.audit_log.name
+    ROUTE_TABLE       = local.route_table
+  }
+}
+
+resource "aws_api_gateway_method" "mail_suppression_remove" {
+  authorization = "CUSTOM"
+  authorizer_id = aws_api_gateway_authorizer.gateway_authorizer.id
+  http_method   = "DELETE"
+  resource_id   = aws_api_gateway_resource.mail_suppression_email.id
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+
+  request_parameters = {
+    "method.request.path.email" = true
+  }
+}
+
+resource "aws_api_gateway_integration" "mail_suppression_remove" {
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = aws_api_gateway_resource.mail_suppression_email.id
+  http_method             = aws_api_gateway_method.mail_suppression_remove.http_method
+  integration_http_method = "POST"
+  type                    = "AWS_PROXY"
+  uri                     = module.mail_suppression_remove_lambda.invoke_arn
+}
+
+resource "aws_lambda_permission" "mail_suppression_remove_allow_gateway_invoke" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = module.mail_suppression_remove_lambda.function_name
+  principal     = "apigateway.amazonaws.com"
+
+  source_arn = "arn:aws:execute-api:us-east-1:${data.aws_caller_identity.current.account_id}:${aws_api_gateway_rest_api.api.id}/*/DELETE/${aws_api_gateway_resource.mail.path_part}/${aws_api_gateway_resource.mail_suppression.path_part}/*"
+}
@@ -0,0 +1,260 @@
+resource "aws_api_gateway_resource" "session" {
+  rest_api_id = aws_api_gateway_rest_api.api.id
+  parent_id   = aws_api_gateway_rest_api.api.root_resource_id
+  path_part   = "session"
+}
+
+resource "aws_api_gateway_resource" "session_refresh" {
+  rest_api_id = aws_api_gateway_rest_api.api.id
+  parent_id   = aws_api_gateway_resource.session.id
+  path_part   = "refresh"
+}
+
+data "aws_iam_policy_document" "session_create_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowSessionStoreAccess"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:PutItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.session_store.name}"
+    ]
+  }
+}
+
+module "session_create_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "sessionCreate"
+  lambda_policy    = data.aws_iam_policy_document.session_create_policy.json
+  env_variables    = {
+    LOG_LEVEL           = "info"
+    ALLOWED_ORIGINS     = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
+    GOOGLE_CLIENT_ID    = data.aws_ssm_parameter.google_client_id.value
+    ROOT_USER           = data.aws_ssm_parameter.root_user.value
+    AUTHOR_USERS        = data.aws_ssm_parameter.author_users.value
+    SESSION_TABLE       = aws_dynamodb_table.session_store.name
+    SESSION_SIGNING_KEY = data.aws_ssm_parameter.session_signing_key.value
+  }
+}
+
+resource "aws_api_gateway_method" "session_create" {
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+  resource_id   = aws_api_gateway_resource.session.id
+  http_method   = "POST"
+  authorization = "CUSTOM"
+  authorizer_id = aws_api_gateway_authorizer.gateway_authorizer.id
+}
+
+resource "aws_api_gateway_integration" "session_create" {
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = aws_api_gateway_resource.session.id
+  http_method             = aws_api_gateway_method.session_create.http_method
+  integration_http_method = "POST"
+  type                    = "AWS_PROXY"
+  uri                     = module.session_create_lambda.invoke_arn
+}
+
+resource "aws_lambda_permission" "session_create_allow_gateway_invoke" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = module.session_create_lambda.function_name
+  principal     = "apigateway.amazonaws.com"
+
+  source_arn = "arn:aws:execute-api:us-east-1:${data.aws_caller_identity.current.account_id}:${aws_api_gateway_rest_api.api.id}/*/POST/${aws_api_gateway_resource.session.path_part}"
+}
+
+data "aws_iam_policy_document" "session_refresh_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowSessionStoreAccess"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:GetItem",
+      "dynamodb:UpdateItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.session_store.name}"
+    ]
+  }
+}
+
+module "session_refresh_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "sessionRefresh"
+  lambda_policy    = data.aws_iam_policy_document.session_refresh_policy.json
+  env_variables    = {
+    LOG_LEVEL           = "info"
+    ALLOWED_ORIGINS     = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
+    ROOT_USER           = data.aws_ssm_parameter.root_user.value
+    AUTHOR_USERS        = data.aws_ssm_parameter.author_users.value
+    SESSION_TABLE       = aws_dynamodb_table.session_store.name
+    SESSION_SIGNING_KEY = data.aws_ssm_parameter.session_signing_key.value
+  }
+}
+
+resource "aws_api_gateway_method" "session_refresh" {
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+  resource_id   = aws_api_gateway_resource.session_refresh.id
+  http_method   = "POST"
+  authorization = "CUSTOM"
+  authorizer_id = aws_api_gateway_authorizer.gateway_authorizer.id
+}
+
+resource "aws_api_gateway_integration" "session_refresh" {
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = aws_api_gateway_resource.session_refresh.id
+  http_method             = aws_api_gateway_method.session_refresh.http_method
+  integration_http_method = "POST"
+  type                    = "AWS_PROXY"
+  uri                     = module.session_refresh_lambda.invoke_arn
+}
+
+resource "aws_lambda_permission" "session_refresh_allow_gateway_invoke" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = module.session_refresh_lambda.function_name
+  principal     = "apigateway.amazonaws.com"
+
+  source_arn = "arn:aws:execute-api:us-east-1:${data.aws_caller_identity.current.account_id}:${aws_api_gateway_rest_api.api.id}/*/POST/${aws_api_gateway_resource.session.path_part}/${aws_api_gateway_resource.session_refresh.path_part}"
+}
+
+data "aws_iam_policy_document" "session_logout_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowSessionStoreAccess"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:UpdateItem",
+      "dynamodb:Query",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.session_store.name}",
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.session_store.name}/index/*"
+    ]
+  }
+}
+
+module "session_logout_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "sessionLogout"
+  lambda_policy    = data.aws_iam_policy_document.session_logout_policy.json
+  env_variables    = {
+    LOG_LEVEL       = "info"
+    ALLOWED_ORIGINS = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
+    SESSION_TABLE   = aws_dynamodb_table.session_store.name
+    ROUTE_TABLE     = local.route_table
+  }
+}
+
+resource "aws_api_gateway_method" "session_logout" {
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+  resource_id   = aws_api_gateway_resource.session.id
+  http_method   = "DELETE"
+  authorization = "CUSTOM"
+  authorizer_id = aws_api_gateway_authorizer.gateway_authorizer.id
+
+  request_parameters = {
+    "method.request.querystring.everywhere" = false
+  }
+}
+
+resource "aws_api_gateway_integration" "session_logout" {
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = aws_api_gateway_resource.session.id
+  http_method             = aws_api_gateway_method.session_logout.http_method
+  integration_http_method = "POST"
+  type                    = "AWS_PROXY"
+  uri                     = module.session_logout_lambda.invoke_arn
+}
+
+resource "aws_lambda_permission" "session_logout_allow_gateway_invoke" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = module.session_logout_lambda.function_name
+  principal     = "apigateway.amazonaws.com"
+
+  source_arn = "arn:aws:execute-api:us-east-1:${data.aws_caller_identity.current.account_id}:${aws_api_gateway_rest_api.api.id}/*/DELETE/${aws_api_gateway_resource.session.path_part}"
+}
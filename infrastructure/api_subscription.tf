@@ -0,0 +1,386 @@
+// readers subscribed to mail about new posts, along with those still to confirm (forgotten after a week) and those who
+// have unsubscribed
+resource "aws_dynamodb_table" "subscribers" {
+  name         = "${local.workspace_prefix}Subscribers"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key = "Email"
+
+  attribute {
+    name = "Email"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "Expires"
+    enabled        = true
+  }
+
+  tags = {
+    Workspace = terraform.workspace
+  }
+}
+
+resource "aws_dynamodb_table" "subscription_rate_limit" {
+  name         = "${local.workspace_prefix}SubscriptionRateLimit"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key = "LimitKey"
+
+  attribute {
+    name = "LimitKey"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "Expires"
+    enabled        = true
+  }
+
+  tags = {
+    Workspace = terraform.workspace
+  }
+}
+
+locals {
+  // subscribe requests allowed from a single ip each hour, and for a single address each day
+  subscribe_ip_limit_per_hour   = 10
+  subscribe_email_limit_per_day = 3
+  subscription_site_url         = "https://${aws_acm_certificate.ui_cert.domain_name}"
+  subscription_api_url          = "https://${aws_api_gateway_domain_name.api.domain_name}"
+}
+
+resource "aws_api_gateway_resource" "subscription" {
+  rest_api_id = aws_api_gateway_rest_api.api.id
+  parent_id   = aws_api_gateway_rest_api.api.root_resource_id
+  path_part   = "subscription"
+}
+
+resource "aws_api_gateway_resource" "subscription_confirm" {
+  rest_api_id = aws_api_gateway_rest_api.api.id
+  parent_id   = aws_api_gateway_resource.subscription.id
+  path_part   = "confirm"
+}
+
+resource "aws_api_gateway_resource" "subscription_unsubscribe" {
+  rest_api_id = aws_api_gateway_rest_api.api.id
+  parent_id   = aws_api_gateway_resource.subscription.id
+  path_part   = "unsubscribe"
+}
+
+data "aws_iam_policy_document" "subscription_subscribe_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowSubscriberReadWrite"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:GetItem",
+      "dynamodb:PutItem"
+    ]
+    resources = [
+      aws_dynamodb_table.subscribers.arn
+    ]
+  }
+
+  statement {
+    sid       = "AllowRateLimitUpdate"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:UpdateItem"
+    ]
+    resources = [
+      aws_dynamodb_table.subscription_rate_limit.arn
+    ]
+  }
+
+  statement {
+    sid       = "AllowMailTemplateRead"
+    effect    = "Allow"
+    actions   = [
+      "s3:ListBucket",
+      "s3:GetObject"
+    ]
+    resources = [
+      aws_s3_bucket.mail_templates_bucket.arn,
+      "${aws_s3_bucket.mail_templates_bucket.arn}/*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowSendingConfirmation"
+    effect    = "Allow"
+    actions   = [
+      "ses:SendRawEmail"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowSuppressionCheck"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:GetItem"
+    ]
+    resources = [
+      aws_dynamodb_table.mail_suppression.arn
+    ]
+  }
+}
+
+module "subscription_subscribe_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "subscriptionSubscribe"
+  lambda_policy    = data.aws_iam_policy_document.subscription_subscribe_policy.json
+  env_variables    = {
+    LOG_LEVEL                = "info"
+    ALLOWED_ORIGINS          = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
+    SUBSCRIBER_TABLE         = aws_dynamodb_table.subscribers.name
+    RATE_LIMIT_TABLE         = aws_dynamodb_table.subscription_rate_limit.name
+    IP_LIMIT_PER_HOUR        = local.subscribe_ip_limit_per_hour
+    EMAIL_LIMIT_PER_DAY      = local.subscribe_email_limit_per_day
+    TEMPLATE_BUCKET          = aws_s3_bucket.mail_templates_bucket.bucket
+    SUBSCRIPTION_SIGNING_KEY = data.aws_ssm_parameter.subscription_signing_key.value
+    API_URL                  = local.subscription_api_url
+    SITE_URL                 = local.subscription_site_url
+    MAIL_FROM                = local.support_email
+    SUPPRESSION_TABLE        = aws_dynamodb_table.mail_suppression.name
+  }
+}
+
+resource "aws_api_gateway_method" "subscription_subscribe" {
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+  resource_id   = aws_api_gateway_resource.subscription.id
+  http_method   = "POST"
+  authorization = "CUSTOM"
+  authorizer_id = aws_api_gateway_authorizer.gateway_authorizer.id
+}
+
+resource "aws_api_gateway_integration" "subscription_subscribe" {
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = aws_api_gateway_resource.subscription.id
+  http_method             = aws_api_gateway_method.subscription_subscribe.http_method
+  integration_http_method = "POST"
+  type                    = "AWS_PROXY"
+  uri                     = module.subscription_subscribe_lambda.invoke_arn
+}
+
+resource "aws_lambda_permission" "subscription_subscribe_allow_gateway_invoke" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = module.subscription_subscribe_lambda.function_name
+  principal     = "apigateway.amazonaws.com"
+
+  source_arn = "arn:aws:execute-api:us-east-1:${data.aws_caller_identity.current.account_id}:${aws_api_gateway_rest_api.api.id}/*/POST/${aws_api_gateway_resource.subscription.path_part}"
+}
+
+data "aws_iam_policy_document" "subscription_confirm_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowSubscriberUpdate"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:UpdateItem"
+    ]
+    resources = [
+      aws_dynamodb_table.subscribers.arn
+    ]
+  }
+}
+
+module "subscription_confirm_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "subscriptionConfirm"
+  lambda_policy    = data.aws_iam_policy_document.subscription_confirm_policy.json
+  env_variables    = {
+    LOG_LEVEL                = "info"
+    ALLOWED_ORIGINS          = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
+    SUBSCRIBER_TABLE         = aws_dynamodb_table.subscribers.name
+    SUBSCRIPTION_SIGNING_KEY = data.aws_ssm_parameter.subscription_signing_key.value
+    SITE_URL                 = local.subscription_site_url
+  }
+}
+
+// links in mail carry no authorization header, the signed token in the link is what authorizes them
+resource "aws_api_gateway_method" "subscription_confirm" {
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+  resource_id   = aws_api_gateway_resource.subscription_confirm.id
+  http_method   = "GET"
+  authorization = "NONE"
+
+  request_parameters = {
+    "method.request.querystring.token" = true
+  }
+}
+
+resource "aws_api_gateway_integration" "subscription_confirm" {
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = aws_api_gateway_resource.subscription_confirm.id
+  http_method             = aws_api_gateway_method.subscription_confirm.http_method
+  integration_http_method = "POST"
+  type                    = "AWS_PROXY"
+  uri                     = module.subscription_confirm_lambda.invoke_arn
+}
+
+resource "aws_lambda_permission" "subscription_confirm_allow_gateway_invoke" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = module.subscription_confirm_lambda.function_name
+  principal     = "apigateway.amazonaws.com"
+
+  source_arn = "arn:aws:execute-api:us-east-1:${data.aws_caller_identity.current.account_id}:${aws_api_gateway_rest_api.api.id}/*/GET/${aws_api_gateway_resource.subscription.path_part}/${aws_api_gateway_resource.subscription_confirm.path_part}"
+}
+
+data "aws_iam_policy_document" "subscription_unsubscribe_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowSubscriberUpdate"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:UpdateItem"
+    ]
+    resources = [
+      aws_dynamodb_table.subscribers.arn
+    ]
+  }
+}
+
+module "subscription_unsubscribe_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "subscriptionUnsubscribe"
+  lambda_policy    = data.aws_iam_policy_document.subscription_unsubscribe_policy.json
+  env_variables    = {
+    LOG_LEVEL                = "info"
+    ALLOWED_ORIGINS          = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
+    SUBSCRIBER_TABLE         = aws_dynamodb_table.subscribers.name
+    SUBSCRIPTION_SIGNING_KEY = data.aws_ssm_parameter.subscription_signing_key.value
+    SITE_URL                 = local.subscription_site_url
+  }
+}
+
+// GET for readers following the link, POST for mail clients doing a one click unsubscribe
+resource "aws_api_gateway_method" "subscription_unsubscribe" {
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+  resource_id   = aws_api_gateway_resource.subscription_unsubscribe.id
+  http_method   = "GET"
+  authorization = "NONE"
+
+  request_parameters = {
+    "method.request.querystring.token" = true
+  }
+}
+
+resource "aws_api_gateway_integration" "subscription_unsubscribe" {
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = aws_api_gateway_resource.subscription_unsubscribe.id
+  http_method             = aws_api_gateway_method.subscription_unsubscribe.http_method
+  integration_http_method = "POST"
+  type                    = "AWS_PROXY"
+  uri                     = module.subscription_unsubscribe_lambda.invoke_arn
+}
+
+resource "aws_api_gateway_method" "subscription_unsubscribe_one_click" {
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+  resource_id   = aws_api_gateway_resource.subscription_unsubscribe.id
+  http_method   = "POST"
+  authorization = "NONE"
+
+  request_parameters = {
+    "method.request.querystring.token" = true
+  }
+}
+
+resource "aws_api_gateway_integration" "subscription_unsubscribe_one_click" {
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = aws_api_gateway_resource.subscription_unsubscribe.id
+  http_method             = aws_api_gateway_method.subscription_unsubscribe_one_click.http_method
+  integration_http_method = "POST"
+  type                    = "AWS_PROXY"
+  uri                     = module.subscription_unsubscribe_lambda.invoke_arn
+}
+
+resource "aws_lambda_permission" "subscription_unsubscribe_allow_gateway_invoke" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = module.subscription_unsubscribe_lambda.function_name
+  principal     = "apigateway.amazonaws.com"
+
+  source_arn = "arn:aws:execute-api:us-east-1:${data.aws_caller_identity.current.account_id}:${aws_api_gateway_rest_api.api.id}/*/*/${aws_api_gateway_resource.subscription.path_part}/${aws_api_gateway_resource.subscription_unsubscribe.path_part}"
+}
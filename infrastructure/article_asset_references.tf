@@ -0,0 +1,167 @@
+resource "aws_dynamodb_table" "article_asset_references" {
+  name         = "${local.workspace_prefix}ArticleAssetReferences"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key  = "AssetPath"
+  range_key = "Slug"
+
+  attribute {
+    name = "AssetPath"
+    type = "S"
+  }
+
+  attribute {
+    name = "Slug"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "Slug"
+    hash_key        = "Slug"
+    range_key       = "AssetPath"
+    projection_type = "KEYS_ONLY"
+  }
+
+  tags = {
+    Workspace = terraform.workspace
+  }
+}
+
+data "aws_iam_policy_document" "asset_reference_report_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowAssetBucketList"
+    effect    = "Allow"
+    actions   = [
+      "s3:ListBucket"
+    ]
+    resources = [aws_s3_bucket.article_assets_bucket.arn]
+  }
+
+  statement {
+    sid       = "AllowArticleStoreAccess"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:Scan",
+      "dynamodb:GetItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.article_store.name}"
+    ]
+  }
+
+  statement {
+    sid       = "AllowReferenceIndexAccess"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:Query",
+      "dynamodb:Scan",
+      "dynamodb:BatchWriteItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.article_asset_references.name}",
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.article_asset_references.name}/index/*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowMailTemplateRead"
+    effect    = "Allow"
+    actions   = [
+      "s3:ListBucket",
+      "s3:GetObject"
+    ]
+    resources = [
+      aws_s3_bucket.mail_templates_bucket.arn,
+      "${aws_s3_bucket.mail_templates_bucket.arn}/*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowSendingReport"
+    effect    = "Allow"
+    actions   = [
+      "ses:SendRawEmail"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowSuppressionCheck"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:GetItem"
+    ]
+    resources = [
+      aws_dynamodb_table.mail_suppression.arn
+    ]
+  }
+}
+
+module "asset_reference_report_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "assetReferenceReport"
+  lambda_policy    = data.aws_iam_policy_document.asset_reference_report_policy.json
+  timeout          = 60
+
+  env_variables = {
+    LOG_LEVEL         = "info"
+    ASSET_BUCKET      = aws_s3_bucket.article_assets_bucket.bucket
+    BASE_ASSET_URL    = "https://${aws_acm_certificate.ui_cert.domain_name}/article-assets"
+    ARTICLE_TABLE     = aws_dynamodb_table.article_store.name
+    REFERENCE_TABLE   = aws_dynamodb_table.article_asset_references.name
+    TEMPLATE_BUCKET   = aws_s3_bucket.mail_templates_bucket.bucket
+    // mail is only set up in the default workspace, elsewhere the report just goes to the logs
+    MAIL_FROM         = terraform.workspace == "default" ? local.support_email : ""
+    REPORT_TO         = terraform.workspace == "default" ? aws_ses_email_identity.support_email[0].email : ""
+    SUPPRESSION_TABLE = aws_dynamodb_table.mail_suppression.name
+  }
+}
+
+resource "aws_cloudwatch_event_rule" "every_monday_morning" {
+  name                = "${local.workspace_prefix}every-monday-morning"
+  description         = "Fires every monday at 6am"
+  schedule_expression = "cron(0 6 ? * MON *)"
+}
+
+resource "aws_cloudwatch_event_target" "run_asset_reference_report" {
+  rule      = aws_cloudwatch_event_rule.every_monday_morning.name
+  target_id = "lambda"
+  arn       = module.asset_reference_report_lambda.arn
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_to_call_asset_reference_report" {
+  statement_id  = "AllowExecutionFromCloudWatch"
+  action        = "lambda:InvokeFunction"
+  function_name = module.asset_reference_report_lambda.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.every_monday_morning.arn
+}
@@ -0,0 +1,111 @@
+resource "aws_dynamodb_table" "article_assets" {
+  name         = "${local.workspace_prefix}ArticleAssets"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key = "Path"
+
+  attribute {
+    name = "Path"
+    type = "S"
+  }
+
+  tags = {
+    Workspace = terraform.workspace
+  }
+}
+
+data "aws_iam_policy_document" "article_asset_processor_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowAssetReadWrite"
+    effect    = "Allow"
+    actions   = [
+      "s3:GetObject",
+      "s3:PutObject",
+      "s3:PutObjectAcl"
+    ]
+    resources = ["${aws_s3_bucket.article_assets_bucket.arn}/article-assets/*"]
+  }
+
+  // without this head requests for missing objects come back as 403 rather than 404
+  statement {
+    sid       = "AllowAssetBucketList"
+    effect    = "Allow"
+    actions   = [
+      "s3:ListBucket"
+    ]
+    resources = [aws_s3_bucket.article_assets_bucket.arn]
+  }
+
+  statement {
+    sid       = "AllowAssetTableAccess"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:GetItem",
+      "dynamodb:UpdateItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.article_assets.name}"
+    ]
+  }
+}
+
+module "article_asset_processor_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "articleAssetProcessor"
+  lambda_policy    = data.aws_iam_policy_document.article_asset_processor_policy.json
+  // decoding and resizing large photos needs room, and more memory means more cpu
+  timeout          = 60
+  memory_size      = 1536
+  env_variables    = {
+    LOG_LEVEL   = "info"
+    ASSET_TABLE = aws_dynamodb_table.article_assets.name
+  }
+}
+
+resource "aws_lambda_permission" "article_asset_processor_allow_bucket_invoke" {
+  statement_id  = "AllowExecutionFromS3Bucket"
+  action        = "lambda:InvokeFunction"
+  function_name = module.article_asset_processor_lambda.function_name
+  principal     = "s3.amazonaws.com"
+  source_arn    = aws_s3_bucket.article_assets_bucket.arn
+}
+
+resource "aws_s3_bucket_notification" "article_asset_uploaded" {
+  bucket = aws_s3_bucket.article_assets_bucket.id
+
+  lambda_function {
+    lambda_function_arn = module.article_asset_processor_lambda.arn
+    events              = ["s3:ObjectCreated:*"]
+    filter_prefix       = "article-assets/"
+  }
+
+  depends_on = [aws_lambda_permission.article_asset_processor_allow_bucket_invoke]
+}
@@ -0,0 +1,25 @@
+resource "aws_dynamodb_table" "audit_log" {
+  name         = "${local.workspace_prefix}AuditLog"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key  = "Partition"
+  range_key = "SortKey"
+
+  attribute {
+    name = "Partition"
+    type = "S"
+  }
+
+  attribute {
+    name = "SortKey"
+    type = "S"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  tags = {
+    Workspace = terraform.workspace
+  }
+}
@@ -32,6 +32,9 @@ resource "aws_lambda_function" "lambda" {
   role             = aws_iam_role.lambda_role.arn
   runtime          = "go1.x"
   timeout          = var.timeout
+  memory_size      = var.memory_size
+
+  reserved_concurrent_executions = var.reserved_concurrent_executions
 
   tracing_config {
     mode = "Active"
@@ -17,4 +17,14 @@ variable "env_variables" {
 variable "timeout" {
   type    = string
   default = 3
-}
\ No newline at end of file
+}
+
+variable "memory_size" {
+  type    = number
+  default = 128
+}
+
+variable "reserved_concurrent_executions" {
+  type    = number
+  default = -1
+}
@@ -46,8 +46,15 @@ resource "aws_ses_email_identity" "support_email" {
 }
 
 locals {
-  mail_bucket_name = "mail.${data.aws_ssm_parameter.domain_name.value}"
-  support_email    = "support@${data.aws_ssm_parameter.domain_name.value}"
+  mail_bucket_name       = "mail.${data.aws_ssm_parameter.domain_name.value}"
+  support_email          = "support@${data.aws_ssm_parameter.domain_name.value}"
+  // addresses, or whole domains, that SES hands to the forwarder. The routing document decides what happens after that.
+  inbound_recipients     = [local.support_email]
+  mail_routing_key       = "config/routing.json"
+  // what happens to mail failing SES's checks, see ParseVerdictPolicy in mail/verdict.go
+  mail_verdict_policy    = "virus=drop,spam=quarantine,dmarc=quarantine,spf=tag,dkim=tag"
+  // keep forwarded mail in the archive rather than deleting it once sent
+  archive_forwarded_mail = true
 }
 
 data "aws_iam_policy_document" "mail_bucket_policy" {
@@ -73,6 +80,73 @@ resource "aws_s3_bucket" "mail_bucket" {
   policy = data.aws_iam_policy_document.mail_bucket_policy.json
   acl    = "private"
 
+  // mail held back for failing spam or authentication checks, kept for a while in case something real got caught
+  lifecycle_rule {
+    id      = "expire-quarantined-mail"
+    enabled = true
+    prefix  = "quarantine/"
+
+    expiration {
+      days = 30
+    }
+  }
+
+  // copies of mail too large to forward, only needed for as long as the download links sent in their place last
+  lifecycle_rule {
+    id      = "expire-large-originals"
+    enabled = true
+    prefix  = "large/"
+
+    expiration {
+      days = 2
+    }
+  }
+
+  count = terraform.workspace == "default" ? 1 : 0
+}
+
+// only the starting point, edits made to the document in S3 are picked up by the forwarder within a minute and left alone
+// by terraform
+resource "aws_s3_bucket_object" "mail_routing" {
+  bucket       = aws_s3_bucket.mail_bucket[0].bucket
+  key          = local.mail_routing_key
+  content_type = "application/json"
+  content      = jsonencode({
+    rules   = []
+    default = {
+      action       = "forward"
+      destinations = [aws_ses_email_identity.support_email[0].email]
+    }
+  })
+
+  lifecycle {
+    ignore_changes = [content, etag]
+  }
+
+  count = terraform.workspace == "default" ? 1 : 0
+}
+
+// what became of each message the forwarder has seen, so SES retries don't send things twice
+resource "aws_dynamodb_table" "processed_mail" {
+  name         = "ProcessedMail"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key = "MessageID"
+
+  attribute {
+    name = "MessageID"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "Expires"
+    enabled        = true
+  }
+
+  tags = {
+    Workspace = terraform.workspace
+  }
+
   count = terraform.workspace == "default" ? 1 : 0
 }
 
@@ -137,6 +211,85 @@ data "aws_iam_policy_document" "support_forward_lambda_policy" {
     ]
   }
 
+  statement {
+    sid       = "AllowMailArchiveWrite"
+    effect    = "Allow"
+    actions   = [
+      "s3:PutObject"
+    ]
+    resources = [
+      "${aws_s3_bucket.mail_bucket[0].arn}/archive/*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowMailArchiveIndexWrite"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:PutItem"
+    ]
+    resources = [
+      aws_dynamodb_table.mail_archive.arn
+    ]
+  }
+
+  statement {
+    sid       = "AllowLargeMailWrite"
+    effect    = "Allow"
+    actions   = [
+      "s3:PutObject"
+    ]
+    resources = [
+      "${aws_s3_bucket.mail_bucket[0].arn}/large/*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowMailQuarantineWrite"
+    effect    = "Allow"
+    actions   = [
+      "s3:PutObject"
+    ]
+    resources = [
+      "${aws_s3_bucket.mail_bucket[0].arn}/quarantine/*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowMailDeadLetterWrite"
+    effect    = "Allow"
+    actions   = [
+      "s3:PutObject"
+    ]
+    resources = [
+      "${aws_s3_bucket.mail_bucket[0].arn}/dead-letter/*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowProcessedMailReadWrite"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:GetItem",
+      "dynamodb:PutItem"
+    ]
+    resources = [
+      aws_dynamodb_table.processed_mail[0].arn
+    ]
+  }
+
+  statement {
+    sid       = "AllowAuditLogAppend"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:PutItem",
+      "dynamodb:DescribeTable"
+    ]
+    resources = [
+      "arn:aws:dynamodb:*:*:table/${aws_dynamodb_table.audit_log.name}"
+    ]
+  }
+
   statement {
     sid       = "AllowSESSendRawEmail"
     effect    = "Allow"
@@ -176,6 +329,7 @@ resource "aws_lambda_function" "support_forward_lambda" {
   function_name    = "supportForwarder"
   role             = aws_iam_role.support_forward_lambda_role[0].arn
   runtime          = "go1.x"
+  timeout          = 30
 
   tracing_config {
     mode = "Active"
@@ -183,11 +337,18 @@ resource "aws_lambda_function" "support_forward_lambda" {
 
   environment {
     variables = {
-      MAIL_BUCKET     = aws_s3_bucket.mail_bucket[0].bucket
-      MAIL_FROM       = local.support_email
-      MAIL_TO         = aws_ses_email_identity.support_email[0].email
-      SUBJECT_TO_SEND = "An email has been sent to ${local.support_email}"
-      LOG_LEVEL       = "info"
+      MAIL_BUCKET        = aws_s3_bucket.mail_bucket[0].bucket
+      MAIL_FROM          = local.support_email
+      MAIL_TO            = aws_ses_email_identity.support_email[0].email
+      ROUTING_CONFIG_KEY = aws_s3_bucket_object.mail_routing[0].key
+      VERDICT_POLICY     = local.mail_verdict_policy
+      AUDIT_TABLE        = aws_dynamodb_table.audit_log.name
+      PROCESSED_TABLE    = aws_dynamodb_table.processed_mail[0].name
+      ARCHIVE_TABLE      = aws_dynamodb_table.mail_archive.name
+      ARCHIVE_FORWARDED  = local.archive_forwarded_mail
+      SUBJECT_TO_SEND    = "An email has been sent to ${local.support_email}"
+      ATTACH_ORIGINAL    = "true"
+      LOG_LEVEL          = "info"
     }
   }
 
@@ -219,7 +380,7 @@ resource "aws_ses_receipt_rule" "forward_support_email" {
 
   name          = "forward_support_email"
   rule_set_name = aws_ses_receipt_rule_set.sabadoscodes_rules[0].rule_set_name
-  recipients    = [local.support_email]
+  recipients    = local.inbound_recipients
   enabled       = true
   scan_enabled  = true
 
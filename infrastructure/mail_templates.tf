@@ -0,0 +1,112 @@
+// templates put in this bucket take precedence over the ones kept alongside the code in backend/src/go/mail/templates,
+// so wording can be changed without a deploy
+resource "aws_s3_bucket" "mail_templates_bucket" {
+  bucket = "${local.workspace_prefix}sabadoscodes.mail-templates.${data.aws_caller_identity.current.account_id}"
+  acl    = "private"
+
+  versioning {
+    enabled = true
+  }
+
+  tags = {
+    Workspace = terraform.workspace
+  }
+}
+
+resource "aws_api_gateway_resource" "mail_template" {
+  rest_api_id = aws_api_gateway_rest_api.api.id
+  parent_id   = aws_api_gateway_resource.mail.id
+  path_part   = "template"
+}
+
+resource "aws_api_gateway_resource" "mail_template_name" {
+  rest_api_id = aws_api_gateway_rest_api.api.id
+  parent_id   = aws_api_gateway_resource.mail_template.id
+  path_part   = "{name}"
+}
+
+data "aws_iam_policy_document" "mail_template_preview_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  // listing lets S3 answer 404 rather than 403 for templates that haven't been overridden
+  statement {
+    sid       = "AllowMailTemplateRead"
+    effect    = "Allow"
+    actions   = [
+      "s3:ListBucket",
+      "s3:GetObject"
+    ]
+    resources = [
+      aws_s3_bucket.mail_templates_bucket.arn,
+      "${aws_s3_bucket.mail_templates_bucket.arn}/*"
+    ]
+  }
+}
+
+module "mail_template_preview_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "mailTemplatePreview"
+  lambda_policy    = data.aws_iam_policy_document.mail_template_preview_policy.json
+  env_variables    = {
+    LOG_LEVEL       = "info"
+    ALLOWED_ORIGINS = "https://${aws_acm_certificate.ui_cert.domain_name},https://${aws_acm_certificate.ui_cert.subject_alternative_names[0]},http://localhost:8080"
+    TEMPLATE_BUCKET = aws_s3_bucket.mail_templates_bucket.bucket
+    ROUTE_TABLE     = local.route_table
+  }
+}
+
+resource "aws_api_gateway_method" "mail_template_preview" {
+  authorization = "CUSTOM"
+  authorizer_id = aws_api_gateway_authorizer.gateway_authorizer.id
+  http_method   = "GET"
+  resource_id   = aws_api_gateway_resource.mail_template_name.id
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+
+  request_parameters = {
+    "method.request.path.name"          = true
+    "method.request.querystring.locale" = false
+  }
+}
+
+resource "aws_api_gateway_integration" "mail_template_preview" {
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = aws_api_gateway_resource.mail_template_name.id
+  http_method             = aws_api_gateway_method.mail_template_preview.http_method
+  integration_http_method = "POST"
+  type                    = "AWS_PROXY"
+  uri                     = module.mail_template_preview_lambda.invoke_arn
+}
+
+resource "aws_lambda_permission" "mail_template_preview_allow_gateway_invoke" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = module.mail_template_preview_lambda.function_name
+  principal     = "apigateway.amazonaws.com"
+
+  source_arn = "arn:aws:execute-api:us-east-1:${data.aws_caller_identity.current.account_id}:${aws_api_gateway_rest_api.api.id}/*/GET/${aws_api_gateway_resource.mail.path_part}/${aws_api_gateway_resource.mail_template.path_part}/*"
+}
@@ -1,5 +1,7 @@
 locals {
   workspace_prefix = terraform.workspace == "default" ? "" : "${terraform.workspace}-"
+  // authorization rules for every API route, shared by the authorizer and handlers
+  route_table      = file("${path.module}/routes.json")
 }
 
 data "aws_caller_identity" "current" {}
@@ -16,6 +18,18 @@ data "aws_ssm_parameter" "root_user" {
   name = "sabadoscodes.root_user"
 }
 
+data "aws_ssm_parameter" "author_users" {
+  name = "sabadoscodes.author_users"
+}
+
+data "aws_ssm_parameter" "session_signing_key" {
+  name = "sabadoscodes.session_signing_key"
+}
+
+data "aws_ssm_parameter" "subscription_signing_key" {
+  name = "sabadoscodes.subscription_signing_key"
+}
+
 data "aws_route53_zone" "main_domain" {
   name = data.aws_ssm_parameter.domain_name.value
 }
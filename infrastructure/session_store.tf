@@ -0,0 +1,31 @@
+resource "aws_dynamodb_table" "session_store" {
+  name         = "${local.workspace_prefix}SessionStore"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key = "SessionID"
+
+  attribute {
+    name = "SessionID"
+    type = "S"
+  }
+
+  attribute {
+    name = "UserID"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "UserID"
+    hash_key        = "UserID"
+    projection_type = "KEYS_ONLY"
+  }
+
+  ttl {
+    attribute_name = "Expires"
+    enabled        = true
+  }
+
+  tags = {
+    Workspace = terraform.workspace
+  }
+}
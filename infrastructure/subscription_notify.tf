@@ -0,0 +1,201 @@
+// article/save queues the slug of an article when it is first published, the notify lambda picks it up and mails
+// subscribers about it
+resource "aws_sqs_queue" "article_published_dead_letter" {
+  name                      = "${local.workspace_prefix}ArticlePublishedDeadLetter"
+  message_retention_seconds = 1209600
+
+  tags = {
+    Workspace = terraform.workspace
+  }
+}
+
+resource "aws_sqs_queue" "article_published" {
+  name                      = "${local.workspace_prefix}ArticlePublished"
+  message_retention_seconds = 345600
+  // aws recommends six times the timeout of the lambda consuming the queue
+  visibility_timeout_seconds = 5400
+  // article/save queues the event before saving, this gives the save time to land before anything looks for it
+  delay_seconds = 60
+
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.article_published_dead_letter.arn
+    maxReceiveCount     = 5
+  })
+
+  tags = {
+    Workspace = terraform.workspace
+  }
+}
+
+// which subscribers have been mailed about which articles, so retried batches don't mail anyone twice
+resource "aws_dynamodb_table" "notification_deliveries" {
+  name         = "${local.workspace_prefix}NotificationDeliveries"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key  = "Slug"
+  range_key = "Email"
+
+  attribute {
+    name = "Slug"
+    type = "S"
+  }
+
+  attribute {
+    name = "Email"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "Expires"
+    enabled        = true
+  }
+
+  tags = {
+    Workspace = terraform.workspace
+  }
+}
+
+locals {
+  // messages per second, SES's default for accounts that haven't asked for more
+  subscription_notify_send_rate = 14
+  // articles published within this long of each other go out as a single digest
+  subscription_notify_batch_window = 300
+}
+
+data "aws_iam_policy_document" "subscription_notify_policy" {
+  statement {
+    sid       = "AllowLogging"
+    effect    = "Allow"
+    actions   = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents"
+    ]
+    resources = [
+      "arn:aws:logs:*:*:*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowXRayWrite"
+    effect    = "Allow"
+    actions   = [
+      "xray:PutTraceSegments",
+      "xray:PutTelemetryRecords",
+      "xray:GetSamplingRules",
+      "xray:GetSamplingTargets",
+      "xray:GetSamplingStatisticSummaries"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowPublishedQueueConsume"
+    effect    = "Allow"
+    actions   = [
+      "sqs:ReceiveMessage",
+      "sqs:DeleteMessage",
+      "sqs:GetQueueAttributes"
+    ]
+    resources = [aws_sqs_queue.article_published.arn]
+  }
+
+  statement {
+    sid       = "AllowArticleStoreRead"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:GetItem"
+    ]
+    resources = [
+      aws_dynamodb_table.article_store.arn
+    ]
+  }
+
+  statement {
+    sid       = "AllowSubscriberScan"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:Scan"
+    ]
+    resources = [
+      aws_dynamodb_table.subscribers.arn
+    ]
+  }
+
+  statement {
+    sid       = "AllowDeliveryReadWrite"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:GetItem",
+      "dynamodb:PutItem"
+    ]
+    resources = [
+      aws_dynamodb_table.notification_deliveries.arn
+    ]
+  }
+
+  statement {
+    sid       = "AllowMailTemplateRead"
+    effect    = "Allow"
+    actions   = [
+      "s3:ListBucket",
+      "s3:GetObject"
+    ]
+    resources = [
+      aws_s3_bucket.mail_templates_bucket.arn,
+      "${aws_s3_bucket.mail_templates_bucket.arn}/*"
+    ]
+  }
+
+  statement {
+    sid       = "AllowSendingNotifications"
+    effect    = "Allow"
+    actions   = [
+      "ses:SendRawEmail"
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid       = "AllowSuppressionCheck"
+    effect    = "Allow"
+    actions   = [
+      "dynamodb:GetItem"
+    ]
+    resources = [
+      aws_dynamodb_table.mail_suppression.arn
+    ]
+  }
+}
+
+module "subscription_notify_lambda" {
+  source           = "./lambda"
+  workspace_prefix = local.workspace_prefix
+  lambda_name      = "subscriptionNotify"
+  lambda_policy    = data.aws_iam_policy_document.subscription_notify_policy.json
+  timeout          = 900
+  // one copy at a time, so concurrent batches don't add up to more than the send rate
+  reserved_concurrent_executions = 1
+
+  env_variables = {
+    LOG_LEVEL                = "info"
+    ARTICLE_TABLE            = aws_dynamodb_table.article_store.name
+    SUBSCRIBER_TABLE         = aws_dynamodb_table.subscribers.name
+    DELIVERY_TABLE           = aws_dynamodb_table.notification_deliveries.name
+    SEND_RATE                = local.subscription_notify_send_rate
+    TEMPLATE_BUCKET          = aws_s3_bucket.mail_templates_bucket.bucket
+    SUBSCRIPTION_SIGNING_KEY = data.aws_ssm_parameter.subscription_signing_key.value
+    BASE_ARTICLE_URL         = "${local.subscription_site_url}/articles/article"
+    API_URL                  = local.subscription_api_url
+    SITE_URL                 = local.subscription_site_url
+    MAIL_FROM                = local.support_email
+    SUPPRESSION_TABLE        = aws_dynamodb_table.mail_suppression.name
+  }
+}
+
+resource "aws_lambda_event_source_mapping" "subscription_notify_article_published" {
+  event_source_arn                   = aws_sqs_queue.article_published.arn
+  function_name                      = module.subscription_notify_lambda.arn
+  batch_size                         = 10
+  maximum_batching_window_in_seconds = local.subscription_notify_batch_window
+}
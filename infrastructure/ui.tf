@@ -15,6 +15,40 @@ resource "aws_s3_bucket" "article_assets_bucket" {
   bucket = "${local.workspace_prefix}${data.aws_ssm_parameter.ui_bucket_name.value}-article-assets"
   acl    = "public-read"
 
+  // direct uploads come straight from the browser via presigned urls
+  cors_rule {
+    allowed_methods = ["PUT"]
+    allowed_origins = [
+      "https://${local.workspace_domain_prefix}${data.aws_ssm_parameter.domain_name.value}",
+      "https://${terraform.workspace == "default" ? "www." : "www-"}${local.workspace_domain_prefix}${data.aws_ssm_parameter.domain_name.value}",
+      "http://localhost:8080"
+    ]
+    allowed_headers = ["*"]
+    max_age_seconds = 3000
+  }
+
+  // uploads that were never completed
+  lifecycle_rule {
+    id      = "expire-pending-uploads"
+    enabled = true
+    prefix  = "pending-uploads/"
+
+    expiration {
+      days = 1
+    }
+  }
+
+  // uploads that failed scanning, kept around for a while in case anyone wants to look at them
+  lifecycle_rule {
+    id      = "expire-quarantined-uploads"
+    enabled = true
+    prefix  = "quarantine/"
+
+    expiration {
+      days = 30
+    }
+  }
+
   tags = {
     Workspace = terraform.workspace
   }